@@ -0,0 +1,569 @@
+// Package client is a client of the HTTP API of genwallet servers. It speaks
+// in the request/response types of package wallet and returns the errors of
+// the server as `*errorrrs.E`, as the service itself would return them:
+//
+//	var e *errorrrs.E
+//	if errors.As(err, &e) && e.Code == errorrrs.CodeInsufficientFunds {
+//
+// Requests failing for transient reasons are retried (see `Retries`), and
+// listings can be iterated over page by page (see `Iterator`). Requests carry
+// the trace context of theirs as a W3C `traceparent` header, if any.
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// Client calls the API of the server at its base URL
+type Client struct {
+	base    *url.URL
+	apiKey  string
+	http    *http.Client
+	retries Retries
+}
+
+var _ wallet.Service = (*Client)(nil)
+
+type Option func(*Client)
+
+// WithAPIKey authenticates requests with API key `key`
+// (see `wallet.AuthMiddleware`)
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithHTTPClient sends requests with `hc` rather than `http.DefaultClient`
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithRetries retries requests as `r` rather than as `DefaultRetries`;
+// `Retries{}` disables retries
+func WithRetries(r Retries) Option {
+	return func(c *Client) {
+		c.retries = r
+	}
+}
+
+// New makes a client of the server at `baseURL`, e.g. `http://localhost:8000`
+func New(baseURL string, options ...Option) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, errors.New("client: base URL must be an http(s) URL")
+	}
+	c := &Client{
+		base:    base,
+		http:    http.DefaultClient,
+		retries: DefaultRetries,
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// request is an API request; `body`, if not nil, is sent as JSON
+type request struct {
+	method, path string
+	query        url.Values
+	accept       string
+	body         interface{}
+	// idempotencyKey, if any, is sent as `wallet.IdempotencyKeyHeader`
+	idempotencyKey string
+	// replayable tells whether the request can be sent again when it is
+	// unknown if it had any effect, e.g. as its response was lost. Nil is
+	// never; reads always are, and writes are as long as they are idempotent.
+	replayable func() bool
+	// attempts is the number of times the request was sent
+	attempts int
+}
+
+func always() bool { return true }
+
+// do sends `r`, decoding the response with `dec` if successful,
+// and retries it as long as it fails for transient reasons
+func (c *Client) do(ctx context.Context, r *request, dec httptransport.DecodeResponseFunc) error {
+	for {
+		status, retryAfter, err := c.send(ctx, r, dec)
+		if err == nil || r.attempts > c.retries.Max || ctx.Err() != nil || !retryable(r, status, err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(c.retries.backoff(r.attempts, retryAfter)):
+		}
+	}
+}
+
+// send sends `r` once, returning the status and `Retry-After`
+// of its response, if any
+func (c *Client) send(ctx context.Context, r *request, dec httptransport.DecodeResponseFunc) (int, time.Duration, error) {
+	var (
+		status     int
+		retryAfter time.Duration
+	)
+	enc := func(ctx context.Context, req *http.Request, body interface{}) error {
+		req.URL.Path = strings.TrimSuffix(c.base.Path, "/") + r.path
+		req.URL.RawQuery = r.query.Encode()
+		accept := r.accept
+		if accept == "" {
+			accept = "application/json"
+		}
+		req.Header.Set("Accept", accept)
+		if c.apiKey != "" {
+			req.Header.Set(wallet.AuthorizationHeader, "Bearer "+c.apiKey)
+		}
+		if r.idempotencyKey != "" {
+			req.Header.Set(wallet.IdempotencyKeyHeader, r.idempotencyKey)
+		}
+		// the server continues the trace of the caller, if any
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		if body == nil {
+			return nil
+		}
+		return httptransport.EncodeJSONRequest(ctx, req, body)
+	}
+	decode := func(ctx context.Context, resp *http.Response) (interface{}, error) {
+		status = resp.StatusCode
+		retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		return dec(ctx, resp)
+	}
+	r.attempts++
+	ep := httptransport.NewClient(r.method, c.base, enc, decode, httptransport.SetClient(c.http)).Endpoint()
+	_, err := ep(ctx, r.body)
+
+	return status, retryAfter, err
+}
+
+// errorOf returns the error of unsuccessful responses
+func errorOf(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	bits, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var prob errorrrs.Problem
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), errorrrs.ProblemMediaType) &&
+		json.Unmarshal(bits, &prob) == nil {
+		return errorrrs.FromProblem(prob)
+	}
+
+	// e.g. of proxies in front of the server
+	return errorrrs.FromProblem(errorrrs.Problem{
+		Status: resp.StatusCode,
+		Detail: strings.TrimSpace(resp.Status + ": " + string(bits)),
+	})
+}
+
+// codeOf is the code of API error `err`, if it is one
+func codeOf(err error) errorrrs.Code {
+	var e *errorrrs.E
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// decodeJSON decodes successful responses into `v`
+func decodeJSON(v interface{}) httptransport.DecodeResponseFunc {
+	return func(_ context.Context, resp *http.Response) (interface{}, error) {
+		if err := errorOf(resp); err != nil {
+			return nil, err
+		}
+		return nil, json.NewDecoder(resp.Body).Decode(v)
+	}
+}
+
+// decodeNDJSON calls `row` for each line of successful NDJSON responses
+// as it is read, stopping at the first error
+func decodeNDJSON(row func(*json.Decoder) error) httptransport.DecodeResponseFunc {
+	return func(_ context.Context, resp *http.Response) (interface{}, error) {
+		if err := errorOf(resp); err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(resp.Body)
+		for dec.More() {
+			if err := row(dec); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+}
+
+// newIdempotencyKey makes a random idempotency key for writes without one
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func walletPath(id string, sub ...string) string {
+	return strings.Join(append([]string{"/wallets", url.PathEscape(id)}, sub...), "/")
+}
+
+func currencyQuery(cur *string) url.Values {
+	q := url.Values{}
+	if cur != nil {
+		q.Set("currency", *cur)
+	}
+	return q
+}
+
+func setMetadata(q url.Values, m wallet.Metadata) {
+	for k, v := range m {
+		q.Set(wallet.MetadataParamPrefix+k, v)
+	}
+}
+
+func setPage(q url.Values, afterID *int, limit int) {
+	if afterID != nil {
+		q.Set("after_id", strconv.Itoa(*afterID))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+}
+
+func accountsQuery(req wallet.ListAccountsRequest) url.Values {
+	q := currencyQuery(req.Currency)
+	if req.After != nil {
+		q.Set("after", *req.After)
+	}
+	setPage(q, nil, req.Limit)
+	return q
+}
+
+func paymentsQuery(req wallet.ListPaymentsRequest) url.Values {
+	q := url.Values{}
+	if req.Reference != nil {
+		q.Set("reference", *req.Reference)
+	}
+	setMetadata(q, req.Metadata)
+	setPage(q, req.AfterID, req.Limit)
+	return q
+}
+
+func transfersQuery(req wallet.ListTransfersRequest) url.Values {
+	q := currencyQuery(req.Currency)
+	if req.From != nil {
+		q.Set("from", *req.From)
+	}
+	if req.To != nil {
+		q.Set("to", *req.To)
+	}
+	if req.Reference != nil {
+		q.Set("reference", *req.Reference)
+	}
+	setMetadata(q, req.Metadata)
+	setPage(q, req.AfterID, req.Limit)
+	return q
+}
+
+func (c *Client) ListAccounts(ctx context.Context, req wallet.ListAccountsRequest) ([]wallet.Account, error) {
+	var accts []wallet.Account
+	r := request{method: "GET", path: "/wallets", query: accountsQuery(req), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&accts))
+	return accts, err
+}
+
+// StreamAccounts is only retried until the first account is streamed
+func (c *Client) StreamAccounts(ctx context.Context, req wallet.ListAccountsRequest, fn func(wallet.Account) error) error {
+	streamed := false
+	r := request{
+		method:     "GET",
+		path:       "/wallets",
+		query:      accountsQuery(req),
+		accept:     wallet.MediaTypeNDJSON,
+		replayable: func() bool { return !streamed },
+	}
+	return c.do(ctx, &r, decodeNDJSON(func(dec *json.Decoder) error {
+		var acct wallet.Account
+		if err := dec.Decode(&acct); err != nil {
+			return err
+		}
+		streamed = true
+		return fn(acct)
+	}))
+}
+
+func (c *Client) GetAccount(ctx context.Context, req wallet.GetAccountRequest) (wallet.Account, error) {
+	var acct wallet.Account
+	r := request{method: "GET", path: walletPath(req.ID), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&acct))
+	return acct, err
+}
+
+// CreateAccount is idempotent by account ID: retries that find the account
+// created by an earlier attempt return it rather than `account_exists`
+func (c *Client) CreateAccount(ctx context.Context, req wallet.CreateAccountRequest) (wallet.Account, error) {
+	var acct wallet.Account
+	r := request{method: "POST", path: "/wallets", body: req, replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&acct))
+	if r.attempts > 1 && codeOf(err) == errorrrs.CodeAccountExists {
+		existing, getErr := c.GetAccount(ctx, wallet.GetAccountRequest{ID: req.ID})
+		if getErr == nil && strings.EqualFold(existing.Currency, strings.TrimSpace(req.Currency)) {
+			return existing, nil
+		}
+	}
+
+	return acct, err
+}
+
+func (c *Client) ListPayments(ctx context.Context, req wallet.ListPaymentsRequest) ([]wallet.Payment, error) {
+	var payments []wallet.Payment
+	r := request{method: "GET", path: walletPath(req.ID, "payments"), query: paymentsQuery(req), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&payments))
+	return payments, err
+}
+
+// StreamPayments is only retried until the first payment is streamed
+func (c *Client) StreamPayments(ctx context.Context, req wallet.ListPaymentsRequest, fn func(wallet.Payment) error) error {
+	streamed := false
+	r := request{
+		method:     "GET",
+		path:       walletPath(req.ID, "payments"),
+		query:      paymentsQuery(req),
+		accept:     wallet.MediaTypeNDJSON,
+		replayable: func() bool { return !streamed },
+	}
+	return c.do(ctx, &r, decodeNDJSON(func(dec *json.Decoder) error {
+		var p wallet.Payment
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		streamed = true
+		return fn(p)
+	}))
+}
+
+// CreatePayment is idempotent by idempotency key: the server returns the
+// payment of a retry that went through already rather than make another.
+// Payments without `IdempotencyKey` are given a random one when retries are
+// enabled; pass your own (e.g. derived from an order ID) for retries across
+// processes to be safe too.
+func (c *Client) CreatePayment(ctx context.Context, req wallet.CreatePaymentRequest) (wallet.Payment, error) {
+	if req.IdempotencyKey == "" && c.retries.Max > 0 {
+		req.IdempotencyKey = newIdempotencyKey()
+	}
+	var p wallet.Payment
+	r := request{method: "POST", path: walletPath(req.Self, "payments"), body: req, idempotencyKey: req.IdempotencyKey}
+	if req.IdempotencyKey != "" {
+		r.replayable = always
+	}
+	err := c.do(ctx, &r, decodeJSON(&p))
+	return p, err
+}
+
+func (c *Client) ListTransfers(ctx context.Context, req wallet.ListTransfersRequest) ([]wallet.Transfer, error) {
+	var trnsfrs []wallet.Transfer
+	r := request{method: "GET", path: "/transfers", query: transfersQuery(req), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&trnsfrs))
+	return trnsfrs, err
+}
+
+// StreamTransfers is only retried until the first transfer is streamed
+func (c *Client) StreamTransfers(ctx context.Context, req wallet.ListTransfersRequest, fn func(wallet.Transfer) error) error {
+	streamed := false
+	r := request{
+		method:     "GET",
+		path:       "/transfers",
+		query:      transfersQuery(req),
+		accept:     wallet.MediaTypeNDJSON,
+		replayable: func() bool { return !streamed },
+	}
+	return c.do(ctx, &r, decodeNDJSON(func(dec *json.Decoder) error {
+		var t wallet.Transfer
+		if err := dec.Decode(&t); err != nil {
+			return err
+		}
+		streamed = true
+		return fn(t)
+	}))
+}
+
+// GetStatement reads the statement back from its camt.053 document (see
+// `wallet.ParseCamt053`), so its account only has an ID and currency
+func (c *Client) GetStatement(ctx context.Context, req wallet.StatementRequest) (wallet.Statement, error) {
+	q := url.Values{}
+	if !req.From.IsZero() {
+		q.Set("from", req.From.Format(time.RFC3339Nano))
+	}
+	if !req.To.IsZero() {
+		q.Set("to", req.To.Format(time.RFC3339Nano))
+	}
+	var stmt wallet.Statement
+	r := request{
+		method:     "GET",
+		path:       walletPath(req.ID, "statement.xml"),
+		query:      q,
+		accept:     "application/xml",
+		replayable: always,
+	}
+	err := c.do(ctx, &r, func(_ context.Context, resp *http.Response) (interface{}, error) {
+		if err := errorOf(resp); err != nil {
+			return nil, err
+		}
+		var err error
+		stmt, err = wallet.ParseCamt053(resp.Body)
+		return nil, err
+	})
+	if err != nil {
+		return stmt, err
+	}
+	// rather than that of the document, which long IDs are shortened in
+	stmt.Account.ID = req.ID
+
+	return stmt, nil
+}
+
+// GetLedgerProof gets the proof of a transfer as served; check it with
+// `LedgerProof.Verify` against the public key of the checkpoint signer
+func (c *Client) GetLedgerProof(ctx context.Context, req wallet.LedgerProofRequest) (wallet.LedgerProof, error) {
+	var proof wallet.LedgerProof
+	q := url.Values{"transfer_id": {strconv.Itoa(req.TransferID)}}
+	r := request{method: "GET", path: "/ledger/proof", query: q, replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&proof))
+	return proof, err
+}
+
+// RequestAdjustment is idempotent by idempotency key, as `CreatePayment` is
+func (c *Client) RequestAdjustment(ctx context.Context, req wallet.AdjustmentRequest) (wallet.Adjustment, error) {
+	if req.IdempotencyKey == "" && c.retries.Max > 0 {
+		req.IdempotencyKey = newIdempotencyKey()
+	}
+	var adj wallet.Adjustment
+	r := request{method: "POST", path: "/adjustments", body: req, idempotencyKey: req.IdempotencyKey}
+	if req.IdempotencyKey != "" {
+		r.replayable = always
+	}
+	err := c.do(ctx, &r, decodeJSON(&adj))
+	return adj, err
+}
+
+func adjustmentsQuery(req wallet.ListAdjustmentsRequest) url.Values {
+	q := url.Values{}
+	if req.AccountID != nil {
+		q.Set("account_id", *req.AccountID)
+	}
+	if req.Status != nil {
+		q.Set("status", string(*req.Status))
+	}
+	if req.Reference != nil {
+		q.Set("reference", *req.Reference)
+	}
+	setPage(q, req.AfterID, req.Limit)
+	return q
+}
+
+func (c *Client) ListAdjustments(ctx context.Context, req wallet.ListAdjustmentsRequest) ([]wallet.Adjustment, error) {
+	var adjs []wallet.Adjustment
+	r := request{method: "GET", path: "/adjustments", query: adjustmentsQuery(req), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&adjs))
+	return adjs, err
+}
+
+func adjustmentPath(id int, sub ...string) string {
+	return strings.Join(append([]string{"/adjustments", strconv.Itoa(id)}, sub...), "/")
+}
+
+func (c *Client) GetAdjustment(ctx context.Context, req wallet.GetAdjustmentRequest) (wallet.Adjustment, error) {
+	var adj wallet.Adjustment
+	r := request{method: "GET", path: adjustmentPath(req.ID), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&adj))
+	return adj, err
+}
+
+// DecideAdjustment is retried since a decision goes through only once;
+// a retried one that turns out to have gone through the first time
+// returns the adjustment as decided rather than a conflict
+func (c *Client) DecideAdjustment(ctx context.Context, req wallet.DecideAdjustmentRequest) (wallet.Adjustment, error) {
+	action, status := "reject", wallet.AdjustmentRejected
+	if req.Approve {
+		action, status = "approve", wallet.AdjustmentApproved
+	}
+	body := struct {
+		Note string `json:"note,omitempty"`
+	}{req.Note}
+	var adj wallet.Adjustment
+	r := request{method: "POST", path: adjustmentPath(req.ID, action), body: body, replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&adj))
+	if r.attempts > 1 && codeOf(err) == errorrrs.CodeAdjustmentDecided {
+		decided, getErr := c.GetAdjustment(ctx, wallet.GetAdjustmentRequest{ID: req.ID})
+		if getErr == nil && decided.Status == status && decided.Note == req.Note {
+			return decided, nil
+		}
+	}
+
+	return adj, err
+}
+
+func (c *Client) FreezeAccount(ctx context.Context, req wallet.FreezeAccountRequest) (wallet.Account, error) {
+	action := "freeze"
+	if !req.Frozen {
+		action = "unfreeze"
+	}
+	var acct wallet.Account
+	r := request{method: "POST", path: walletPath(req.ID, action), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&acct))
+	return acct, err
+}
+
+func (c *Client) Reconcile(ctx context.Context, req wallet.ReconcileRequest) ([]wallet.Reconciliation, error) {
+	var recs []wallet.Reconciliation
+	r := request{method: "GET", path: "/reconciliation", query: currencyQuery(req.Currency), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&recs))
+	return recs, err
+}
+
+func auditQuery(req wallet.ListAuditRequest) url.Values {
+	q := url.Values{}
+	if req.Actor != nil {
+		q.Set("actor", *req.Actor)
+	}
+	if req.Target != nil {
+		q.Set("target", *req.Target)
+	}
+	if !req.From.IsZero() {
+		q.Set("from", req.From.Format(time.RFC3339Nano))
+	}
+	if !req.To.IsZero() {
+		q.Set("to", req.To.Format(time.RFC3339Nano))
+	}
+	setPage(q, req.AfterID, req.Limit)
+	return q
+}
+
+func (c *Client) ListAudit(ctx context.Context, req wallet.ListAuditRequest) ([]wallet.AuditEntry, error) {
+	var entries []wallet.AuditEntry
+	r := request{method: "GET", path: "/audit", query: auditQuery(req), replayable: always}
+	err := c.do(ctx, &r, decodeJSON(&entries))
+	return entries, err
+}
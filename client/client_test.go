@@ -0,0 +1,540 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/client"
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// newServer serves the whole stack over a memory repository, with tenant
+// "acme" and two admin API keys of it, the second one to check (approve)
+// what the first one makes. Transfers are chained as the server would.
+func newServer(t *testing.T) (*httptest.Server, wallet.APIKey, wallet.APIKey) {
+	return newFlakyServer(t, nil)
+}
+
+// newFlakyServer is `newServer` whose requests go through `flaky`, if not nil
+func newFlakyServer(t *testing.T, flaky func(http.Handler) http.Handler) (*httptest.Server, wallet.APIKey, wallet.APIKey) {
+	repo := wallet.NewMemRepo()
+	ctx := context.Background()
+	_, err := repo.CreateTenant(ctx, wallet.Tenant{ID: "acme", Name: "Acme"})
+	require.Nil(t, err)
+	key, err := repo.CreateAPIKey(ctx, wallet.APIKey{TenantID: "acme", Admin: true})
+	require.Nil(t, err)
+	checker, err := repo.CreateAPIKey(ctx, wallet.APIKey{TenantID: "acme", Admin: true})
+	require.Nil(t, err)
+
+	var handler http.Handler = wallet.MakeHTTPHandler(&wallet.AuthMiddleware{
+		Next: &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		},
+		Keys:     repo,
+		Required: true,
+	})
+	if flaky != nil {
+		handler = flaky(handler)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				repo.ChainLedger(ctx)
+			}
+		}
+	}()
+
+	return srv, key, checker
+}
+
+func TestClient(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	srv, key, checker := newServer(t)
+	c, err := client.New(srv.URL, client.WithAPIKey(key.Key), client.WithHTTPClient(srv.Client()))
+	reqrd.Nil(err)
+	ctx := context.Background()
+
+	for _, req := range []wallet.CreateAccountRequest{
+		{ID: "alice-123", Currency: "USD", InitAmt: 100},
+		{ID: "bob-456", Currency: "USD", InitAmt: 50},
+		{ID: "chen-789", Currency: "CNY"},
+	} {
+		acct, err := c.CreateAccount(ctx, req)
+		reqrd.Nil(err)
+		as.Equal(req.ID, acct.ID)
+		as.Equal(req.InitAmt, acct.Balance)
+	}
+
+	payment, err := c.CreatePayment(ctx, wallet.CreatePaymentRequest{
+		Self:      "alice-123",
+		To:        "bob-456",
+		Amount:    10,
+		Reference: "inv-1",
+	})
+	reqrd.Nil(err)
+	as.Equal(10.0, payment.Amount)
+
+	acct, err := c.GetAccount(ctx, wallet.GetAccountRequest{ID: "bob-456"})
+	reqrd.Nil(err)
+	as.Equal(60.0, acct.Balance)
+
+	usd := "USD"
+	accts, err := c.ListAccounts(ctx, wallet.ListAccountsRequest{Currency: &usd})
+	reqrd.Nil(err)
+	as.Len(accts, 2)
+	streamed := []wallet.Account{}
+	err = c.StreamAccounts(ctx, wallet.ListAccountsRequest{}, func(a wallet.Account) error {
+		streamed = append(streamed, a)
+		return nil
+	})
+	reqrd.Nil(err)
+	as.Len(streamed, 3)
+
+	payments, err := c.ListPayments(ctx, wallet.ListPaymentsRequest{ID: "alice-123"})
+	reqrd.Nil(err)
+	as.Len(payments, 1)
+	as.Equal("inv-1", payments[0].Reference)
+
+	adj, err := c.RequestAdjustment(ctx, wallet.AdjustmentRequest{
+		AccountID:   "bob-456",
+		Amount:      -5,
+		Reason:      "correction",
+		Attachments: []string{"https://tickets.example.com/42"},
+	})
+	reqrd.Nil(err)
+	as.Equal(wallet.AdjustmentPending, adj.Status)
+	as.Empty(adj.Reference, "idempotency keys are not references")
+	_, err = c.DecideAdjustment(ctx, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true})
+	as.Equal(errorrrs.CodeSelfApproval, codeOf(err))
+	checking, err := client.New(srv.URL, client.WithAPIKey(checker.Key), client.WithHTTPClient(srv.Client()))
+	reqrd.Nil(err)
+	adj, err = checking.DecideAdjustment(ctx, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true, Note: "checked"})
+	reqrd.Nil(err)
+	as.Equal(wallet.AdjustmentApproved, adj.Status)
+	as.Equal("apikey:"+checker.ID, adj.DecidedBy)
+	reqrd.NotNil(adj.TransferID)
+	adjs, err := c.ListAdjustments(ctx, wallet.ListAdjustmentsRequest{AccountID: &adj.AccountID})
+	reqrd.Nil(err)
+	as.Equal([]wallet.Adjustment{adj}, adjs)
+	got, err := c.GetAdjustment(ctx, wallet.GetAdjustmentRequest{ID: adj.ID})
+	reqrd.Nil(err)
+	as.Equal(adj, got)
+
+	trnsfrs, err := c.ListTransfers(ctx, wallet.ListTransfersRequest{})
+	reqrd.Nil(err)
+	as.Len(trnsfrs, 2)
+	after := trnsfrs[0].ID
+	trnsfrs, err = c.ListTransfers(ctx, wallet.ListTransfersRequest{AfterID: &after})
+	reqrd.Nil(err)
+	reqrd.Len(trnsfrs, 1)
+	as.Equal(*adj.TransferID, trnsfrs[0].ID)
+	count := 0
+	err = c.StreamTransfers(ctx, wallet.ListTransfersRequest{}, func(wallet.Transfer) error {
+		count++
+		return nil
+	})
+	reqrd.Nil(err)
+	as.Equal(2, count)
+
+	// transfers are proven once chained, shortly after they are booked
+	var proof wallet.LedgerProof
+	reqrd.Eventually(func() bool {
+		proof, err = c.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: *adj.TransferID})
+		return codeOf(err) != errorrrs.CodeTransferPending
+	}, time.Second, 5*time.Millisecond)
+	reqrd.Nil(err)
+	as.Equal(*adj.TransferID, proof.Transfer.ID)
+	as.NotEmpty(proof.Transfer.PrevHash, "chained onto the payment")
+	as.True(errors.Is(proof.Verify(nil), wallet.ErrNotCheckpointed), "hashes check out but nothing is checkpointed")
+
+	acct, err = c.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: "alice-123", Frozen: true})
+	reqrd.Nil(err)
+	as.True(acct.Frozen)
+	acct, err = c.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: "alice-123"})
+	reqrd.Nil(err)
+	as.False(acct.Frozen)
+
+	recs, err := c.Reconcile(ctx, wallet.ReconcileRequest{})
+	reqrd.Nil(err)
+	as.Len(recs, 4)
+	for _, rec := range recs {
+		as.True(rec.Balanced, rec.ID)
+	}
+
+	alice := "alice-123"
+	entries, err := c.ListAudit(ctx, wallet.ListAuditRequest{Target: &alice, From: time.Now().Add(-time.Minute)})
+	reqrd.Nil(err)
+	actions := make([]string, len(entries))
+	for i, e := range entries {
+		actions[i] = e.Action
+		as.Equal("apikey:"+key.ID, e.Actor)
+	}
+	as.Equal([]string{
+		wallet.AuditCreateAccount,
+		wallet.AuditCreatePayment,
+		wallet.AuditFreezeAccount,
+		wallet.AuditUnfreezeAccount,
+	}, actions)
+}
+
+func TestClientErrors(t *testing.T) {
+	srv, key, _ := newServer(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		apiKey string
+		call   func(*client.Client) error
+		id     errorrrs.ID
+		code   errorrrs.Code
+		fields bool
+	}{
+		{
+			name: "unauthenticated",
+			call: func(c *client.Client) error {
+				_, err := c.ListAccounts(ctx, wallet.ListAccountsRequest{})
+				return err
+			},
+			id:   errorrrs.Unauthorized,
+			code: errorrrs.CodeUnauthenticated,
+		},
+		{
+			name:   "not found",
+			apiKey: key.Key,
+			call: func(c *client.Client) error {
+				_, err := c.GetAccount(ctx, wallet.GetAccountRequest{ID: "nobody-0"})
+				return err
+			},
+			id:   errorrrs.NotFound,
+			code: errorrrs.CodeAccountNotFound,
+		},
+		{
+			name:   "validation",
+			apiKey: key.Key,
+			call: func(c *client.Client) error {
+				_, err := c.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "x", Currency: "XXX"})
+				return err
+			},
+			id:     errorrrs.BadRequest,
+			code:   errorrrs.CodeValidationFailed,
+			fields: true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(tt *testing.T) {
+			as := assert.New(tt)
+			cl, err := client.New(srv.URL, client.WithAPIKey(c.apiKey))
+			require.Nil(tt, err)
+
+			err = c.call(cl)
+			var e *errorrrs.E
+			require.True(tt, errors.As(err, &e), "%T: %v", err, err)
+			as.Equal(c.id, e.ID)
+			as.Equal(c.code, e.Code)
+			as.Equal(c.fields, len(e.Fields) > 0)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := client.New("localhost:8000")
+	assert.NotNil(t, err)
+	_, err = client.New("http://localhost:8000/api")
+	assert.Nil(t, err)
+}
+
+// fastRetries retry without waiting for long
+var fastRetries = client.WithRetries(client.Retries{Max: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+// failFirst fails the first `n` requests matching `match` with `status`,
+// after serving them if `served`, i.e. as if their responses were lost
+func failFirst(n int32, status int, served bool, match func(*http.Request) bool) func(http.Handler) http.Handler {
+	var failed int32
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !match(req) || atomic.AddInt32(&failed, 1) > n {
+				next.ServeHTTP(w, req)
+				return
+			}
+			if served {
+				next.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+		})
+	}
+}
+
+func isPost(req *http.Request) bool { return req.Method == "POST" }
+
+func TestClientRetries(t *testing.T) {
+	ctx := context.Background()
+	seed := func(t *testing.T, c *client.Client) {
+		for _, req := range []wallet.CreateAccountRequest{
+			{ID: "alice-123", Currency: "USD", InitAmt: 100},
+			{ID: "bob-456", Currency: "USD"},
+		} {
+			_, err := c.CreateAccount(ctx, req)
+			require.Nil(t, err)
+		}
+	}
+
+	t.Run("lost responses", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		srv, key, _ := newFlakyServer(tt, failFirst(1, http.StatusBadGateway, true, func(req *http.Request) bool {
+			return isPost(req) && req.URL.Path != "/wallets"
+		}))
+		c, err := client.New(srv.URL, client.WithAPIKey(key.Key), fastRetries)
+		reqrd.Nil(err)
+		seed(tt, c)
+
+		// the payment went through on the first attempt only
+		p, err := c.CreatePayment(ctx, wallet.CreatePaymentRequest{Self: "alice-123", To: "bob-456", Amount: 10})
+		reqrd.Nil(err)
+		as.Equal(10.0, p.Amount)
+		as.Empty(p.Reference, "idempotency keys are not references")
+		acct, err := c.GetAccount(ctx, wallet.GetAccountRequest{ID: "alice-123"})
+		reqrd.Nil(err)
+		as.Equal(90.0, acct.Balance)
+		payments, err := c.ListPayments(ctx, wallet.ListPaymentsRequest{ID: "alice-123"})
+		reqrd.Nil(err)
+		as.Len(payments, 1)
+	})
+
+	t.Run("lost adjustment request", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		srv, key, _ := newFlakyServer(tt, failFirst(1, http.StatusBadGateway, true, func(req *http.Request) bool {
+			return isPost(req) && req.URL.Path == "/adjustments"
+		}))
+		c, err := client.New(srv.URL, client.WithAPIKey(key.Key), fastRetries)
+		reqrd.Nil(err)
+		seed(tt, c)
+
+		// the request went through on the first attempt only
+		adj, err := c.RequestAdjustment(ctx, wallet.AdjustmentRequest{AccountID: "bob-456", Amount: 5, Reason: "goodwill"})
+		reqrd.Nil(err)
+		as.Empty(adj.Reference)
+		adjs, err := c.ListAdjustments(ctx, wallet.ListAdjustmentsRequest{})
+		reqrd.Nil(err)
+		reqrd.Len(adjs, 1)
+		as.Equal(adj.ID, adjs[0].ID)
+	})
+
+	t.Run("lost adjustment decision", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		srv, key, checker := newFlakyServer(tt, failFirst(1, http.StatusBadGateway, true, func(req *http.Request) bool {
+			return strings.HasSuffix(req.URL.Path, "/approve")
+		}))
+		c, err := client.New(srv.URL, client.WithAPIKey(key.Key), fastRetries)
+		reqrd.Nil(err)
+		checking, err := client.New(srv.URL, client.WithAPIKey(checker.Key), fastRetries)
+		reqrd.Nil(err)
+		seed(tt, c)
+
+		adj, err := c.RequestAdjustment(ctx, wallet.AdjustmentRequest{AccountID: "bob-456", Amount: 5, Reason: "goodwill"})
+		reqrd.Nil(err)
+		// the approval went through on the first attempt only
+		adj, err = checking.DecideAdjustment(ctx, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true})
+		reqrd.Nil(err)
+		as.Equal(wallet.AdjustmentApproved, adj.Status)
+		acct, err := c.GetAccount(ctx, wallet.GetAccountRequest{ID: "bob-456"})
+		reqrd.Nil(err)
+		as.Equal(5.0, acct.Balance)
+		_, err = checking.DecideAdjustment(ctx, wallet.DecideAdjustmentRequest{ID: adj.ID})
+		as.Equal(errorrrs.CodeAdjustmentDecided, codeOf(err), "first attempts conflict as usual")
+	})
+
+	t.Run("lost account creation", func(tt *testing.T) {
+		as := assert.New(tt)
+		srv, key, _ := newFlakyServer(tt, failFirst(1, http.StatusBadGateway, true, isPost))
+		c, err := client.New(srv.URL, client.WithAPIKey(key.Key), fastRetries)
+		require.Nil(tt, err)
+
+		acct, err := c.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "alice-123", Currency: "usd", InitAmt: 100})
+		require.Nil(tt, err)
+		as.Equal(100.0, acct.Balance)
+		_, err = c.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "alice-123", Currency: "USD"})
+		as.Equal(errorrrs.CodeAccountExists, codeOf(err), "first attempts conflict as usual")
+	})
+
+	t.Run("too many requests", func(tt *testing.T) {
+		as := assert.New(tt)
+		srv, key, _ := newFlakyServer(tt, failFirst(2, http.StatusTooManyRequests, false, isPost))
+		c, err := client.New(srv.URL, client.WithAPIKey(key.Key), fastRetries)
+		require.Nil(tt, err)
+
+		_, err = c.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "alice-123", Currency: "USD"})
+		as.Nil(err)
+	})
+
+	t.Run("disabled", func(tt *testing.T) {
+		as := assert.New(tt)
+		var posts int32
+		srv, key, _ := newFlakyServer(tt, failFirst(1, http.StatusServiceUnavailable, false, func(req *http.Request) bool {
+			if isPost(req) && req.URL.Path != "/wallets" {
+				atomic.AddInt32(&posts, 1)
+				return true
+			}
+			return false
+		}))
+		c, err := client.New(srv.URL, client.WithAPIKey(key.Key), client.WithRetries(client.Retries{}))
+		require.Nil(tt, err)
+		seed(tt, c)
+
+		_, err = c.CreatePayment(ctx, wallet.CreatePaymentRequest{Self: "alice-123", To: "bob-456", Amount: 10})
+		as.NotNil(err)
+		as.Equal(int32(1), atomic.LoadInt32(&posts))
+	})
+
+	t.Run("gives up", func(tt *testing.T) {
+		as := assert.New(tt)
+		srv, key, _ := newFlakyServer(tt, failFirst(5, http.StatusServiceUnavailable, false, func(*http.Request) bool { return true }))
+		c, err := client.New(srv.URL, client.WithAPIKey(key.Key), fastRetries)
+		require.Nil(tt, err)
+
+		_, err = c.ListAccounts(ctx, wallet.ListAccountsRequest{})
+		var e *errorrrs.E
+		require.True(tt, errors.As(err, &e), "%v", err)
+		as.Equal(errorrrs.Unavailable, e.ID)
+	})
+}
+
+func codeOf(err error) errorrrs.Code {
+	var e *errorrrs.E
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+func TestIterators(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	srv, key, _ := newServer(t)
+	c, err := client.New(srv.URL, client.WithAPIKey(key.Key))
+	reqrd.Nil(err)
+	ctx := context.Background()
+
+	ids := []string{"a-1", "a-2", "a-3", "a-4", "a-5"}
+	for _, id := range ids {
+		_, err := c.CreateAccount(ctx, wallet.CreateAccountRequest{ID: id, Currency: "USD", InitAmt: 10})
+		reqrd.Nil(err)
+	}
+	for i := 1; i < len(ids); i++ {
+		_, err := c.CreatePayment(ctx, wallet.CreatePaymentRequest{Self: "a-1", To: ids[i], Amount: 1})
+		reqrd.Nil(err)
+	}
+
+	var got []string
+	accts := c.Accounts(ctx, wallet.ListAccountsRequest{Limit: 2})
+	for accts.Next() {
+		got = append(got, accts.Value().ID)
+	}
+	reqrd.Nil(accts.Err())
+	as.Equal(ids, got)
+
+	n := 0
+	transfers := c.Transfers(ctx, wallet.ListTransfersRequest{Limit: 3})
+	for transfers.Next() {
+		n++
+		as.Equal(n, transfers.Value().ID)
+	}
+	reqrd.Nil(transfers.Err())
+	as.Equal(4, n)
+
+	n = 0
+	payments := c.Payments(ctx, wallet.ListPaymentsRequest{ID: "a-1", Limit: 4})
+	for payments.Next() {
+		n++
+	}
+	reqrd.Nil(payments.Err())
+	as.Equal(4, n, "a full last page is followed by an empty one")
+
+	n = 0
+	entries := c.Audit(ctx, wallet.ListAuditRequest{Limit: 4})
+	for entries.Next() {
+		n++
+	}
+	reqrd.Nil(entries.Err())
+	// along with those of creating the tenant and keys of the server
+	as.Equal(len(ids)+4+3, n)
+
+	for _, id := range ids[:3] {
+		_, err := c.RequestAdjustment(ctx, wallet.AdjustmentRequest{AccountID: id, Amount: 1, Reason: "goodwill"})
+		reqrd.Nil(err)
+	}
+	n = 0
+	adjs := c.Adjustments(ctx, wallet.ListAdjustmentsRequest{Limit: 2})
+	for adjs.Next() {
+		n++
+		as.Equal(ids[n-1], adjs.Value().AccountID)
+	}
+	reqrd.Nil(adjs.Err())
+	as.Equal(3, n)
+
+	payments = c.Payments(ctx, wallet.ListPaymentsRequest{ID: "a-1", Limit: wallet.MaxPageSize + 1})
+	as.False(payments.Next())
+	as.Equal(errorrrs.CodeValidationFailed, codeOf(payments.Err()))
+}
+
+func TestGetStatement(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	srv, key, _ := newServer(t)
+	c, err := client.New(srv.URL, client.WithAPIKey(key.Key))
+	reqrd.Nil(err)
+	ctx := context.Background()
+
+	for _, id := range []string{"alice-123", "bob-456"} {
+		_, err := c.CreateAccount(ctx, wallet.CreateAccountRequest{ID: id, Currency: "USD", InitAmt: 100})
+		reqrd.Nil(err)
+	}
+	p, err := c.CreatePayment(ctx, wallet.CreatePaymentRequest{
+		Self:        "alice-123",
+		To:          "bob-456",
+		Amount:      12.5,
+		Description: "lunch",
+		Reference:   "inv-1",
+	})
+	reqrd.Nil(err)
+
+	stmt, err := c.GetStatement(ctx, wallet.StatementRequest{ID: "alice-123", To: time.Now().Add(time.Hour)})
+	reqrd.Nil(err)
+	as.Equal("alice-123", stmt.Account.ID)
+	as.Equal(100.0, stmt.OpeningBalance)
+	as.Equal(87.5, stmt.ClosingBalance)
+	reqrd.Len(stmt.Entries, 1)
+	as.Equal(p.ID, stmt.Entries[0].ID)
+	as.Equal("bob-456", stmt.Entries[0].To)
+	as.Equal("inv-1", stmt.Entries[0].Reference)
+	as.Equal("lunch", stmt.Entries[0].Description)
+
+	_, err = c.GetStatement(ctx, wallet.StatementRequest{ID: "nobody-0"})
+	as.Equal(errorrrs.CodeAccountNotFound, codeOf(err))
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// DefaultPageSize is the page size of iterators
+// whose requests have no `Limit`
+const DefaultPageSize = 100
+
+// Iterator iterates over a listing page by page, requesting each page
+// as the previous one runs out, so that listings of any size can be
+// gone through without holding them in memory:
+//
+//	it := c.Transfers(ctx, wallet.ListTransfersRequest{Currency: &usd})
+//	for it.Next() {
+//		t := it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//
+// Pages are requested after the last item of the previous page, so
+// items created meanwhile are included if they sort after it.
+type Iterator[T any] struct {
+	// next requests the page after the last one
+	next  func() ([]T, error)
+	limit int
+	page  []T
+	value T
+	done  bool
+	err   error
+}
+
+// Next advances to the next item, returning false when there are no more
+// or when requesting a page failed, which `Err` tells apart
+func (it *Iterator[T]) Next() bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.page, it.err = it.next()
+		// short pages are the last ones
+		it.done = len(it.page) < it.limit
+	}
+	it.value, it.page = it.page[0], it.page[1:]
+
+	return true
+}
+
+// Value is the current item
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err is the error of requesting a page, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	return limit
+}
+
+// Accounts iterates over accounts in pages of `req.Limit`, in ID order
+func (c *Client) Accounts(ctx context.Context, req wallet.ListAccountsRequest) *Iterator[wallet.Account] {
+	req.Limit = pageSize(req.Limit)
+	return &Iterator[wallet.Account]{
+		limit: req.Limit,
+		next: func() ([]wallet.Account, error) {
+			page, err := c.ListAccounts(ctx, req)
+			if len(page) > 0 {
+				req.After = &page[len(page)-1].ID
+			}
+			return page, err
+		},
+	}
+}
+
+// Payments iterates over payments in pages of `req.Limit`, in ID order
+func (c *Client) Payments(ctx context.Context, req wallet.ListPaymentsRequest) *Iterator[wallet.Payment] {
+	req.Limit = pageSize(req.Limit)
+	return &Iterator[wallet.Payment]{
+		limit: req.Limit,
+		next: func() ([]wallet.Payment, error) {
+			page, err := c.ListPayments(ctx, req)
+			if len(page) > 0 {
+				req.AfterID = &page[len(page)-1].ID
+			}
+			return page, err
+		},
+	}
+}
+
+// Transfers iterates over transfers in pages of `req.Limit`, in ID order
+func (c *Client) Transfers(ctx context.Context, req wallet.ListTransfersRequest) *Iterator[wallet.Transfer] {
+	req.Limit = pageSize(req.Limit)
+	return &Iterator[wallet.Transfer]{
+		limit: req.Limit,
+		next: func() ([]wallet.Transfer, error) {
+			page, err := c.ListTransfers(ctx, req)
+			if len(page) > 0 {
+				req.AfterID = &page[len(page)-1].ID
+			}
+			return page, err
+		},
+	}
+}
+
+// Audit iterates over audit entries in pages of `req.Limit`, in ID order
+func (c *Client) Audit(ctx context.Context, req wallet.ListAuditRequest) *Iterator[wallet.AuditEntry] {
+	req.Limit = pageSize(req.Limit)
+	return &Iterator[wallet.AuditEntry]{
+		limit: req.Limit,
+		next: func() ([]wallet.AuditEntry, error) {
+			page, err := c.ListAudit(ctx, req)
+			if len(page) > 0 {
+				req.AfterID = &page[len(page)-1].ID
+			}
+			return page, err
+		},
+	}
+}
+
+// Adjustments iterates over adjustments in pages of `req.Limit`, in ID order
+func (c *Client) Adjustments(ctx context.Context, req wallet.ListAdjustmentsRequest) *Iterator[wallet.Adjustment] {
+	req.Limit = pageSize(req.Limit)
+	return &Iterator[wallet.Adjustment]{
+		limit: req.Limit,
+		next: func() ([]wallet.Adjustment, error) {
+			page, err := c.ListAdjustments(ctx, req)
+			if len(page) > 0 {
+				req.AfterID = &page[len(page)-1].ID
+			}
+			return page, err
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arhyth/genwallet/errorrrs"
+)
+
+// Retries is how requests failing for transient reasons are retried: up to
+// `Max` times, after backoffs doubling from `Backoff` up to `MaxBackoff`
+// (give or take jitter), or after as long as the server asks with a
+// `Retry-After` header.
+//
+// Requests refused without effect, i.e. with `429 Too Many Requests`,
+// `concurrent_update` or `overloaded` (503), are always retried. Requests whose effect is unknown,
+// i.e. with no response or a `5xx` one, are only retried if they can be
+// replayed: reads, and writes that are idempotent (see `CreatePayment`).
+type Retries struct {
+	Max        int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetries are the retries of clients without `WithRetries`
+var DefaultRetries = Retries{
+	Max:        3,
+	Backoff:    100 * time.Millisecond,
+	MaxBackoff: 2 * time.Second,
+}
+
+// backoff is the wait before retry number `n` (from 1)
+func (r Retries) backoff(n int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	d := r.Backoff << (n - 1)
+	if d > r.MaxBackoff || d <= 0 {
+		d = r.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	// in [d/2, d] so that clients failing together do not retry together
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable tells whether `r`, having failed with `err` and a response
+// of status `status` (0 if none), is worth sending again
+func retryable(r *request, status int, err error) bool {
+	switch {
+	case status == http.StatusTooManyRequests, codeOf(err) == errorrrs.CodeConcurrentUpdate,
+		codeOf(err) == errorrrs.CodeOverloaded:
+		return true
+	case status == 0, status >= 500, status < 300:
+		// no response, a failure of the server (or of a proxy in front of
+		// it) or a broken response: whether `r` had an effect is unknown
+		return r.replayable != nil && r.replayable()
+	}
+
+	return false
+}
+
+// parseRetryAfter parses `Retry-After` header values, either in seconds
+// or as an HTTP date, returning 0 if there is none
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/arhyth/genwallet/config"
+)
+
+const configUsage = "usage: genwallet [-config FILE] [-FLAG VALUE]... config print"
+
+// configCmd runs the `genwallet config print` command, which prints the
+// config of the flags, environment and config file it is run with, with
+// its secrets redacted, and then fails if it is invalid
+func configCmd(out io.Writer, cfg config.APIConfig, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+	if err := cfg.Print(out); err != nil {
+		return err
+	}
+
+	return cfg.Validate()
+}
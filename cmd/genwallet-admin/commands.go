@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// command runs the commands of genwallet-admin against `svc`
+type command struct {
+	svc    service
+	out    io.Writer
+	errOut io.Writer
+	print  *printer
+	// tick is the clock of `tail` polls; tests override it
+	tick func(time.Duration) <-chan time.Time
+}
+
+func (c *command) run(ctx context.Context, args []string) error {
+	name, args := args[0], args[1:]
+	switch name {
+	case "accounts":
+		if len(args) == 0 {
+			return errUsage
+		}
+		switch args[0] {
+		case "list":
+			return c.listAccounts(ctx, args[1:])
+		case "show":
+			return c.showAccount(ctx, args[1:])
+		case "create":
+			return c.createAccount(ctx, args[1:])
+		}
+	case "adjust":
+		return c.adjust(ctx, args)
+	case "adjustments":
+		return c.adjustments(ctx, args)
+	case "approve", "reject":
+		return c.decide(ctx, args, name == "approve")
+	case "freeze", "unfreeze":
+		return c.freeze(ctx, args, name == "freeze")
+	case "tail":
+		return c.tail(ctx, args)
+	case "reconcile":
+		return c.reconcile(ctx, args)
+	case "audit":
+		return c.audit(ctx, args)
+	case "export":
+		return c.export(ctx, args)
+	}
+
+	return errUsage
+}
+
+func (c *command) flags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("genwallet-admin "+name, flag.ContinueOnError)
+	flags.SetOutput(c.errOut)
+	return flags
+}
+
+// optional returns nil for empty flag values
+func optional(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+func (c *command) listAccounts(ctx context.Context, args []string) error {
+	flags := c.flags("accounts list")
+	currency := flags.String("currency", "", "only list accounts of currency")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	accts, err := c.svc.ListAccounts(ctx, wallet.ListAccountsRequest{Currency: optional(*currency)})
+	if err != nil {
+		return err
+	}
+
+	return c.print.accounts(accts...)
+}
+
+// accountID is the single positional ID argument of a command
+func accountID(args []string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", errUsage
+	}
+	return args[0], nil
+}
+
+func (c *command) showAccount(ctx context.Context, args []string) error {
+	id, err := accountID(args)
+	if err != nil {
+		return err
+	}
+	acct, err := c.svc.GetAccount(ctx, wallet.GetAccountRequest{ID: id})
+	if err != nil {
+		return err
+	}
+
+	return c.print.account(acct)
+}
+
+func (c *command) createAccount(ctx context.Context, args []string) error {
+	flags := c.flags("accounts create")
+	var req wallet.CreateAccountRequest
+	flags.StringVar(&req.ID, "id", "", "account ID")
+	flags.StringVar(&req.Currency, "currency", "", "ISO 4217 currency code")
+	flags.Float64Var(&req.InitAmt, "init", 0, "initial balance")
+	flags.IntVar(&req.Shards, "shards", 0, "number of sub-balances, for accounts with many incoming payments")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	acct, err := c.svc.CreateAccount(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return c.print.account(acct)
+}
+
+// adjust requests an adjustment, which is only booked once
+// approved by someone else (see `decide`)
+func (c *command) adjust(ctx context.Context, args []string) error {
+	flags := c.flags("adjust")
+	var req wallet.AdjustmentRequest
+	flags.StringVar(&req.AccountID, "id", "", "account ID")
+	flags.Float64Var(&req.Amount, "amount", 0, "amount to credit, or debit if negative")
+	flags.StringVar(&req.Reason, "reason", "", "reason of the adjustment")
+	flags.StringVar(&req.Reference, "reference", "", "reference of the adjustment")
+	flags.Func("attach", "reference of a supporting document, e.g. a ticket URL; repeat for more", func(v string) error {
+		req.Attachments = append(req.Attachments, v)
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	adj, err := c.svc.RequestAdjustment(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return c.print.adjustment(adj)
+}
+
+func (c *command) adjustments(ctx context.Context, args []string) error {
+	flags := c.flags("adjustments")
+	account := flags.String("account", "", "only list adjustments of account")
+	status := flags.String("status", "", "only list adjustments of status, `pending`, `approved` or `rejected`")
+	after := flags.Int("after", 0, "only list adjustments after adjustment `ID`")
+	limit := flags.Int("limit", 0, "list at most `N` adjustments")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	req := wallet.ListAdjustmentsRequest{
+		AccountID: optional(*account),
+		Limit:     *limit,
+	}
+	if *status != "" {
+		s := wallet.AdjustmentStatus(*status)
+		req.Status = &s
+	}
+	if *after > 0 {
+		req.AfterID = after
+	}
+
+	adjs, err := c.svc.ListAdjustments(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return c.print.adjustments(adjs...)
+}
+
+// decide approves or rejects an adjustment; approvals
+// must be by someone else than the requester
+func (c *command) decide(ctx context.Context, args []string, approve bool) error {
+	name := "reject"
+	if approve {
+		name = "approve"
+	}
+	flags := c.flags(name)
+	note := flags.String("note", "", "note on the decision")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("%v: adjustment ID must be an integer", name)
+	}
+
+	adj, err := c.svc.DecideAdjustment(ctx, wallet.DecideAdjustmentRequest{ID: id, Approve: approve, Note: *note})
+	if err != nil {
+		return err
+	}
+
+	return c.print.adjustment(adj)
+}
+
+func (c *command) freeze(ctx context.Context, args []string, frozen bool) error {
+	id, err := accountID(args)
+	if err != nil {
+		return err
+	}
+	acct, err := c.svc.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: id, Frozen: frozen})
+	if err != nil {
+		return err
+	}
+
+	return c.print.account(acct)
+}
+
+// tail prints the last `-n` transfers and then polls for new ones until
+// interrupted. Given `-after`, it prints those after that ID instead,
+// which spares scanning the whole ledger for the last ones.
+func (c *command) tail(ctx context.Context, args []string) error {
+	flags := c.flags("tail")
+	n := flags.Int("n", 10, "number of past transfers to print first")
+	after := flags.Int("after", -1, "print transfers after this ID rather than the last `-n`")
+	account := flags.String("account", "", "only tail transfers from/to account")
+	currency := flags.String("currency", "", "only tail transfers of currency")
+	interval := flags.Duration("interval", 2*time.Second, "poll interval")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	tick := c.tick
+	if tick == nil {
+		tick = time.After
+	}
+
+	req := wallet.ListTransfersRequest{
+		From:     optional(*account),
+		To:       optional(*account),
+		Currency: optional(*currency),
+	}
+	if *after >= 0 {
+		req.AfterID = after
+	} else {
+		// the last `n` of a single scan, so that memory is bounded
+		last := make([]wallet.Transfer, 0, *n)
+		err := c.svc.StreamTransfers(ctx, req, func(t wallet.Transfer) error {
+			if *n == 0 {
+				return nil
+			}
+			if len(last) == *n {
+				last = append(last[:0], last[1:]...)
+			}
+			last = append(last, t)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.print.transfers(last...); err != nil {
+			return err
+		}
+		lastID := 0
+		if len(last) > 0 {
+			lastID = last[len(last)-1].ID
+		}
+		req.AfterID = &lastID
+	}
+
+	for {
+		trnsfrs, err := c.svc.ListTransfers(ctx, req)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if len(trnsfrs) > 0 {
+			if err := c.print.transfers(trnsfrs...); err != nil {
+				return err
+			}
+			lastID := trnsfrs[len(trnsfrs)-1].ID
+			req.AfterID = &lastID
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick(*interval):
+		}
+	}
+}
+
+// errUnbalanced fails `reconcile` runs that find accounts out of balance
+var errUnbalanced = errors.New("accounts out of balance")
+
+func (c *command) reconcile(ctx context.Context, args []string) error {
+	flags := c.flags("reconcile")
+	currency := flags.String("currency", "", "only reconcile accounts of currency")
+	all := flags.Bool("all", false, "print balanced accounts too")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	recs, err := c.svc.Reconcile(ctx, wallet.ReconcileRequest{Currency: optional(*currency)})
+	if err != nil {
+		return err
+	}
+	unbalanced := make([]wallet.Reconciliation, 0, len(recs))
+	for _, rec := range recs {
+		if !rec.Balanced {
+			unbalanced = append(unbalanced, rec)
+		}
+	}
+	if *all {
+		err = c.print.reconciliations(recs...)
+	} else {
+		err = c.print.reconciliations(unbalanced...)
+	}
+	if err != nil {
+		return err
+	}
+	if len(unbalanced) > 0 {
+		return fmt.Errorf("%w: %d of %d", errUnbalanced, len(unbalanced), len(recs))
+	}
+
+	return nil
+}
+
+func (c *command) audit(ctx context.Context, args []string) error {
+	flags := c.flags("audit")
+	actor := flags.String("actor", "", "only list calls of actor, e.g. apikey:<ID>")
+	target := flags.String("target", "", "only list calls on target, e.g. an account ID")
+	from := flags.String("from", "", "only list calls since RFC 3339 `time`")
+	to := flags.String("to", "", "only list calls before RFC 3339 `time`")
+	after := flags.Int("after", 0, "only list entries after entry `ID`")
+	limit := flags.Int("limit", 0, "list at most `N` entries")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	req := wallet.ListAuditRequest{
+		Actor:  optional(*actor),
+		Target: optional(*target),
+		Limit:  *limit,
+	}
+	var err error
+	if *from != "" {
+		if req.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			return fmt.Errorf("audit -from: %w", err)
+		}
+	}
+	if *to != "" {
+		if req.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("audit -to: %w", err)
+		}
+	}
+	if *after > 0 {
+		req.AfterID = after
+	}
+
+	entries, err := c.svc.ListAudit(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return c.print.auditEntries(entries...)
+}
+
+func (c *command) export(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	what := args[0]
+	flags := c.flags("export " + what)
+	id := flags.String("id", "", "account of the payments to export")
+	currency := flags.String("currency", "", "only export accounts/transfers of currency")
+	format := flags.String("format", "csv", "`csv` or `ndjson`")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	mediaType := map[string]string{
+		"csv":    wallet.MediaTypeCSV,
+		"ndjson": wallet.MediaTypeNDJSON,
+	}[*format]
+	if mediaType == "" {
+		return fmt.Errorf("unknown export format %q, should be csv or ndjson", *format)
+	}
+
+	switch what {
+	case "accounts":
+		req := wallet.ListAccountsRequest{Currency: optional(*currency)}
+		return wallet.ExportAccounts(c.out, mediaType, func(fn func(wallet.Account) error) error {
+			return c.svc.StreamAccounts(ctx, req, fn)
+		})
+	case "transfers":
+		req := wallet.ListTransfersRequest{Currency: optional(*currency)}
+		return wallet.ExportTransfers(c.out, mediaType, func(fn func(wallet.Transfer) error) error {
+			return c.svc.StreamTransfers(ctx, req, fn)
+		})
+	case "payments":
+		if *id == "" {
+			return errUsage
+		}
+		req := wallet.ListPaymentsRequest{ID: *id}
+		return wallet.ExportPayments(c.out, mediaType, func(fn func(wallet.Payment) error) error {
+			return c.svc.StreamPayments(ctx, req, fn)
+		})
+	}
+
+	return errUsage
+}
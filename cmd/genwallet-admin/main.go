@@ -0,0 +1,175 @@
+// Command genwallet-admin operates wallets for ops: it lists, shows and
+// creates accounts, requests and decides balance adjustments, freezes accounts, tails and exports
+// the ledger, reconciles balances and reads the audit log, so that none of
+// it takes raw SQL. Database commands are audited as of the database role
+// they connect as, so makers and checkers of adjustments need roles of
+// their own to decide each other's adjustments on the database.
+//
+// It talks either to the database directly (`DB_URL`, as the server does)
+// or, given `-url`, to a running server over HTTP, where an admin API key
+// (`genwallet apikey create -admin`) is needed for the admin operations.
+//
+//	$ genwallet-admin accounts list -currency USD
+//	$ genwallet-admin -url http://localhost:8000 -api-key $KEY -o json accounts show bob-456
+//	$ genwallet-admin adjust -id bob-456 -amount -12.5 -reason "duplicate top-up" -attach https://tickets.example.com/4411
+//	$ genwallet-admin adjustments -status pending
+//	$ genwallet-admin approve -note "checked against the PSP report" 7
+//	$ genwallet-admin reconcile
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/arhyth/genwallet/client"
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet"
+)
+
+const usage = `usage: genwallet-admin [-url URL [-api-key KEY] | -tenant ID] [-o table|json] COMMAND
+
+commands:
+  accounts list [-currency CUR]
+  accounts show ID
+  accounts create -id ID -currency CUR [-init AMOUNT] [-shards N]
+  adjust -id ID -amount AMOUNT -reason TEXT [-reference REF] [-attach REF]...
+  adjustments [-account ID] [-status pending|approved|rejected] [-after ID] [-limit N]
+  approve [-note TEXT] ADJUSTMENT_ID
+  reject [-note TEXT] ADJUSTMENT_ID
+  freeze ID
+  unfreeze ID
+  tail [-n N] [-after ID] [-account ID] [-currency CUR] [-interval DURATION]
+  reconcile [-currency CUR] [-all]
+  audit [-actor ACTOR] [-target ID] [-from TIME] [-to TIME] [-after ID] [-limit N]
+  export accounts|transfers|payments [-id ID] [-currency CUR] [-format csv|ndjson]`
+
+// service is what the commands need of `wallet.Service`;
+// both the service itself and `client.Client` implement it
+type service interface {
+	ListAccounts(context.Context, wallet.ListAccountsRequest) ([]wallet.Account, error)
+	GetAccount(context.Context, wallet.GetAccountRequest) (wallet.Account, error)
+	CreateAccount(context.Context, wallet.CreateAccountRequest) (wallet.Account, error)
+	ListTransfers(context.Context, wallet.ListTransfersRequest) ([]wallet.Transfer, error)
+	StreamAccounts(context.Context, wallet.ListAccountsRequest, func(wallet.Account) error) error
+	StreamPayments(context.Context, wallet.ListPaymentsRequest, func(wallet.Payment) error) error
+	StreamTransfers(context.Context, wallet.ListTransfersRequest, func(wallet.Transfer) error) error
+	RequestAdjustment(context.Context, wallet.AdjustmentRequest) (wallet.Adjustment, error)
+	ListAdjustments(context.Context, wallet.ListAdjustmentsRequest) ([]wallet.Adjustment, error)
+	DecideAdjustment(context.Context, wallet.DecideAdjustmentRequest) (wallet.Adjustment, error)
+	FreezeAccount(context.Context, wallet.FreezeAccountRequest) (wallet.Account, error)
+	Reconcile(context.Context, wallet.ReconcileRequest) ([]wallet.Reconciliation, error)
+	ListAudit(context.Context, wallet.ListAuditRequest) ([]wallet.AuditEntry, error)
+}
+
+var (
+	_ service = (*wallet.ValidationMiddleware)(nil)
+	_ service = (*client.Client)(nil)
+)
+
+// errUsage is returned as is for bad command lines
+var errUsage = errors.New(usage)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Stdout, os.Stderr, os.Args[1:], os.Getenv)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, describe(err))
+		os.Exit(1)
+	}
+}
+
+// describe formats errors of the service, along with their field errors
+func describe(err error) string {
+	var e *errorrrs.E
+	if !errors.As(err, &e) {
+		return err.Error()
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v: %v", errorrrs.Classify(e).Code, e.Msg)
+	for _, fe := range e.Fields {
+		fmt.Fprintf(&sb, "\n  %v: %v", fe.Field, fe.Msg)
+	}
+
+	return sb.String()
+}
+
+// run parses the global flags, opens the service and runs the command
+func run(ctx context.Context, out, errOut io.Writer, args []string, getenv func(string) string) error {
+	flags := flag.NewFlagSet("genwallet-admin", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() { fmt.Fprintln(errOut, usage) }
+	baseURL := flags.String("url", "", "base URL of a genwallet server to talk to rather than the database")
+	apiKey := flags.String("api-key", getenv("GENWALLET_API_KEY"), "API key to authenticate with over HTTP (default $GENWALLET_API_KEY)")
+	tenant := flags.String("tenant", wallet.DefaultTenantID, "tenant to operate on, with the database; over HTTP it is that of the API key")
+	output := flags.String("o", "table", "output format, `table` or `json`")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errUsage
+	}
+	p, err := newPrinter(out, *output)
+	if err != nil {
+		return err
+	}
+
+	var svc service
+	if *baseURL != "" {
+		svc, err = client.New(*baseURL, client.WithAPIKey(*apiKey))
+		if err != nil {
+			return err
+		}
+	} else {
+		dsn := getenv("DB_URL")
+		if dsn == "" || dsn == wallet.MemoryDSN {
+			return errors.New("DB_URL of a Postgres database is required unless -url is given")
+		}
+		repo, err := wallet.NewRepo(dsn)
+		if err != nil {
+			return err
+		}
+		defer repo.DB.Close()
+		svc = &wallet.ValidationMiddleware{Next: &wallet.ServiceImpl{Repo: repo}}
+		actor, err := dbActor(ctx, repo.DB)
+		if err != nil {
+			return err
+		}
+		ctx = wallet.WithActor(asAdmin(ctx, *tenant), actor)
+	}
+
+	cmd := &command{svc: svc, out: out, errOut: errOut, print: p}
+	return cmd.run(ctx, flags.Args())
+}
+
+// dbActor is the actor that database commands are audited and decide
+// adjustments as, since they go without an API key: the database role
+// they connect as. Unlike the OS user or its environment, whoever runs
+// them cannot make it up, so cannot approve their own adjustments.
+func dbActor(ctx context.Context, db *sql.DB) (string, error) {
+	var role string
+	err := db.QueryRowContext(ctx, `SELECT current_user;`).Scan(&role)
+	return "db:" + role, err
+}
+
+// asAdmin scopes the database commands to tenant `tenant` with admin rights.
+// Requests of the default tenant go without a principal, as unauthenticated
+// requests to the server do. Tenant limits only apply to API keys.
+func asAdmin(ctx context.Context, tenant string) context.Context {
+	if tenant == wallet.DefaultTenantID {
+		return ctx
+	}
+	return wallet.WithPrincipal(ctx, wallet.Principal{
+		Tenant: wallet.Tenant{ID: tenant},
+		Admin:  true,
+	})
+}
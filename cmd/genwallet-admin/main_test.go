@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/client"
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// newServer serves a memory repository seeded with two USD accounts
+func newServer(t *testing.T) *httptest.Server {
+	repo := wallet.NewMemRepo()
+	ctx := context.Background()
+	for _, req := range []wallet.CreateAccountRequest{
+		{ID: "alice-123", Currency: "USD", InitAmt: 100},
+		{ID: "bob-456", Currency: "USD", InitAmt: 50},
+	} {
+		_, err := repo.CreateAccount(ctx, req)
+		require.Nil(t, err)
+	}
+	_, err := repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 10})
+	require.Nil(t, err)
+
+	srv := httptest.NewServer(wallet.MakeHTTPHandler(&wallet.ValidationMiddleware{
+		Next: &wallet.ServiceImpl{
+			Repo: repo,
+		},
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestRun(t *testing.T) {
+	srv := newServer(t)
+	getenv := func(string) string { return "" }
+
+	cases := []struct {
+		name     string
+		args     []string
+		contains []string
+		err      error
+	}{
+		{
+			name:     "accounts list",
+			args:     []string{"accounts", "list"},
+			contains: []string{"ID  ", "alice-123  90", "bob-456    60", "active"},
+		},
+		{
+			name:     "accounts show, json",
+			args:     []string{"-o", "json", "accounts", "show", "bob-456"},
+			contains: []string{`"id":"bob-456"`, `"balance":60`},
+		},
+		{
+			name:     "adjust",
+			args:     []string{"adjust", "-id", "bob-456", "-amount", "-5", "-reason", "correction", "-attach", "ticket-4411"},
+			contains: []string{"account_id:", "bob-456", "pending", "attachment:", "ticket-4411"},
+		},
+		{
+			name:     "adjustments",
+			args:     []string{"adjustments", "-status", "pending"},
+			contains: []string{"REQUESTED_BY", "bob-456", "-5", "pending", "anonymous"},
+		},
+		{
+			name:     "reject",
+			args:     []string{"reject", "-note", "withdrawn", "1"},
+			contains: []string{"status:", "rejected", "note:", "withdrawn"},
+		},
+		{
+			name:     "freeze",
+			args:     []string{"freeze", "alice-123"},
+			contains: []string{"status:", "frozen"},
+		},
+		{
+			name:     "reconcile",
+			args:     []string{"reconcile", "-all"},
+			contains: []string{"DIFFERENCE", "alice-123", "ok"},
+		},
+		{
+			name:     "audit",
+			args:     []string{"audit", "-target", "bob-456"},
+			contains: []string{"OUTCOME", "account.create", "anonymous", "ok"},
+		},
+		{
+			name:     "audit, json",
+			args:     []string{"-o", "json", "audit", "-actor", "anonymous", "-limit", "1"},
+			contains: []string{`"id":1,`, `"action":"account.create"`, `"target":"alice-123"`},
+		},
+		{
+			name:     "export transfers",
+			args:     []string{"export", "transfers"},
+			contains: []string{"id,from,to", "alice-123,bob-456"},
+		},
+		{
+			name: "no command",
+			err:  errUsage,
+		},
+		{
+			name: "unknown command",
+			args: []string{"accounts", "delete", "bob-456"},
+			err:  errUsage,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(tt *testing.T) {
+			as := assert.New(tt)
+			var out, errOut bytes.Buffer
+			args := append([]string{"-url", srv.URL}, c.args...)
+
+			err := run(context.Background(), &out, &errOut, args, getenv)
+			if c.err != nil {
+				as.True(errors.Is(err, c.err), err)
+				return
+			}
+			require.Nil(tt, err, errOut.String())
+			for _, s := range c.contains {
+				as.Contains(out.String(), s)
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	as := assert.New(t)
+	srv := newServer(t)
+	var out, errOut bytes.Buffer
+
+	err := run(context.Background(), &out, &errOut, []string{"accounts", "list"}, func(string) string { return wallet.MemoryDSN })
+	as.NotNil(err, "database mode needs Postgres")
+
+	err = run(context.Background(), &out, &errOut, []string{"-url", srv.URL, "accounts", "show", "nobody-0"}, func(string) string { return "" })
+	as.True(strings.HasPrefix(describe(err), "account_not_found: "), describe(err))
+
+	err = run(context.Background(), &out, &errOut, []string{"-url", srv.URL, "adjust", "-id", "bob-456"}, func(string) string { return "" })
+	as.Contains(describe(err), "validation_failed")
+	as.Contains(describe(err), "\n  reason: ")
+
+	// anonymous callers cannot tell each other apart, so cannot approve
+	err = run(context.Background(), &out, &errOut, []string{"-url", srv.URL, "adjust", "-id", "bob-456", "-amount", "5", "-reason", "goodwill"}, func(string) string { return "" })
+	as.Nil(err)
+	err = run(context.Background(), &out, &errOut, []string{"-url", srv.URL, "approve", "1"}, func(string) string { return "" })
+	as.True(strings.HasPrefix(describe(err), "self_approval: "), describe(err))
+}
+
+func TestTail(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	srv := newServer(t)
+	c, err := client.New(srv.URL)
+	reqrd.Nil(err)
+	var out bytes.Buffer
+	p, err := newPrinter(&out, "json")
+	reqrd.Nil(err)
+
+	// each poll makes a payment, until the third one stops the tail
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	polls := 0
+	tick := func(time.Duration) <-chan time.Time {
+		polls++
+		if polls == 3 {
+			cancel()
+			return nil
+		}
+		_, err := c.CreatePayment(ctx, wallet.CreatePaymentRequest{Self: "bob-456", To: "alice-123", Amount: 1})
+		reqrd.Nil(err)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+	cmd := &command{svc: c, out: &out, errOut: &out, print: p, tick: tick}
+
+	reqrd.Nil(cmd.tail(ctx, []string{"-n", "1"}))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	as.Len(lines, 3, out.String())
+	for i, line := range lines {
+		as.Contains(line, `"id":`+strconv.Itoa(i+1))
+	}
+}
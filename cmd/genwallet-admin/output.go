@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// printer prints results either as aligned tables or as JSON. Single
+// results are printed as JSON objects and listings as NDJSON, one object
+// per line, so that `tail` output can be piped as it comes.
+type printer struct {
+	out  io.Writer
+	json bool
+}
+
+func newPrinter(out io.Writer, format string) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{out: out}, nil
+	case "json":
+		return &printer{out: out, json: true}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, should be table or json", format)
+}
+
+// table writes `rows` under `header` as tab separated columns
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	if header != nil {
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) ndjson(n int, row func(i int) interface{}) error {
+	enc := json.NewEncoder(p.out)
+	for i := 0; i < n; i++ {
+		if err := enc.Encode(row(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+func formatAmount(amt float64) string {
+	return strconv.FormatFloat(amt, 'f', -1, 64)
+}
+
+// account prints the details of a single account
+func (p *printer) account(acct wallet.Account) error {
+	if p.json {
+		return p.ndjson(1, func(int) interface{} { return acct })
+	}
+	rows := [][]string{
+		{"id:", acct.ID},
+		{"balance:", formatAmount(acct.Balance)},
+		{"currency:", acct.Currency},
+		{"status:", accountStatus(acct)},
+		{"created_at:", formatTime(acct.CreatedAt)},
+		{"updated_at:", formatTime(acct.UpdatedAt)},
+	}
+	keys := make([]string, 0, len(acct.Metadata))
+	for k := range acct.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rows = append(rows, []string{wallet.MetadataParamPrefix + k + ":", acct.Metadata[k]})
+	}
+
+	return p.table(nil, rows)
+}
+
+func accountStatus(acct wallet.Account) string {
+	var flags []string
+	if acct.Frozen {
+		flags = append(flags, "frozen")
+	}
+	if acct.System {
+		flags = append(flags, "system")
+	}
+	if len(flags) == 0 {
+		return "active"
+	}
+	return strings.Join(flags, ",")
+}
+
+func (p *printer) accounts(accts ...wallet.Account) error {
+	if p.json {
+		return p.ndjson(len(accts), func(i int) interface{} { return accts[i] })
+	}
+	rows := make([][]string, len(accts))
+	for i, a := range accts {
+		rows[i] = []string{a.ID, formatAmount(a.Balance), a.Currency, accountStatus(a), formatTime(a.UpdatedAt)}
+	}
+
+	return p.table([]string{"ID", "BALANCE", "CURRENCY", "STATUS", "UPDATED_AT"}, rows)
+}
+
+func (p *printer) transfers(trnsfrs ...wallet.Transfer) error {
+	if p.json {
+		return p.ndjson(len(trnsfrs), func(i int) interface{} { return trnsfrs[i] })
+	}
+	if len(trnsfrs) == 0 {
+		return nil
+	}
+	rows := make([][]string, len(trnsfrs))
+	for i, t := range trnsfrs {
+		rows[i] = []string{
+			strconv.Itoa(t.ID),
+			formatTime(t.CreatedAt),
+			t.From,
+			t.To,
+			formatAmount(t.Amount),
+			t.Currency,
+			t.Reference,
+			t.Description,
+		}
+	}
+
+	return p.table([]string{"ID", "CREATED_AT", "FROM", "TO", "AMOUNT", "CURRENCY", "REFERENCE", "DESCRIPTION"}, rows)
+}
+
+// adjustment prints the details of a single adjustment
+func (p *printer) adjustment(adj wallet.Adjustment) error {
+	if p.json {
+		return p.ndjson(1, func(int) interface{} { return adj })
+	}
+	rows := [][]string{
+		{"id:", strconv.Itoa(adj.ID)},
+		{"account_id:", adj.AccountID},
+		{"amount:", formatAmount(adj.Amount)},
+		{"reason:", adj.Reason},
+		{"reference:", adj.Reference},
+		{"status:", string(adj.Status)},
+		{"requested_by:", adj.RequestedBy},
+		{"requested_at:", formatTime(adj.RequestedAt)},
+	}
+	for _, a := range adj.Attachments {
+		rows = append(rows, []string{"attachment:", a})
+	}
+	if adj.DecidedAt != nil {
+		rows = append(rows,
+			[]string{"decided_by:", adj.DecidedBy},
+			[]string{"decided_at:", formatTime(*adj.DecidedAt)},
+			[]string{"note:", adj.Note},
+		)
+	}
+	if adj.TransferID != nil {
+		rows = append(rows, []string{"transfer_id:", strconv.Itoa(*adj.TransferID)})
+	}
+
+	return p.table(nil, rows)
+}
+
+func (p *printer) adjustments(adjs ...wallet.Adjustment) error {
+	if p.json {
+		return p.ndjson(len(adjs), func(i int) interface{} { return adjs[i] })
+	}
+	rows := make([][]string, len(adjs))
+	for i, a := range adjs {
+		rows[i] = []string{
+			strconv.Itoa(a.ID),
+			formatTime(a.RequestedAt),
+			a.AccountID,
+			formatAmount(a.Amount),
+			string(a.Status),
+			a.RequestedBy,
+			a.DecidedBy,
+			a.Reason,
+		}
+	}
+
+	return p.table([]string{"ID", "REQUESTED_AT", "ACCOUNT_ID", "AMOUNT", "STATUS", "REQUESTED_BY", "DECIDED_BY", "REASON"}, rows)
+}
+
+func (p *printer) reconciliations(recs ...wallet.Reconciliation) error {
+	if p.json {
+		return p.ndjson(len(recs), func(i int) interface{} { return recs[i] })
+	}
+	rows := make([][]string, len(recs))
+	for i, r := range recs {
+		status := "ok"
+		if !r.Balanced {
+			status = "MISMATCH"
+		}
+		rows[i] = []string{
+			r.ID,
+			r.Currency,
+			formatAmount(r.Balance),
+			formatAmount(r.Expected),
+			formatAmount(r.Difference),
+			status,
+		}
+	}
+
+	return p.table([]string{"ID", "CURRENCY", "BALANCE", "EXPECTED", "DIFFERENCE", "STATUS"}, rows)
+}
+
+func (p *printer) auditEntries(entries ...wallet.AuditEntry) error {
+	if p.json {
+		return p.ndjson(len(entries), func(i int) interface{} { return entries[i] })
+	}
+	rows := make([][]string, len(entries))
+	for i, e := range entries {
+		rows[i] = []string{
+			strconv.Itoa(e.ID),
+			formatTime(e.At),
+			e.Actor,
+			e.Action,
+			e.Target,
+			e.Outcome,
+			e.SourceIP,
+		}
+	}
+
+	return p.table([]string{"ID", "AT", "ACTOR", "ACTION", "TARGET", "OUTCOME", "SOURCE_IP"}, rows)
+}
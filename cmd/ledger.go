@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/arhyth/genwallet/wallet"
+	"github.com/rs/zerolog"
+)
+
+const ledgerUsage = "usage: genwallet ledger keygen | genwallet ledger checkpoint | genwallet ledger verify [-tenant ID] [-public-key KEY]..."
+
+// chainLedger chains the transfers booked since onto the
+// ledgers every `interval` until `ctx` is done
+func chainLedger(ctx context.Context, logger zerolog.Logger, ledger wallet.Ledger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ledger.ChainLedger(ctx); err != nil {
+				logger.Err(err).Msg("genwallet ledger: chain fail")
+			}
+		}
+	}
+}
+
+// checkpointLedger signs checkpoints of the ledgers that moved
+// every `interval` until `ctx` is done
+func checkpointLedger(ctx context.Context, logger zerolog.Logger, ledger wallet.Ledger, signer wallet.LedgerSigner, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cps, err := ledger.CheckpointLedger(ctx, signer)
+			if err != nil {
+				logger.Err(err).Msg("genwallet ledger: checkpoint fail")
+			}
+			for _, cp := range cps {
+				logger.Info().
+					Str("tenant", cp.TenantID).
+					Int("transfer_id", cp.TransferID).
+					Msg("genwallet ledger: checkpointed")
+			}
+		}
+	}
+}
+
+// ledger runs the `genwallet ledger keygen|checkpoint|verify` command.
+// `signingKey` is that of the config, if any.
+func ledger(ctx context.Context, out, errOut io.Writer, dsn, signingKey string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(ledgerUsage)
+	}
+	switch args[0] {
+	case "keygen":
+		seed, public, err := wallet.GenerateLedgerKey()
+		if err != nil {
+			return err
+		}
+		key, _ := wallet.ParseLedgerPublicKey(public)
+		fmt.Fprintf(out, "signing key: %v\npublic key:  %v\nkey ID:      %v\n", seed, public, wallet.LedgerKeyID(key))
+		return nil
+	case "checkpoint":
+		return checkpoint(ctx, out, dsn, signingKey)
+	case "verify":
+		return verifyLedger(ctx, out, errOut, dsn, signingKey, args[1:])
+	}
+
+	return errors.New(ledgerUsage)
+}
+
+// checkpoint chains pending transfers and signs checkpoints
+// of the ledgers that moved, right away
+func checkpoint(ctx context.Context, out io.Writer, dsn, signingKey string) error {
+	if signingKey == "" {
+		return errors.New("ledger checkpoint: LEDGER_SIGNING_KEY is required")
+	}
+	signer, err := wallet.ParseLedgerSigner(signingKey)
+	if err != nil {
+		return err
+	}
+	repo, err := openLedger(dsn)
+	if err != nil {
+		return err
+	}
+	defer repo.DB.Close()
+
+	cps, err := repo.CheckpointLedger(ctx, signer)
+	for _, cp := range cps {
+		fmt.Fprintf(out, "checkpointed tenant %v at transfer %v\n", cp.TenantID, cp.TransferID)
+	}
+	if err == nil && len(cps) == 0 {
+		fmt.Fprintln(out, "nothing to checkpoint")
+	}
+
+	return err
+}
+
+// verifyLedger walks the ledgers and reports the first broken link of each.
+// Checkpoints are checked against the passed public keys, or that of the
+// configured signing key if none.
+func verifyLedger(ctx context.Context, out, errOut io.Writer, dsn, signingKey string, args []string) error {
+	flags := flag.NewFlagSet("genwallet ledger verify", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	tenant := flags.String("tenant", "", "tenant whose ledger to verify (default every tenant)")
+	var keys []ed25519.PublicKey
+	flags.Func("public-key", "base64 public key that checkpoints may be signed with; repeat for rotated keys", func(v string) error {
+		key, err := wallet.ParseLedgerPublicKey(v)
+		if err == nil {
+			keys = append(keys, key)
+		}
+		return err
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(keys) == 0 && signingKey != "" {
+		signer, err := wallet.ParseLedgerSigner(signingKey)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, signer.PublicKey())
+	}
+	if len(keys) == 0 {
+		fmt.Fprintln(errOut, "ledger verify: no public key, checkpoint signatures are not checked")
+	}
+
+	repo, err := openLedger(dsn)
+	if err != nil {
+		return err
+	}
+	defer repo.DB.Close()
+
+	var tenants []string
+	if *tenant != "" {
+		tenants = append(tenants, *tenant)
+	}
+	vs, err := repo.VerifyLedger(ctx, keys, tenants...)
+	if err != nil {
+		return err
+	}
+	broken := 0
+	for _, v := range vs {
+		if v.Broken != nil {
+			broken++
+			fmt.Fprintf(out, "tenant %v: BROKEN at transfer %v: %v\n", v.TenantID, v.Broken.TransferID, v.Broken.Reason)
+			continue
+		}
+		fmt.Fprintf(out, "tenant %v: ok, %v transfers and %v checkpoints verified", v.TenantID, v.Verified, v.Checkpoints)
+		if v.Unchained > 0 {
+			fmt.Fprintf(out, ", %v transfers predate the ledger", v.Unchained)
+		}
+		if v.Pending > 0 {
+			fmt.Fprintf(out, ", %v transfers not chained yet", v.Pending)
+		}
+		if v.Archived {
+			fmt.Fprint(out, ", starts after archived transfers")
+		}
+		fmt.Fprintln(out)
+	}
+	if broken > 0 {
+		return fmt.Errorf("ledger verify: %v of %v ledgers broken", broken, len(vs))
+	}
+
+	return nil
+}
+
+// openLedger opens the (Postgres) repository at `dsn`; the ledgers
+// of an in-memory one would be gone as soon as the command exits
+func openLedger(dsn string) (*wallet.Repo, error) {
+	if dsn == wallet.MemoryDSN {
+		return nil, errors.New("ledger: nothing to do for in-memory DB_URL")
+	}
+	return wallet.NewRepo(dsn)
+}
@@ -1,31 +1,99 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/arhyth/genwallet/config"
-	"github.com/arhyth/genwallet/errorrrs"
 	"github.com/arhyth/genwallet/wallet"
+	"github.com/arhyth/genwallet/wallet/pb"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
-
-	httptransport "github.com/go-kit/kit/transport/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
-	// Logging
+	// Logging, until that of the config
 	logger := zerolog.New(os.Stderr)
 
 	// Config
-	cfg, err := config.GetAPIConfig()
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		logger.Fatal().Err(err).Msg("genwallet server start: config parse fail")
 	}
-	httpAddr := cfg.AddrPort
+	var cmd string
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	if cmd == "config" {
+		if err := configCmd(os.Stdout, cfg, args); err != nil {
+			logger.Fatal().Err(err).Msg("genwallet config fail")
+		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal().Err(err).Msg("genwallet server start: config parse fail")
+	}
+	logger = newLogger(cfg)
+
+	// Migrations
+	if cmd == "migrate" {
+		if err := migrate(context.Background(), logger, os.Stdout, cfg.DBConnStr, args); err != nil {
+			logger.Fatal().Err(err).Msg("genwallet migrate fail")
+		}
+		return
+	}
+	if cmd == "archive" {
+		if err := archive(context.Background(), logger, os.Stderr, cfg.DBConnStr, args); err != nil {
+			logger.Fatal().Err(err).Msg("genwallet archive fail")
+		}
+		return
+	}
+	if cmd == "tenant" {
+		if err := tenant(context.Background(), os.Stdout, os.Stderr, cfg.DBConnStr, args); err != nil {
+			logger.Fatal().Err(err).Msg("genwallet tenant fail")
+		}
+		return
+	}
+	if cmd == "apikey" {
+		if err := apikey(context.Background(), os.Stdout, os.Stderr, cfg.DBConnStr, args); err != nil {
+			logger.Fatal().Err(err).Msg("genwallet apikey fail")
+		}
+		return
+	}
+	if cmd == "ledger" {
+		if err := ledger(context.Background(), os.Stdout, os.Stderr, cfg.DBConnStr, cfg.LedgerSigningKey, args); err != nil {
+			logger.Fatal().Err(err).Msg("genwallet ledger fail")
+		}
+		return
+	}
+	if cmd != "" {
+		logger.Fatal().Str("command", cmd).Msg("genwallet: unknown command")
+	}
+	if cfg.MigrateOnStart {
+		if err := migrateOnStart(context.Background(), logger, cfg.DBConnStr); err != nil {
+			logger.Fatal().Err(err).Msg("genwallet server start: migrate fail")
+		}
+	}
+
+	// Tracing
+	tp, shutdownTracing, err := tracerProvider(context.Background(), cfg.TracingExporter, cfg.TracingSampleRatio)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("genwallet server start: tracing setup fail")
+	}
+	tracing := cfg.TracingExporter != "none"
 
 	// Transport
 	r := chi.NewMux()
@@ -36,65 +104,119 @@ func main() {
 	})
 	r.Get("/healthcheck", okHandler)
 
-	repo, err := wallet.NewRepo(cfg.DBConnStr)
+	strategy, err := wallet.ParseTransferStrategy(cfg.TransferStrategy)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("genwallet server start: config parse fail")
+	}
+	repoOptns := []wallet.RepoOption{
+		wallet.WithTransferStrategy(strategy),
+		wallet.WithPool(wallet.Pool{
+			MaxOpenConns:    cfg.DBMaxOpenConns,
+			MaxIdleConns:    cfg.DBMaxIdleConns,
+			ConnMaxLifetime: cfg.DBConnMaxLifetime,
+			ConnMaxIdleTime: cfg.DBConnMaxIdleTime,
+		}),
+	}
+	if cfg.ContentionRetries > 0 {
+		repoOptns = append(repoOptns, wallet.WithContentionRetries(cfg.ContentionRetries, cfg.ContentionBackoff))
+	}
+	if cfg.DBReplicaConnStr != "" {
+		repoOptns = append(repoOptns, wallet.WithReplica(cfg.DBReplicaConnStr))
+	}
+	if tracing {
+		repoOptns = append(repoOptns, wallet.WithTracing(tp))
+	}
+	repo, err := wallet.OpenRepository(cfg.DBConnStr, repoOptns...)
 	if err != nil {
-		logger.Fatal().Err(err).Msg("genwallet server start: wallet.NewRepo")
+		logger.Fatal().Err(err).Msg("genwallet server start: wallet.OpenRepository")
+	}
+
+	// background work stops along with the server
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	if pgRepo, ok := repo.(*wallet.Repo); ok {
+		if cfg.MaintainPartitions {
+			go maintainPartitions(bgCtx, logger, pgRepo, cfg.PartitionInterval, cfg.PartitionsAhead)
+		}
+		r.Method("GET", "/readiness", readinessHandler(pgRepo))
+	} else {
+		r.Get("/readiness", okHandler)
+	}
+
+	// both repositories keep ledgers, which are checkpointed if a key is set
+	if ldgr, ok := repo.(wallet.Ledger); ok {
+		go chainLedger(bgCtx, logger, ldgr, cfg.LedgerChainInterval)
+	}
+	if cfg.LedgerSigningKey != "" {
+		signer, err := wallet.ParseLedgerSigner(cfg.LedgerSigningKey)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("genwallet server start: config parse fail")
+		}
+		if ldgr, ok := repo.(wallet.Ledger); ok {
+			go checkpointLedger(bgCtx, logger, ldgr, signer, cfg.LedgerCheckpointInterval)
+		}
 	}
 
-	walletSvc := &wallet.ValidationMiddleware{
-		Next: &wallet.ServiceImpl{
-			Repo: repo,
+	// both repositories manage tenants as well
+	tenants, _ := repo.(wallet.Tenants)
+	var walletSvc wallet.Service = &wallet.AuthMiddleware{
+		Next: &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
 		},
+		Keys:     tenants,
+		Required: cfg.AuthRequired,
 	}
+	if tracing {
+		walletSvc = &wallet.TracingMiddleware{
+			Next:   walletSvc,
+			Tracer: tp.Tracer(wallet.TracerName),
+		}
+	}
+
+	// the limits are shared by both transports
+	limiter := wallet.NewLimiter(wallet.Limits{
+		PerKey:              wallet.Rate{PerSecond: cfg.RateLimitPerKey, Burst: cfg.RateLimitKeyBurst},
+		PerAccount:          wallet.Rate{PerSecond: cfg.RateLimitPerAccount, Burst: cfg.RateLimitAccountBurst},
+		MaxInFlightPayments: cfg.MaxInFlightPayments,
+	})
 
-	serverErrcoder := httptransport.ServerErrorEncoder(errorrrs.GokitErrorEncoder)
-	walletsIndexHandler := httptransport.NewServer(
-		wallet.MakeWalletListEndpt(walletSvc),
-		wallet.DecodeHTTPListAccountsReq,
-		wallet.EncodeJSONResponse,
-		serverErrcoder,
-	)
-	walletGetHandler := httptransport.NewServer(
-		wallet.MakeWalletGetEndpt(walletSvc),
-		wallet.DecodeHTTPGetAccountReq,
-		wallet.EncodeJSONResponse,
-		serverErrcoder,
-	)
-	walletCreateHandler := httptransport.NewServer(
-		wallet.MakeWalletCreateEndpt(walletSvc),
-		wallet.DecodeHTTPCreateAccountReq,
-		wallet.EncodeJSONResponse,
-		serverErrcoder,
-	)
-	walletPaymentsIndexHandler := httptransport.NewServer(
-		wallet.MakePaymentsIndexEndpt(walletSvc),
-		wallet.DecodeHTTPListPaymentsReq,
-		wallet.EncodeJSONResponse,
-		serverErrcoder,
-	)
-	walletPostPaymentHandler := httptransport.NewServer(
-		wallet.MakePaymentsPostEndpt(walletSvc),
-		wallet.DecodeHTTPPostPaymentsReq,
-		wallet.EncodeJSONResponse,
-		serverErrcoder,
-	)
-	ledgerHandler := httptransport.NewServer(
-		wallet.MakeListTransfersEndpt(walletSvc),
-		wallet.DecodeHTTPListTransfersReq,
-		wallet.EncodeJSONResponse,
-		serverErrcoder,
-	)
-	r.Method("GET", "/wallets", walletsIndexHandler)
-	r.Method("POST", "/wallets", walletCreateHandler)
-	r.Method("GET", "/wallets/{id}", walletGetHandler)
-	r.Method("GET", "/wallets/{id}/payments", walletPaymentsIndexHandler)
-	r.Method("POST", "/wallets/{id}/payments", walletPostPaymentHandler)
-	r.Method("GET", "/transfers", ledgerHandler)
+	var apiHandler http.Handler = wallet.MakeLimitedHTTPHandler(walletSvc, limiter)
+	apiHandler = http.MaxBytesHandler(withDeadline(cfg.RequestTimeout, apiHandler), cfg.MaxBodyBytes)
+	if tracing {
+		apiHandler = wallet.HTTPTracing(tp)(apiHandler)
+	}
+	r.Mount("/", apiHandler)
+
+	httpServer := &http.Server{
+		Addr:              cfg.AddrPort,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	tls := cfg.TLSCertFile != ""
+
+	grpcOptns := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpcDeadline(cfg.RequestTimeout)),
+		grpc.StreamInterceptor(grpcStreamDeadline(cfg.RequestTimeout)),
+	}
+	if tls {
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("genwallet server start: TLS setup fail")
+		}
+		grpcOptns = append(grpcOptns, grpc.Creds(creds))
+	}
+	grpcServer := grpc.NewServer(grpcOptns...)
+	pb.RegisterWalletServer(grpcServer, wallet.NewLimitedGRPCServer(walletSvc, limiter))
 
 	// Interrupt
-	errc := make(chan error)
+	errc := make(chan error, 3)
 	go func() {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		errc <- fmt.Errorf("%s", <-c)
 	}()
@@ -103,10 +225,55 @@ func main() {
 	go func() {
 		logger.Info().
 			Str("transport", "HTTP").
-			Str("addr", httpAddr).
+			Str("addr", httpServer.Addr).
+			Bool("tls", tls).
 			Msg("genwallet server start")
-		errc <- http.ListenAndServe(httpAddr, r)
+		if tls {
+			errc <- httpServer.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			errc <- httpServer.ListenAndServe()
+		}
 	}()
+	if cfg.GRPCEnabled {
+		go func() {
+			lis, err := net.Listen("tcp", cfg.GRPCAddrPort)
+			if err != nil {
+				errc <- err
+				return
+			}
+			logger.Info().
+				Str("transport", "gRPC").
+				Str("addr", cfg.GRPCAddrPort).
+				Bool("tls", tls).
+				Msg("genwallet server start")
+			errc <- grpcServer.Serve(lis)
+		}()
+	}
 
 	logger.Err(<-errc).Msg("genwallet server exit")
+	stopBackground()
+
+	// requests in flight are waited for, up to the shutdown timeout
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Err(err).Msg("genwallet server exit: HTTP shutdown fail")
+	}
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+
+	// spans yet to be exported are flushed, for up to 5 seconds
+	tctx, tcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer tcancel()
+	if err := shutdownTracing(tctx); err != nil {
+		logger.Err(err).Msg("genwallet server exit: tracing shutdown fail")
+	}
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arhyth/genwallet/db"
+	"github.com/arhyth/genwallet/wallet"
+	"github.com/rs/zerolog"
+)
+
+const migrateUsage = "usage: genwallet migrate up|down|status|redo"
+
+// migrate runs the `genwallet migrate <cmd>` command
+func migrate(ctx context.Context, logger zerolog.Logger, out io.Writer, dsn string, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+	if dsn == wallet.MemoryDSN {
+		return errors.New("migrate: nothing to migrate for in-memory DB_URL")
+	}
+
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	mg := db.NewMigrator(conn)
+
+	switch args[0] {
+	case "up":
+		applied, err := mg.Up(ctx)
+		for _, m := range applied {
+			logger.Info().Int64("version", m.Version).Str("name", m.Name).Msg("migrate: applied")
+		}
+		if err == nil && len(applied) == 0 {
+			logger.Info().Msg("migrate: no pending migrations")
+		}
+		return err
+	case "down":
+		m, err := mg.Down(ctx)
+		if m != nil {
+			logger.Info().Int64("version", m.Version).Str("name", m.Name).Msg("migrate: rolled back")
+		}
+		if err == nil && m == nil {
+			logger.Info().Msg("migrate: no applied migrations")
+		}
+		return err
+	case "redo":
+		m, err := mg.Redo(ctx)
+		if m != nil {
+			logger.Info().Int64("version", m.Version).Str("name", m.Name).Msg("migrate: redone")
+		}
+		if err == nil && m == nil {
+			logger.Info().Msg("migrate: no applied migrations")
+		}
+		return err
+	case "status":
+		statuses, err := mg.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Applied At\tMigration")
+		for _, st := range statuses {
+			at := "Pending"
+			if st.AppliedAt != nil {
+				at = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%v\t%v\n", at, st.Name)
+		}
+		return tw.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// migrateOnStart applies pending migrations before the server starts serving.
+// Instances starting at the same time wait on each other's advisory lock.
+func migrateOnStart(ctx context.Context, logger zerolog.Logger, dsn string) error {
+	if dsn == wallet.MemoryDSN {
+		return nil
+	}
+
+	return migrate(ctx, logger, io.Discard, dsn, []string{"up"})
+}
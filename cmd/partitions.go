@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"time"
+
+	"github.com/arhyth/genwallet/wallet"
+	"github.com/rs/zerolog"
+)
+
+// maintainPartitions creates upcoming transfer partitions right away
+// and then every `interval` until `ctx` is done
+func maintainPartitions(ctx context.Context, logger zerolog.Logger, repo *wallet.Repo, interval time.Duration, ahead int) {
+	ensure := func() {
+		created, err := repo.EnsureTransferPartitions(ctx, time.Now(), ahead)
+		if err != nil {
+			logger.Err(err).Msg("genwallet partitions: create fail")
+			return
+		}
+		for _, name := range created {
+			logger.Info().Str("partition", name).Msg("genwallet partitions: created")
+		}
+	}
+
+	ensure()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ensure()
+		}
+	}
+}
+
+// archive runs the `genwallet archive -before YYYY-MM [-dir DIR]` command
+func archive(ctx context.Context, logger zerolog.Logger, errOut io.Writer, dsn string, args []string) error {
+	flags := flag.NewFlagSet("genwallet archive", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	before := flags.String("before", "", "archive the months before this one (YYYY-MM)")
+	dir := flags.String("dir", "archive", "directory to export archived transfers to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *before == "" {
+		flags.Usage()
+		return errors.New("archive: -before is required")
+	}
+	month, err := time.Parse("2006-01", *before)
+	if err != nil {
+		return errors.New("archive: -before should be of YYYY-MM format")
+	}
+	if dsn == wallet.MemoryDSN {
+		return errors.New("archive: nothing to archive for in-memory DB_URL")
+	}
+
+	repo, err := wallet.NewRepo(dsn)
+	if err != nil {
+		return err
+	}
+	defer repo.DB.Close()
+
+	archived, err := repo.ArchiveTransfers(ctx, month, *dir)
+	for _, a := range archived {
+		logger.Info().
+			Str("partition", a.Partition).
+			Str("file", a.File).
+			Int64("rows", a.Rows).
+			Msg("archive: archived")
+	}
+	if err == nil && len(archived) == 0 {
+		logger.Info().Msg("archive: nothing to archive")
+	}
+
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+type readinessResp struct {
+	Status            string   `json:"status"`
+	Error             string   `json:"error,omitempty"`
+	ReplicaLagSeconds *float64 `json:"replica_lag_seconds,omitempty"`
+	ReplicaError      string   `json:"replica_error,omitempty"`
+}
+
+// readinessHandler reports whether the primary database is reachable and
+// has the transfer partitions of this month and the next, along with the
+// replication lag of the replica if there is one. Payments fail without
+// their partition, so a missing one (e.g. as nothing maintains them) fails
+// readiness ahead of time. A lagging or unreachable replica does not fail
+// readiness since reads that cannot afford stale data can always go to the
+// primary.
+func readinessHandler(repo *wallet.Repo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		resp := readinessResp{Status: "ok"}
+		code := http.StatusOK
+		if err := repo.DB.PingContext(req.Context()); err != nil {
+			resp.Status = "unavailable"
+			resp.Error = err.Error()
+			code = http.StatusServiceUnavailable
+		} else if missing, err := repo.MissingTransferPartitions(req.Context(), time.Now(), 1); err != nil || len(missing) > 0 {
+			resp.Status = "unavailable"
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Error = "missing transfer partitions: " + strings.Join(missing, ", ")
+			}
+			code = http.StatusServiceUnavailable
+		}
+		if repo.Replica != nil {
+			lag, err := repo.ReplicationLag(req.Context())
+			if err != nil {
+				resp.ReplicaError = err.Error()
+			} else {
+				secs := lag.Seconds()
+				resp.ReplicaLagSeconds = &secs
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(resp)
+	})
+}
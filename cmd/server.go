@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+
+	"github.com/arhyth/genwallet/config"
+)
+
+// newLogger makes the logger of the config, which becomes
+// the global one as well for the packages logging to it
+func newLogger(cfg config.APIConfig) zerolog.Logger {
+	// validated already
+	level, _ := zerolog.ParseLevel(cfg.LogLevel)
+	logger := zerolog.New(os.Stderr)
+	if cfg.LogFormat == "console" {
+		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+	}
+	logger = logger.Level(level)
+	log.Logger = logger
+
+	return logger
+}
+
+// withDeadline sets the deadline of requests to `timeout` from their
+// start, if any, past which their statements are canceled
+func withDeadline(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// grpcDeadline is `withDeadline` for unary gRPC calls
+func grpcDeadline(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// grpcStreamDeadline is `grpcDeadline` for streaming gRPC calls, which
+// take as long as exports over HTTP do
+func grpcStreamDeadline(timeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if timeout <= 0 {
+			return handler(srv, ss)
+		}
+		ctx, cancel := context.WithTimeout(ss.Context(), timeout)
+		defer cancel()
+		return handler(srv, deadlineStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// deadlineStream is a `grpc.ServerStream` of the context with its deadline
+type deadlineStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s deadlineStream) Context() context.Context { return s.ctx }
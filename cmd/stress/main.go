@@ -0,0 +1,342 @@
+// Command stress fires random concurrent payments at a genwallet server
+// and then checks that no money was created or lost along the way:
+//   - the total balance of each currency is unchanged
+//   - no balance is negative
+//   - every committed payment is reflected exactly once, both in the
+//     ledger (`GET /transfers`) and in the balances
+//
+// Payments aborted due to contention (`concurrent_update`) are retried.
+//
+//	$ stress -url http://localhost:8000 -accounts 20 -payments 5000 -concurrency 32
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet"
+	"github.com/rs/zerolog"
+)
+
+type options struct {
+	baseURL string
+	// apiKey, if set, authenticates requests as of its tenant
+	apiKey      string
+	accounts    int
+	payments    int
+	concurrency int
+	currencies  []string
+	maxRetries  int
+	seed        int64
+	// runID prefixes the IDs of accounts created by the run
+	// so that runs can share a database
+	runID string
+}
+
+type report struct {
+	committed int
+	// rejected are payments refused for a legitimate reason,
+	// i.e. insufficient funds or currency mismatch
+	rejected  int
+	retries   int
+	failed    int
+	elapsed   time.Duration
+	violation []string
+}
+
+func main() {
+	logger := zerolog.New(os.Stderr)
+
+	var (
+		opts       options
+		currencies string
+	)
+	flag.StringVar(&opts.baseURL, "url", "http://localhost:8000", "base URL of the genwallet HTTP API")
+	flag.StringVar(&opts.apiKey, "api-key", "", "API key to authenticate with, if the server requires one")
+	flag.IntVar(&opts.accounts, "accounts", 20, "number of accounts to create")
+	flag.IntVar(&opts.payments, "payments", 5000, "number of payments to make")
+	flag.IntVar(&opts.concurrency, "concurrency", 32, "number of concurrent clients")
+	flag.StringVar(&currencies, "currencies", "USD,EUR", "comma separated currencies of the accounts")
+	flag.IntVar(&opts.maxRetries, "retries", 20, "max retries of a payment aborted due to contention")
+	flag.Int64Var(&opts.seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+	opts.currencies = strings.Split(currencies, ",")
+	opts.runID = fmt.Sprintf("stress-%x", rand.New(rand.NewSource(opts.seed)).Uint32())
+
+	rep, err := run(context.Background(), http.DefaultClient, opts)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("stress: run fail")
+	}
+
+	logger.Info().
+		Str("run", opts.runID).
+		Int64("seed", opts.seed).
+		Int("committed", rep.committed).
+		Int("rejected", rep.rejected).
+		Int("retries", rep.retries).
+		Int("failed", rep.failed).
+		Dur("elapsed", rep.elapsed).
+		Float64("payments_per_sec", float64(rep.committed)/rep.elapsed.Seconds()).
+		Msg("stress: done")
+	for _, v := range rep.violation {
+		logger.Error().Msg(v)
+	}
+	if len(rep.violation) > 0 || rep.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// client is a bare client of the wallet HTTP API
+type client struct {
+	http    *http.Client
+	baseURL string
+	apiKey  string
+}
+
+// problemError is an error response of the API
+type problemError struct {
+	status int
+	prob   errorrrs.Problem
+}
+
+func (pe *problemError) Error() string {
+	return fmt.Sprintf("%d %v: %v", pe.status, pe.prob.Code, pe.prob.Detail)
+}
+
+func (c *client) do(ctx context.Context, method, path string, body, resp interface{}) error {
+	var rdr io.Reader
+	if body != nil {
+		bits, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rdr = bytes.NewReader(bits)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, rdr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set(wallet.AuthorizationHeader, "Bearer "+c.apiKey)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		pe := &problemError{status: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(&pe.prob); err != nil {
+			return fmt.Errorf("%d: undecodable error response: %w", res.StatusCode, err)
+		}
+		return pe
+	}
+
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+func problemCode(err error) errorrrs.Code {
+	var pe *problemError
+	if errors.As(err, &pe) {
+		return pe.prob.Code
+	}
+	return ""
+}
+
+// payment is a committed payment
+type payment struct {
+	from, to string
+	amount   float64
+}
+
+func run(ctx context.Context, hc *http.Client, opts options) (report, error) {
+	var rep report
+	c := &client{http: hc, baseURL: strings.TrimSuffix(opts.baseURL, "/"), apiKey: opts.apiKey}
+	rnd := rand.New(rand.NewSource(opts.seed))
+
+	// Setup. Balances are whole numbers and payments whole amounts so that
+	// sums are exact, even as the float32 the database stores them as.
+	initial := map[string]wallet.Account{}
+	var ids []string
+	for i := 0; i < opts.accounts; i++ {
+		req := wallet.CreateAccountRequest{
+			ID:       fmt.Sprintf("%v-%03d", opts.runID, i),
+			InitAmt:  float64(100 + rnd.Intn(900)),
+			Currency: opts.currencies[i%len(opts.currencies)],
+		}
+		var acct wallet.Account
+		if err := c.do(ctx, "POST", "/wallets", req, &acct); err != nil {
+			return rep, fmt.Errorf("create account %v: %w", req.ID, err)
+		}
+		initial[acct.ID] = acct
+		ids = append(ids, acct.ID)
+	}
+
+	// Load. Payment requests are generated upfront so that a run
+	// is reproducible (up to scheduling) from its seed.
+	reqs := make(chan wallet.CreatePaymentRequest, opts.payments)
+	for i := 0; i < opts.payments; i++ {
+		from := ids[rnd.Intn(len(ids))]
+		to := ids[rnd.Intn(len(ids))]
+		for to == from {
+			to = ids[rnd.Intn(len(ids))]
+		}
+		reqs <- wallet.CreatePaymentRequest{Self: from, To: to, Amount: float64(1 + rnd.Intn(50))}
+	}
+	close(reqs)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		committed []payment
+	)
+	start := time.Now()
+	for w := 0; w < opts.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range reqs {
+				res, retries, err := pay(ctx, c, req, opts.maxRetries)
+
+				mu.Lock()
+				rep.retries += retries
+				switch code := problemCode(err); {
+				case err == nil:
+					committed = append(committed, payment{from: req.Self, to: *res.To, amount: res.Amount})
+				case code == errorrrs.CodeInsufficientFunds || code == errorrrs.CodeCurrencyMismatch:
+					rep.rejected++
+				default:
+					// Neither of these should happen. Transport errors leave the
+					// outcome unknown so the checks below may flag them too.
+					rep.failed++
+					rep.violation = append(rep.violation, fmt.Sprintf("payment %v -> %v: %v", req.Self, req.To, err))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	rep.elapsed = time.Since(start)
+	rep.committed = len(committed)
+
+	violations, err := verify(ctx, c, initial, committed)
+	if err != nil {
+		return rep, err
+	}
+	rep.violation = append(rep.violation, violations...)
+
+	return rep, nil
+}
+
+// pay makes a payment, retrying it while aborted due to contention
+func pay(ctx context.Context, c *client, req wallet.CreatePaymentRequest, maxRetries int) (wallet.Payment, int, error) {
+	var (
+		res wallet.Payment
+		err error
+	)
+	path := fmt.Sprintf("/wallets/%v/payments", req.Self)
+	body := struct {
+		To     string  `json:"to_account"`
+		Amount float64 `json:"amount"`
+	}{req.To, req.Amount}
+	for retry := 0; ; retry++ {
+		err = c.do(ctx, "POST", path, body, &res)
+		if problemCode(err) != errorrrs.CodeConcurrentUpdate || retry == maxRetries {
+			return res, retry, err
+		}
+		// jittered exponential backoff (capped at 64ms)
+		// so that contending payments spread out
+		backoff := 1 << uint(retry)
+		if retry > 6 {
+			backoff = 1 << 6
+		}
+		time.Sleep(time.Duration(rand.Intn(backoff)) * time.Millisecond)
+	}
+}
+
+// verify checks the final state of the accounts against their `initial`
+// state and the `committed` payments, returning every violation found
+func verify(ctx context.Context, c *client, initial map[string]wallet.Account, committed []payment) ([]string, error) {
+	var violations []string
+
+	expected := map[string]float64{}
+	for id, acct := range initial {
+		expected[id] = acct.Balance
+	}
+	for _, p := range committed {
+		expected[p.from] -= p.amount
+		expected[p.to] += p.amount
+	}
+
+	totalBefore := map[string]float64{}
+	totalAfter := map[string]float64{}
+	for id, acct := range initial {
+		var final wallet.Account
+		if err := c.do(ctx, "GET", "/wallets/"+id, nil, &final); err != nil {
+			return nil, fmt.Errorf("get account %v: %w", id, err)
+		}
+		totalBefore[acct.Currency] += acct.Balance
+		totalAfter[final.Currency] += final.Balance
+
+		if final.Balance < 0 {
+			violations = append(violations, fmt.Sprintf("account %v: negative balance %v", id, final.Balance))
+		}
+		if final.Balance != expected[id] {
+			violations = append(violations, fmt.Sprintf("account %v: balance %v, expected %v from committed payments",
+				id, final.Balance, expected[id]))
+		}
+	}
+	for cur, before := range totalBefore {
+		if after := totalAfter[cur]; after != before {
+			violations = append(violations, fmt.Sprintf("%v: total balance %v, was %v", cur, after, before))
+		}
+	}
+
+	// Every committed payment must be in the ledger exactly once
+	// and the ledger must hold nothing else of the run's accounts.
+	// Transfers are listed by payer which, in the run, is always one
+	// of the run's accounts.
+	count := map[payment]int{}
+	for _, p := range committed {
+		count[p]++
+	}
+	for id := range initial {
+		var transfers []wallet.Transfer
+		if err := c.do(ctx, "GET", "/transfers?from="+id, nil, &transfers); err != nil {
+			return nil, fmt.Errorf("list transfers from %v: %w", id, err)
+		}
+		for _, t := range transfers {
+			count[payment{from: t.From, to: t.To, amount: t.Amount}]--
+		}
+	}
+	var mismatched []string
+	for p, n := range count {
+		switch {
+		case n > 0:
+			mismatched = append(mismatched, fmt.Sprintf("payment %v -> %v of %v: committed but missing %d times from ledger",
+				p.from, p.to, p.amount, n))
+		case n < 0:
+			mismatched = append(mismatched, fmt.Sprintf("payment %v -> %v of %v: in ledger %d more times than committed",
+				p.from, p.to, p.amount, -n))
+		}
+	}
+	sort.Strings(mismatched)
+
+	return append(violations, mismatched...), nil
+}
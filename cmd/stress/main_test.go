@@ -0,0 +1,55 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/config"
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// TestStress runs the harness through the full HTTP stack
+// against the Postgres database at `DB_URL`
+func TestStress(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+
+	cfg, err := config.GetAPIConfig()
+	reqrd.Nil(err)
+	repo, err := wallet.NewRepo(cfg.DBConnStr)
+	reqrd.Nil(err)
+
+	walletSvc := &wallet.ValidationMiddleware{
+		Next: &wallet.ServiceImpl{
+			Repo: repo,
+		},
+	}
+	srv := httptest.NewServer(wallet.MakeHTTPHandler(walletSvc))
+	defer srv.Close()
+
+	seed := time.Now().UnixNano()
+	rep, err := run(context.Background(), srv.Client(), options{
+		baseURL:     srv.URL,
+		accounts:    10,
+		payments:    2000,
+		concurrency: 16,
+		currencies:  []string{"USD", "EUR"},
+		maxRetries:  50,
+		seed:        seed,
+		runID:       "stress-test-" + time.Now().Format("150405.000000"),
+	})
+	reqrd.Nil(err)
+
+	t.Logf("seed %d: %d committed, %d rejected, %d retries in %v",
+		seed, rep.committed, rep.rejected, rep.retries, rep.elapsed)
+	as.Zero(rep.failed)
+	as.Empty(rep.violation)
+	as.NotZero(rep.committed)
+}
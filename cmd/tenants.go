@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os/user"
+	"strings"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+const (
+	tenantUsage = "usage: genwallet tenant create -id ID -name NAME [-currencies USD,EUR] [-max-transfer AMOUNT]"
+	apikeyUsage = "usage: genwallet apikey create -tenant ID [-admin] | genwallet apikey revoke -id KEY_ID"
+)
+
+// tenant runs the `genwallet tenant create` command
+func tenant(ctx context.Context, out, errOut io.Writer, dsn string, args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return errors.New(tenantUsage)
+	}
+	flags := flag.NewFlagSet("genwallet tenant create", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	id := flags.String("id", "", "tenant ID")
+	name := flags.String("name", "", "tenant name")
+	currencies := flags.String("currencies", "", "comma separated currencies its accounts can be opened in (default any)")
+	maxTransfer := flags.Float64("max-transfer", 0, "maximum amount of single payments (default none)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	t := wallet.Tenant{ID: *id, Name: *name, MaxTransferAmount: *maxTransfer}
+	if *currencies != "" {
+		t.Currencies = strings.Split(*currencies, ",")
+	}
+	t = wallet.NormalizeTenant(t)
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("tenant: %w", err)
+	}
+
+	tenants, closeRepo, err := openTenants(dsn)
+	if err != nil {
+		return err
+	}
+	defer closeRepo()
+	ctx = wallet.WithActor(ctx, cliActor())
+
+	t, err = tenants.CreateTenant(ctx, t)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "created tenant %v\n", t.ID)
+
+	return nil
+}
+
+// apikey runs the `genwallet apikey create|revoke` command. Created keys
+// are printed once; only their hash is stored.
+func apikey(ctx context.Context, out, errOut io.Writer, dsn string, args []string) error {
+	if len(args) == 0 || (args[0] != "create" && args[0] != "revoke") {
+		return errors.New(apikeyUsage)
+	}
+	flags := flag.NewFlagSet("genwallet apikey "+args[0], flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	tenantID := flags.String("tenant", "", "tenant of the key to create")
+	admin := flags.Bool("admin", false, "create an admin key, which may also adjust balances, freeze accounts and reconcile")
+	keyID := flags.String("id", "", "ID of the key to revoke")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	tenants, closeRepo, err := openTenants(dsn)
+	if err != nil {
+		return err
+	}
+	defer closeRepo()
+	ctx = wallet.WithActor(ctx, cliActor())
+
+	switch args[0] {
+	case "create":
+		if *tenantID == "" {
+			return errors.New(apikeyUsage)
+		}
+		key, err := tenants.CreateAPIKey(ctx, wallet.APIKey{TenantID: *tenantID, Admin: *admin})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "id:  %v\nkey: %v\n", key.ID, key.Key)
+	default:
+		if *keyID == "" {
+			return errors.New(apikeyUsage)
+		}
+		if err := tenants.RevokeAPIKey(ctx, *keyID); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "revoked API key %v\n", *keyID)
+	}
+
+	return nil
+}
+
+// openTenants opens the tenants of the (Postgres) repository at `dsn`;
+// tenants of an in-memory one would be gone as soon as the command exits
+func openTenants(dsn string) (wallet.Tenants, func(), error) {
+	if dsn == wallet.MemoryDSN {
+		return nil, nil, errors.New("tenants cannot be managed for in-memory DB_URL")
+	}
+	repo, err := wallet.NewRepo(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return repo, func() { repo.DB.Close() }, nil
+}
+
+// cliActor is the actor that commands are audited as, after the OS user
+// running them since they go without an API key
+func cliActor() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return "cli:" + name
+}
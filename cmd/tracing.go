@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerProvider makes the tracer provider exporting to `exporter` (see
+// `config.APIConfig.TracingExporter`), along with its shutdown func which
+// flushes the spans yet to be exported. Spans of `none` go nowhere.
+func tracerProvider(ctx context.Context, exporter string, sampleRatio float64) (trace.TracerProvider, func(context.Context) error, error) {
+	var (
+		exp sdktrace.SpanExporter
+		err error
+	)
+	switch exporter {
+	case "none":
+		return trace.NewNoopTracerProvider(), func(context.Context) error { return nil }, nil
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		// the endpoint and such are of the standard `OTEL_EXPORTER_OTLP_*`
+		exp, err = otlptracegrpc.New(ctx)
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter %q: should be one of `none`, `stdout`, `otlp`", exporter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// `OTEL_SERVICE_NAME` and `OTEL_RESOURCE_ATTRIBUTES` take precedence
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("genwallet")),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+
+	return tp, tp.Shutdown, nil
+}
@@ -1,19 +1,121 @@
+// Package config is the configuration of the genwallet server. Each setting
+// has an environment variable, a key of the same name in lower case in YAML
+// config files and a flag of the same name in lower case with dashes, e.g.
+// `DB_MAX_OPEN_CONNS`, `db_max_open_conns` and `-db-max-open-conns`.
+//
+// Settings are taken from, in increasing order of precedence, their defaults,
+// the config file (at `-config` or `CONFIG_FILE`), the environment and flags.
 package config
 
 import (
-	"github.com/kelseyhightower/envconfig"
+	"time"
 )
 
 type APIConfig struct {
-	AddrPort  string `endconfig:"ADDR_PORT" default:":8000"`
-	DBConnStr string `envconfig:"DB_URL" required:"true"`
+	// Server
+
+	AddrPort    string `env:"ADDR_PORT" default:":8000" desc:"address:port the HTTP API listens at"`
+	GRPCEnabled bool   `env:"GRPC_ENABLED" default:"true" desc:"serve the gRPC API"`
+	// GRPCAddrPort is ignored unless GRPCEnabled
+	GRPCAddrPort string `env:"GRPC_ADDR_PORT" default:":8001" desc:"address:port the gRPC API listens at"`
+	// TLSCertFile and TLSKeyFile are PEM files of both APIs,
+	// which are served without TLS unless both are set
+	TLSCertFile string `env:"TLS_CERT_FILE" desc:"PEM certificate (chain) file to serve TLS with, along with TLS_KEY_FILE"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE" desc:"PEM private key file of TLS_CERT_FILE"`
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are those
+	// of the HTTP server; 0 is none. Exports stream their responses for as
+	// long as they take so writes are not timed out by default.
+	ReadHeaderTimeout time.Duration `env:"READ_HEADER_TIMEOUT" default:"5s" desc:"time to read request headers in"`
+	ReadTimeout       time.Duration `env:"READ_TIMEOUT" default:"30s" desc:"time to read whole requests in"`
+	WriteTimeout      time.Duration `env:"WRITE_TIMEOUT" default:"0s" desc:"time to write responses in, 0 for none"`
+	IdleTimeout       time.Duration `env:"IDLE_TIMEOUT" default:"2m" desc:"time keep-alive connections are kept idle for"`
+	// RequestTimeout is the deadline of API requests, past which their
+	// statements are canceled; 0 is none
+	RequestTimeout time.Duration `env:"REQUEST_TIMEOUT" default:"0s" desc:"deadline of API requests, 0 for none"`
+	// ShutdownTimeout is how long requests in flight are waited for on exit
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"15s" desc:"time requests in flight are waited for on exit"`
+	MaxBodyBytes    int64         `env:"MAX_BODY_BYTES" default:"1048576" desc:"size limit of request bodies"`
+
+	// Database
+
+	DBConnStr string `env:"DB_URL" secret:"true" desc:"postgres connection string, or memory:// (required)"`
+	// DBReplicaConnStr is of an optional read replica of `DB_URL`
+	DBReplicaConnStr string `env:"DB_REPLICA_URL" secret:"true" desc:"postgres connection string of a read replica of DB_URL"`
+	// DBMaxOpenConns, DBMaxIdleConns, DBConnMaxLifetime and DBConnMaxIdleTime
+	// size the connection pools of `DB_URL` and `DB_REPLICA_URL` each
+	DBMaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" default:"32" desc:"connections open at most, 0 for no limit"`
+	DBMaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" default:"8" desc:"idle connections kept at most"`
+	DBConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" default:"30m" desc:"time connections are reused for, 0 for ever"`
+	DBConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" default:"5m" desc:"time connections are kept idle for, 0 for ever"`
+	// TransferStrategy is one of `serializable`, `rowlock`
+	TransferStrategy string `env:"TRANSFER_STRATEGY" default:"serializable" desc:"serializable or rowlock"`
+	// ContentionRetries is how many times the server retries payments
+	// aborted by concurrent ones (after ContentionBackoff, doubling up
+	// to a second) before failing them with `concurrent_update`
+	ContentionRetries int           `env:"CONTENTION_RETRIES" default:"0" desc:"server side retries of payments aborted by concurrent ones"`
+	ContentionBackoff time.Duration `env:"CONTENTION_BACKOFF" default:"10ms" desc:"wait before the first retry of CONTENTION_RETRIES, doubling up to 1s"`
+	// MigrateOnStart applies pending migrations before serving
+	MigrateOnStart bool `env:"MIGRATE_ON_START" default:"false" desc:"apply pending migrations before serving"`
+	// MaintainPartitions keeps transfer partitions created ahead,
+	// which may be left to a single instance
+	MaintainPartitions bool `env:"MAINTAIN_PARTITIONS" default:"true" desc:"keep transfer partitions created ahead"`
+	// PartitionsAhead is how many months of transfer partitions
+	// are kept created ahead of the current one
+	PartitionsAhead int `env:"PARTITIONS_AHEAD" default:"3" desc:"months of transfer partitions created ahead"`
+	// PartitionInterval is how often upcoming partitions are checked
+	PartitionInterval time.Duration `env:"PARTITION_INTERVAL" default:"6h" desc:"how often upcoming transfer partitions are checked"`
+
+	// AuthRequired refuses requests without an API key. Otherwise they are
+	// served as of the default tenant, which only suits single tenant
+	// deployments, so it has to be turned off explicitly.
+	AuthRequired bool `env:"AUTH_REQUIRED" default:"true" desc:"refuse requests without an API key"`
+
+	// LedgerChainInterval is how often booked transfers are chained onto
+	// the ledgers of their tenants, which proofs of them wait for
+	LedgerChainInterval time.Duration `env:"LEDGER_CHAIN_INTERVAL" default:"1s" desc:"how often booked transfers are chained onto the ledgers"`
+	// LedgerSigningKey is the base64 encoded Ed25519 seed that ledger
+	// checkpoints are signed with; none are taken without one
+	LedgerSigningKey string `env:"LEDGER_SIGNING_KEY" secret:"true" desc:"base64 Ed25519 seed ledger checkpoints are signed with"`
+	// LedgerCheckpointInterval is how often ledger checkpoints are taken
+	LedgerCheckpointInterval time.Duration `env:"LEDGER_CHECKPOINT_INTERVAL" default:"1h" desc:"how often ledgers that moved are checkpointed"`
+
+	// Limits
+
+	// RateLimitPerKey is how many requests per second each API key (or
+	// source IP, without one known to be valid) may make, in bursts of up to RateLimitKeyBurst;
+	// 0 does not limit them
+	RateLimitPerKey   float64 `env:"RATE_LIMIT_PER_KEY" default:"100" desc:"requests per second of each API key, 0 for no limit"`
+	RateLimitKeyBurst int     `env:"RATE_LIMIT_KEY_BURST" default:"200" desc:"bursts of requests of each API key"`
+	// RateLimitPerAccount is how many payments per second each API key may
+	// make from the same account, in bursts of up to RateLimitAccountBurst;
+	// 0 does not limit them
+	RateLimitPerAccount   float64 `env:"RATE_LIMIT_PER_ACCOUNT" default:"20" desc:"payments per second from each wallet of each API key, 0 for no limit"`
+	RateLimitAccountBurst int     `env:"RATE_LIMIT_ACCOUNT_BURST" default:"40" desc:"bursts of payments from each wallet of each API key"`
+	// MaxInFlightPayments is how many payments may be in flight at once,
+	// beyond which they are shed with `503`; 0 does not cap them
+	MaxInFlightPayments int `env:"MAX_INFLIGHT_PAYMENTS" default:"64" desc:"payments in flight at once, 0 for no cap"`
+
+	// Observability
+
+	// LogLevel is one of `debug`, `info`, `warn`, `error`
+	LogLevel string `env:"LOG_LEVEL" default:"info" desc:"debug, info, warn or error"`
+	// LogFormat is `json`, or `console` for humans
+	LogFormat string `env:"LOG_FORMAT" default:"json" desc:"json or console"`
+	// TracingExporter is where OpenTelemetry spans are exported to, one of
+	// `none`, `stdout`, `otlp` (configured by the standard `OTEL_EXPORTER_OTLP_*`)
+	TracingExporter string `env:"TRACING_EXPORTER" default:"none" desc:"none, stdout or otlp"`
+	// TracingSampleRatio is the ratio of traces sampled, unless their
+	// parent (of a `traceparent` header) says otherwise
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" default:"1" desc:"ratio of traces sampled, from 0 to 1"`
 }
 
+// GetAPIConfig loads the config of the environment (and of its
+// `CONFIG_FILE`, if any) and validates it, for want of flags
 func GetAPIConfig() (APIConfig, error) {
-	var cfg APIConfig
-	if err := envconfig.Process("", &cfg); err != nil {
+	cfg, _, err := Load(nil)
+	if err != nil {
 		return cfg, err
 	}
 
-	return cfg, nil
+	return cfg, cfg.Validate()
 }
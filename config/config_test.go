@@ -0,0 +1,161 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/config"
+)
+
+// writeFile writes a config file of `content` to a temporary directory
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "genwallet.yaml")
+	require.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	// empty variables are taken as unset
+	for _, env := range []string{"CONFIG_FILE", "ADDR_PORT", "GRPC_ENABLED", "DB_URL", "DB_MAX_OPEN_CONNS", "LOG_LEVEL", "SHUTDOWN_TIMEOUT"} {
+		t.Setenv(env, "")
+	}
+
+	t.Run("defaults", func(tt *testing.T) {
+		as := assert.New(tt)
+		cfg, args, err := config.Load(nil)
+		as.Nil(err)
+		as.Empty(args)
+		as.Equal(":8000", cfg.AddrPort)
+		as.True(cfg.GRPCEnabled)
+		as.Equal(32, cfg.DBMaxOpenConns)
+		as.Equal(15*time.Second, cfg.ShutdownTimeout)
+		as.Equal(float64(1), cfg.TracingSampleRatio)
+		as.Equal("info", cfg.LogLevel)
+		as.True(cfg.AuthRequired)
+	})
+
+	t.Run("precedence", func(tt *testing.T) {
+		as := assert.New(tt)
+		path := writeFile(tt, `
+addr_port: ":1"
+db_max_open_conns: 10
+log_level: debug
+grpc_enabled: false
+shutdown_timeout: 1m
+`)
+		tt.Setenv("ADDR_PORT", ":2")
+		tt.Setenv("DB_MAX_OPEN_CONNS", "20")
+
+		cfg, args, err := config.Load([]string{"-config", path, "-addr-port", ":3", "-auth-required=false", "migrate", "up"})
+		as.Nil(err)
+		as.Equal([]string{"migrate", "up"}, args)
+		// flags over the environment over the file over defaults
+		as.Equal(":3", cfg.AddrPort)
+		as.Equal(20, cfg.DBMaxOpenConns)
+		as.Equal("debug", cfg.LogLevel)
+		as.False(cfg.GRPCEnabled)
+		as.Equal(time.Minute, cfg.ShutdownTimeout)
+		as.False(cfg.AuthRequired)
+		as.Equal(8, cfg.DBMaxIdleConns)
+	})
+
+	t.Run("config file of the environment", func(tt *testing.T) {
+		as := assert.New(tt)
+		tt.Setenv("CONFIG_FILE", writeFile(tt, "addr_port: \":4\"\n"))
+		cfg, _, err := config.Load(nil)
+		as.Nil(err)
+		as.Equal(":4", cfg.AddrPort)
+	})
+
+	t.Run("empty config file", func(tt *testing.T) {
+		_, _, err := config.Load([]string{"-config", writeFile(tt, "")})
+		assert.Nil(tt, err)
+	})
+
+	t.Run("unknown setting", func(tt *testing.T) {
+		_, _, err := config.Load([]string{"-config", writeFile(tt, "adr_port: \":1\"\n")})
+		assert.ErrorContains(tt, err, `unknown setting "adr_port"`)
+	})
+
+	t.Run("bad values", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, _, err := config.Load([]string{"-config", writeFile(tt, "db_max_open_conns: lots\n")})
+		as.ErrorContains(err, "db_max_open_conns")
+
+		tt.Setenv("SHUTDOWN_TIMEOUT", "15")
+		_, _, err = config.Load(nil)
+		as.ErrorContains(err, "SHUTDOWN_TIMEOUT")
+		tt.Setenv("SHUTDOWN_TIMEOUT", "")
+
+		_, _, err = config.Load([]string{"-grpc-enabled=maybe"})
+		as.Error(err)
+	})
+}
+
+// valid is a valid config
+func valid(t *testing.T) config.APIConfig {
+	cfg, _, err := config.Load([]string{"-db-url", "memory://"})
+	require.Nil(t, err)
+	require.Nil(t, cfg.Validate())
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	as := assert.New(t)
+	t.Setenv("CONFIG_FILE", "")
+
+	cfg := valid(t)
+	cfg.DBConnStr = ""
+	cfg.TLSCertFile = "cert.pem"
+	cfg.DBMaxIdleConns = 64
+	cfg.LogLevel = "loud"
+	cfg.TracingSampleRatio = 2
+	cfg.ReadTimeout = -time.Second
+	err := cfg.Validate()
+	as.ErrorContains(err, "DB_URL is required")
+	as.ErrorContains(err, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	as.ErrorContains(err, "DB_MAX_IDLE_CONNS (64) must not exceed DB_MAX_OPEN_CONNS (32)")
+	as.ErrorContains(err, `LOG_LEVEL must be one of debug, info, warn, error, not "loud"`)
+	as.ErrorContains(err, "TRACING_SAMPLE_RATIO must be from 0 to 1")
+	as.ErrorContains(err, "READ_TIMEOUT must not be negative")
+
+	// limits of 0 are none, which need no bursts
+	cfg = valid(t)
+	cfg.RateLimitPerKey, cfg.RateLimitKeyBurst = 0, 0
+	cfg.DBMaxOpenConns = 0
+	as.Nil(cfg.Validate())
+}
+
+func TestPrint(t *testing.T) {
+	as := assert.New(t)
+	t.Setenv("CONFIG_FILE", "")
+
+	cfg := valid(t)
+	cfg.DBConnStr = "postgres://genwallet:hunter2@db:5432/genwallet?sslmode=disable"
+	cfg.DBReplicaConnStr = "host=replica password=hunter2"
+	cfg.LedgerSigningKey = "c2VjcmV0"
+	cfg.AddrPort = ":9000"
+	var buf bytes.Buffer
+	as.Nil(cfg.Print(&buf))
+
+	out := buf.String()
+	as.NotContains(out, "hunter2")
+	as.NotContains(out, "c2VjcmV0")
+	as.Contains(out, "db_url: postgres://genwallet:xxxxx@db:5432/genwallet?sslmode=disable\n")
+	as.Contains(out, "db_replica_url: xxxxx\n")
+	as.Contains(out, "shutdown_timeout: 15s\n")
+	as.Contains(out, "# address:port the HTTP API listens at\n")
+
+	// which is a config file of the same config, but for secrets
+	printed, _, err := config.Load([]string{"-config", writeFile(t, out)})
+	as.Nil(err)
+	printed.DBConnStr, printed.DBReplicaConnStr, printed.LedgerSigningKey =
+		cfg.DBConnStr, cfg.DBReplicaConnStr, cfg.LedgerSigningKey
+	as.Equal(cfg, printed)
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a field of `APIConfig`, of its struct tags
+type setting struct {
+	index  int
+	env    string
+	def    string
+	desc   string
+	secret bool
+}
+
+// key is the key of the setting in config files
+func (s setting) key() string {
+	return strings.ToLower(s.env)
+}
+
+// flag is the name of the flag of the setting
+func (s setting) flag() string {
+	return strings.ReplaceAll(s.key(), "_", "-")
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	settings     = settingsOf(reflect.TypeOf(APIConfig{}))
+)
+
+func settingsOf(typ reflect.Type) []setting {
+	ss := make([]setting, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag
+		ss = append(ss, setting{
+			index:  i,
+			env:    tag.Get("env"),
+			def:    tag.Get("default"),
+			desc:   tag.Get("desc"),
+			secret: tag.Get("secret") == "true",
+		})
+	}
+	return ss
+}
+
+// Load loads the config of, in increasing order of precedence, the defaults,
+// the config file at the `-config` flag (or `CONFIG_FILE`), the environment
+// and the flags of `args`. Flags end at the first argument that is not one,
+// which is where the rest of `args` returned start, e.g. at a subcommand.
+// The config is not validated, see `Validate`.
+func Load(args []string) (APIConfig, []string, error) {
+	var cfg APIConfig
+	v := reflect.ValueOf(&cfg).Elem()
+	for _, s := range settings {
+		if s.def == "" {
+			continue
+		}
+		if err := set(v.Field(s.index), s.def); err != nil {
+			return cfg, nil, fmt.Errorf("default of %s: %w", s.env, err)
+		}
+	}
+
+	// flags are parsed first for the config file but applied last
+	flags := flag.NewFlagSet("genwallet", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML config file (env CONFIG_FILE)")
+	flagged := map[int]string{}
+	for _, s := range settings {
+		typ := v.Field(s.index).Type()
+		def := s.def
+		// zero values go without saying in usages
+		if def == format(reflect.New(typ).Elem()) {
+			def = ""
+		}
+		flags.Var(&flagValue{
+			typ:     typ,
+			def:     def,
+			index:   s.index,
+			flagged: flagged,
+		}, s.flag(), s.desc+" (env "+s.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if *path != "" {
+		if err := loadFile(v, *path); err != nil {
+			return cfg, nil, err
+		}
+	}
+	for _, s := range settings {
+		// empty variables are taken as unset, as compose files tend to leave them
+		val := os.Getenv(s.env)
+		if val == "" {
+			continue
+		}
+		if err := set(v.Field(s.index), val); err != nil {
+			return cfg, nil, fmt.Errorf("env %s: %w", s.env, err)
+		}
+	}
+	for _, s := range settings {
+		if val, ok := flagged[s.index]; ok {
+			// parsed already
+			_ = set(v.Field(s.index), val)
+		}
+	}
+
+	return cfg, flags.Args(), nil
+}
+
+// loadFile loads the YAML config file at `path` into `v`. Its keys are
+// those of the settings, of which it may have any, but no others.
+func loadFile(v reflect.Value, path string) error {
+	bits, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	var doc map[string]yaml.Node
+	if err := yaml.Unmarshal(bits, &doc); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key()] = s
+	}
+	for key, node := range doc {
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("config file %s: line %d: unknown setting %q", path, node.Line, key)
+		}
+		if node.Kind != yaml.ScalarNode {
+			return fmt.Errorf("config file %s: line %d: %s: not a scalar", path, node.Line, key)
+		}
+		if err := set(v.Field(s.index), node.Value); err != nil {
+			return fmt.Errorf("config file %s: line %d: %s: %w", path, node.Line, key, err)
+		}
+	}
+
+	return nil
+}
+
+// set parses `val` into `field`, of one of the kinds of settings
+func set(field reflect.Value, val string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(val)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", val)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", val)
+		}
+		field.SetInt(i)
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", val)
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting of type %s", field.Type())
+	}
+	return nil
+}
+
+// format is the inverse of `set`
+func format(field reflect.Value) string {
+	switch {
+	case field.Type() == durationType:
+		return time.Duration(field.Int()).String()
+	case field.Kind() == reflect.Bool:
+		return strconv.FormatBool(field.Bool())
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10)
+	case field.Kind() == reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'g', -1, 64)
+	default:
+		return field.String()
+	}
+}
+
+// flagValue is the flag of a setting, which records the values it is set
+// to in `flagged`, once checked, for them to be applied after the others
+type flagValue struct {
+	typ     reflect.Type
+	def     string
+	index   int
+	flagged map[int]string
+}
+
+func (fv *flagValue) String() string {
+	if fv == nil || fv.flagged == nil {
+		return ""
+	}
+	if val, ok := fv.flagged[fv.index]; ok {
+		return val
+	}
+	return fv.def
+}
+
+func (fv *flagValue) Set(val string) error {
+	if err := set(reflect.New(fv.typ).Elem(), val); err != nil {
+		return err
+	}
+	fv.flagged[fv.index] = val
+	return nil
+}
+
+func (fv *flagValue) IsBoolFlag() bool {
+	return fv.typ.Kind() == reflect.Bool
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted is what secrets are printed as
+const redacted = "xxxxx"
+
+// Print writes the config to `w` as a YAML config file, along with the
+// description of each setting. Secrets are redacted: passwords of URLs,
+// and whole values otherwise.
+func (cfg APIConfig) Print(w io.Writer) error {
+	v := reflect.ValueOf(cfg)
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range settings {
+		field := v.Field(s.index)
+		val, tag := format(field), "!!str"
+		switch {
+		case s.secret && val != "":
+			val = redact(val)
+		case field.Type() == durationType:
+		case field.Kind() == reflect.Bool:
+			tag = "!!bool"
+		case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+			tag = "!!int"
+		case field.Kind() == reflect.Float64:
+			tag = "!!float"
+		}
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: s.key(), HeadComment: s.desc},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: val},
+		)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// redact redacts the secret `val`, which is left recognizable if it is a
+// URL, e.g. `postgres://genwallet:xxxxx@db:5432/genwallet`
+func redact(val string) string {
+	u, err := url.Parse(val)
+	if err != nil || u.Scheme == "" || u.Opaque != "" {
+		return redacted
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", redacted)
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
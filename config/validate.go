@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate checks the config for settings that are missing, out of range or
+// at odds with each other, reporting all of them at once
+func (cfg APIConfig) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	oneOf := func(env, val string, vals ...string) {
+		for _, v := range vals {
+			if val == v {
+				return
+			}
+		}
+		problem("%s must be one of %s, not %q", env, strings.Join(vals, ", "), val)
+	}
+
+	if cfg.AddrPort == "" {
+		problem("ADDR_PORT is required")
+	}
+	if cfg.GRPCEnabled && cfg.GRPCAddrPort == "" {
+		problem("GRPC_ADDR_PORT is required unless GRPC_ENABLED is false")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		problem("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	for _, n := range []struct {
+		env string
+		val int64
+	}{
+		{"READ_HEADER_TIMEOUT", int64(cfg.ReadHeaderTimeout)},
+		{"READ_TIMEOUT", int64(cfg.ReadTimeout)},
+		{"WRITE_TIMEOUT", int64(cfg.WriteTimeout)},
+		{"IDLE_TIMEOUT", int64(cfg.IdleTimeout)},
+		{"REQUEST_TIMEOUT", int64(cfg.RequestTimeout)},
+		{"SHUTDOWN_TIMEOUT", int64(cfg.ShutdownTimeout)},
+		{"DB_MAX_OPEN_CONNS", int64(cfg.DBMaxOpenConns)},
+		{"DB_MAX_IDLE_CONNS", int64(cfg.DBMaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", int64(cfg.DBConnMaxLifetime)},
+		{"DB_CONN_MAX_IDLE_TIME", int64(cfg.DBConnMaxIdleTime)},
+		{"CONTENTION_RETRIES", int64(cfg.ContentionRetries)},
+		{"CONTENTION_BACKOFF", int64(cfg.ContentionBackoff)},
+		{"MAX_INFLIGHT_PAYMENTS", int64(cfg.MaxInFlightPayments)},
+	} {
+		if n.val < 0 {
+			problem("%s must not be negative", n.env)
+		}
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		problem("MAX_BODY_BYTES must be positive")
+	}
+
+	if cfg.DBConnStr == "" {
+		problem("DB_URL is required")
+	}
+	if cfg.DBMaxOpenConns > 0 && cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+		problem("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", cfg.DBMaxIdleConns, cfg.DBMaxOpenConns)
+	}
+	oneOf("TRANSFER_STRATEGY", cfg.TransferStrategy, "serializable", "rowlock")
+	if cfg.MaintainPartitions {
+		// readiness takes the partition of next month
+		if cfg.PartitionsAhead < 1 {
+			problem("PARTITIONS_AHEAD must be at least 1")
+		}
+		if cfg.PartitionInterval <= 0 {
+			problem("PARTITION_INTERVAL must be positive")
+		}
+	}
+	if cfg.LedgerChainInterval <= 0 {
+		problem("LEDGER_CHAIN_INTERVAL must be positive")
+	}
+	if cfg.LedgerSigningKey != "" && cfg.LedgerCheckpointInterval <= 0 {
+		problem("LEDGER_CHECKPOINT_INTERVAL must be positive")
+	}
+
+	if cfg.RateLimitPerKey < 0 {
+		problem("RATE_LIMIT_PER_KEY must not be negative")
+	}
+	if cfg.RateLimitPerKey > 0 && cfg.RateLimitKeyBurst < 1 {
+		problem("RATE_LIMIT_KEY_BURST must be at least 1")
+	}
+	if cfg.RateLimitPerAccount < 0 {
+		problem("RATE_LIMIT_PER_ACCOUNT must not be negative")
+	}
+	if cfg.RateLimitPerAccount > 0 && cfg.RateLimitAccountBurst < 1 {
+		problem("RATE_LIMIT_ACCOUNT_BURST must be at least 1")
+	}
+
+	oneOf("LOG_LEVEL", cfg.LogLevel, "debug", "info", "warn", "error")
+	oneOf("LOG_FORMAT", cfg.LogFormat, "json", "console")
+	oneOf("TRACING_EXPORTER", cfg.TracingExporter, "none", "stdout", "otlp")
+	if cfg.TracingSampleRatio < 0 || cfg.TracingSampleRatio > 1 {
+		problem("TRACING_SAMPLE_RATIO must be from 0 to 1, not %g", cfg.TracingSampleRatio)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+}
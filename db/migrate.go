@@ -0,0 +1,351 @@
+// Package db embeds the database migrations and runs them.
+//
+// Migrations are plain SQL files in goose's format, named
+// `<version>_<description>.sql` with `-- +goose Up` and `-- +goose Down`
+// sections. Applied versions are tracked in goose's `goose_db_version`
+// table so databases migrated with the goose CLI can be migrated by the
+// service and vice versa.
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// advisoryLockKey identifies the Postgres advisory lock held while migrating
+// so that instances starting at the same time take turns
+const advisoryLockKey = 7_136_504_171
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// NoTx is set by the `-- +goose NO TRANSACTION` annotation, for
+	// statements that cannot run in a transaction (e.g. `CREATE INDEX CONCURRENTLY`)
+	NoTx bool
+}
+
+// MigrationStatus is a migration along with when it was applied,
+// if it was
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		bits, err := migrationsFS.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseMigration(e.Name(), string(bits))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d: %v, %v",
+				migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// parseMigration parses the goose annotations of migration file `name`.
+// Statements need not be split since each section is run as a whole.
+func parseMigration(name, src string) (Migration, error) {
+	m := Migration{Name: name}
+	prefix, _, ok := strings.Cut(name, "_")
+	if !ok || !strings.HasSuffix(name, ".sql") {
+		return m, fmt.Errorf("migration %v: name should be of `<version>_<description>.sql` format", name)
+	}
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil || version < 1 {
+		return m, fmt.Errorf("migration %v: invalid version %q", name, prefix)
+	}
+	m.Version = version
+
+	var (
+		up, down strings.Builder
+		section  *strings.Builder
+	)
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "-- +goose ") {
+			switch strings.TrimSpace(strings.TrimPrefix(trimmed, "-- +goose ")) {
+			case "Up":
+				section = &up
+			case "Down":
+				section = &down
+			case "NO TRANSACTION":
+				m.NoTx = true
+			}
+			// StatementBegin/End only matter to statement splitting
+			continue
+		}
+		if section != nil {
+			section.WriteString(line)
+			section.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return m, fmt.Errorf("migration %v: %w", name, err)
+	}
+	m.Up = strings.TrimSpace(up.String())
+	m.Down = strings.TrimSpace(down.String())
+	if m.Up == "" {
+		return m, fmt.Errorf("migration %v: missing `-- +goose Up` section", name)
+	}
+
+	return m, nil
+}
+
+// Migrator runs the embedded migrations on a Postgres database
+type Migrator struct {
+	DB *sql.DB
+}
+
+func NewMigrator(db *sql.DB) *Migrator {
+	return &Migrator{DB: db}
+}
+
+// withLock runs `fn` on a single connection holding the migrations advisory
+// lock, after making sure that the version table exists
+func (mg *Migrator) withLock(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := mg.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, advisoryLockKey); err != nil {
+		return fmt.Errorf("acquire migrations lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, advisoryLockKey)
+
+	// the same table and initial row as goose's
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS goose_db_version (
+		id serial NOT NULL,
+		version_id bigint NOT NULL,
+		is_applied boolean NOT NULL,
+		tstamp timestamp NULL DEFAULT now(),
+		PRIMARY KEY (id)
+	);
+	INSERT INTO goose_db_version (version_id, is_applied)
+	SELECT 0, true WHERE NOT EXISTS (SELECT 1 FROM goose_db_version);`)
+	if err != nil {
+		return fmt.Errorf("create version table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// applied reads the applied versions and when they were applied. As in goose,
+// the latest row of each version tells whether it is currently applied.
+func applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT DISTINCT ON (version_id) version_id, is_applied, tstamp
+	FROM goose_db_version ORDER BY version_id, id DESC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			version   int64
+			isApplied bool
+			tstamp    sql.NullTime
+		)
+		if err := rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, err
+		}
+		if isApplied && version > 0 {
+			versions[version] = tstamp.Time
+		}
+	}
+
+	return versions, rows.Err()
+}
+
+// run runs one direction of a migration and records it
+func run(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	stmts := m.Down
+	if up {
+		stmts = m.Up
+	}
+	record := func(exec func(context.Context, string, ...interface{}) (sql.Result, error)) error {
+		_, err := exec(ctx, `INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, $2);`,
+			m.Version, up)
+		return err
+	}
+
+	if m.NoTx {
+		if stmts != "" {
+			if _, err := conn.ExecContext(ctx, stmts); err != nil {
+				return fmt.Errorf("migration %v: %w", m.Name, err)
+			}
+		}
+		return record(conn.ExecContext)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if stmts != "" {
+		if _, err := tx.ExecContext(ctx, stmts); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %v: %w", m.Name, err)
+		}
+	}
+	if err := record(tx.ExecContext); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Up applies every pending migration, returning those applied
+func (mg *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = mg.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := versions[m.Version]; ok {
+				continue
+			}
+			if err := run(ctx, conn, m, true); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the latest applied migration, returning it
+// or nil if there is none
+func (mg *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var done *Migration
+	err := mg.withLock(ctx, func(conn *sql.Conn) error {
+		m, err := latest(ctx, conn)
+		if err != nil || m == nil {
+			return err
+		}
+		if err := run(ctx, conn, *m, false); err != nil {
+			return err
+		}
+		done = m
+		return nil
+	})
+
+	return done, err
+}
+
+// Redo rolls back and reapplies the latest applied migration,
+// returning it or nil if there is none
+func (mg *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	var done *Migration
+	err := mg.withLock(ctx, func(conn *sql.Conn) error {
+		m, err := latest(ctx, conn)
+		if err != nil || m == nil {
+			return err
+		}
+		if err := run(ctx, conn, *m, false); err != nil {
+			return err
+		}
+		if err := run(ctx, conn, *m, true); err != nil {
+			return err
+		}
+		done = m
+		return nil
+	})
+
+	return done, err
+}
+
+// latest returns the latest applied migration
+func latest(ctx context.Context, conn *sql.Conn) (*Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if _, ok := versions[migrations[i].Version]; ok {
+			return &migrations[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Status lists every migration along with when it was applied
+func (mg *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = mg.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			st := MigrationStatus{Migration: m}
+			if at, ok := versions[m.Version]; ok {
+				at := at
+				st.AppliedAt = &at
+			}
+			statuses = append(statuses, st)
+		}
+		return nil
+	})
+
+	return statuses, err
+}
@@ -0,0 +1,75 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/db"
+)
+
+// TestMigrator migrates the Postgres database at `DB_URL`
+// and leaves it fully migrated
+func TestMigrator(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+
+	conn, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	reqrd.Nil(err)
+	defer conn.Close()
+	mg := db.NewMigrator(conn)
+	migrations, err := db.Migrations()
+	reqrd.Nil(err)
+
+	// instances starting at the same time take turns
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = db.NewMigrator(conn).Up(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		as.Nil(err)
+	}
+
+	applied, err := mg.Up(ctx)
+	reqrd.Nil(err)
+	as.Empty(applied)
+
+	latest := migrations[len(migrations)-1]
+	redone, err := mg.Redo(ctx)
+	reqrd.Nil(err)
+	reqrd.NotNil(redone)
+	as.Equal(latest.Version, redone.Version)
+
+	down, err := mg.Down(ctx)
+	reqrd.Nil(err)
+	reqrd.NotNil(down)
+	as.Equal(latest.Version, down.Version)
+
+	statuses, err := mg.Status(ctx)
+	reqrd.Nil(err)
+	reqrd.Len(statuses, len(migrations))
+	as.Nil(statuses[len(statuses)-1].AppliedAt)
+	for _, st := range statuses[:len(statuses)-1] {
+		as.NotNil(st.AppliedAt, st.Name)
+	}
+
+	applied, err = mg.Up(ctx)
+	reqrd.Nil(err)
+	reqrd.Len(applied, 1)
+	as.Equal(latest.Version, applied[0].Version)
+}
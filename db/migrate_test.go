@@ -0,0 +1,54 @@
+package db_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/db"
+	"github.com/arhyth/genwallet/wallet"
+)
+
+func TestMigrations(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+
+	migrations, err := db.Migrations()
+	reqrd.Nil(err)
+	reqrd.NotEmpty(migrations)
+
+	for i, m := range migrations {
+		if i > 0 {
+			as.Greater(m.Version, migrations[i-1].Version, m.Name)
+		}
+		as.NotEmpty(m.Up, m.Name)
+		as.NotEmpty(m.Down, m.Name)
+		as.NotContains(m.Up, "+goose", m.Name)
+		as.NotContains(m.Down, "+goose", m.Name)
+	}
+}
+
+// TestCurrenciesMigration checks that the `currencies` table,
+// which the currency foreign keys reference, has every currency
+// that the service accepts
+func TestCurrenciesMigration(t *testing.T) {
+	migrations, err := db.Migrations()
+	require.Nil(t, err)
+
+	seeded := map[string]bool{}
+	rgxpSeed := regexp.MustCompile(`\('([A-Z]{3})'\)`)
+	for _, m := range migrations {
+		if !strings.Contains(m.Up, "INSERT INTO currencies") {
+			continue
+		}
+		for _, match := range rgxpSeed.FindAllStringSubmatch(m.Up, -1) {
+			seeded[match[1]] = true
+		}
+	}
+	for cur := range wallet.ValidCurrencies {
+		assert.True(t, seeded[cur], "currency %v is not in the `currencies` table", cur)
+	}
+}
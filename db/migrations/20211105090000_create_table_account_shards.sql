@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Sharded accounts keep their balance split across `shards` rows of
+-- `account_shards` (and none in `accounts.balance`) so that concurrent
+-- credits to a hot account update different rows.
+ALTER TABLE accounts
+ADD COLUMN shards integer NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS account_shards (
+    account_id text REFERENCES accounts (id),
+    shard integer,
+    balance real NOT NULL DEFAULT 0,
+    updated_at timestamp with time zone DEFAULT now(),
+    PRIMARY KEY (account_id, shard)
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP TABLE IF EXISTS account_shards;
+ALTER TABLE accounts
+DROP COLUMN IF EXISTS shards;
@@ -0,0 +1,120 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Currencies are those of `wallet.ValidCurrencies` (ISO 4217).
+CREATE TABLE IF NOT EXISTS currencies (
+    code text PRIMARY KEY CHECK (code ~ '^[A-Z]{3}$')
+);
+INSERT INTO currencies (code) VALUES
+    ('AFN'), ('ALL'), ('DZD'), ('AOA'), ('XCD'), ('ARS'), ('AMD'), ('AWG'), ('AUD'), ('AZN'), ('BSD'), ('BHD'),
+    ('BDT'), ('BBD'), ('BYN'), ('BZD'), ('BMD'), ('BTN'), ('INR'), ('BOB'), ('BOV'), ('BAM'), ('BWP'), ('NOK'),
+    ('BRL'), ('BND'), ('BGN'), ('BIF'), ('CVE'), ('KHR'), ('XAF'), ('CAD'), ('KYD'), ('CLF'), ('CLP'), ('CNY'),
+    ('COP'), ('COU'), ('KMF'), ('CDF'), ('NZD'), ('CRC'), ('HRK'), ('CUC'), ('CUP'), ('ANG'), ('CZK'), ('DKK'),
+    ('DJF'), ('DOP'), ('EGP'), ('SVC'), ('ERN'), ('ETB'), ('FKP'), ('FJD'), ('EUR'), ('XPF'), ('GMD'), ('GEL'),
+    ('GHS'), ('GIP'), ('GTQ'), ('GBP'), ('GNF'), ('GYD'), ('HTG'), ('HNL'), ('HKD'), ('HUF'), ('ISK'), ('IDR'),
+    ('XDR'), ('IRR'), ('IQD'), ('ILS'), ('JMD'), ('JPY'), ('JOD'), ('KZT'), ('KES'), ('KPW'), ('KRW'), ('KWD'),
+    ('KGS'), ('LAK'), ('LBP'), ('LSL'), ('ZAR'), ('LRD'), ('LYD'), ('CHF'), ('MOP'), ('MGA'), ('MWK'), ('MYR'),
+    ('MVR'), ('MRU'), ('MUR'), ('XUA'), ('MXN'), ('MXV'), ('MDL'), ('MNT'), ('MAD'), ('MZN'), ('MMK'), ('NAD'),
+    ('NPR'), ('NIO'), ('NGN'), ('OMR'), ('PKR'), ('USD'), ('PAB'), ('PGK'), ('PYG'), ('PEN'), ('PHP'), ('PLN'),
+    ('QAR'), ('MKD'), ('RON'), ('RUB'), ('RWF'), ('SHP'), ('WST'), ('STN'), ('SAR'), ('XOF'), ('RSD'), ('SCR'),
+    ('SLL'), ('SGD'), ('XSU'), ('SBD'), ('SOS'), ('SSP'), ('LKR'), ('SDG'), ('SRD'), ('SZL'), ('SEK'), ('CHE'),
+    ('CHW'), ('SYP'), ('TWD'), ('TJS'), ('TZS'), ('THB'), ('TOP'), ('TTD'), ('TND'), ('TRY'), ('TMT'), ('UGX'),
+    ('UAH'), ('AED'), ('USN'), ('UYI'), ('UYU'), ('UZS'), ('VUV'), ('VEF'), ('VND'), ('YER'), ('ZMW'), ('ZWL')
+ON CONFLICT DO NOTHING;
+
+-- Backfill. Currencies were once stored as sent, e.g. ` usd`, and
+-- timestamps left to defaults that could be overridden with NULL.
+UPDATE accounts SET currency = upper(trim(currency))
+WHERE currency <> upper(trim(currency));
+UPDATE transfers SET currency = upper(trim(currency))
+WHERE currency <> upper(trim(currency));
+UPDATE accounts SET created_at = now() WHERE created_at IS NULL;
+UPDATE accounts SET updated_at = created_at WHERE updated_at IS NULL;
+UPDATE account_shards SET updated_at = now() WHERE updated_at IS NULL;
+UPDATE transfers SET created_at = now() WHERE created_at IS NULL;
+
+-- Validation. Rows that cannot be backfilled abort the migration
+-- so that they are fixed by hand rather than guessed at.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    n bigint;
+BEGIN
+    SELECT count(*) INTO n FROM accounts
+    WHERE balance IS NULL OR balance < 0 OR currency IS NULL
+        OR currency NOT IN (SELECT code FROM currencies);
+    IF n > 0 THEN
+        RAISE EXCEPTION '% accounts with NULL or negative balance, or NULL or unknown currency', n;
+    END IF;
+
+    SELECT count(*) INTO n FROM account_shards WHERE balance < 0;
+    IF n > 0 THEN
+        RAISE EXCEPTION '% account shards with negative balance', n;
+    END IF;
+
+    SELECT count(*) INTO n FROM transfers
+    WHERE "from" IS NULL OR "to" IS NULL OR "from" = "to"
+        OR amount IS NULL OR amount <= 0
+        OR currency NOT IN (SELECT code FROM currencies);
+    IF n > 0 THEN
+        RAISE EXCEPTION '% transfers with NULL or same payer and payee, NULL or non-positive amount, or unknown currency', n;
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE accounts
+    ALTER COLUMN balance SET NOT NULL,
+    ALTER COLUMN currency SET NOT NULL,
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET NOT NULL,
+    ADD CONSTRAINT accounts_balance_nonnegative CHECK (balance >= 0),
+    ADD CONSTRAINT accounts_shards_nonnegative CHECK (shards >= 0),
+    ADD CONSTRAINT accounts_currency_fkey FOREIGN KEY (currency) REFERENCES currencies (code);
+
+ALTER TABLE account_shards
+    ALTER COLUMN updated_at SET NOT NULL,
+    ADD CONSTRAINT account_shards_balance_nonnegative CHECK (balance >= 0);
+
+ALTER TABLE transfers
+    ALTER COLUMN "from" SET NOT NULL,
+    ALTER COLUMN "to" SET NOT NULL,
+    ALTER COLUMN amount SET NOT NULL,
+    ALTER COLUMN created_at SET NOT NULL,
+    ADD CONSTRAINT transfers_amount_positive CHECK (amount > 0),
+    ADD CONSTRAINT transfers_distinct_parties CHECK ("from" <> "to"),
+    ADD CONSTRAINT transfers_currency_fkey FOREIGN KEY (currency) REFERENCES currencies (code);
+
+-- Listings by payer/payee (`ListPayments`, `GET /transfers`) and by currency
+CREATE INDEX IF NOT EXISTS transfers_from_created_at_idx ON transfers ("from", created_at);
+CREATE INDEX IF NOT EXISTS transfers_to_created_at_idx ON transfers ("to", created_at);
+CREATE INDEX IF NOT EXISTS transfers_currency_created_at_idx ON transfers (currency, created_at);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP INDEX IF EXISTS transfers_currency_created_at_idx;
+DROP INDEX IF EXISTS transfers_to_created_at_idx;
+DROP INDEX IF EXISTS transfers_from_created_at_idx;
+
+ALTER TABLE transfers
+    DROP CONSTRAINT IF EXISTS transfers_currency_fkey,
+    DROP CONSTRAINT IF EXISTS transfers_distinct_parties,
+    DROP CONSTRAINT IF EXISTS transfers_amount_positive,
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN amount DROP NOT NULL,
+    ALTER COLUMN "to" DROP NOT NULL,
+    ALTER COLUMN "from" DROP NOT NULL;
+
+ALTER TABLE account_shards
+    DROP CONSTRAINT IF EXISTS account_shards_balance_nonnegative,
+    ALTER COLUMN updated_at DROP NOT NULL;
+
+ALTER TABLE accounts
+    DROP CONSTRAINT IF EXISTS accounts_currency_fkey,
+    DROP CONSTRAINT IF EXISTS accounts_shards_nonnegative,
+    DROP CONSTRAINT IF EXISTS accounts_balance_nonnegative,
+    ALTER COLUMN updated_at DROP NOT NULL,
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN currency DROP NOT NULL,
+    ALTER COLUMN balance DROP NOT NULL;
+
+DROP TABLE IF EXISTS currencies;
@@ -0,0 +1,110 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Transfers are range partitioned by month of `created_at` (UTC), in
+-- partitions named `transfers_pYYYY_MM`. Upcoming partitions are created
+-- by the service and old ones detached by `genwallet archive`, which
+-- records them in `transfer_archives`.
+CREATE TABLE IF NOT EXISTS transfer_archives (
+    partition text PRIMARY KEY,
+    range_start timestamp with time zone NOT NULL,
+    range_end timestamp with time zone NOT NULL,
+    -- file and rows are set once the detached partition is exported
+    file text,
+    rows bigint,
+    detached_at timestamp with time zone NOT NULL DEFAULT now(),
+    archived_at timestamp with time zone
+);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION create_transfers_partitions(first_month date, last_month date)
+RETURNS SETOF text AS $$
+DECLARE
+    m date := date_trunc('month', first_month);
+    name text;
+BEGIN
+    -- concurrent callers (i.e. service instances) take turns
+    PERFORM pg_advisory_xact_lock(hashtext('create_transfers_partitions'));
+    WHILE m <= last_month LOOP
+        name := format('transfers_p%s', to_char(m, 'YYYY_MM'));
+        IF to_regclass(name) IS NULL THEN
+            EXECUTE format('CREATE TABLE %I PARTITION OF transfers FOR VALUES FROM (%L) TO (%L)',
+                name, m::timestamp AT TIME ZONE 'UTC', (m + interval '1 month')::timestamp AT TIME ZONE 'UTC');
+            RETURN NEXT name;
+        END IF;
+        m := m + interval '1 month';
+    END LOOP;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+ALTER TABLE transfers RENAME TO transfers_unpartitioned;
+ALTER INDEX transfers_pkey RENAME TO transfers_unpartitioned_pkey;
+ALTER INDEX transfers_from_created_at_idx RENAME TO transfers_unpartitioned_from_created_at_idx;
+ALTER INDEX transfers_to_created_at_idx RENAME TO transfers_unpartitioned_to_created_at_idx;
+ALTER INDEX transfers_currency_created_at_idx RENAME TO transfers_unpartitioned_currency_created_at_idx;
+
+-- The partition key must be part of the primary key. IDs
+-- are still unique as they are drawn from the same sequence.
+CREATE TABLE transfers (
+    id integer NOT NULL DEFAULT nextval('transfers_id_seq'),
+    "from" text NOT NULL REFERENCES accounts (id),
+    "to" text NOT NULL REFERENCES accounts (id),
+    amount real NOT NULL,
+    currency text NOT NULL REFERENCES currencies (code),
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id, created_at),
+    CONSTRAINT transfers_amount_positive CHECK (amount > 0),
+    CONSTRAINT transfers_distinct_parties CHECK ("from" <> "to")
+) PARTITION BY RANGE (created_at);
+
+CREATE INDEX transfers_from_created_at_idx ON transfers ("from", created_at);
+CREATE INDEX transfers_to_created_at_idx ON transfers ("to", created_at);
+CREATE INDEX transfers_currency_created_at_idx ON transfers (currency, created_at);
+
+-- partitions for every month since the first transfer through 3 months ahead
+SELECT create_transfers_partitions(
+    (COALESCE((SELECT min(created_at) FROM transfers_unpartitioned), now()) AT TIME ZONE 'UTC')::date,
+    (now() AT TIME ZONE 'UTC' + interval '3 months')::date
+);
+
+INSERT INTO transfers (id, "from", "to", amount, currency, created_at)
+SELECT id, "from", "to", amount, currency, created_at FROM transfers_unpartitioned;
+
+ALTER TABLE transfers_unpartitioned ALTER COLUMN id DROP DEFAULT;
+ALTER SEQUENCE transfers_id_seq OWNED BY transfers.id;
+DROP TABLE transfers_unpartitioned;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+-- Only transfers of attached partitions are kept; archived ones
+-- remain in their export files.
+ALTER TABLE transfers RENAME TO transfers_partitioned;
+ALTER INDEX transfers_pkey RENAME TO transfers_partitioned_pkey;
+ALTER INDEX transfers_from_created_at_idx RENAME TO transfers_partitioned_from_created_at_idx;
+ALTER INDEX transfers_to_created_at_idx RENAME TO transfers_partitioned_to_created_at_idx;
+ALTER INDEX transfers_currency_created_at_idx RENAME TO transfers_partitioned_currency_created_at_idx;
+
+CREATE TABLE transfers (
+    id integer PRIMARY KEY DEFAULT nextval('transfers_id_seq'),
+    "from" text NOT NULL REFERENCES accounts (id),
+    "to" text NOT NULL REFERENCES accounts (id),
+    amount real NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    currency text NOT NULL REFERENCES currencies (code),
+    CONSTRAINT transfers_amount_positive CHECK (amount > 0),
+    CONSTRAINT transfers_distinct_parties CHECK ("from" <> "to")
+);
+
+CREATE INDEX transfers_from_created_at_idx ON transfers ("from", created_at);
+CREATE INDEX transfers_to_created_at_idx ON transfers ("to", created_at);
+CREATE INDEX transfers_currency_created_at_idx ON transfers (currency, created_at);
+
+INSERT INTO transfers (id, "from", "to", amount, currency, created_at)
+SELECT id, "from", "to", amount, currency, created_at FROM transfers_partitioned;
+
+ALTER TABLE transfers_partitioned ALTER COLUMN id DROP DEFAULT;
+ALTER SEQUENCE transfers_id_seq OWNED BY transfers.id;
+DROP TABLE transfers_partitioned;
+
+DROP FUNCTION IF EXISTS create_transfers_partitions(date, date);
+DROP TABLE IF EXISTS transfer_archives;
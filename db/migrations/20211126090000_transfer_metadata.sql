@@ -0,0 +1,62 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Lengths are those of the ISO 20022 text types that references
+-- (`Max35Text`) and descriptions (`Max140Text`) are rendered as.
+ALTER TABLE accounts
+    ADD COLUMN metadata jsonb NOT NULL DEFAULT '{}',
+    ADD CONSTRAINT accounts_metadata_object CHECK (jsonb_typeof(metadata) = 'object');
+
+ALTER TABLE transfers
+    ADD COLUMN description text,
+    ADD COLUMN reference text,
+    ADD COLUMN metadata jsonb NOT NULL DEFAULT '{}',
+    ADD CONSTRAINT transfers_description_length CHECK (char_length(description) <= 140),
+    ADD CONSTRAINT transfers_reference_length CHECK (char_length(reference) <= 35),
+    ADD CONSTRAINT transfers_metadata_object CHECK (jsonb_typeof(metadata) = 'object');
+
+CREATE INDEX transfers_reference_idx ON transfers (reference) WHERE reference IS NOT NULL;
+CREATE INDEX transfers_metadata_idx ON transfers USING gin (metadata jsonb_path_ops);
+
+-- Unique indexes of (partitioned) transfers must include `created_at`, so
+-- references are kept unique per payer here instead. Rows outlive archived
+-- transfers so that references are never reused.
+CREATE TABLE transfer_references (
+    payer text NOT NULL REFERENCES accounts (id),
+    reference text NOT NULL,
+    transfer_id integer NOT NULL,
+    PRIMARY KEY (payer, reference)
+);
+
+-- partitions detached but not yet exported are no longer altered along
+-- with `transfers`, yet their export reads the same columns
+-- +goose StatementBegin
+DO $$
+DECLARE
+    p text;
+BEGIN
+    FOR p IN SELECT partition FROM transfer_archives
+        WHERE archived_at IS NULL AND to_regclass(partition) IS NOT NULL
+    LOOP
+        EXECUTE format('ALTER TABLE %I
+            ADD COLUMN IF NOT EXISTS description text,
+            ADD COLUMN IF NOT EXISTS reference text,
+            ADD COLUMN IF NOT EXISTS metadata jsonb NOT NULL DEFAULT ''{}''', p);
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP TABLE IF EXISTS transfer_references;
+
+DROP INDEX IF EXISTS transfers_metadata_idx;
+DROP INDEX IF EXISTS transfers_reference_idx;
+
+ALTER TABLE transfers
+    DROP COLUMN IF EXISTS metadata,
+    DROP COLUMN IF EXISTS reference,
+    DROP COLUMN IF EXISTS description;
+
+ALTER TABLE accounts
+    DROP COLUMN IF EXISTS metadata;
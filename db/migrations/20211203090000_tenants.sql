@@ -0,0 +1,129 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Tenants have namespaces of account IDs of their own, so accounts are keyed
+-- by (tenant_id, id) and referenced along with their tenant. Transfers
+-- reference both accounts with the tenant of the transfer, which keeps
+-- transfers across tenants out at the schema level too.
+CREATE TABLE tenants (
+    id text PRIMARY KEY CHECK (id ~ '^[\w-]+$'),
+    name text NOT NULL,
+    -- currencies accounts can be opened in, any if empty
+    currencies text[] NOT NULL DEFAULT '{}',
+    max_transfer_amount real CHECK (max_transfer_amount > 0),
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+-- existing accounts and transfers are of the default tenant
+INSERT INTO tenants (id, name) VALUES ('default', 'Default');
+
+-- only the SHA-256 of the secret part of keys is stored
+CREATE TABLE api_keys (
+    id text PRIMARY KEY,
+    tenant_id text NOT NULL REFERENCES tenants (id),
+    key_hash bytea NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    revoked_at timestamp with time zone
+);
+
+CREATE INDEX api_keys_tenant_id_idx ON api_keys (tenant_id);
+
+-- partitions detached but not yet exported keep the foreign keys they had
+-- as partitions, which would hold on to the primary key of accounts, and
+-- their export reads the tenant of transfers
+-- +goose StatementBegin
+DO $$
+DECLARE
+    p text;
+BEGIN
+    FOR p IN SELECT partition FROM transfer_archives
+        WHERE archived_at IS NULL AND to_regclass(partition) IS NOT NULL
+    LOOP
+        EXECUTE format('ALTER TABLE %I
+            DROP CONSTRAINT IF EXISTS transfers_from_fkey,
+            DROP CONSTRAINT IF EXISTS transfers_to_fkey,
+            ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT ''default''', p);
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE transfers
+    DROP CONSTRAINT transfers_from_fkey,
+    DROP CONSTRAINT transfers_to_fkey;
+ALTER TABLE account_shards
+    DROP CONSTRAINT account_shards_account_id_fkey;
+ALTER TABLE transfer_references
+    DROP CONSTRAINT transfer_references_payer_fkey;
+
+-- Defaults only backfill existing rows; inserts must name their tenant.
+ALTER TABLE accounts
+    ADD COLUMN tenant_id text NOT NULL DEFAULT 'default' REFERENCES tenants (id),
+    DROP CONSTRAINT accounts_pkey,
+    ADD PRIMARY KEY (tenant_id, id);
+ALTER TABLE accounts ALTER COLUMN tenant_id DROP DEFAULT;
+
+ALTER TABLE account_shards
+    ADD COLUMN tenant_id text NOT NULL DEFAULT 'default',
+    DROP CONSTRAINT account_shards_pkey,
+    ADD PRIMARY KEY (tenant_id, account_id, shard),
+    ADD CONSTRAINT account_shards_account_id_fkey
+        FOREIGN KEY (tenant_id, account_id) REFERENCES accounts (tenant_id, id);
+ALTER TABLE account_shards ALTER COLUMN tenant_id DROP DEFAULT;
+
+ALTER TABLE transfers
+    ADD COLUMN tenant_id text NOT NULL DEFAULT 'default',
+    ADD CONSTRAINT transfers_from_fkey
+        FOREIGN KEY (tenant_id, "from") REFERENCES accounts (tenant_id, id),
+    ADD CONSTRAINT transfers_to_fkey
+        FOREIGN KEY (tenant_id, "to") REFERENCES accounts (tenant_id, id);
+ALTER TABLE transfers ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- Unfiltered listings (`GET /transfers`) of a tenant
+CREATE INDEX transfers_tenant_id_id_idx ON transfers (tenant_id, id);
+
+ALTER TABLE transfer_references
+    ADD COLUMN tenant_id text NOT NULL DEFAULT 'default',
+    DROP CONSTRAINT transfer_references_pkey,
+    ADD PRIMARY KEY (tenant_id, payer, reference),
+    ADD CONSTRAINT transfer_references_payer_fkey
+        FOREIGN KEY (tenant_id, payer) REFERENCES accounts (tenant_id, id);
+ALTER TABLE transfer_references ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+-- Rolling back fails, by design, once account IDs are reused across tenants.
+ALTER TABLE transfer_references
+    DROP CONSTRAINT transfer_references_payer_fkey,
+    DROP CONSTRAINT transfer_references_pkey,
+    DROP COLUMN tenant_id,
+    ADD PRIMARY KEY (payer, reference);
+
+DROP INDEX IF EXISTS transfers_tenant_id_id_idx;
+ALTER TABLE transfers
+    DROP CONSTRAINT transfers_from_fkey,
+    DROP CONSTRAINT transfers_to_fkey,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE account_shards
+    DROP CONSTRAINT account_shards_account_id_fkey,
+    DROP CONSTRAINT account_shards_pkey,
+    DROP COLUMN tenant_id,
+    ADD PRIMARY KEY (account_id, shard);
+
+ALTER TABLE accounts
+    DROP CONSTRAINT accounts_pkey,
+    DROP COLUMN tenant_id,
+    ADD PRIMARY KEY (id);
+
+ALTER TABLE account_shards
+    ADD CONSTRAINT account_shards_account_id_fkey
+        FOREIGN KEY (account_id) REFERENCES accounts (id);
+ALTER TABLE transfers
+    ADD CONSTRAINT transfers_from_fkey FOREIGN KEY ("from") REFERENCES accounts (id),
+    ADD CONSTRAINT transfers_to_fkey FOREIGN KEY ("to") REFERENCES accounts (id);
+ALTER TABLE transfer_references
+    ADD CONSTRAINT transfer_references_payer_fkey
+        FOREIGN KEY (payer) REFERENCES accounts (id);
+
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS tenants;
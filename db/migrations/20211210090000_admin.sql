@@ -0,0 +1,48 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Frozen accounts can neither pay nor be paid. System accounts (e.g. the
+-- suspense accounts that adjustments are booked against) are booked by
+-- the service itself and are the only ones that may go negative.
+ALTER TABLE accounts
+    ADD COLUMN frozen boolean NOT NULL DEFAULT false,
+    ADD COLUMN system boolean NOT NULL DEFAULT false,
+    DROP CONSTRAINT accounts_balance_nonnegative,
+    ADD CONSTRAINT accounts_balance_nonnegative CHECK (system OR balance >= 0);
+
+-- Reconciliation derives balances from the opening balance of accounts and
+-- the transfers booked since, so the net of archived transfers is kept
+-- per account as their partitions are detached.
+ALTER TABLE accounts
+    ADD COLUMN opening_balance double precision NOT NULL DEFAULT 0,
+    ADD COLUMN archived_net double precision NOT NULL DEFAULT 0;
+
+-- Backfill. Transfers already archived are folded into opening balances.
+UPDATE accounts a
+SET opening_balance = a.balance + COALESCE(s.balance, 0) - COALESCE(t.net, 0)
+FROM accounts b
+LEFT JOIN LATERAL (
+    SELECT SUM(balance) AS balance FROM account_shards
+    WHERE tenant_id = b.tenant_id AND account_id = b.id
+) s ON true
+LEFT JOIN LATERAL (
+    SELECT SUM(CASE WHEN "to" = b.id THEN amount ELSE -amount END::double precision) AS net
+    FROM transfers WHERE tenant_id = b.tenant_id AND ("from" = b.id OR "to" = b.id)
+) t ON true
+WHERE a.tenant_id = b.tenant_id AND a.id = b.id;
+
+-- Admin API keys are of ops, who may adjust balances, freeze
+-- accounts and reconcile within the tenant of the key
+ALTER TABLE api_keys ADD COLUMN admin boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+-- Rolling back fails, by design, while system accounts are negative.
+ALTER TABLE api_keys DROP COLUMN admin;
+
+ALTER TABLE accounts
+    DROP CONSTRAINT accounts_balance_nonnegative,
+    ADD CONSTRAINT accounts_balance_nonnegative CHECK (balance >= 0),
+    DROP COLUMN archived_net,
+    DROP COLUMN opening_balance,
+    DROP COLUMN system,
+    DROP COLUMN frozen;
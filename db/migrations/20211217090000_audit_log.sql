@@ -0,0 +1,43 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Every state-changing call is recorded, along with who made it and how
+-- it went. Successful calls are recorded in the transaction of their
+-- mutation, so an entry exists if and only if the mutation was committed;
+-- failed ones are recorded on their own after the rollback.
+-- `tenant_id` is not a foreign key since entries outlive what they are of.
+CREATE TABLE audit_log (
+    id bigserial PRIMARY KEY,
+    tenant_id text NOT NULL,
+    at timestamptz NOT NULL DEFAULT now(),
+    actor text NOT NULL,
+    action text NOT NULL,
+    target text NOT NULL,
+    payload_hash text NOT NULL,
+    outcome text NOT NULL,
+    source_ip inet
+);
+
+CREATE INDEX audit_log_tenant_actor ON audit_log (tenant_id, actor, id);
+CREATE INDEX audit_log_tenant_target ON audit_log (tenant_id, target, id);
+CREATE INDEX audit_log_tenant_at ON audit_log (tenant_id, at);
+
+-- Entries are append-only: updates and deletes fail whoever runs them.
+-- TRUNCATE, which skips row triggers, is left to the owner of the table;
+-- the role the service connects as should not be granted it.
+-- +goose StatementBegin
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only: % refused', TG_OP
+        USING ERRCODE = 'insufficient_privilege';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP TABLE audit_log;
+DROP FUNCTION audit_log_append_only();
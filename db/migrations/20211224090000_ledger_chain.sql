@@ -0,0 +1,36 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- The transfers of each tenant form a hash chain: `hash` covers the contents
+-- of a transfer and the `prev_hash` of the transfer before it, so that
+-- altering, removing or reordering transfers breaks the chain from there on.
+-- Transfers booked before this migration stay unchained (NULL hashes).
+ALTER TABLE transfers ADD COLUMN prev_hash text, ADD COLUMN hash text;
+
+-- The last chained transfer of each tenant, which is locked to chain onto
+-- it (by the ledger chainer since transfers are queued in `ledger_pending`).
+CREATE TABLE ledger_heads (
+    tenant_id text PRIMARY KEY REFERENCES tenants (id),
+    transfer_id integer,
+    hash text NOT NULL DEFAULT '',
+    -- at is when the transfer was booked
+    at timestamptz
+);
+
+-- Checkpoints are signed snapshots of heads; a chain that was rewritten
+-- from some transfer on no longer matches the checkpoints after it.
+CREATE TABLE ledger_checkpoints (
+    id bigserial PRIMARY KEY,
+    tenant_id text NOT NULL REFERENCES tenants (id),
+    transfer_id integer NOT NULL,
+    hash text NOT NULL,
+    at timestamptz NOT NULL,
+    key_id text NOT NULL,
+    signature bytea NOT NULL,
+    UNIQUE (tenant_id, transfer_id)
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP TABLE ledger_checkpoints;
+DROP TABLE ledger_heads;
+ALTER TABLE transfers DROP COLUMN hash, DROP COLUMN prev_hash;
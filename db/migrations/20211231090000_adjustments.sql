@@ -0,0 +1,36 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Balance adjustments are requested first and only booked (as transfers
+-- against the suspense account of their currency) once approved by another
+-- principal than their requester. Requesters may reject (withdraw) their own.
+CREATE TABLE adjustments (
+    id serial PRIMARY KEY,
+    tenant_id text NOT NULL,
+    account_id text NOT NULL,
+    -- positive amounts credit the account, negative ones debit it
+    amount real NOT NULL CHECK (amount <> 0),
+    reason text NOT NULL,
+    reference text,
+    -- attachments are references of supporting documents, e.g. ticket URLs
+    attachments text[] NOT NULL DEFAULT '{}',
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    requested_by text NOT NULL,
+    requested_at timestamptz NOT NULL DEFAULT now(),
+    decided_by text,
+    decided_at timestamptz,
+    note text,
+    -- transfer_id is of the transfer that approved adjustments are booked as
+    transfer_id integer,
+    FOREIGN KEY (tenant_id, account_id) REFERENCES accounts (tenant_id, id),
+    CONSTRAINT adjustments_approved_by_other CHECK (status <> 'approved' OR decided_by <> requested_by)
+);
+
+CREATE INDEX adjustments_tenant_status_idx ON adjustments (tenant_id, status, id);
+CREATE INDEX adjustments_tenant_account_idx ON adjustments (tenant_id, account_id, id);
+-- references make requests idempotent, as they do payments
+CREATE UNIQUE INDEX adjustments_reference_idx ON adjustments (tenant_id, account_id, reference)
+    WHERE reference IS NOT NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP TABLE adjustments;
@@ -0,0 +1,42 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Transfers are no longer chained in their own transaction, which held the
+-- head of their tenant until commit and so booked the transfers of a tenant
+-- one at a time. They are queued in `ledger_pending` instead and chained
+-- shortly after, a batch at a time, by the ledger chainer, which is all that
+-- locks heads. Transfers commit out of ID order, so `ledger_seq` is their
+-- position in the chain of their tenant.
+CREATE TABLE ledger_pending (
+    tenant_id text NOT NULL,
+    transfer_id integer NOT NULL,
+    -- created_at is that of the transfer, whose key it is part of
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (tenant_id, transfer_id)
+);
+
+ALTER TABLE transfers ADD COLUMN ledger_seq bigint;
+UPDATE transfers t SET ledger_seq = c.seq
+FROM (
+    SELECT id, created_at, row_number() OVER (PARTITION BY tenant_id ORDER BY id) AS seq
+    FROM transfers WHERE hash IS NOT NULL
+) c
+WHERE t.id = c.id AND t.created_at = c.created_at;
+CREATE INDEX transfers_tenant_ledger_seq_idx ON transfers (tenant_id, ledger_seq);
+
+ALTER TABLE ledger_heads ADD COLUMN seq bigint NOT NULL DEFAULT 0;
+UPDATE ledger_heads h
+SET seq = COALESCE((SELECT max(ledger_seq) FROM transfers t WHERE t.tenant_id = h.tenant_id), 0);
+
+-- checkpoints of archived transfers are left without
+ALTER TABLE ledger_checkpoints ADD COLUMN seq bigint;
+UPDATE ledger_checkpoints c SET seq = t.ledger_seq
+FROM transfers t WHERE t.tenant_id = c.tenant_id AND t.id = c.transfer_id;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+-- Transfers still pending stay unchained, and chains that are out of
+-- ID order no longer verify; run `genwallet ledger checkpoint` first.
+ALTER TABLE ledger_checkpoints DROP COLUMN seq;
+ALTER TABLE ledger_heads DROP COLUMN seq;
+ALTER TABLE transfers DROP COLUMN ledger_seq;
+DROP TABLE ledger_pending;
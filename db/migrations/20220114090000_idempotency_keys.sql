@@ -0,0 +1,19 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Idempotency keys are of requests rather than of payments: a payment
+-- requested again with the key of an earlier one returns the transfer that
+-- one booked. They are kept apart from references, which are the payer's
+-- own identifiers of payments, and apart from (partitioned) transfers for
+-- the same reason references are.
+CREATE TABLE transfer_idempotency_keys (
+    tenant_id text NOT NULL,
+    payer text NOT NULL,
+    key text NOT NULL CHECK (char_length(key) <= 255),
+    transfer_id integer NOT NULL,
+    PRIMARY KEY (tenant_id, payer, key),
+    FOREIGN KEY (tenant_id, payer) REFERENCES accounts (tenant_id, id)
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP TABLE transfer_idempotency_keys;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Adjustment requests repeated with the idempotency key of an earlier one
+-- return its adjustment, as payments do (see `transfer_idempotency_keys`).
+ALTER TABLE adjustments
+    ADD COLUMN idempotency_key text CHECK (char_length(idempotency_key) <= 255);
+
+CREATE UNIQUE INDEX adjustments_idempotency_key_idx ON adjustments (tenant_id, account_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+ALTER TABLE adjustments DROP COLUMN idempotency_key;
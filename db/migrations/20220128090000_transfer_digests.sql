@@ -0,0 +1,47 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+-- Transfers store the digest of their contents as booked, in the transaction
+-- that books them, which the ledger chainer links rather than a digest of
+-- the contents as it reads them. Transfers altered while pending no longer
+-- match their digest once chained. Transfers booked before this migration
+-- have none and are chained as read.
+ALTER TABLE transfers ADD COLUMN digest text;
+
+-- Transfers only leave the queue once chained, and queue entries are never
+-- updated, so removing a pending transfer leaves its entry behind (unless
+-- triggers are disabled, which is left to the owner of the table, as
+-- TRUNCATE is). The check is deferred to commit so that the chainer may take
+-- a batch off the queue before chaining it.
+-- +goose StatementBegin
+CREATE FUNCTION ledger_pending_chained_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        RAISE EXCEPTION 'ledger_pending entries cannot be updated'
+            USING ERRCODE = 'insufficient_privilege';
+    END IF;
+    IF NOT EXISTS (SELECT FROM transfers
+        WHERE tenant_id = OLD.tenant_id AND id = OLD.transfer_id AND created_at = OLD.created_at
+        AND hash IS NOT NULL) THEN
+        RAISE EXCEPTION 'ledger_pending: transfer % is not chained', OLD.transfer_id
+            USING ERRCODE = 'insufficient_privilege';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER ledger_pending_no_update
+    BEFORE UPDATE ON ledger_pending
+    FOR EACH ROW EXECUTE FUNCTION ledger_pending_chained_only();
+
+CREATE CONSTRAINT TRIGGER ledger_pending_chained_only
+    AFTER DELETE ON ledger_pending
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_pending_chained_only();
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+DROP TRIGGER ledger_pending_chained_only ON ledger_pending;
+DROP TRIGGER ledger_pending_no_update ON ledger_pending;
+DROP FUNCTION ledger_pending_chained_only();
+ALTER TABLE transfers DROP COLUMN digest;
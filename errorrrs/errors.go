@@ -4,55 +4,395 @@ package errorrrs
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// ID is the class of an error, which determines
+// the transport (HTTP, gRPC) status it is reported with
 type ID int
 
 const (
 	BadRequest ID = iota + 1
 	NotFound
 	InternalServerError
+	Conflict
+	Unprocessable
+	Unauthorized
+	Forbidden
+	TooManyRequests
+	Unavailable
+)
+
+// Code is a stable, machine readable identifier of an error
+// that clients can rely on, unlike messages
+type Code string
+
+const (
+	CodeMalformedRequest  Code = "malformed_request"
+	CodeValidationFailed  Code = "validation_failed"
+	CodeAccountNotFound   Code = "account_not_found"
+	CodeAccountExists     Code = "account_exists"
+	CodeInsufficientFunds Code = "insufficient_funds"
+	CodeCurrencyMismatch  Code = "currency_mismatch"
+	// CodeAccountFrozen is of payments from/to frozen accounts
+	CodeAccountFrozen Code = "account_frozen"
+	// CodeDuplicateReference is of payments whose reference the
+	// payer already used for another payment
+	CodeDuplicateReference Code = "duplicate_reference"
+	// CodeIdempotencyKeyReused is of payments whose idempotency key
+	// the payer already used for a different payment
+	CodeIdempotencyKeyReused Code = "idempotency_key_reused"
+	// CodePeriodArchived is of statements over periods whose
+	// transfers have been archived
+	CodePeriodArchived Code = "period_archived"
+	// CodeTransferNotFound is of ledger proofs of transfers
+	// that do not exist within the tenant of the request
+	CodeTransferNotFound Code = "transfer_not_found"
+	// CodeTransferNotChained is of ledger proofs of transfers
+	// booked before the ledger was introduced
+	CodeTransferNotChained Code = "transfer_not_chained"
+	// CodeTransferPending is of ledger proofs of transfers
+	// booked but not chained yet, which are shortly
+	CodeTransferPending Code = "transfer_pending"
+	// CodeAdjustmentNotFound is of balance adjustments that do not exist
+	CodeAdjustmentNotFound Code = "adjustment_not_found"
+	// CodeAdjustmentDecided is of decisions on balance adjustments
+	// that were already approved or rejected
+	CodeAdjustmentDecided Code = "adjustment_decided"
+	// CodeSelfApproval is of approvals of balance adjustments
+	// by the principal that requested them
+	CodeSelfApproval Code = "self_approval"
+	// CodeConcurrentUpdate is of requests aborted due to concurrent ones
+	// (e.g. on the same wallet); they are safe to retry as is
+	CodeConcurrentUpdate Code = "concurrent_update"
+	// CodeUnauthenticated is of requests without a valid API key
+	// where one is required
+	CodeUnauthenticated Code = "unauthenticated"
+	// CodeForbidden is of admin operations requested with a non-admin API key
+	CodeForbidden Code = "forbidden"
+	// CodeRateLimited is of requests beyond the rate limits of their
+	// API key or payer; they are safe to retry after `Retry-After`
+	CodeRateLimited Code = "rate_limited"
+	// CodeOverloaded is of requests shed as too many are in flight;
+	// they are safe to retry after `Retry-After`
+	CodeOverloaded Code = "overloaded"
+	CodeInternal   Code = "internal_error"
 )
 
+var titles = map[Code]string{
+	CodeMalformedRequest:     "Malformed request",
+	CodeValidationFailed:     "Request validation failed",
+	CodeAccountNotFound:      "Wallet account not found",
+	CodeAccountExists:        "Wallet account already exists",
+	CodeInsufficientFunds:    "Insufficient funds",
+	CodeCurrencyMismatch:     "Currency mismatch",
+	CodeAccountFrozen:        "Wallet account frozen",
+	CodeDuplicateReference:   "Duplicate payment reference",
+	CodeIdempotencyKeyReused: "Idempotency key reused",
+	CodePeriodArchived:       "Statement period archived",
+	CodeTransferNotFound:     "Transfer not found",
+	CodeTransferNotChained:   "Transfer predates the ledger",
+	CodeTransferPending:      "Transfer not chained yet, retry",
+	CodeAdjustmentNotFound:   "Adjustment not found",
+	CodeAdjustmentDecided:    "Adjustment already decided",
+	CodeSelfApproval:         "Adjustment requires another approver",
+	CodeConcurrentUpdate:     "Concurrent update, retry",
+	CodeUnauthenticated:      "Authentication required",
+	CodeForbidden:            "Admin API key required",
+	CodeRateLimited:          "Rate limit exceeded",
+	CodeOverloaded:           "Server overloaded, retry",
+	CodeInternal:             "Internal error",
+}
+
+// internalDetail replaces the message of internal errors in responses.
+// The actual message is only logged, along with the correlation ID.
+const internalDetail = "an internal error occurred; report the correlation ID if it persists"
+
 var _ error = (*E)(nil)
 
 type E struct {
-	ID  ID     `json:"-"`
-	Msg string `json:"error"`
+	ID   ID
+	Code Code
+	Msg  string
+	// Fields holds the details of validation errors, one per offending field
+	Fields []FieldError
+	// RetryAfter is how long clients should wait before retrying,
+	// if they are told (`Retry-After`)
+	RetryAfter time.Duration
+	// Cause is the underlying error, e.g. of the database, which is logged
+	// with the correlation ID of the response but left out of it
+	Cause error
+}
+
+// FieldError is a validation error of a single request field
+type FieldError struct {
+	Field string `json:"field"`
+	Msg   string `json:"message"`
 }
 
 func (e *E) Error() string {
 	return e.Msg
 }
 
-// GokitErrorEncoder is an implementation of Gokit func signature
-// for writing (and "minor" handling) HTTP error responses
-func GokitErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	switch errt := err.(type) {
-	case *E:
-		var hs int
-		if errt.ID == BadRequest {
-			hs = http.StatusBadRequest
-		} else if errt.ID == NotFound {
-			hs = http.StatusNotFound
-		} else {
-			hs = http.StatusInternalServerError
-		}
-		w.WriteHeader(hs)
-		bits, err := json.Marshal(errt)
-		if err != nil {
-			panic(err.Error())
-		}
-		w.Write(bits)
+// Problem is an RFC 7807 problem details object,
+// the body of every error response
+type Problem struct {
+	Type          string       `json:"type"`
+	Title         string       `json:"title"`
+	Status        int          `json:"status"`
+	Detail        string       `json:"detail"`
+	Code          Code         `json:"code"`
+	CorrelationID string       `json:"correlation_id,omitempty"`
+	Errors        []FieldError `json:"errors,omitempty"`
+}
+
+// ProblemMediaType is the content type of error responses
+const ProblemMediaType = "application/problem+json"
+
+// ProblemType is the problem type URI of an error code
+func ProblemType(c Code) string {
+	return "urn:genwallet:problem:" + string(c)
+}
+
+// HTTPStatus is the HTTP status code of an error ID
+func HTTPStatus(id ID) int {
+	switch id {
+	case BadRequest:
+		return http.StatusBadRequest
+	case NotFound:
+		return http.StatusNotFound
+	case Conflict:
+		return http.StatusConflict
+	case Unprocessable:
+		return http.StatusUnprocessableEntity
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case Forbidden:
+		return http.StatusForbidden
+	case TooManyRequests:
+		return http.StatusTooManyRequests
+	case Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// idOf is the error ID of an HTTP status code, the inverse of `HTTPStatus`
+func idOf(status int) ID {
+	switch status {
+	case http.StatusBadRequest:
+		return BadRequest
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusUnprocessableEntity:
+		return Unprocessable
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusTooManyRequests:
+		return TooManyRequests
+	case http.StatusServiceUnavailable:
+		return Unavailable
 	default:
-		e := E{Msg: errt.Error()}
-		bits, err := json.Marshal(e)
-		if err != nil {
-			panic(err.Error())
+		return InternalServerError
+	}
+}
+
+// FromProblem converts the problem details of an error response back into
+// the error it was made of, e.g. for clients of the API. Details of internal
+// errors are left out of responses, so their correlation ID is kept instead.
+func FromProblem(p Problem) *E {
+	e := &E{
+		ID:     idOf(p.Status),
+		Code:   p.Code,
+		Msg:    p.Detail,
+		Fields: p.Errors,
+	}
+	if e.Code == "" {
+		e.Code = defaultCode(e.ID)
+	}
+	if e.ID == InternalServerError && p.CorrelationID != "" {
+		e.Msg = fmt.Sprintf("%v (correlation ID: %v)", e.Msg, p.CorrelationID)
+	}
+
+	return e
+}
+
+// Classify returns `err` as an *E, classifying anything else as internal
+func Classify(err error) *E {
+	if e, ok := err.(*E); ok {
+		if e.Code == "" {
+			ee := *e
+			ee.Code = defaultCode(e.ID)
+			return &ee
 		}
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write(bits)
+		return e
+	}
+
+	return &E{
+		ID:   InternalServerError,
+		Code: CodeInternal,
+		Msg:  err.Error(),
 	}
 }
+
+func defaultCode(id ID) Code {
+	switch id {
+	case BadRequest:
+		return CodeValidationFailed
+	case NotFound:
+		return CodeAccountNotFound
+	case Unauthorized:
+		return CodeUnauthenticated
+	case Forbidden:
+		return CodeForbidden
+	case TooManyRequests:
+		return CodeRateLimited
+	default:
+		return CodeInternal
+	}
+}
+
+// NewCorrelationID makes a random ID to correlate an
+// error response with its log entry
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewProblem converts an error into the problem details to respond with.
+// Internal errors are logged with `correlationID` and their details left out.
+func NewProblem(err error, correlationID string) Problem {
+	return newProblem(err, correlationID, "")
+}
+
+// maxRequestIDLen bounds the request IDs of clients that are logged
+const maxRequestIDLen = 64
+
+// newProblem is `NewProblem` of a request that the client gave ID
+// `requestID` (if any), which is logged alongside `correlationID`
+func newProblem(err error, correlationID, requestID string) Problem {
+	if len(requestID) > maxRequestIDLen {
+		requestID = requestID[:maxRequestIDLen]
+	}
+	e := Classify(err)
+	status := HTTPStatus(e.ID)
+	prob := Problem{
+		Type:          ProblemType(e.Code),
+		Title:         titles[e.Code],
+		Status:        status,
+		Detail:        e.Msg,
+		Code:          e.Code,
+		CorrelationID: correlationID,
+		Errors:        e.Fields,
+	}
+	if prob.Title == "" {
+		prob.Title = http.StatusText(status)
+	}
+	if e.ID == InternalServerError {
+		log.Error().
+			Str("correlation_id", correlationID).
+			Str("request_id", requestID).
+			Str("code", string(e.Code)).
+			Err(e.Cause).
+			Msg(e.Msg)
+		prob.Detail = internalDetail
+	} else if e.Cause != nil {
+		log.Warn().
+			Str("correlation_id", correlationID).
+			Str("request_id", requestID).
+			Str("code", string(e.Code)).
+			Err(e.Cause).
+			Msg(e.Msg)
+	}
+
+	return prob
+}
+
+// GokitErrorEncoder is an implementation of Gokit func signature
+// for writing (and "minor" handling) HTTP error responses as
+// `application/problem+json`. The correlation ID is always made by the
+// server, as clients could otherwise make errors of others look like theirs
+// in the logs; the request's own `X-Request-Id`, if the server populates the
+// request context, is only logged alongside it.
+func GokitErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	correlationID := NewCorrelationID()
+	requestID, _ := ctx.Value(httptransport.ContextKeyRequestXRequestID).(string)
+
+	prob := newProblem(err, correlationID, requestID)
+	if e := Classify(err); e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", retryAfterSecs(e.RetryAfter))
+	}
+	bits, err := json.Marshal(prob)
+	if err != nil {
+		panic(err.Error())
+	}
+	w.Header().Set("Content-Type", ProblemMediaType)
+	w.Header().Set("X-Request-Id", correlationID)
+	if prob.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="genwallet"`)
+	}
+	w.WriteHeader(prob.Status)
+	w.Write(bits)
+}
+
+// retryAfterSecs formats `d` as `Retry-After` seconds, rounded up
+// so that clients do not retry too early
+func retryAfterSecs(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// GRPCError is the gRPC counterpart of `GokitErrorEncoder`. It converts
+// an error into a gRPC status error with the code corresponding to its ID.
+func GRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	prob := NewProblem(err, NewCorrelationID())
+	var code codes.Code
+	e := Classify(err)
+	switch {
+	case e.Code == CodeConcurrentUpdate:
+		code = codes.Aborted
+	case e.ID == BadRequest:
+		code = codes.InvalidArgument
+	case e.ID == NotFound:
+		code = codes.NotFound
+	case e.ID == Conflict:
+		code = codes.AlreadyExists
+	case e.ID == Unprocessable:
+		code = codes.FailedPrecondition
+	case e.ID == Unauthorized:
+		code = codes.Unauthenticated
+	case e.ID == Forbidden:
+		code = codes.PermissionDenied
+	case e.ID == TooManyRequests:
+		code = codes.ResourceExhausted
+	case e.ID == Unavailable:
+		code = codes.Unavailable
+	default:
+		code = codes.Internal
+		return status.Errorf(code, "%v: %v (correlation ID: %v)", prob.Code, prob.Detail, prob.CorrelationID)
+	}
+
+	return status.Errorf(code, "%v: %v", prob.Code, prob.Detail)
+}
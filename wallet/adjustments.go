@@ -0,0 +1,386 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Balance adjustments credit or debit accounts outside of payments, e.g. as
+// goodwill or to correct a balance. They take two principals (maker-checker):
+// one requests an adjustment, another approves it and only then is it booked,
+// as a transfer from/to the suspense account of the account's currency (see
+// `SuspenseAccountID`). Pending adjustments may be rejected by anyone,
+// their requester included, e.g. to withdraw them.
+
+// Errors of adjustments, along with those of transfers when they are booked
+var (
+	ErrAdjustmentNotFound = errors.New("adjustment not found")
+	// ErrAdjustmentDecided is of decisions on adjustments
+	// that were already approved or rejected
+	ErrAdjustmentDecided = errors.New("adjustment already decided")
+	// ErrSelfApproval is of approvals by the requester of an adjustment,
+	// or by anonymous callers, who cannot be told apart
+	ErrSelfApproval = errors.New("adjustment must be approved by another principal than its requester")
+)
+
+// AdjustmentRequest requests to credit (positive `Amount`) or debit
+// (negative `Amount`) account `AccountID` by `Reason`. `Attachments` are
+// references of supporting documents, e.g. ticket URLs. `Reference`, if
+// any, is unique per account. `IdempotencyKey` is of the request, as that
+// of `CreatePaymentRequest` is: requests of an account with the same key
+// return the adjustment the first one requested.
+type AdjustmentRequest struct {
+	AccountID      string   `json:"account_id"`
+	Amount         float64  `json:"amount"`
+	Reason         string   `json:"reason"`
+	Reference      string   `json:"reference,omitempty"`
+	Attachments    []string `json:"attachments,omitempty"`
+	IdempotencyKey string   `json:"-"`
+}
+
+type AdjustmentStatus string
+
+const (
+	AdjustmentPending  AdjustmentStatus = "pending"
+	AdjustmentApproved AdjustmentStatus = "approved"
+	AdjustmentRejected AdjustmentStatus = "rejected"
+)
+
+// Adjustment is a requested adjustment and its decision, if any.
+// `TransferID` is of the transfer that approved adjustments are booked as.
+type Adjustment struct {
+	ID          int              `json:"id"`
+	AccountID   string           `json:"account_id"`
+	Amount      float64          `json:"amount"`
+	Reason      string           `json:"reason"`
+	Reference   string           `json:"reference,omitempty"`
+	Attachments []string         `json:"attachments,omitempty"`
+	Status      AdjustmentStatus `json:"status"`
+	RequestedBy string           `json:"requested_by"`
+	RequestedAt time.Time        `json:"requested_at"`
+	DecidedBy   string           `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time       `json:"decided_at,omitempty"`
+	Note        string           `json:"note,omitempty"`
+	TransferID  *int             `json:"transfer_id,omitempty"`
+}
+
+// ListAdjustmentsRequest filters the adjustments of the tenant of the
+// request; `AfterID` and `Limit` page through them as they do transfers
+type ListAdjustmentsRequest struct {
+	AccountID *string
+	Status    *AdjustmentStatus
+	Reference *string
+	AfterID   *int
+	Limit     int
+}
+
+type GetAdjustmentRequest struct {
+	ID int `json:"id"`
+}
+
+// DecideAdjustmentRequest approves, or else rejects, adjustment `ID`
+// with an optional `Note`
+type DecideAdjustmentRequest struct {
+	ID      int    `json:"id"`
+	Approve bool   `json:"approve"`
+	Note    string `json:"note,omitempty"`
+}
+
+func (s AdjustmentStatus) valid() bool {
+	switch s {
+	case AdjustmentPending, AdjustmentApproved, AdjustmentRejected:
+		return true
+	}
+	return false
+}
+
+// checkDecision checks that `actor` may decide `adj` as requested
+func checkDecision(adj Adjustment, actor string, approve bool) error {
+	if adj.Status != AdjustmentPending {
+		return fmt.Errorf("%w: %v is %v", ErrAdjustmentDecided, adj.ID, adj.Status)
+	}
+	if approve && (actor == adj.RequestedBy || actor == AnonymousActor) {
+		return fmt.Errorf("%w: %v", ErrSelfApproval, adj.ID)
+	}
+	return nil
+}
+
+// decisionAction is the audited action of a decision
+func decisionAction(approve bool) string {
+	if approve {
+		return AuditApproveAdjustment
+	}
+	return AuditRejectAdjustment
+}
+
+// adjustmentTransfer is the transfer that adjustment `adj` is booked as,
+// against suspense account `suspense`. Its reference is made of the ID of
+// the adjustment since the references of adjustments are unique per account
+// only, while transfer references are unique per payer (e.g. the suspense
+// account).
+func adjustmentTransfer(adj Adjustment, suspense string) CreateTransferRequest {
+	trnsfr := CreateTransferRequest{
+		From:        suspense,
+		To:          adj.AccountID,
+		Amount:      adj.Amount,
+		Description: adj.Reason,
+		Reference:   "adjustment:" + strconv.Itoa(adj.ID),
+	}
+	if adj.Amount < 0 {
+		trnsfr.From, trnsfr.To = adj.AccountID, suspense
+		trnsfr.Amount = math.Abs(adj.Amount)
+	}
+
+	return trnsfr
+}
+
+// adjustmentColumns are the columns of adjustments that `scanAdjustment` scans
+const adjustmentColumns = `id, account_id, amount, reason, reference, attachments, status,
+	requested_by, requested_at, decided_by, decided_at, note, transfer_id`
+
+func scanAdjustment(row interface{ Scan(...interface{}) error }) (Adjustment, error) {
+	var (
+		adj                  Adjustment
+		ref, decidedBy, note sql.NullString
+		decidedAt            sql.NullTime
+		transferID           sql.NullInt64
+	)
+	err := row.Scan(&adj.ID,
+		&adj.AccountID,
+		&adj.Amount,
+		&adj.Reason,
+		&ref,
+		pq.Array(&adj.Attachments),
+		&adj.Status,
+		&adj.RequestedBy,
+		&adj.RequestedAt,
+		&decidedBy,
+		&decidedAt,
+		&note,
+		&transferID)
+	adj.Reference = ref.String
+	adj.DecidedBy = decidedBy.String
+	adj.Note = note.String
+	if decidedAt.Valid {
+		adj.DecidedAt = &decidedAt.Time
+	}
+	if transferID.Valid {
+		id := int(transferID.Int64)
+		adj.TransferID = &id
+	}
+	if len(adj.Attachments) == 0 {
+		adj.Attachments = nil
+	}
+
+	return adj, err
+}
+
+func (r *Repo) RequestAdjustment(ctx context.Context, req AdjustmentRequest) (Adjustment, error) {
+	var (
+		tenant = tenantOf(ctx)
+		e      = newAuditEntry(ctx, tenant, AuditRequestAdjustment, req.AccountID, req)
+		adj    Adjustment
+	)
+	// as with transfers, requests repeated with the idempotency key
+	// of one that went through return its adjustment
+	if req.IdempotencyKey != "" {
+		made, found, err := idempotentAdjustment(ctx, r.DB, tenant, req)
+		if err != nil || found {
+			return made, err
+		}
+	}
+	err := r.audited(ctx, &e, func(tx *sql.Tx) error {
+		var system bool
+		err := tx.QueryRowContext(ctx, `SELECT system FROM accounts
+		WHERE tenant_id = $1 AND id = $2;`, tenant, req.AccountID).Scan(&system)
+		if err == nil && system {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			return accountErr(err, req.AccountID)
+		}
+		attachments := req.Attachments
+		if attachments == nil {
+			attachments = []string{}
+		}
+		// requests of the same key that commit first are of the request
+		adj, err = scanAdjustment(tx.QueryRowContext(ctx, `INSERT INTO adjustments (tenant_id, account_id, amount, reason, reference, attachments, requested_by, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (tenant_id, account_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+		RETURNING `+adjustmentColumns+`;`,
+			tenant, req.AccountID, req.Amount, req.Reason, nullString(req.Reference), pq.Array(attachments), e.Actor,
+			nullString(req.IdempotencyKey)))
+		if errors.Is(err, sql.ErrNoRows) {
+			adj, _, err = idempotentAdjustment(ctx, tx, tenant, req)
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgUniqueViolation {
+			return fmt.Errorf("%w: %v", ErrDuplicateReference, req.Reference)
+		}
+		return err
+	})
+
+	return adj, err
+}
+
+// idempotentAdjustment reads the adjustment of account `req.AccountID`
+// requested with idempotency key `req.IdempotencyKey`, if any. It must be
+// of the same amount as `req`.
+func idempotentAdjustment(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, tenant string, req AdjustmentRequest) (Adjustment, bool, error) {
+	adj, err := scanAdjustment(q.QueryRowContext(ctx, `SELECT `+adjustmentColumns+` FROM adjustments
+	WHERE tenant_id = $1 AND account_id = $2 AND idempotency_key = $3;`, tenant, req.AccountID, req.IdempotencyKey))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Adjustment{}, false, nil
+	case err != nil:
+		return Adjustment{}, false, err
+	case float32(adj.Amount) != float32(req.Amount):
+		// amounts are stored in single precision
+		return Adjustment{}, true, fmt.Errorf("%w: %v", ErrIdempotencyKeyReused, req.IdempotencyKey)
+	}
+
+	return adj, true, nil
+}
+
+// listAdjustmentsQuery builds the (parameterized) query for
+// a page of the adjustments of tenant `tenant`
+func listAdjustmentsQuery(tenant string, req ListAdjustmentsRequest) (string, []interface{}) {
+	var (
+		conds = []string{`tenant_id = $1`}
+		args  = []interface{}{tenant}
+	)
+	if req.AccountID != nil {
+		args = append(args, *req.AccountID)
+		conds = append(conds, fmt.Sprintf(`account_id = $%d`, len(args)))
+	}
+	if req.Status != nil {
+		args = append(args, string(*req.Status))
+		conds = append(conds, fmt.Sprintf(`status = $%d`, len(args)))
+	}
+	if req.Reference != nil {
+		args = append(args, *req.Reference)
+		conds = append(conds, fmt.Sprintf(`reference = $%d`, len(args)))
+	}
+	if req.AfterID != nil {
+		args = append(args, *req.AfterID)
+		conds = append(conds, fmt.Sprintf(`id > $%d`, len(args)))
+	}
+	query := `SELECT ` + adjustmentColumns + ` FROM adjustments WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY id`
+
+	return query + limitClause(&args, req.Limit) + ";", args
+}
+
+// ListAdjustments reads from the primary, as `ListAudit` does;
+// checkers expect to see the requests just made
+func (r *Repo) ListAdjustments(ctx context.Context, req ListAdjustmentsRequest) ([]Adjustment, error) {
+	query, args := listAdjustmentsQuery(tenantOf(ctx), req)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var adjs []Adjustment
+	for rows.Next() {
+		adj, err := scanAdjustment(rows)
+		if err != nil {
+			return nil, err
+		}
+		adjs = append(adjs, adj)
+	}
+
+	return adjs, rows.Err()
+}
+
+func (r *Repo) GetAdjustment(ctx context.Context, req GetAdjustmentRequest) (Adjustment, error) {
+	adj, err := scanAdjustment(r.DB.QueryRowContext(ctx, `SELECT `+adjustmentColumns+` FROM adjustments
+	WHERE tenant_id = $1 AND id = $2;`, tenantOf(ctx), req.ID))
+	if err == sql.ErrNoRows {
+		return adj, fmt.Errorf("%w: %v", ErrAdjustmentNotFound, req.ID)
+	}
+
+	return adj, err
+}
+
+// DecideAdjustment books approved adjustments in the transaction that
+// marks them approved. Decisions are conditional on adjustments being
+// pending still, so of concurrent ones only the first goes through.
+// Their audit entries target the account of the adjustment.
+func (r *Repo) DecideAdjustment(ctx context.Context, req DecideAdjustmentRequest) (Adjustment, error) {
+	action := decisionAction(req.Approve)
+	adj, err := r.GetAdjustment(ctx, GetAdjustmentRequest{ID: req.ID})
+	if err != nil {
+		r.auditFailure(ctx, newAuditEntry(ctx, tenantOf(ctx), action, strconv.Itoa(req.ID), req), err)
+		return Adjustment{}, err
+	}
+	e := newAuditEntry(ctx, tenantOf(ctx), action, adj.AccountID, req)
+	if err = checkDecision(adj, e.Actor, req.Approve); err != nil {
+		r.auditFailure(ctx, e, err)
+		return Adjustment{}, err
+	}
+
+	if req.Approve {
+		adj, err = r.approveAdjustment(ctx, adj, req.Note, e)
+		r.auditFailure(ctx, e, err)
+		return adj, err
+	}
+	err = r.audited(ctx, &e, func(tx *sql.Tx) error {
+		adj, err = decideAdjustment(ctx, tx, adj.ID, AdjustmentRejected, e.Actor, req.Note, nil)
+		return err
+	})
+
+	return adj, err
+}
+
+// approveAdjustment books `adj` against the suspense account
+// of its account's currency, creating it on first use
+func (r *Repo) approveAdjustment(ctx context.Context, adj Adjustment, note string, e AuditEntry) (Adjustment, error) {
+	tenant := tenantOf(ctx)
+	var currency string
+	err := r.DB.QueryRowContext(ctx, `SELECT currency FROM accounts
+	WHERE tenant_id = $1 AND id = $2;`, tenant, adj.AccountID).Scan(&currency)
+	if err != nil {
+		return Adjustment{}, accountErr(err, adj.AccountID)
+	}
+
+	suspense := SuspenseAccountID(currency)
+	_, err = r.DB.ExecContext(ctx, `INSERT INTO accounts (tenant_id, id, balance, currency, system)
+	VALUES ($1, $2, 0, $3, true) ON CONFLICT DO NOTHING;`, tenant, suspense, currency)
+	if err != nil {
+		return Adjustment{}, err
+	}
+
+	var approved Adjustment
+	_, err = r.createTransfer(ctx, adjustmentTransfer(adj, suspense), true, e, func(tx *sql.Tx, trnsfr Transfer) error {
+		approved, err = decideAdjustment(ctx, tx, adj.ID, AdjustmentApproved, e.Actor, note, &trnsfr.ID)
+		return err
+	})
+	if err != nil {
+		return Adjustment{}, balanceErr(contentionErr(err))
+	}
+
+	return approved, nil
+}
+
+// decideAdjustment marks adjustment `id` as `status` by `actor`,
+// provided that it is still pending
+func decideAdjustment(ctx context.Context, tx *sql.Tx, id int, status AdjustmentStatus, actor, note string, transferID *int) (Adjustment, error) {
+	adj, err := scanAdjustment(tx.QueryRowContext(ctx, `UPDATE adjustments
+	SET (status, decided_by, decided_at, note, transfer_id) = ($1, $2, now(), $3, $4)
+	WHERE tenant_id = $5 AND id = $6 AND status = 'pending' RETURNING `+adjustmentColumns+`;`,
+		string(status), actor, nullString(note), transferID, tenantOf(ctx), id))
+	if err == sql.ErrNoRows {
+		return adj, fmt.Errorf("%w: %v", ErrAdjustmentDecided, id)
+	}
+
+	return adj, err
+}
@@ -0,0 +1,137 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rs/zerolog/log"
+)
+
+func (r *Repo) FreezeAccount(ctx context.Context, req FreezeAccountRequest) (Account, error) {
+	action := AuditFreezeAccount
+	if !req.Frozen {
+		action = AuditUnfreezeAccount
+	}
+	e := newAuditEntry(ctx, tenantOf(ctx), action, req.ID, req)
+	acct, err := r.freezeAccount(ctx, req, e)
+	r.auditFailure(ctx, e, err)
+
+	return acct, err
+}
+
+func (r *Repo) freezeAccount(ctx context.Context, req FreezeAccountRequest, e AuditEntry) (Account, error) {
+	var rbErr error
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Account{}, err
+	}
+	defer func() {
+		// catch if rollback fails
+		if rbErr != nil {
+			log.Err(rbErr).Msg("repo.FreezeAccount: txn rollback fail")
+		}
+	}()
+
+	tenant := tenantOf(ctx)
+	res, err := tx.ExecContext(ctx, `UPDATE accounts SET (frozen, updated_at) = ($1, now())
+	WHERE tenant_id = $2 AND id = $3 AND NOT system;`, req.Frozen, tenant, req.ID)
+	if err == nil {
+		var n int64
+		if n, err = res.RowsAffected(); err == nil && n == 0 {
+			err = sql.ErrNoRows
+		}
+	}
+	// transfers of sharded accounts only lock or update their shards, which
+	// are updated too so that transfers in flight finish before the freeze
+	// or see it (see `createTransfer`). They are locked in shard order first,
+	// as debits lock them, so as not to deadlock with those.
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `SELECT FROM account_shards
+		WHERE tenant_id = $1 AND account_id = $2 ORDER BY shard FOR UPDATE;`, tenant, req.ID)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `UPDATE account_shards SET updated_at = now()
+		WHERE tenant_id = $1 AND account_id = $2;`, tenant, req.ID)
+	}
+	if err != nil {
+		rbErr = tx.Rollback()
+		return Account{}, accountErr(err, req.ID)
+	}
+	acct, err := scanAccount(tx.QueryRowContext(ctx, selectAccounts+` WHERE a.tenant_id = $1 AND a.id = $2;`, tenant, req.ID))
+	if err != nil {
+		rbErr = tx.Rollback()
+		return Account{}, err
+	}
+	if err = writeAudit(ctx, tx, e); err != nil {
+		rbErr = tx.Rollback()
+		return Account{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		rbErr = tx.Rollback()
+		return Account{}, err
+	}
+
+	return acct, nil
+}
+
+// reconcileAccounts selects the balances of accounts (aliased `a`) along
+// with their expected balances: their opening balance plus the net of their
+// transfers, archived or not. Sums are of double precision since transfer
+// amounts are single precision.
+const reconcileAccounts = `SELECT a.id, a.currency, a.balance + COALESCE(s.balance, 0),
+	a.opening_balance + a.archived_net + COALESCE(t.net, 0)
+	FROM accounts a LEFT JOIN LATERAL (
+		SELECT SUM(balance) AS balance
+		FROM account_shards WHERE tenant_id = a.tenant_id AND account_id = a.id
+	) s ON true LEFT JOIN LATERAL (
+		SELECT SUM(CASE WHEN "to" = a.id THEN amount ELSE -amount END::double precision) AS net
+		FROM transfers WHERE tenant_id = a.tenant_id AND ("from" = a.id OR "to" = a.id)
+	) t ON true`
+
+// Reconcile reads from the primary, in a single snapshot, so that transfers
+// committing meanwhile cannot show as differences
+func (r *Repo) Reconcile(ctx context.Context, req ReconcileRequest) ([]Reconciliation, error) {
+	var rbErr error
+	txOptns := &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	}
+	tx, err := r.DB.BeginTx(ctx, txOptns)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// catch if rollback fails
+		if rbErr != nil {
+			log.Err(rbErr).Msg("repo.Reconcile: txn rollback fail")
+		}
+	}()
+
+	query, args := reconcileAccounts+` WHERE a.tenant_id = $1`, []interface{}{tenantOf(ctx)}
+	if req.Currency != nil {
+		query += ` AND a.currency = $2`
+		args = append(args, *req.Currency)
+	}
+	rows, err := tx.QueryContext(ctx, query+` ORDER BY a.id;`, args...)
+	if err != nil {
+		rbErr = tx.Rollback()
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recs []Reconciliation
+	for rows.Next() {
+		var rec Reconciliation
+		if err := rows.Scan(&rec.ID, &rec.Currency, &rec.Balance, &rec.Expected); err != nil {
+			rbErr = tx.Rollback()
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	if err = rows.Err(); err != nil {
+		rbErr = tx.Rollback()
+		return nil, err
+	}
+
+	return recs, tx.Commit()
+}
@@ -0,0 +1,323 @@
+package wallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/arhyth/genwallet/errorrrs"
+)
+
+// AuditEntry records a state-changing call: who (`Actor`) did what
+// (`Action`) to what (`Target`, e.g. an account ID) and how it went
+// (`Outcome`). `PayloadHash` is the SHA-256 of the JSON encoding of the
+// request as the repository received it, so that a request can be matched
+// to its entry without the entry holding its data.
+//
+// Entries of successful calls are written in the transaction of their
+// mutation; those of failed ones on their own after the rollback. Calls
+// refused before reaching the repository (e.g. by authentication or
+// validation) change nothing and are not recorded.
+type AuditEntry struct {
+	ID          int       `json:"id"`
+	At          time.Time `json:"at"`
+	Actor       string    `json:"actor"`
+	Action      string    `json:"action"`
+	Target      string    `json:"target"`
+	PayloadHash string    `json:"payload_hash"`
+	Outcome     string    `json:"outcome"`
+	SourceIP    string    `json:"source_ip,omitempty"`
+
+	tenant string
+}
+
+// Audited actions
+const (
+	AuditCreateAccount     = "account.create"
+	AuditFreezeAccount     = "account.freeze"
+	AuditUnfreezeAccount   = "account.unfreeze"
+	AuditCreatePayment     = "payment.create"
+	AuditRequestAdjustment = "adjustment.request"
+	AuditApproveAdjustment = "adjustment.approve"
+	AuditRejectAdjustment  = "adjustment.reject"
+	AuditCreateTenant      = "tenant.create"
+	AuditCreateAPIKey      = "api_key.create"
+	AuditRevokeAPIKey      = "api_key.revoke"
+)
+
+// AuditOutcomeOK is the outcome of successful calls; that of
+// failed ones is their error code (see `errorrrs.Code`)
+const AuditOutcomeOK = "ok"
+
+// AnonymousActor is the actor of calls without an API key
+// or an actor of their own (see `WithActor`)
+const AnonymousActor = "anonymous"
+
+// ListAuditRequest filters entries of the tenant of the request by actor,
+// target and the period [From, To); a zero `From` or `To` leaves that end
+// open. `AfterID` and `Limit` page through entries as they do transfers.
+type ListAuditRequest struct {
+	Actor   *string
+	Target  *string
+	From    time.Time
+	To      time.Time
+	AfterID *int
+	Limit   int
+}
+
+type actorKey struct{}
+
+// WithActor sets the actor that the calls of `ctx` are recorded as,
+// for internal callers (e.g. commands) that have no API key
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorOf is the actor of the request of `ctx`: the one set with `WithActor`,
+// else the API key of its principal as `apikey:<ID>`, else `AnonymousActor`
+func actorOf(ctx context.Context) string {
+	if actor, _ := ctx.Value(actorKey{}).(string); actor != "" {
+		return actor
+	}
+	if p, ok := PrincipalFrom(ctx); ok && p.KeyID != "" {
+		return "apikey:" + p.KeyID
+	}
+	return AnonymousActor
+}
+
+type sourceIPKey struct{}
+
+// WithSourceIP sets the IP address that the request of `ctx` came from
+func WithSourceIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, sourceIPKey{}, ip)
+}
+
+func sourceIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(sourceIPKey{}).(string)
+	return ip
+}
+
+// hostIP returns the IP of `host:port` address `addr`, if it is one
+func hostIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if net.ParseIP(host) == nil {
+		return ""
+	}
+	return host
+}
+
+// sourceIPHTTP is a go-kit http `ServerBefore` func. The source IP is
+// that of the peer; `X-Forwarded-For` headers, which anyone can set,
+// are not trusted.
+func sourceIPHTTP(ctx context.Context, req *http.Request) context.Context {
+	if ip := hostIP(req.RemoteAddr); ip != "" {
+		return WithSourceIP(ctx, ip)
+	}
+	return ctx
+}
+
+// sourceIPGRPC is a go-kit grpc `ServerBefore` func; gRPC keeps
+// the peer of calls in their context rather than their metadata
+func sourceIPGRPC(ctx context.Context, _ metadata.MD) context.Context {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if ip := hostIP(p.Addr.String()); ip != "" {
+			return WithSourceIP(ctx, ip)
+		}
+	}
+	return ctx
+}
+
+// newAuditEntry is the entry of `action` on `target` by the caller of
+// `ctx`, within tenant `tenant`, of request `req`
+func newAuditEntry(ctx context.Context, tenant, action, target string, req interface{}) AuditEntry {
+	return AuditEntry{
+		Actor:       actorOf(ctx),
+		Action:      action,
+		Target:      target,
+		PayloadHash: payloadHash(req),
+		Outcome:     AuditOutcomeOK,
+		SourceIP:    sourceIPFrom(ctx),
+		tenant:      tenant,
+	}
+}
+
+// payloadHash is the hex SHA-256 of the JSON encoding of `req`.
+// Requests are plain structs, which always encode.
+func payloadHash(req interface{}) string {
+	b, _ := json.Marshal(req)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// failed returns `e` with the outcome of error `err`: its error code as
+// served (see `classify`), or for errors of `Tenants`, which are not
+// served, one of the same form
+func (e AuditEntry) failed(err error) AuditEntry {
+	switch {
+	case errors.Is(err, ErrTenantExists):
+		e.Outcome = "tenant_exists"
+	case errors.Is(err, ErrTenantNotFound):
+		e.Outcome = "tenant_not_found"
+	case errors.Is(err, ErrAPIKeyNotFound):
+		e.Outcome = "api_key_not_found"
+	default:
+		e.Outcome = string(errorrrs.Classify(classify(err)).Code)
+	}
+
+	return e
+}
+
+// execer is what `Repo.writeAudit` needs of a `*sql.DB` or `*sql.Tx`
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// writeAudit writes `e` with `db`, the transaction of its mutation if it succeeded
+func writeAudit(ctx context.Context, db execer, e AuditEntry) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO audit_log (tenant_id, actor, action, target, payload_hash, outcome, source_ip)
+	VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		e.tenant, e.Actor, e.Action, e.Target, e.PayloadHash, e.Outcome, nullString(e.SourceIP))
+	return err
+}
+
+// auditFailureTimeout bounds the writing of the entry of a failed call
+const auditFailureTimeout = 5 * time.Second
+
+// auditFailure records the failure, if any, of the call of entry `e`. The
+// failure itself is what the caller gets, so failing to record it is only
+// logged. The failure is often that `ctx` was canceled (the client went away
+// or its deadline passed), so the entry is written without its cancellation.
+func (r *Repo) auditFailure(ctx context.Context, e AuditEntry, err error) {
+	if err == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(withoutCancel{ctx}, auditFailureTimeout)
+	defer cancel()
+	if wErr := writeAudit(ctx, r.DB, e.failed(err)); wErr != nil {
+		log.Err(wErr).Str("action", e.Action).Str("target", e.Target).Msg("repo: audit of failure fail")
+	}
+}
+
+// audited runs mutation `fn` and writes audit entry `e` of it in a single
+// transaction, or records the failure of either. `fn` may fill in `e`,
+// e.g. with the tenant of what it mutated.
+func (r *Repo) audited(ctx context.Context, e *AuditEntry, fn func(*sql.Tx) error) error {
+	err := r.inTx(ctx, e, fn)
+	r.auditFailure(ctx, *e, err)
+
+	return err
+}
+
+func (r *Repo) inTx(ctx context.Context, e *AuditEntry, fn func(*sql.Tx) error) error {
+	var rbErr error
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// catch if rollback fails
+		if rbErr != nil {
+			log.Err(rbErr).Str("action", e.Action).Msg("repo: txn rollback fail")
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		rbErr = tx.Rollback()
+		return err
+	}
+	if err = writeAudit(ctx, tx, *e); err != nil {
+		rbErr = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		rbErr = tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// listAuditQuery builds the (parameterized) query for
+// a page of the audit entries of tenant `tenant`
+func listAuditQuery(tenant string, req ListAuditRequest) (string, []interface{}) {
+	var (
+		conds = []string{`tenant_id = $1`}
+		args  = []interface{}{tenant}
+	)
+	if req.Actor != nil {
+		args = append(args, *req.Actor)
+		conds = append(conds, fmt.Sprintf(`actor = $%d`, len(args)))
+	}
+	if req.Target != nil {
+		args = append(args, *req.Target)
+		conds = append(conds, fmt.Sprintf(`target = $%d`, len(args)))
+	}
+	if !req.From.IsZero() {
+		args = append(args, req.From)
+		conds = append(conds, fmt.Sprintf(`at >= $%d`, len(args)))
+	}
+	if !req.To.IsZero() {
+		args = append(args, req.To)
+		conds = append(conds, fmt.Sprintf(`at < $%d`, len(args)))
+	}
+	if req.AfterID != nil {
+		args = append(args, *req.AfterID)
+		conds = append(conds, fmt.Sprintf(`id > $%d`, len(args)))
+	}
+
+	query := `SELECT id, at, actor, action, target, payload_hash, outcome, COALESCE(host(source_ip), '')
+	FROM audit_log WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY id`
+
+	return query + limitClause(&args, req.Limit) + ";", args
+}
+
+// ListAudit reads from the primary; entries are few and far
+// between compared to reads, and ops expect to see their own
+func (r *Repo) ListAudit(ctx context.Context, req ListAuditRequest) ([]AuditEntry, error) {
+	query, args := listAuditQuery(tenantOf(ctx), req)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.Target, &e.PayloadHash, &e.Outcome, &e.SourceIP); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// withoutCancel is a context with the values of its parent but neither its
+// deadline nor its cancellation, i.e. `context.WithoutCancel` of Go 1.21
+type withoutCancel struct {
+	parent context.Context
+}
+
+func (withoutCancel) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (withoutCancel) Done() <-chan struct{} { return nil }
+
+func (withoutCancel) Err() error { return nil }
+
+func (c withoutCancel) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,303 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/arhyth/genwallet/errorrrs"
+)
+
+// Callers authenticate with an API key (see `Tenants.CreateAPIKey`) as
+// an `Authorization: Bearer <key>` or `X-API-Key` header over HTTP, or
+// the same (lower case) metadata over gRPC
+const (
+	AuthorizationHeader = "Authorization"
+	APIKeyHeader        = "X-API-Key"
+)
+
+type apiKeyKey struct{}
+
+// WithAPIKey sets the API key the request of `ctx` came with,
+// to be authenticated by `AuthMiddleware`
+func WithAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+func apiKeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyKey{}).(string)
+	return key
+}
+
+// bearer returns the token of an `Authorization: Bearer` header value
+func bearer(v string) string {
+	const scheme = "bearer "
+	if len(v) > len(scheme) && strings.EqualFold(v[:len(scheme)], scheme) {
+		return strings.TrimSpace(v[len(scheme):])
+	}
+	return ""
+}
+
+// apiKeyHTTP is a go-kit http `ServerBefore` func
+func apiKeyHTTP(ctx context.Context, req *http.Request) context.Context {
+	key := bearer(req.Header.Get(AuthorizationHeader))
+	if key == "" {
+		key = req.Header.Get(APIKeyHeader)
+	}
+	if key != "" {
+		return WithAPIKey(ctx, key)
+	}
+
+	return ctx
+}
+
+// apiKeyGRPC is a go-kit grpc `ServerBefore` func
+func apiKeyGRPC(ctx context.Context, md metadata.MD) context.Context {
+	for _, v := range md.Get(strings.ToLower(AuthorizationHeader)) {
+		if key := bearer(v); key != "" {
+			return WithAPIKey(ctx, key)
+		}
+	}
+	for _, key := range md.Get(strings.ToLower(APIKeyHeader)) {
+		if key != "" {
+			return WithAPIKey(ctx, key)
+		}
+	}
+
+	return ctx
+}
+
+var _ Service = (*AuthMiddleware)(nil)
+
+// AuthMiddleware authenticates the API key of each request (see `WithAPIKey`)
+// and scopes the request to the tenant of the key by setting its principal.
+// Like validation, it is done in the service layer so that every transport
+// is covered the same.
+type AuthMiddleware struct {
+	Next Service
+	Keys Authenticator
+	// Required refuses requests without a key; otherwise
+	// they are served as of the default tenant
+	Required bool
+}
+
+// authenticate returns `ctx` with the principal of its API key
+func (am *AuthMiddleware) authenticate(ctx context.Context) (context.Context, error) {
+	key := apiKeyFrom(ctx)
+	if key == "" {
+		if am.Required {
+			return ctx, &errorrrs.E{
+				ID:   errorrrs.Unauthorized,
+				Code: errorrrs.CodeUnauthenticated,
+				Msg:  "API key required",
+			}
+		}
+		return ctx, nil
+	}
+
+	p, err := am.Keys.Authenticate(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAPIKey) {
+			return ctx, &errorrrs.E{
+				ID:   errorrrs.Unauthorized,
+				Code: errorrrs.CodeUnauthenticated,
+				Msg:  err.Error(),
+			}
+		}
+		return ctx, classify(err)
+	}
+
+	return WithPrincipal(ctx, p), nil
+}
+
+// authenticateAdmin is `authenticate` for admin operations, which are
+// refused to principals of non-admin keys, and to requests without a key
+// even where keys are optional, as there is no telling who made them
+func (am *AuthMiddleware) authenticateAdmin(ctx context.Context) (context.Context, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return ctx, &errorrrs.E{
+			ID:   errorrrs.Unauthorized,
+			Code: errorrrs.CodeUnauthenticated,
+			Msg:  "admin API key required",
+		}
+	}
+	if !p.Admin {
+		return ctx, &errorrrs.E{
+			ID:   errorrrs.Forbidden,
+			Code: errorrrs.CodeForbidden,
+			Msg:  "admin API key required",
+		}
+	}
+
+	return ctx, nil
+}
+
+func (am *AuthMiddleware) ListAccounts(ctx context.Context, req ListAccountsRequest) ([]Account, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return am.Next.ListAccounts(ctx, req)
+}
+
+func (am *AuthMiddleware) StreamAccounts(ctx context.Context, req ListAccountsRequest, fn func(Account) error) error {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	return am.Next.StreamAccounts(ctx, req, fn)
+}
+
+func (am *AuthMiddleware) GetAccount(ctx context.Context, req GetAccountRequest) (Account, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return Account{}, err
+	}
+
+	return am.Next.GetAccount(ctx, req)
+}
+
+func (am *AuthMiddleware) CreateAccount(ctx context.Context, req CreateAccountRequest) (Account, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return Account{}, err
+	}
+
+	return am.Next.CreateAccount(ctx, req)
+}
+
+func (am *AuthMiddleware) ListPayments(ctx context.Context, req ListPaymentsRequest) ([]Payment, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return am.Next.ListPayments(ctx, req)
+}
+
+func (am *AuthMiddleware) StreamPayments(ctx context.Context, req ListPaymentsRequest, fn func(Payment) error) error {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	return am.Next.StreamPayments(ctx, req, fn)
+}
+
+func (am *AuthMiddleware) CreatePayment(ctx context.Context, req CreatePaymentRequest) (Payment, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	return am.Next.CreatePayment(ctx, req)
+}
+
+func (am *AuthMiddleware) ListTransfers(ctx context.Context, req ListTransfersRequest) ([]Transfer, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return am.Next.ListTransfers(ctx, req)
+}
+
+func (am *AuthMiddleware) StreamTransfers(ctx context.Context, req ListTransfersRequest, fn func(Transfer) error) error {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	return am.Next.StreamTransfers(ctx, req, fn)
+}
+
+func (am *AuthMiddleware) GetStatement(ctx context.Context, req StatementRequest) (Statement, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	return am.Next.GetStatement(ctx, req)
+}
+
+func (am *AuthMiddleware) GetLedgerProof(ctx context.Context, req LedgerProofRequest) (LedgerProof, error) {
+	ctx, err := am.authenticate(ctx)
+	if err != nil {
+		return LedgerProof{}, err
+	}
+
+	return am.Next.GetLedgerProof(ctx, req)
+}
+
+func (am *AuthMiddleware) RequestAdjustment(ctx context.Context, req AdjustmentRequest) (Adjustment, error) {
+	ctx, err := am.authenticateAdmin(ctx)
+	if err != nil {
+		return Adjustment{}, err
+	}
+
+	return am.Next.RequestAdjustment(ctx, req)
+}
+
+func (am *AuthMiddleware) ListAdjustments(ctx context.Context, req ListAdjustmentsRequest) ([]Adjustment, error) {
+	ctx, err := am.authenticateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return am.Next.ListAdjustments(ctx, req)
+}
+
+func (am *AuthMiddleware) GetAdjustment(ctx context.Context, req GetAdjustmentRequest) (Adjustment, error) {
+	ctx, err := am.authenticateAdmin(ctx)
+	if err != nil {
+		return Adjustment{}, err
+	}
+
+	return am.Next.GetAdjustment(ctx, req)
+}
+
+func (am *AuthMiddleware) DecideAdjustment(ctx context.Context, req DecideAdjustmentRequest) (Adjustment, error) {
+	ctx, err := am.authenticateAdmin(ctx)
+	if err != nil {
+		return Adjustment{}, err
+	}
+
+	return am.Next.DecideAdjustment(ctx, req)
+}
+
+func (am *AuthMiddleware) FreezeAccount(ctx context.Context, req FreezeAccountRequest) (Account, error) {
+	ctx, err := am.authenticateAdmin(ctx)
+	if err != nil {
+		return Account{}, err
+	}
+
+	return am.Next.FreezeAccount(ctx, req)
+}
+
+func (am *AuthMiddleware) Reconcile(ctx context.Context, req ReconcileRequest) ([]Reconciliation, error) {
+	ctx, err := am.authenticateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return am.Next.Reconcile(ctx, req)
+}
+
+func (am *AuthMiddleware) ListAudit(ctx context.Context, req ListAuditRequest) ([]AuditEntry, error) {
+	ctx, err := am.authenticateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return am.Next.ListAudit(ctx, req)
+}
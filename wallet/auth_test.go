@@ -0,0 +1,371 @@
+package wallet_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet"
+	MOCKWALLET "github.com/arhyth/genwallet/wallet/mock"
+	"github.com/arhyth/genwallet/wallet/pb"
+)
+
+// newTenant creates tenant `t` in `repo` along with an API key of it
+func newTenant(t *testing.T, repo *wallet.MemRepo, tenant wallet.Tenant) wallet.APIKey {
+	ctx := context.Background()
+	_, err := repo.CreateTenant(ctx, tenant)
+	require.Nil(t, err)
+	key, err := repo.CreateAPIKey(ctx, wallet.APIKey{TenantID: tenant.ID})
+	require.Nil(t, err)
+
+	return key
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	repo := wallet.NewMemRepo()
+	key := newTenant(t, repo, wallet.Tenant{ID: "acme", Name: "Acme"})
+	revoked := newTenant(t, repo, wallet.Tenant{ID: "umbrella", Name: "Umbrella"})
+	require.Nil(t, repo.RevokeAPIKey(context.Background(), revoked.ID))
+
+	cases := []struct {
+		name     string
+		key      string
+		required bool
+		tenant   string
+		errCode  errorrrs.Code
+	}{
+		{name: "optional, no key", tenant: wallet.DefaultTenantID},
+		{name: "optional, key", key: key.Key, tenant: "acme"},
+		{name: "required, key", key: key.Key, required: true, tenant: "acme"},
+		{name: "required, no key", required: true, errCode: errorrrs.CodeUnauthenticated},
+		{name: "unknown key", key: key.Key + "x", errCode: errorrrs.CodeUnauthenticated},
+		{name: "malformed key", key: "secret", errCode: errorrrs.CodeUnauthenticated},
+		{name: "revoked key", key: revoked.Key, errCode: errorrrs.CodeUnauthenticated},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(tt *testing.T) {
+			as := assert.New(tt)
+			reqrd := require.New(tt)
+			ctrl := gomock.NewController(tt)
+			defer ctrl.Finish()
+			next := MOCKWALLET.NewMockService(ctrl)
+			svc := &wallet.AuthMiddleware{Next: next, Keys: repo, Required: c.required}
+
+			ctx := context.Background()
+			if c.key != "" {
+				ctx = wallet.WithAPIKey(ctx, c.key)
+			}
+			if c.errCode == "" {
+				next.EXPECT().
+					GetAccount(gomock.Any(), wallet.GetAccountRequest{ID: "bob-888"}).
+					DoAndReturn(func(ctx context.Context, req wallet.GetAccountRequest) (wallet.Account, error) {
+						p, ok := wallet.PrincipalFrom(ctx)
+						if c.tenant == wallet.DefaultTenantID {
+							as.False(ok, "no principal")
+						} else {
+							as.Equal(c.tenant, p.Tenant.ID)
+							as.Equal(key.ID, p.KeyID)
+						}
+						return wallet.Account{ID: req.ID}, nil
+					}).
+					Times(1)
+			}
+
+			_, err := svc.GetAccount(ctx, wallet.GetAccountRequest{ID: "bob-888"})
+			if c.errCode == "" {
+				as.Nil(err)
+				return
+			}
+			e, ok := err.(*errorrrs.E)
+			reqrd.True(ok)
+			as.Equal(errorrrs.Unauthorized, e.ID)
+			as.Equal(c.errCode, e.Code)
+		})
+	}
+}
+
+// TestAuthMiddlewareAdmin checks that admin operations take an admin key
+// even where keys are optional, which there is no telling who made otherwise
+func TestAuthMiddlewareAdmin(t *testing.T) {
+	repo := wallet.NewMemRepo()
+	key := newTenant(t, repo, wallet.Tenant{ID: "acme", Name: "Acme"})
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// nothing gets through
+	next := MOCKWALLET.NewMockService(ctrl)
+	svc := &wallet.AuthMiddleware{Next: next, Keys: repo}
+	handler := wallet.MakeHTTPHandler(svc)
+
+	assertErr := func(t *testing.T, err error, id errorrrs.ID, code errorrrs.Code) {
+		e, ok := err.(*errorrrs.E)
+		require.True(t, ok)
+		assert.Equal(t, id, e.ID)
+		assert.Equal(t, code, e.Code)
+	}
+
+	t.Run("no key", func(tt *testing.T) {
+		ctx := context.Background()
+		_, err := svc.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: "bob-456", Frozen: true})
+		assertErr(tt, err, errorrrs.Unauthorized, errorrrs.CodeUnauthenticated)
+		_, err = svc.RequestAdjustment(ctx, wallet.AdjustmentRequest{AccountID: "bob-456", Amount: 5, Reason: "goodwill"})
+		assertErr(tt, err, errorrrs.Unauthorized, errorrrs.CodeUnauthenticated)
+
+		for _, req := range []struct{ method, url, body string }{
+			{"POST", "/wallets/bob-456/freeze", ""},
+			{"POST", "/adjustments", `{"account_id": "bob-456", "amount": 5, "reason": "goodwill"}`},
+			{"GET", "/audit", ""},
+		} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(req.method, req.url, strings.NewReader(req.body)))
+			assert.Equal(tt, http.StatusUnauthorized, w.Code, req.url)
+		}
+	})
+
+	t.Run("non-admin key", func(tt *testing.T) {
+		ctx := wallet.WithAPIKey(context.Background(), key.Key)
+		_, err := svc.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: "bob-456", Frozen: true})
+		assertErr(tt, err, errorrrs.Forbidden, errorrrs.CodeForbidden)
+		_, err = svc.RequestAdjustment(ctx, wallet.AdjustmentRequest{AccountID: "bob-456", Amount: 5, Reason: "goodwill"})
+		assertErr(tt, err, errorrrs.Forbidden, errorrrs.CodeForbidden)
+	})
+}
+
+// TestHTTPTenants runs requests of two tenants through the whole stack
+func TestHTTPTenants(t *testing.T) {
+	repo := wallet.NewMemRepo()
+	acme := newTenant(t, repo, wallet.Tenant{ID: "acme", Name: "Acme", Currencies: []string{"USD"}, MaxTransferAmount: 50})
+	umbrella := newTenant(t, repo, wallet.Tenant{ID: "umbrella", Name: "Umbrella"})
+	handler := wallet.MakeHTTPHandler(&wallet.AuthMiddleware{
+		Next: &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		},
+		Keys:     repo,
+		Required: true,
+	})
+
+	do := func(t *testing.T, method, url, body string, header http.Header) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.Nil(t, err)
+		req.RemoteAddr = "192.0.2.1:4321"
+		for k, vs := range header {
+			req.Header.Set(k, vs[0])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	asAcme := http.Header{wallet.AuthorizationHeader: {"Bearer " + acme.Key}}
+	asUmbrella := http.Header{wallet.APIKeyHeader: {umbrella.Key}}
+
+	t.Run("unauthenticated", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := do(tt, "GET", "/wallets", "", nil)
+		as.Equal(http.StatusUnauthorized, w.Code)
+		as.NotEmpty(w.Header().Get("WWW-Authenticate"))
+		var prob errorrrs.Problem
+		as.Nil(json.Unmarshal(w.Body.Bytes(), &prob))
+		as.Equal(errorrrs.CodeUnauthenticated, prob.Code)
+	})
+
+	t.Run("isolation", func(tt *testing.T) {
+		as := assert.New(tt)
+		for _, h := range []http.Header{asAcme, asUmbrella} {
+			w := do(tt, "POST", "/wallets", `{"id": "alice-123", "currency": "USD", "init_amt": 100}`, h)
+			as.Equal(http.StatusOK, w.Code, w.Body.String())
+		}
+		w := do(tt, "POST", "/wallets", `{"id": "bob-456", "currency": "USD"}`, asUmbrella)
+		as.Equal(http.StatusOK, w.Code, w.Body.String())
+
+		w = do(tt, "GET", "/wallets/bob-456", "", asAcme)
+		as.Equal(http.StatusNotFound, w.Code)
+		w = do(tt, "POST", "/wallets/alice-123/payments", `{"to_account": "bob-456", "amount": 10}`, asAcme)
+		as.Equal(http.StatusNotFound, w.Code, "cross-tenant payment")
+		w = do(tt, "POST", "/wallets/alice-123/payments", `{"to_account": "bob-456", "amount": 10}`, asUmbrella)
+		as.Equal(http.StatusOK, w.Code, w.Body.String())
+
+		var accts []wallet.Account
+		w = do(tt, "GET", "/wallets", "", asAcme)
+		as.Nil(json.Unmarshal(w.Body.Bytes(), &accts))
+		as.Len(accts, 1)
+		as.Equal(100.0, accts[0].Balance)
+	})
+
+	t.Run("ledger proof", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		var transfers []wallet.Transfer
+		w := do(tt, "GET", "/transfers", "", asUmbrella)
+		reqrd.Nil(json.Unmarshal(w.Body.Bytes(), &transfers))
+		reqrd.Len(transfers, 1)
+		url := "/ledger/proof?transfer_id=" + strconv.Itoa(transfers[0].ID)
+
+		w = do(tt, "GET", url, "", asUmbrella)
+		as.Equal(http.StatusConflict, w.Code, "not chained yet")
+		as.Contains(w.Body.String(), string(errorrrs.CodeTransferPending))
+		_, err := repo.ChainLedger(context.Background())
+		reqrd.Nil(err)
+		w = do(tt, "GET", url, "", asUmbrella)
+		reqrd.Equal(http.StatusOK, w.Code, w.Body.String())
+		var proof wallet.LedgerProof
+		reqrd.Nil(json.Unmarshal(w.Body.Bytes(), &proof))
+		as.Equal("umbrella", proof.TenantID)
+		as.Equal(transfers[0].ID, proof.Transfer.ID)
+		as.NotEmpty(proof.Transfer.Hash)
+		as.Nil(proof.Checkpoint)
+		w = do(tt, "GET", url, "", asAcme)
+		as.Equal(http.StatusNotFound, w.Code, "transfer of another tenant")
+		as.Contains(w.Body.String(), string(errorrrs.CodeTransferNotFound))
+		w = do(tt, "GET", "/ledger/proof", "", asUmbrella)
+		as.Equal(http.StatusBadRequest, w.Code)
+		as.Contains(w.Body.String(), "transfer_id")
+	})
+
+	t.Run("tenant limits", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := do(tt, "POST", "/wallets", `{"id": "chen-789", "currency": "CNY"}`, asAcme)
+		as.Equal(http.StatusBadRequest, w.Code)
+		as.Contains(w.Body.String(), "not allowed for tenant")
+		w = do(tt, "POST", "/wallets", `{"id": "chen-789", "currency": "CNY"}`, asUmbrella)
+		as.Equal(http.StatusOK, w.Code, w.Body.String())
+
+		w = do(tt, "POST", "/wallets", `{"id": "dana-012", "currency": "USD"}`, asAcme)
+		as.Equal(http.StatusOK, w.Code, w.Body.String())
+		w = do(tt, "POST", "/wallets/alice-123/payments", `{"to_account": "dana-012", "amount": 60}`, asAcme)
+		as.Equal(http.StatusBadRequest, w.Code)
+		as.Contains(w.Body.String(), "for tenant")
+	})
+
+	t.Run("admin", func(tt *testing.T) {
+		as := assert.New(tt)
+		admin, err := repo.CreateAPIKey(context.Background(), wallet.APIKey{TenantID: "acme", Admin: true})
+		require.Nil(tt, err)
+		asAdmin := http.Header{wallet.AuthorizationHeader: {"Bearer " + admin.Key}}
+
+		for _, req := range []struct{ method, url, body string }{
+			{"POST", "/adjustments", `{"account_id": "alice-123", "amount": 5, "reason": "goodwill"}`},
+			{"GET", "/adjustments", ""},
+			{"GET", "/adjustments/1", ""},
+			{"POST", "/adjustments/1/reject", ""},
+			{"POST", "/wallets/alice-123/freeze", ""},
+			{"POST", "/wallets/alice-123/unfreeze", ""},
+			{"GET", "/reconciliation", ""},
+			{"GET", "/audit", ""},
+		} {
+			w := do(tt, req.method, req.url, req.body, asAcme)
+			as.Equal(http.StatusForbidden, w.Code, req.url)
+			var prob errorrrs.Problem
+			as.Nil(json.Unmarshal(w.Body.Bytes(), &prob))
+			as.Equal(errorrrs.CodeForbidden, prob.Code)
+
+			w = do(tt, req.method, req.url, req.body, asAdmin)
+			as.Equal(http.StatusOK, w.Code, w.Body.String())
+		}
+
+		w := do(tt, "POST", "/wallets/alice-123/freeze", "", asAdmin)
+		as.Equal(http.StatusOK, w.Code, w.Body.String())
+		w = do(tt, "POST", "/wallets/alice-123/payments", `{"to_account": "dana-012", "amount": 1}`, asAcme)
+		as.Equal(http.StatusUnprocessableEntity, w.Code)
+		as.Contains(w.Body.String(), string(errorrrs.CodeAccountFrozen))
+
+		w = do(tt, "GET", "/audit?target=alice-123&actor=apikey:"+admin.ID, "", asAdmin)
+		as.Equal(http.StatusOK, w.Code, w.Body.String())
+		var entries []wallet.AuditEntry
+		as.Nil(json.Unmarshal(w.Body.Bytes(), &entries))
+		actions := make([]string, len(entries))
+		for i, e := range entries {
+			actions[i] = e.Action
+			as.Equal("192.0.2.1", e.SourceIP)
+			as.Equal(wallet.AuditOutcomeOK, e.Outcome)
+		}
+		as.Equal([]string{
+			wallet.AuditRequestAdjustment,
+			wallet.AuditRejectAdjustment,
+			wallet.AuditFreezeAccount,
+			wallet.AuditUnfreezeAccount,
+			wallet.AuditFreezeAccount,
+		}, actions)
+
+		w = do(tt, "GET", "/audit?actor=apikey:"+acme.ID+"&limit=1&after_id="+strconv.Itoa(entries[len(entries)-1].ID), "", asAdmin)
+		as.Equal(http.StatusOK, w.Code, w.Body.String())
+		as.Nil(json.Unmarshal(w.Body.Bytes(), &entries))
+		reqrd := require.New(tt)
+		reqrd.Len(entries, 1)
+		as.Equal(wallet.AuditCreatePayment, entries[0].Action)
+		as.Equal(string(errorrrs.CodeAccountFrozen), entries[0].Outcome)
+
+		w = do(tt, "GET", "/audit?from=yesterday", "", asAdmin)
+		as.Equal(http.StatusBadRequest, w.Code)
+		as.Contains(w.Body.String(), "RFC 3339")
+
+		// adjustments are approved by another admin than their requester
+		w = do(tt, "POST", "/adjustments", `{"account_id": "dana-012", "amount": 5, "reason": "goodwill"}`, asAdmin)
+		reqrd.Equal(http.StatusOK, w.Code, w.Body.String())
+		var adj wallet.Adjustment
+		reqrd.Nil(json.Unmarshal(w.Body.Bytes(), &adj))
+		as.Equal("apikey:"+admin.ID, adj.RequestedBy)
+		approve := "/adjustments/" + strconv.Itoa(adj.ID) + "/approve"
+		w = do(tt, "POST", approve, `{"note": "checked"}`, asAdmin)
+		as.Equal(http.StatusForbidden, w.Code)
+		as.Contains(w.Body.String(), string(errorrrs.CodeSelfApproval))
+		checker, err := repo.CreateAPIKey(context.Background(), wallet.APIKey{TenantID: "acme", Admin: true})
+		reqrd.Nil(err)
+		w = do(tt, "POST", approve, `{"note": "checked"}`, http.Header{wallet.APIKeyHeader: {checker.Key}})
+		reqrd.Equal(http.StatusOK, w.Code, w.Body.String())
+		reqrd.Nil(json.Unmarshal(w.Body.Bytes(), &adj))
+		as.Equal(wallet.AdjustmentApproved, adj.Status)
+		as.Equal("checked", adj.Note)
+		w = do(tt, "GET", "/wallets/dana-012", "", asAcme)
+		as.Contains(w.Body.String(), `"balance":5`)
+		w = do(tt, "POST", "/adjustments/x/approve", "", asAdmin)
+		as.Equal(http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestGRPCAuth(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	next := MOCKWALLET.NewMockService(ctrl)
+	repo := wallet.NewMemRepo()
+	key := newTenant(t, repo, wallet.Tenant{ID: "acme", Name: "Acme"})
+
+	client := newGRPCClient(t, &wallet.AuthMiddleware{Next: next, Keys: repo, Required: true})
+
+	_, err := client.GetAccount(context.Background(), &pb.GetAccountRequest{Id: "sato-91011"})
+	as.Equal(codes.Unauthenticated, status.Code(err))
+
+	next.EXPECT().
+		GetAccount(gomock.Any(), wallet.GetAccountRequest{ID: "sato-91011"}).
+		DoAndReturn(func(ctx context.Context, req wallet.GetAccountRequest) (wallet.Account, error) {
+			p, ok := wallet.PrincipalFrom(ctx)
+			as.True(ok)
+			as.Equal("acme", p.Tenant.ID)
+			return wallet.Account{ID: req.ID, Currency: "CNY"}, nil
+		}).
+		Times(2)
+
+	for _, md := range []metadata.MD{
+		metadata.Pairs("authorization", "Bearer "+key.Key),
+		metadata.Pairs("x-api-key", key.Key),
+	} {
+		ctx := metadata.NewOutgoingContext(context.Background(), md)
+		_, err = client.GetAccount(ctx, &pb.GetAccountRequest{Id: "sato-91011"})
+		reqrd.Nil(err)
+	}
+}
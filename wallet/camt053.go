@@ -0,0 +1,444 @@
+package wallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Camt053Namespace is the ISO 20022 bank-to-customer statement
+// message version that statements are rendered as
+const Camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+var rgxpWalletsIDStatement = regexp.MustCompile(`/wallets/([\w-]+)/statement\.xml`)
+
+// The types below mirror the subset of camt.053.001.02 that a wallet
+// statement needs. Element order within each type follows the schema's
+// sequences so field order here must not be changed.
+
+type camt053Document struct {
+	XMLName xml.Name         `xml:"Document"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Stmt    camt053BkToCstmr `xml:"BkToCstmrStmt"`
+}
+
+type camt053BkToCstmr struct {
+	GrpHdr camt053GrpHdr `xml:"GrpHdr"`
+	Stmt   camt053Stmt   `xml:"Stmt"`
+}
+
+type camt053GrpHdr struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type camt053Stmt struct {
+	Id        string           `xml:"Id"`
+	CreDtTm   string           `xml:"CreDtTm"`
+	FrToDt    camt053FrToDt    `xml:"FrToDt"`
+	Acct      camt053Acct      `xml:"Acct"`
+	Bal       []camt053Bal     `xml:"Bal"`
+	TxsSummry camt053TxsSummry `xml:"TxsSummry"`
+	Ntry      []camt053Ntry    `xml:"Ntry"`
+}
+
+type camt053FrToDt struct {
+	FrDtTm string `xml:"FrDtTm"`
+	ToDtTm string `xml:"ToDtTm"`
+}
+
+type camt053Acct struct {
+	Id  camt053AcctId `xml:"Id"`
+	Ccy string        `xml:"Ccy,omitempty"`
+}
+
+type camt053AcctId struct {
+	Othr struct {
+		Id string `xml:"Id"`
+	} `xml:"Othr"`
+}
+
+type camt053Amt struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camt053Bal struct {
+	Tp struct {
+		CdOrPrtry struct {
+			Cd string `xml:"Cd"`
+		} `xml:"CdOrPrtry"`
+	} `xml:"Tp"`
+	Amt       camt053Amt `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Dt        struct {
+		Dt string `xml:"Dt"`
+	} `xml:"Dt"`
+}
+
+type camt053TxsSummry struct {
+	TtlNtries    camt053NumSum `xml:"TtlNtries"`
+	TtlCdtNtries camt053NumSum `xml:"TtlCdtNtries"`
+	TtlDbtNtries camt053NumSum `xml:"TtlDbtNtries"`
+}
+
+type camt053NumSum struct {
+	NbOfNtries string `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+}
+
+type camt053DtTm struct {
+	DtTm string `xml:"DtTm"`
+}
+
+type camt053Ntry struct {
+	NtryRef     string      `xml:"NtryRef"`
+	Amt         camt053Amt  `xml:"Amt"`
+	CdtDbtInd   string      `xml:"CdtDbtInd"`
+	Sts         string      `xml:"Sts"`
+	BookgDt     camt053DtTm `xml:"BookgDt"`
+	ValDt       camt053DtTm `xml:"ValDt"`
+	AcctSvcrRef string      `xml:"AcctSvcrRef"`
+	BkTxCd      struct {
+		Prtry struct {
+			Cd string `xml:"Cd"`
+		} `xml:"Prtry"`
+	} `xml:"BkTxCd"`
+	NtryDtls struct {
+		TxDtls camt053TxDtls `xml:"TxDtls"`
+	} `xml:"NtryDtls"`
+}
+
+type camt053TxDtls struct {
+	Refs struct {
+		AcctSvcrRef string `xml:"AcctSvcrRef"`
+		EndToEndId  string `xml:"EndToEndId"`
+	} `xml:"Refs"`
+	RltdPties struct {
+		DbtrAcct camt053Acct `xml:"DbtrAcct"`
+		CdtrAcct camt053Acct `xml:"CdtrAcct"`
+	} `xml:"RltdPties"`
+	RmtInf *camt053RmtInf `xml:"RmtInf,omitempty"`
+}
+
+type camt053RmtInf struct {
+	Ustrd string `xml:"Ustrd"`
+}
+
+const (
+	camt053Credit = "CRDT"
+	camt053Debit  = "DBIT"
+
+	camt053DtTmLayout = "2006-01-02T15:04:05.000Z07:00"
+	camt053DtLayout   = "2006-01-02"
+)
+
+// camt053Amount formats an amount of currency `ccy` as a camt
+// `ActiveOrHistoricCurrencyAndAmount`, to the minor unit of the currency.
+// It is unsigned; the sign is carried by the credit/debit indicator.
+func camt053Amount(amt float64, ccy string) string {
+	return strconv.FormatFloat(math.Abs(amt), 'f', minorUnits(ccy), 64)
+}
+
+func camt053Indicator(amt float64) string {
+	if amt < 0 {
+		return camt053Debit
+	}
+	return camt053Credit
+}
+
+func camt053Balance(code string, amt float64, ccy string, at time.Time) camt053Bal {
+	var bal camt053Bal
+	bal.Tp.CdOrPrtry.Cd = code
+	bal.Amt = camt053Amt{Ccy: ccy, Value: camt053Amount(amt, ccy)}
+	bal.CdtDbtInd = camt053Indicator(amt)
+	bal.Dt.Dt = at.UTC().Format(camt053DtLayout)
+
+	return bal
+}
+
+func camt053AcctOf(id, ccy string) camt053Acct {
+	var acct camt053Acct
+	acct.Id.Othr.Id = camt053AcctID(id)
+	acct.Ccy = ccy
+
+	return acct
+}
+
+// camt053MaxAcctIDLen is that of the `Max34Text` of camt account identifications
+const camt053MaxAcctIDLen = 34
+
+// camt053AcctID fits account ID `id` into a camt account identification.
+// Longer IDs are cut short and suffixed with `~` and a hash of the whole ID,
+// which keeps them recognizable, unique and apart from actual IDs (which
+// cannot contain `~`).
+func camt053AcctID(id string) string {
+	if len(id) <= camt053MaxAcctIDLen {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	hash := hex.EncodeToString(sum[:6])
+
+	return id[:camt053MaxAcctIDLen-len(hash)-1] + "~" + hash
+}
+
+// camt053Ref derives an identifier from `parts` that fits
+// the `Max35Text` type of camt message/statement identifications
+func camt053Ref(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:35]
+}
+
+// newCamt053Document renders a statement as a camt.053 document
+// created at `now`
+func newCamt053Document(stmt Statement, now time.Time) camt053Document {
+	acct := stmt.Account
+	from := stmt.From
+	if from.Before(acct.CreatedAt) {
+		from = acct.CreatedAt
+	}
+	created := now.UTC().Format(camt053DtTmLayout)
+	stmtID := camt053Ref(acct.ID, from.String(), stmt.To.String())
+
+	doc := camt053Document{Xmlns: Camt053Namespace}
+	doc.Stmt.GrpHdr = camt053GrpHdr{
+		MsgId:   camt053Ref(stmtID, created),
+		CreDtTm: created,
+	}
+
+	s := &doc.Stmt.Stmt
+	s.Id = stmtID
+	s.CreDtTm = created
+	s.FrToDt = camt053FrToDt{
+		FrDtTm: from.UTC().Format(camt053DtTmLayout),
+		ToDtTm: stmt.To.UTC().Format(camt053DtTmLayout),
+	}
+	s.Acct = camt053AcctOf(acct.ID, acct.Currency)
+	s.Bal = []camt053Bal{
+		camt053Balance("OPBD", stmt.OpeningBalance, acct.Currency, from),
+		// `To` is exclusive so the closing balance is as of the instant before it
+		camt053Balance("CLBD", stmt.ClosingBalance, acct.Currency, stmt.To.Add(-time.Nanosecond)),
+	}
+
+	var (
+		cdtN, dbtN     int
+		cdtSum, dbtSum float64
+	)
+	s.Ntry = make([]camt053Ntry, len(stmt.Entries))
+	for i, t := range stmt.Entries {
+		ref := strconv.Itoa(t.ID)
+		booked := t.CreatedAt.UTC().Format(camt053DtTmLayout)
+
+		ntry := &s.Ntry[i]
+		ntry.NtryRef = ref
+		ntry.Amt = camt053Amt{Ccy: t.Currency, Value: camt053Amount(t.Amount, t.Currency)}
+		if t.To == acct.ID {
+			ntry.CdtDbtInd = camt053Credit
+			cdtN++
+			cdtSum += t.Amount
+		} else {
+			ntry.CdtDbtInd = camt053Debit
+			dbtN++
+			dbtSum += t.Amount
+		}
+		ntry.Sts = "BOOK"
+		ntry.BookgDt.DtTm = booked
+		ntry.ValDt.DtTm = booked
+		ntry.AcctSvcrRef = ref
+		ntry.BkTxCd.Prtry.Cd = "TRANSFER"
+
+		txDtls := &ntry.NtryDtls.TxDtls
+		txDtls.Refs.AcctSvcrRef = ref
+		// the payer's reference identifies the payment end to end
+		txDtls.Refs.EndToEndId = "NOTPROVIDED"
+		if t.Reference != "" {
+			txDtls.Refs.EndToEndId = t.Reference
+		}
+		txDtls.RltdPties.DbtrAcct = camt053AcctOf(t.From, "")
+		txDtls.RltdPties.CdtrAcct = camt053AcctOf(t.To, "")
+		if t.Description != "" {
+			txDtls.RmtInf = &camt053RmtInf{Ustrd: t.Description}
+		}
+	}
+	s.TxsSummry = camt053TxsSummry{
+		TtlNtries: camt053NumSum{
+			NbOfNtries: strconv.Itoa(cdtN + dbtN),
+			Sum:        camt053Amount(cdtSum+dbtSum, acct.Currency),
+		},
+		TtlCdtNtries: camt053NumSum{
+			NbOfNtries: strconv.Itoa(cdtN),
+			Sum:        camt053Amount(cdtSum, acct.Currency),
+		},
+		TtlDbtNtries: camt053NumSum{
+			NbOfNtries: strconv.Itoa(dbtN),
+			Sum:        camt053Amount(dbtSum, acct.Currency),
+		},
+	}
+
+	return doc
+}
+
+func MakeStatementEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(StatementRequest)
+		return svc.GetStatement(ctx, req)
+	}
+}
+
+// DecodeHTTPStatementReq accepts optional `from` and `to` query params, either
+// as RFC 3339 timestamps or as dates. Dates are inclusive on both ends,
+// e.g. `?from=2021-10-01&to=2021-10-31` is the whole month of October.
+func DecodeHTTPStatementReq(_ context.Context, req *http.Request) (interface{}, error) {
+	var stmtReq StatementRequest
+	match := rgxpWalletsIDStatement.FindStringSubmatch(req.URL.Path)
+	if len(match) < 2 {
+		return nil, &errorrrs.E{
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed path: should be of `/wallets/{id}/statement.xml` format",
+		}
+	}
+	stmtReq.ID = match[1]
+
+	var err error
+	if from := req.URL.Query().Get("from"); from != "" {
+		if stmtReq.From, err = parseStatementTime(from, false); err != nil {
+			return nil, err
+		}
+	}
+	if to := req.URL.Query().Get("to"); to != "" {
+		if stmtReq.To, err = parseStatementTime(to, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmtReq, nil
+}
+
+func parseStatementTime(v string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(camt053DtLayout, v)
+	if err != nil {
+		field := "from"
+		if end {
+			field = "to"
+		}
+		msg := "malformed statement period: should be a date (YYYY-MM-DD) or RFC 3339 timestamp"
+		return t, &errorrrs.E{
+			ID:     errorrrs.BadRequest,
+			Code:   errorrrs.CodeValidationFailed,
+			Msg:    msg,
+			Fields: []errorrrs.FieldError{{Field: field, Msg: msg}},
+		}
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+func EncodeCamt053Response(_ context.Context, w http.ResponseWriter, resp interface{}) error {
+	doc := newCamt053Document(resp.(Statement), time.Now())
+	w.Header().Add("Content-Type", "application/xml")
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	return enc.Encode(doc)
+}
+
+// ParseCamt053 reads back a statement as rendered by `EncodeCamt053Response`,
+// e.g. by clients of the API. Documents carry neither metadata nor the
+// account's current balance, amounts are rounded to the minor unit of
+// their currency and account IDs longer than 34 characters are shortened
+// (see `camt053AcctID`), so what is read back is only as exact as the document.
+func ParseCamt053(r io.Reader) (Statement, error) {
+	var doc camt053Document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return Statement{}, fmt.Errorf("camt.053: %w", err)
+	}
+
+	// err keeps the first parse error of the fields below
+	var err error
+	parseTime := func(v string) time.Time {
+		t, tErr := time.Parse(time.RFC3339, v)
+		if err == nil {
+			err = tErr
+		}
+		return t
+	}
+	parseAmount := func(amt camt053Amt, indicator string) float64 {
+		f, fErr := strconv.ParseFloat(amt.Value, 64)
+		if err == nil {
+			err = fErr
+		}
+		if indicator == camt053Debit {
+			return -f
+		}
+		return f
+	}
+
+	s := doc.Stmt.Stmt
+	stmt := Statement{
+		Account: Account{ID: s.Acct.Id.Othr.Id, Currency: s.Acct.Ccy},
+		From:    parseTime(s.FrToDt.FrDtTm),
+		To:      parseTime(s.FrToDt.ToDtTm),
+	}
+	for _, bal := range s.Bal {
+		switch bal.Tp.CdOrPrtry.Cd {
+		case "OPBD":
+			stmt.OpeningBalance = parseAmount(bal.Amt, bal.CdtDbtInd)
+		case "CLBD":
+			stmt.ClosingBalance = parseAmount(bal.Amt, bal.CdtDbtInd)
+		}
+	}
+	stmt.Entries = make([]Transfer, len(s.Ntry))
+	for i, ntry := range s.Ntry {
+		id, idErr := strconv.Atoi(ntry.NtryRef)
+		if err == nil {
+			err = idErr
+		}
+		txDtls := ntry.NtryDtls.TxDtls
+		t := Transfer{
+			ID:        id,
+			From:      txDtls.RltdPties.DbtrAcct.Id.Othr.Id,
+			To:        txDtls.RltdPties.CdtrAcct.Id.Othr.Id,
+			Currency:  ntry.Amt.Ccy,
+			Amount:    parseAmount(ntry.Amt, camt053Credit),
+			CreatedAt: parseTime(ntry.BookgDt.DtTm),
+		}
+		if ref := txDtls.Refs.EndToEndId; ref != "NOTPROVIDED" {
+			t.Reference = ref
+		}
+		if txDtls.RmtInf != nil {
+			t.Description = txDtls.RmtInf.Ustrd
+		}
+		stmt.Entries[i] = t
+	}
+	if err != nil {
+		return Statement{}, fmt.Errorf("camt.053: %w", err)
+	}
+
+	return stmt, nil
+}
@@ -0,0 +1,401 @@
+package wallet_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet"
+	MOCKWALLET "github.com/arhyth/genwallet/wallet/mock"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// particle is an element within a schema sequence
+type particle struct {
+	name     string
+	min, max int // max < 0 is unbounded
+}
+
+const unbounded = -1
+
+// camt053Schema is the structure of the camt.053.001.02 schema elements
+// rendered by the wallet statement: each complex element's children
+// in sequence order along with their cardinality. Optional elements
+// that are never rendered are left out. Some names (`Id`, `Dt`) are of
+// a complex type in one place and of a simple type in another; elements
+// are looked up here only when they have children.
+var camt053Schema = map[string][]particle{
+	"Document":      {{"BkToCstmrStmt", 1, 1}},
+	"BkToCstmrStmt": {{"GrpHdr", 1, 1}, {"Stmt", 1, unbounded}},
+	"GrpHdr":        {{"MsgId", 1, 1}, {"CreDtTm", 1, 1}},
+	"Stmt": {
+		{"Id", 1, 1}, {"CreDtTm", 1, 1}, {"FrToDt", 0, 1}, {"Acct", 1, 1},
+		{"Bal", 1, unbounded}, {"TxsSummry", 0, 1}, {"Ntry", 0, unbounded},
+	},
+	"FrToDt":       {{"FrDtTm", 1, 1}, {"ToDtTm", 1, 1}},
+	"Acct":         {{"Id", 1, 1}, {"Ccy", 0, 1}},
+	"DbtrAcct":     {{"Id", 1, 1}, {"Ccy", 0, 1}},
+	"CdtrAcct":     {{"Id", 1, 1}, {"Ccy", 0, 1}},
+	"Id":           {{"Othr", 1, 1}},
+	"Othr":         {{"Id", 1, 1}},
+	"Dt":           {{"Dt", 1, 1}},
+	"Bal":          {{"Tp", 1, 1}, {"Amt", 1, 1}, {"CdtDbtInd", 1, 1}, {"Dt", 1, 1}},
+	"Tp":           {{"CdOrPrtry", 1, 1}},
+	"CdOrPrtry":    {{"Cd", 1, 1}},
+	"TxsSummry":    {{"TtlNtries", 0, 1}, {"TtlCdtNtries", 0, 1}, {"TtlDbtNtries", 0, 1}},
+	"TtlNtries":    {{"NbOfNtries", 0, 1}, {"Sum", 0, 1}},
+	"TtlCdtNtries": {{"NbOfNtries", 0, 1}, {"Sum", 0, 1}},
+	"TtlDbtNtries": {{"NbOfNtries", 0, 1}, {"Sum", 0, 1}},
+	"Ntry": {
+		{"NtryRef", 0, 1}, {"Amt", 1, 1}, {"CdtDbtInd", 1, 1}, {"Sts", 1, 1},
+		{"BookgDt", 0, 1}, {"ValDt", 0, 1}, {"AcctSvcrRef", 0, 1},
+		{"BkTxCd", 1, 1}, {"NtryDtls", 0, unbounded},
+	},
+	"BookgDt":   {{"DtTm", 1, 1}},
+	"ValDt":     {{"DtTm", 1, 1}},
+	"BkTxCd":    {{"Prtry", 0, 1}},
+	"Prtry":     {{"Cd", 1, 1}},
+	"NtryDtls":  {{"TxDtls", 0, unbounded}},
+	"TxDtls":    {{"Refs", 0, 1}, {"RltdPties", 0, 1}, {"RmtInf", 0, 1}},
+	"Refs":      {{"AcctSvcrRef", 0, 1}, {"EndToEndId", 0, 1}},
+	"RltdPties": {{"DbtrAcct", 0, 1}, {"CdtrAcct", 0, 1}},
+	"RmtInf":    {{"Ustrd", 0, unbounded}},
+}
+
+// camt053Simple are the patterns of simple typed elements' content, of
+// their name or, where it differs, of their parent's name and theirs
+var camt053Simple = map[string]*regexp.Regexp{
+	"MsgId":       regexp.MustCompile(`^.{1,35}$`),
+	"Id":          regexp.MustCompile(`^.{1,35}$`),
+	"Othr/Id":     regexp.MustCompile(`^.{1,34}$`),
+	"CreDtTm":     regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`),
+	"FrDtTm":      regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`),
+	"ToDtTm":      regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`),
+	"DtTm":        regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`),
+	"Dt":          regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`),
+	"Ccy":         regexp.MustCompile(`^[A-Z]{3}$`),
+	"Amt":         regexp.MustCompile(`^\d{1,13}(\.\d{1,5})?$`),
+	"Sum":         regexp.MustCompile(`^\d{1,13}(\.\d{1,5})?$`),
+	"NbOfNtries":  regexp.MustCompile(`^\d{1,15}$`),
+	"CdtDbtInd":   regexp.MustCompile(`^(CRDT|DBIT)$`),
+	"Cd":          regexp.MustCompile(`^.{1,35}$`),
+	"Sts":         regexp.MustCompile(`^(BOOK|PDNG|INFO)$`),
+	"NtryRef":     regexp.MustCompile(`^.{1,35}$`),
+	"AcctSvcrRef": regexp.MustCompile(`^.{1,35}$`),
+	"EndToEndId":  regexp.MustCompile(`^.{1,35}$`),
+	"Ustrd":       regexp.MustCompile(`^.{1,140}$`),
+}
+
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+// validateCamt053 checks `n`, and recursively its children, against
+// the schema structure above returning every violation found
+func validateCamt053(n xmlNode, path string) []string {
+	parent := path[strings.LastIndex(path, "/")+1:]
+	path += "/" + n.XMLName.Local
+	if n.XMLName.Space != wallet.Camt053Namespace {
+		return []string{fmt.Sprintf("%v: unexpected namespace %q", path, n.XMLName.Space)}
+	}
+
+	if len(n.Children) == 0 {
+		rgxp, simple := camt053Simple[parent+"/"+n.XMLName.Local]
+		if !simple {
+			rgxp, simple = camt053Simple[n.XMLName.Local]
+		}
+		if !simple {
+			return []string{fmt.Sprintf("%v: unknown element", path)}
+		}
+		if !rgxp.MatchString(strings.TrimSpace(n.Content)) {
+			return []string{fmt.Sprintf("%v: invalid content %q", path, n.Content)}
+		}
+		return nil
+	}
+
+	seq, complex := camt053Schema[n.XMLName.Local]
+	if !complex {
+		return []string{fmt.Sprintf("%v: unknown element", path)}
+	}
+	var errs []string
+	i := 0
+	for _, p := range seq {
+		count := 0
+		for i < len(n.Children) && n.Children[i].XMLName.Local == p.name {
+			errs = append(errs, validateCamt053(n.Children[i], path)...)
+			count++
+			i++
+		}
+		if count < p.min || (p.max != unbounded && count > p.max) {
+			errs = append(errs, fmt.Sprintf("%v/%v: occurs %d times", path, p.name, count))
+		}
+	}
+	if i < len(n.Children) {
+		errs = append(errs, fmt.Sprintf("%v/%v: unexpected element", path, n.Children[i].XMLName.Local))
+	}
+
+	return errs
+}
+
+func TestHTTPGetStatement(t *testing.T) {
+	t.Run("success", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		walletSvc := &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		}
+
+		serverErrcoder := httptransport.ServerErrorEncoder(errorrrs.GokitErrorEncoder)
+		statementHandler := httptransport.NewServer(
+			wallet.MakeStatementEndpt(walletSvc),
+			wallet.DecodeHTTPStatementReq,
+			wallet.EncodeCamt053Response,
+			serverErrcoder)
+		w := httptest.NewRecorder()
+
+		acctID := "bob-888"
+		from := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+		stmt := wallet.Statement{
+			Account: wallet.Account{
+				ID:        acctID,
+				Balance:   150.0,
+				Currency:  "USD",
+				CreatedAt: from.AddDate(0, -1, 0),
+			},
+			From:           from,
+			To:             to,
+			OpeningBalance: 350.0,
+			ClosingBalance: 100.0,
+			Entries: []wallet.Transfer{
+				{
+					ID:        7,
+					From:      "sato-91011",
+					To:        acctID,
+					Amount:    50.0,
+					Currency:  "USD",
+					CreatedAt: from.AddDate(0, 0, 3),
+				},
+				{
+					ID:          9,
+					From:        acctID,
+					To:          "fan-1234",
+					Amount:      300.0,
+					Currency:    "USD",
+					CreatedAt:   from.AddDate(0, 0, 5),
+					Description: "October rent",
+					Reference:   "rent-2021-10",
+				},
+			},
+		}
+		stmtReq := wallet.StatementRequest{
+			ID:   acctID,
+			From: from,
+			To:   to,
+		}
+		req, err := http.NewRequest("GET",
+			fmt.Sprintf(`/wallets/%v/statement.xml?from=2021-10-01&to=2021-10-31`, acctID), nil)
+		reqrd.Nil(err)
+
+		repo.EXPECT().
+			GetStatement(gomock.Any(), stmtReq).
+			Return(stmt, nil).
+			Times(1)
+
+		statementHandler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusOK, w.Code)
+		bits, err := io.ReadAll(w.Result().Body)
+		reqrd.Nil(err)
+
+		var doc xmlNode
+		reqrd.Nil(xml.Unmarshal(bits, &doc))
+		as.Empty(validateCamt053(doc, ""))
+
+		var parsed struct {
+			Bal []struct {
+				Cd        string `xml:"Tp>CdOrPrtry>Cd"`
+				Amt       string `xml:"Amt"`
+				CdtDbtInd string `xml:"CdtDbtInd"`
+				Dt        string `xml:"Dt>Dt"`
+			} `xml:"BkToCstmrStmt>Stmt>Bal"`
+			Ntry []struct {
+				Ref string `xml:"NtryRef"`
+				Amt struct {
+					Value string `xml:",chardata"`
+					Ccy   string `xml:"Ccy,attr"`
+				} `xml:"Amt"`
+				CdtDbtInd  string `xml:"CdtDbtInd"`
+				Dbtr       string `xml:"NtryDtls>TxDtls>RltdPties>DbtrAcct>Id>Othr>Id"`
+				EndToEndId string `xml:"NtryDtls>TxDtls>Refs>EndToEndId"`
+				Ustrd      string `xml:"NtryDtls>TxDtls>RmtInf>Ustrd"`
+			} `xml:"BkToCstmrStmt>Stmt>Ntry"`
+		}
+		reqrd.Nil(xml.Unmarshal(bits, &parsed))
+
+		reqrd.Len(parsed.Bal, 2)
+		as.Equal("OPBD", parsed.Bal[0].Cd)
+		as.Equal("350.00", parsed.Bal[0].Amt)
+		as.Equal("CRDT", parsed.Bal[0].CdtDbtInd)
+		as.Equal("2021-10-01", parsed.Bal[0].Dt)
+		as.Equal("CLBD", parsed.Bal[1].Cd)
+		as.Equal("100.00", parsed.Bal[1].Amt)
+		as.Equal("2021-10-31", parsed.Bal[1].Dt)
+
+		reqrd.Len(parsed.Ntry, 2)
+		as.Equal("7", parsed.Ntry[0].Ref)
+		as.Equal("CRDT", parsed.Ntry[0].CdtDbtInd)
+		as.Equal("sato-91011", parsed.Ntry[0].Dbtr)
+		as.Equal("NOTPROVIDED", parsed.Ntry[0].EndToEndId)
+		as.Empty(parsed.Ntry[0].Ustrd)
+		as.Equal("9", parsed.Ntry[1].Ref)
+		as.Equal("DBIT", parsed.Ntry[1].CdtDbtInd)
+		as.Equal("300.00", parsed.Ntry[1].Amt.Value)
+		as.Equal("USD", parsed.Ntry[1].Amt.Ccy)
+		as.Equal("rent-2021-10", parsed.Ntry[1].EndToEndId)
+		as.Equal("October rent", parsed.Ntry[1].Ustrd)
+
+		// statements read back are as rendered, less what documents lack
+		read, err := wallet.ParseCamt053(strings.NewReader(string(bits)))
+		reqrd.Nil(err)
+		as.Equal(wallet.Account{ID: acctID, Currency: "USD"}, read.Account)
+		as.True(from.Equal(read.From))
+		as.True(to.Equal(read.To))
+		as.Equal(350.0, read.OpeningBalance)
+		as.Equal(100.0, read.ClosingBalance)
+		reqrd.Len(read.Entries, 2)
+		for i, t := range stmt.Entries {
+			as.True(t.CreatedAt.Equal(read.Entries[i].CreatedAt))
+			read.Entries[i].CreatedAt = t.CreatedAt
+			as.Equal(t, read.Entries[i])
+		}
+		_, err = wallet.ParseCamt053(strings.NewReader("<Document><BkToCstmrStmt>"))
+		as.NotNil(err)
+	})
+
+	t.Run("long IDs and minor units", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+
+		acctID := strings.Repeat("a", wallet.MaxIDLen)
+		otherID := strings.Repeat("a", wallet.MaxIDLen-1) + "b"
+		from := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+		for ccy, amt := range map[string]string{"JPY": "1500", "BHD": "1500.000", "USD": "1500.00"} {
+			stmt := wallet.Statement{
+				Account:        wallet.Account{ID: acctID, Currency: ccy},
+				From:           from,
+				To:             from.AddDate(0, 1, 0),
+				OpeningBalance: 1500,
+				ClosingBalance: 0,
+				Entries: []wallet.Transfer{{
+					ID:        1,
+					From:      acctID,
+					To:        otherID,
+					Amount:    1500,
+					Currency:  ccy,
+					CreatedAt: from.AddDate(0, 0, 1),
+				}},
+			}
+			w := httptest.NewRecorder()
+			reqrd.Nil(wallet.EncodeCamt053Response(context.Background(), w, stmt))
+			bits := w.Body.Bytes()
+
+			var doc xmlNode
+			reqrd.Nil(xml.Unmarshal(bits, &doc))
+			as.Empty(validateCamt053(doc, ""), ccy)
+
+			var parsed struct {
+				Acct string `xml:"BkToCstmrStmt>Stmt>Acct>Id>Othr>Id"`
+				Bal  []struct {
+					Amt string `xml:"Amt"`
+				} `xml:"BkToCstmrStmt>Stmt>Bal"`
+				Sum  string `xml:"BkToCstmrStmt>Stmt>TxsSummry>TtlNtries>Sum"`
+				Ntry []struct {
+					Amt  string `xml:"Amt"`
+					Cdtr string `xml:"NtryDtls>TxDtls>RltdPties>CdtrAcct>Id>Othr>Id"`
+				} `xml:"BkToCstmrStmt>Stmt>Ntry"`
+			}
+			reqrd.Nil(xml.Unmarshal(bits, &parsed))
+			// shortened alike, but apart
+			as.Len(parsed.Acct, 34)
+			as.Equal(acctID[:21], parsed.Acct[:21])
+			reqrd.Len(parsed.Ntry, 1)
+			as.Len(parsed.Ntry[0].Cdtr, 34)
+			as.NotEqual(parsed.Acct, parsed.Ntry[0].Cdtr)
+			reqrd.Len(parsed.Bal, 2)
+			as.Equal(amt, parsed.Bal[0].Amt, ccy)
+			as.Equal(amt, parsed.Sum, ccy)
+			as.Equal(amt, parsed.Ntry[0].Amt, ccy)
+
+			read, err := wallet.ParseCamt053(strings.NewReader(string(bits)))
+			reqrd.Nil(err)
+			as.Equal(parsed.Acct, read.Account.ID)
+			as.Equal(1500.0, read.OpeningBalance)
+		}
+
+		// and the same every time
+		w := httptest.NewRecorder()
+		reqrd.Nil(wallet.EncodeCamt053Response(context.Background(), w,
+			wallet.Statement{Account: wallet.Account{ID: acctID, Currency: "USD"}, From: from, To: from}))
+		as.Contains(w.Body.String(), "<Id>"+acctID[:21]+"~")
+	})
+
+	t.Run("period archived", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		walletSvc := &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		}
+
+		serverErrcoder := httptransport.ServerErrorEncoder(errorrrs.GokitErrorEncoder)
+		statementHandler := httptransport.NewServer(
+			wallet.MakeStatementEndpt(walletSvc),
+			wallet.DecodeHTTPStatementReq,
+			wallet.EncodeCamt053Response,
+			serverErrcoder)
+		w := httptest.NewRecorder()
+
+		req, err := http.NewRequest("GET", `/wallets/bob-888/statement.xml?from=2020-01-01&to=2020-01-31`, nil)
+		reqrd.Nil(err)
+
+		repo.EXPECT().
+			GetStatement(gomock.Any(), gomock.Any()).
+			Return(wallet.Statement{}, fmt.Errorf("%w: before 2021-01-01T00:00:00Z", wallet.ErrPeriodArchived)).
+			Times(1)
+
+		statementHandler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusUnprocessableEntity, w.Code)
+		var prob errorrrs.Problem
+		reqrd.Nil(json.NewDecoder(w.Body).Decode(&prob))
+		as.Equal(errorrrs.CodePeriodArchived, prob.Code)
+	})
+}
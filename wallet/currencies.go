@@ -170,3 +170,22 @@ var ValidCurrencies = map[string]struct{}{
 	"ZMW": {},
 	"ZWL": {},
 }
+
+// currencyMinorUnits are the ISO 4217 minor units (decimals) of the
+// currencies that do not have 2 of them, which amounts are rendered with
+// where precision matters (e.g. statements)
+var currencyMinorUnits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4,
+}
+
+// minorUnits is the number of decimals of currency `cur`
+func minorUnits(cur string) int {
+	if n, ok := currencyMinorUnits[cur]; ok {
+		return n
+	}
+	return 2
+}
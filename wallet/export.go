@@ -0,0 +1,304 @@
+package wallet
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// Media types that listing endpoints can be exported as, through
+// `Accept` header content negotiation
+const (
+	MediaTypeCSV    = "text/csv"
+	MediaTypeNDJSON = "application/x-ndjson"
+)
+
+var (
+	accountCSVHeader  = []string{"id", "balance", "currency", "created_at", "updated_at", "metadata"}
+	paymentCSVHeader  = []string{"id", "account", "from_account", "to_account", "amount", "direction", "created_at", "description", "reference", "metadata"}
+	transferCSVHeader = []string{"id", "from", "to", "currency", "amount", "created_at", "description", "reference", "metadata"}
+)
+
+// exportRow is a listing row that can be written as a CSV record
+// (and, as all domain objects are, as JSON)
+type exportRow interface {
+	csvRecord() []string
+}
+
+// export is a listing response that is never materialized in memory.
+// Its rows are written one by one by `EncodeExportResponse` as they are
+// read from the underlying query.
+type export struct {
+	header []string
+	stream func(emit func(exportRow) error) error
+}
+
+func (a Account) csvRecord() []string {
+	return []string{
+		a.ID,
+		formatAmount(a.Balance),
+		a.Currency,
+		a.CreatedAt.Format(time.RFC3339Nano),
+		a.UpdatedAt.Format(time.RFC3339Nano),
+		formatMetadata(a.Metadata),
+	}
+}
+
+func (p Payment) csvRecord() []string {
+	var from, to string
+	if p.From != nil {
+		from = *p.From
+	}
+	if p.To != nil {
+		to = *p.To
+	}
+
+	return []string{
+		strconv.Itoa(p.ID),
+		p.Self,
+		from,
+		to,
+		formatAmount(p.Amount),
+		p.Direction.String(),
+		p.CreatedAt.Format(time.RFC3339Nano),
+		p.Description,
+		p.Reference,
+		formatMetadata(p.Metadata),
+	}
+}
+
+func (t Transfer) csvRecord() []string {
+	return []string{
+		strconv.Itoa(t.ID),
+		t.From,
+		t.To,
+		t.Currency,
+		formatAmount(t.Amount),
+		t.CreatedAt.Format(time.RFC3339Nano),
+		t.Description,
+		t.Reference,
+		formatMetadata(t.Metadata),
+	}
+}
+
+func formatAmount(amt float64) string {
+	return strconv.FormatFloat(amt, 'f', -1, 64)
+}
+
+// csvCell defuses cell `s` of being taken as a formula by spreadsheets,
+// which text starting with one of `=+-@` (or a tab or carriage return)
+// is, by prefixing it with a `'`. Numbers are left as they are.
+func csvCell(s string) string {
+	if s == "" || !strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return s
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	return "'" + s
+}
+
+// formatMetadata writes metadata as a JSON object within its CSV field,
+// or leaves the field empty if there is none
+func formatMetadata(m Metadata) string {
+	if len(m) == 0 {
+		return ""
+	}
+	bits, _ := json.Marshal(map[string]string(m))
+	return string(bits)
+}
+
+// exportMediaType returns the first export media type listed in
+// `accept` or an empty string if there is none
+func exportMediaType(accept string) string {
+	for _, rng := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(rng))
+		if err != nil {
+			continue
+		}
+		if mt == MediaTypeCSV || mt == MediaTypeNDJSON {
+			return mt
+		}
+	}
+
+	return ""
+}
+
+// NegotiateExport routes requests accepting one of the export media types
+// to `export` and every other request to `dflt`
+func NegotiateExport(dflt, export http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if exportMediaType(req.Header.Get("Accept")) != "" {
+			export.ServeHTTP(w, req)
+			return
+		}
+		dflt.ServeHTTP(w, req)
+	})
+}
+
+func MakeWalletExportEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ListAccountsRequest)
+		return export{
+			header: accountCSVHeader,
+			stream: func(emit func(exportRow) error) error {
+				return svc.StreamAccounts(ctx, req, func(a Account) error { return emit(a) })
+			},
+		}, nil
+	}
+}
+
+func MakePaymentsExportEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ListPaymentsRequest)
+		return export{
+			header: paymentCSVHeader,
+			stream: func(emit func(exportRow) error) error {
+				return svc.StreamPayments(ctx, req, func(p Payment) error { return emit(p) })
+			},
+		}, nil
+	}
+}
+
+func MakeTransfersExportEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ListTransfersRequest)
+		return export{
+			header: transferCSVHeader,
+			stream: func(emit func(exportRow) error) error {
+				return svc.StreamTransfers(ctx, req, func(t Transfer) error { return emit(t) })
+			},
+		}, nil
+	}
+}
+
+// EncodeExportResponse writes an export endpoint response in the media type
+// negotiated through the `Accept` header. The header is read from the request
+// context so the server must be created with the
+// `httptransport.ServerBefore(httptransport.PopulateRequestContext)` option.
+//
+// Response headers are only written with the first row so that errors
+// surfacing before any row is read are still encoded as proper error responses.
+// Errors surfacing after that can only cut the response short.
+func EncodeExportResponse(ctx context.Context, w http.ResponseWriter, resp interface{}) error {
+	exp := resp.(export)
+	accept, _ := ctx.Value(httptransport.ContextKeyRequestAccept).(string)
+	mediaType := exportMediaType(accept)
+	if mediaType == "" {
+		return fmt.Errorf("unsupported export media type: %q", accept)
+	}
+
+	return writeExport(w, mediaType, exp, func() {
+		w.Header().Set("Content-Type", mediaType)
+	})
+}
+
+// ExportAccounts writes the accounts that `stream` emits to `w` as an export
+// of media type `mediaType`, as `GET /wallets` serves them, e.g. for exports
+// outside of the API. `stream` is typically a `Service.StreamAccounts` call.
+func ExportAccounts(w io.Writer, mediaType string, stream func(func(Account) error) error) error {
+	return writeExport(w, mediaType, export{
+		header: accountCSVHeader,
+		stream: func(emit func(exportRow) error) error {
+			return stream(func(a Account) error { return emit(a) })
+		},
+	}, func() {})
+}
+
+// ExportPayments is `ExportAccounts` for payments
+func ExportPayments(w io.Writer, mediaType string, stream func(func(Payment) error) error) error {
+	return writeExport(w, mediaType, export{
+		header: paymentCSVHeader,
+		stream: func(emit func(exportRow) error) error {
+			return stream(func(p Payment) error { return emit(p) })
+		},
+	}, func() {})
+}
+
+// ExportTransfers is `ExportAccounts` for transfers
+func ExportTransfers(w io.Writer, mediaType string, stream func(func(Transfer) error) error) error {
+	return writeExport(w, mediaType, export{
+		header: transferCSVHeader,
+		stream: func(emit func(exportRow) error) error {
+			return stream(func(t Transfer) error { return emit(t) })
+		},
+	}, func() {})
+}
+
+// writeExport writes `exp` to `w` as `mediaType`, calling `onStart`
+// just before anything is written
+func writeExport(w io.Writer, mediaType string, exp export, onStart func()) error {
+	bw := bufio.NewWriter(w)
+	var (
+		write func(exportRow) error
+		start func() error
+	)
+	switch mediaType {
+	case MediaTypeCSV:
+		cw := csv.NewWriter(bw)
+		start = func() error {
+			if err := cw.Write(exp.header); err != nil {
+				return err
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+		write = func(row exportRow) error {
+			record := row.csvRecord()
+			for i := range record {
+				record[i] = csvCell(record[i])
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+			// csv.Writer buffers internally; flush it into `bw`
+			// which in turn flushes to `w` once its buffer is full
+			cw.Flush()
+			return cw.Error()
+		}
+	case MediaTypeNDJSON:
+		enc := json.NewEncoder(bw)
+		start = func() error { return nil }
+		write = func(row exportRow) error {
+			return enc.Encode(row)
+		}
+	default:
+		return fmt.Errorf("unsupported export media type: %q", mediaType)
+	}
+
+	started := false
+	begin := func() error {
+		started = true
+		onStart()
+		return start()
+	}
+	err := exp.stream(func(row exportRow) error {
+		if !started {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+		return write(row)
+	})
+	if err != nil {
+		return err
+	}
+	if !started {
+		if err := begin(); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"context"
 	"time"
 )
 
@@ -12,7 +13,7 @@ type SimpleService struct{}
 
 var _ Service = (*SimpleService)(nil)
 
-func (ws *SimpleService) GetAccount(req GetAccountRequest) (Account, error) {
+func (ws *SimpleService) GetAccount(ctx context.Context, req GetAccountRequest) (Account, error) {
 	return Account{
 		ID:       req.ID,
 		Balance:  100.0,
@@ -20,7 +21,7 @@ func (ws *SimpleService) GetAccount(req GetAccountRequest) (Account, error) {
 	}, nil
 }
 
-func (ws *SimpleService) ListAccounts(req ListAccountsRequest) ([]Account, error) {
+func (ws *SimpleService) ListAccounts(ctx context.Context, req ListAccountsRequest) ([]Account, error) {
 	accounts := []Account{
 		{
 			ID:       "bob-1234",
@@ -48,7 +49,18 @@ func (ws *SimpleService) ListAccounts(req ListAccountsRequest) ([]Account, error
 	return accounts, nil
 }
 
-func (ws *SimpleService) CreateAccount(req CreateAccountRequest) (Account, error) {
+func (ws *SimpleService) StreamAccounts(ctx context.Context, req ListAccountsRequest, fn func(Account) error) error {
+	accounts, _ := ws.ListAccounts(ctx, req)
+	for i := range accounts {
+		if err := fn(accounts[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ws *SimpleService) CreateAccount(ctx context.Context, req CreateAccountRequest) (Account, error) {
 	now := time.Now().UTC()
 	return Account{
 		ID:        req.ID,
@@ -56,19 +68,23 @@ func (ws *SimpleService) CreateAccount(req CreateAccountRequest) (Account, error
 		Currency:  req.Currency,
 		CreatedAt: now,
 		UpdatedAt: now,
+		Metadata:  req.Metadata,
 	}, nil
 }
 
-func (ws *SimpleService) CreatePayment(req CreatePaymentRequest) (Payment, error) {
+func (ws *SimpleService) CreatePayment(ctx context.Context, req CreatePaymentRequest) (Payment, error) {
 	return Payment{
-		Self:      req.Self,
-		To:        &req.To,
-		Amount:    req.Amount,
-		Direction: Outgoing,
+		Self:        req.Self,
+		To:          &req.To,
+		Amount:      req.Amount,
+		Direction:   Outgoing,
+		Description: req.Description,
+		Reference:   req.Reference,
+		Metadata:    req.Metadata,
 	}, nil
 }
 
-func (ws *SimpleService) ListPayments(req ListPaymentsRequest) ([]Payment, error) {
+func (ws *SimpleService) ListPayments(ctx context.Context, req ListPaymentsRequest) ([]Payment, error) {
 	toother := "toOther123"
 	fromother := "fromOther123"
 	payments := []Payment{
@@ -89,7 +105,18 @@ func (ws *SimpleService) ListPayments(req ListPaymentsRequest) ([]Payment, error
 	return payments, nil
 }
 
-func (ws *SimpleService) ListTransfers(req ListTransfersRequest) ([]Transfer, error) {
+func (ws *SimpleService) StreamPayments(ctx context.Context, req ListPaymentsRequest, fn func(Payment) error) error {
+	payments, _ := ws.ListPayments(ctx, req)
+	for i := range payments {
+		if err := fn(payments[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ws *SimpleService) ListTransfers(ctx context.Context, req ListTransfersRequest) ([]Transfer, error) {
 	ben := "ben123"
 	alice := "alice456"
 	now := time.Now().UTC()
@@ -111,3 +138,151 @@ func (ws *SimpleService) ListTransfers(req ListTransfersRequest) ([]Transfer, er
 
 	return transfers, nil
 }
+
+func (ws *SimpleService) StreamTransfers(ctx context.Context, req ListTransfersRequest, fn func(Transfer) error) error {
+	transfers, _ := ws.ListTransfers(ctx, req)
+	for i := range transfers {
+		if err := fn(transfers[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ws *SimpleService) GetStatement(ctx context.Context, req StatementRequest) (Statement, error) {
+	now := time.Now().UTC()
+	if req.To.IsZero() {
+		req.To = now
+	}
+
+	return Statement{
+		Account: Account{
+			ID:       req.ID,
+			Balance:  100.0,
+			Currency: "USD",
+		},
+		From:           req.From,
+		To:             req.To,
+		OpeningBalance: 30.0,
+		ClosingBalance: 100.0,
+		Entries: []Transfer{
+			{
+				ID:        1,
+				From:      "ben123",
+				To:        req.ID,
+				Currency:  "USD",
+				Amount:    80.0,
+				CreatedAt: now.AddDate(0, 0, -20),
+			},
+			{
+				ID:        2,
+				From:      req.ID,
+				To:        "ben123",
+				Currency:  "USD",
+				Amount:    10.0,
+				CreatedAt: now.AddDate(0, 0, -10),
+			},
+		},
+	}, nil
+}
+
+func (ws *SimpleService) RequestAdjustment(ctx context.Context, req AdjustmentRequest) (Adjustment, error) {
+	return Adjustment{
+		ID:          1,
+		AccountID:   req.AccountID,
+		Amount:      req.Amount,
+		Reason:      req.Reason,
+		Reference:   req.Reference,
+		Attachments: req.Attachments,
+		Status:      AdjustmentPending,
+		RequestedBy: actorOf(ctx),
+		RequestedAt: time.Now().UTC(),
+	}, nil
+}
+
+func (ws *SimpleService) ListAdjustments(ctx context.Context, req ListAdjustmentsRequest) ([]Adjustment, error) {
+	adj, _ := ws.GetAdjustment(ctx, GetAdjustmentRequest{ID: 1})
+	return []Adjustment{adj}, nil
+}
+
+func (ws *SimpleService) GetAdjustment(ctx context.Context, req GetAdjustmentRequest) (Adjustment, error) {
+	return Adjustment{
+		ID:          req.ID,
+		AccountID:   "bob-1234",
+		Amount:      25.0,
+		Reason:      "goodwill",
+		Status:      AdjustmentPending,
+		RequestedBy: "apikey:ops",
+		RequestedAt: time.Now().UTC().AddDate(0, 0, -1),
+	}, nil
+}
+
+func (ws *SimpleService) DecideAdjustment(ctx context.Context, req DecideAdjustmentRequest) (Adjustment, error) {
+	adj, _ := ws.GetAdjustment(ctx, GetAdjustmentRequest{ID: req.ID})
+	now := time.Now().UTC()
+	adj.Status = AdjustmentRejected
+	adj.DecidedBy = actorOf(ctx)
+	adj.DecidedAt = &now
+	adj.Note = req.Note
+	if req.Approve {
+		transferID := 1
+		adj.Status = AdjustmentApproved
+		adj.TransferID = &transferID
+	}
+
+	return adj, nil
+}
+
+func (ws *SimpleService) FreezeAccount(ctx context.Context, req FreezeAccountRequest) (Account, error) {
+	return Account{
+		ID:       req.ID,
+		Balance:  100.0,
+		Currency: "USD",
+		Frozen:   req.Frozen,
+	}, nil
+}
+
+func (ws *SimpleService) Reconcile(ctx context.Context, req ReconcileRequest) ([]Reconciliation, error) {
+	return []Reconciliation{
+		{
+			ID:       "bob-1234",
+			Currency: "JPY",
+			Balance:  10000.0,
+			Expected: 10000.0,
+			Balanced: true,
+		},
+	}, nil
+}
+
+func (ws *SimpleService) GetLedgerProof(ctx context.Context, req LedgerProofRequest) (LedgerProof, error) {
+	t := Transfer{
+		ID:        req.TransferID,
+		From:      "bob-1234",
+		To:        "alice-5678",
+		Currency:  "JPY",
+		Amount:    1000.0,
+		CreatedAt: time.Date(2021, 12, 24, 9, 0, 0, 0, time.UTC),
+	}
+
+	return LedgerProof{
+		TenantID: DefaultTenantID,
+		Transfer: ChainedTransfer{Transfer: t, Hash: chainHash("", transferDigest(DefaultTenantID, t))},
+		Links:    []LedgerLink{},
+	}, nil
+}
+
+func (ws *SimpleService) ListAudit(ctx context.Context, req ListAuditRequest) ([]AuditEntry, error) {
+	return []AuditEntry{
+		{
+			ID:          1,
+			At:          time.Date(2021, 12, 17, 9, 0, 0, 0, time.UTC),
+			Actor:       AnonymousActor,
+			Action:      AuditCreateAccount,
+			Target:      "bob-1234",
+			PayloadHash: payloadHash(CreateAccountRequest{ID: "bob-1234", Currency: "JPY", InitAmt: 10000.0}),
+			Outcome:     AuditOutcomeOK,
+			SourceIP:    "127.0.0.1",
+		},
+	}, nil
+}
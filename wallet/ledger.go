@@ -0,0 +1,805 @@
+package wallet
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The transfers of each tenant form a hash chain, the ledger: every transfer
+// stores `hash`, the SHA-256 of the `hash` of the transfer before it (its
+// `prev_hash`, empty for the first) followed by the digest of its own
+// contents (see `transferDigest`). Altering, removing or reordering a
+// transfer breaks the chain at the next one, unless every hash after it is
+// rewritten as well; checkpoints, signed snapshots of the last hash of a
+// chain, catch that.
+//
+// Transfers are booked pending and chained shortly after by `ChainLedger`,
+// so that booking them does not wait on the head of their tenant. They are
+// chained in the order they are taken off the queue, which is `seq`. Their
+// digest is taken when they are booked, and is what is chained, so that
+// transfers altered while pending break the chain all the same.
+
+// ErrNotCheckpointed is of proofs of transfers that no checkpoint covers yet
+var ErrNotCheckpointed = errors.New("ledger proof: transfer not checkpointed yet")
+
+// ErrTransfersAltered is of chaining transfers that no longer match the
+// digest they were booked with. They are chained as booked all the same,
+// so the ledger reports them as altered.
+var ErrTransfersAltered = errors.New("ledger: transfers altered while pending")
+
+// LedgerProofRequest asks for the proof of transfer `TransferID`
+type LedgerProofRequest struct {
+	TransferID int
+}
+
+// ChainedTransfer is a transfer along with its link of the ledger
+type ChainedTransfer struct {
+	Transfer
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+	// seq is the position of the transfer in the chain, 0 if not chained
+	seq int64
+	// digest is that of the transfer as booked, if it was taken
+	digest string
+}
+
+// LedgerLink is a transfer of a proof, by its digest only
+// so that proofs do not disclose other transfers
+type LedgerLink struct {
+	TransferID int    `json:"transfer_id"`
+	Digest     string `json:"digest"`
+}
+
+// LedgerCheckpoint is a signed snapshot of the ledger of a tenant
+// as of transfer `TransferID`, whose hash is `Hash`
+type LedgerCheckpoint struct {
+	TenantID   string    `json:"tenant_id"`
+	TransferID int       `json:"transfer_id"`
+	Hash       string    `json:"hash"`
+	At         time.Time `json:"at"`
+	KeyID      string    `json:"key_id"`
+	Signature  []byte    `json:"signature"`
+	// seq is the position of the transfer in the chain, 0 if archived
+	seq int64
+}
+
+// LedgerProof proves that `Transfer` is part of the ledger of its tenant:
+// chaining `Links` onto its hash leads to the hash of `Checkpoint`. Proofs
+// of transfers booked since the last checkpoint have neither.
+type LedgerProof struct {
+	TenantID   string            `json:"tenant_id"`
+	Transfer   ChainedTransfer   `json:"transfer"`
+	Links      []LedgerLink      `json:"links"`
+	Checkpoint *LedgerCheckpoint `json:"checkpoint,omitempty"`
+}
+
+// Verify checks `p` against the public key of the checkpoint signer
+func (p LedgerProof) Verify(key ed25519.PublicKey) error {
+	t := p.Transfer
+	if chainHash(t.PrevHash, transferDigest(p.TenantID, t.Transfer)) != t.Hash {
+		return errors.New("ledger proof: transfer does not match its hash")
+	}
+	if p.Checkpoint == nil {
+		return ErrNotCheckpointed
+	}
+
+	hash, id := t.Hash, t.ID
+	for _, l := range p.Links {
+		hash, id = chainHash(hash, l.Digest), l.TransferID
+	}
+	cp := p.Checkpoint
+	if cp.TenantID != p.TenantID || cp.TransferID != id || cp.Hash != hash {
+		return errors.New("ledger proof: links do not lead to the checkpoint")
+	}
+	if !cp.verify(key) {
+		return errors.New("ledger proof: checkpoint signature invalid")
+	}
+
+	return nil
+}
+
+// LedgerVerification is the outcome of walking the ledger of a tenant
+type LedgerVerification struct {
+	TenantID string `json:"tenant_id"`
+	// Unchained transfers are those booked before the ledger was introduced
+	Unchained int `json:"unchained"`
+	// Pending transfers are those booked but not chained yet
+	Pending  int `json:"pending,omitempty"`
+	Verified int `json:"verified"`
+	// Checkpoints is how many checkpoints matched the chain;
+	// their signatures are only checked if keys were passed
+	Checkpoints int `json:"checkpoints"`
+	// Archived means that the chain starts after transfers (and
+	// checkpoints) that have been archived
+	Archived bool `json:"archived,omitempty"`
+	// Broken is the first broken link, if any
+	Broken *BrokenLink `json:"broken,omitempty"`
+}
+
+// BrokenLink pinpoints where the ledger of a tenant was tampered with
+type BrokenLink struct {
+	TransferID int    `json:"transfer_id"`
+	Reason     string `json:"reason"`
+}
+
+// Ledger checkpoints and verifies the ledgers of tenants.
+// `Repo` and `MemRepo` implement it.
+type Ledger interface {
+	// ChainLedger chains the pending transfers of every tenant onto
+	// its ledger, and returns how many it chained
+	ChainLedger(ctx context.Context) (int, error)
+	// CheckpointLedger chains pending transfers, then signs a checkpoint
+	// of every ledger that moved since its last one, and returns those
+	CheckpointLedger(ctx context.Context, signer LedgerSigner) ([]LedgerCheckpoint, error)
+	// VerifyLedger walks the ledgers of `tenants`, or of every tenant if
+	// none, and checks their checkpoints against `keys` if any
+	VerifyLedger(ctx context.Context, keys []ed25519.PublicKey, tenants ...string) ([]LedgerVerification, error)
+}
+
+// transferContents are what the digest of a transfer covers
+type transferContents struct {
+	TenantID    string   `json:"tenant_id"`
+	ID          int      `json:"id"`
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Currency    string   `json:"currency"`
+	Amount      float64  `json:"amount"`
+	CreatedAt   string   `json:"created_at"`
+	Description string   `json:"description,omitempty"`
+	Reference   string   `json:"reference,omitempty"`
+	Metadata    Metadata `json:"metadata,omitempty"`
+}
+
+// transferDigest is the hex SHA-256 of the JSON encoding of the contents
+// of `t` as stored: amounts rounded to `real`, times in UTC to the
+// microsecond. JSON objects encode with sorted keys, so the encoding
+// of given contents never varies.
+func transferDigest(tenant string, t Transfer) string {
+	b, _ := json.Marshal(transferContents{
+		TenantID:    tenant,
+		ID:          t.ID,
+		From:        t.From,
+		To:          t.To,
+		Currency:    t.Currency,
+		Amount:      float64(float32(t.Amount)),
+		CreatedAt:   t.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		Description: t.Description,
+		Reference:   t.Reference,
+		Metadata:    t.Metadata,
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainHash is the hash of the transfer of digest `digest` chained onto `prev`
+func chainHash(prev, digest string) string {
+	sum := sha256.Sum256([]byte(prev + digest))
+	return hex.EncodeToString(sum[:])
+}
+
+// LedgerSigner signs checkpoints with an Ed25519 key
+type LedgerSigner struct {
+	key ed25519.PrivateKey
+}
+
+// ParseLedgerSigner parses a base64 encoded Ed25519 seed
+// (see `GenerateLedgerKey`) into a signer
+func ParseLedgerSigner(seed string) (LedgerSigner, error) {
+	b, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil || len(b) != ed25519.SeedSize {
+		return LedgerSigner{}, fmt.Errorf("ledger signing key should be a base64 encoded %d byte seed", ed25519.SeedSize)
+	}
+	return LedgerSigner{key: ed25519.NewKeyFromSeed(b)}, nil
+}
+
+// ParseLedgerPublicKey parses a base64 encoded Ed25519 public key
+func ParseLedgerPublicKey(key string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("ledger public key should be a base64 encoded %d byte key", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// GenerateLedgerKey generates a signing key, returned as
+// a base64 encoded seed, and its base64 encoded public key
+func GenerateLedgerKey() (seed, public string, err error) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Seed()), base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// LedgerKeyID identifies public key `key` in checkpoints, so that
+// checkpoints signed before a key rotation can still be verified
+func LedgerKeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// PublicKey is the public key of the signer
+func (s LedgerSigner) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// sign fills in the key ID and signature of `cp`
+func (s LedgerSigner) sign(cp *LedgerCheckpoint) {
+	cp.KeyID = LedgerKeyID(s.PublicKey())
+	cp.Signature = ed25519.Sign(s.key, cp.message())
+}
+
+// message is what checkpoints are signed over
+func (cp LedgerCheckpoint) message() []byte {
+	return []byte(fmt.Sprintf("genwallet ledger checkpoint\ntenant_id: %s\ntransfer_id: %d\nhash: %s\nat: %s\n",
+		cp.TenantID, cp.TransferID, cp.Hash, cp.At.UTC().Format(time.RFC3339Nano)))
+}
+
+func (cp LedgerCheckpoint) verify(key ed25519.PublicKey) bool {
+	return cp.KeyID == LedgerKeyID(key) && ed25519.Verify(key, cp.message(), cp.Signature)
+}
+
+// newCheckpoint is the (unsigned) checkpoint of ledger head `head`; checkpoint
+// times are of the precision of Postgres so that they verify once read back
+func newCheckpoint(tenant string, head ledgerHead, at time.Time) LedgerCheckpoint {
+	return LedgerCheckpoint{
+		TenantID:   tenant,
+		TransferID: head.transferID,
+		Hash:       head.hash,
+		At:         at.UTC().Truncate(time.Microsecond),
+		seq:        head.seq,
+	}
+}
+
+// ledgerHead is the last chained transfer of a tenant
+type ledgerHead struct {
+	transferID int
+	hash       string
+	// at is when the transfer was booked
+	at  time.Time
+	seq int64
+}
+
+// chainVerifier walks the ledger of a tenant: unchained transfers first, in
+// ID order, then chained ones in chain order, leaving pending ones out. It is
+// shared by the repositories, which feed it the ledger as they read it.
+type chainVerifier struct {
+	v    LedgerVerification
+	keys map[string]ed25519.PublicKey
+	// cps are the checkpoints not yet met, in chain order
+	cps []LedgerCheckpoint
+	// archivedBefore is when the transfers archived so far were booked before
+	archivedBefore time.Time
+	last           *ChainedTransfer
+	// lastUnchained is the ID of the last unchained transfer
+	lastUnchained int
+}
+
+func newChainVerifier(tenant string, keys []ed25519.PublicKey, cps []LedgerCheckpoint, archivedBefore time.Time) *chainVerifier {
+	cv := &chainVerifier{
+		v:              LedgerVerification{TenantID: tenant},
+		keys:           map[string]ed25519.PublicKey{},
+		cps:            cps,
+		archivedBefore: archivedBefore,
+	}
+	for _, key := range keys {
+		cv.keys[LedgerKeyID(key)] = key
+	}
+
+	return cv
+}
+
+// add verifies the next transfer of the ledger; false once the chain is broken
+func (cv *chainVerifier) add(t ChainedTransfer) bool {
+	if t.Hash == "" {
+		if cv.last != nil {
+			return cv.broke(t.ID, "transfer is not chained although transfers before it are")
+		}
+		cv.v.Unchained++
+		cv.lastUnchained = t.ID
+		return true
+	}
+	// unchained transfers predate the ledger
+	if t.ID < cv.lastUnchained {
+		return cv.broke(cv.lastUnchained, "transfer is not chained although transfers before it are")
+	}
+	// archiving drops the oldest transfers, so checkpoints of transfers
+	// before the first one left are of archived ones, while those of
+	// transfers missing after it are of removed ones
+	for len(cv.cps) > 0 && cv.cps[0].seq < t.seq {
+		if cv.last != nil {
+			return cv.broke(cv.cps[0].TransferID, "checkpointed transfer is missing")
+		}
+		cv.cps = cv.cps[1:]
+	}
+
+	if cv.last == nil && t.PrevHash != "" {
+		if cv.archivedBefore.IsZero() {
+			return cv.broke(t.ID, "chain starts mid-way although no transfers were archived: transfers were removed")
+		}
+		cv.v.Archived = true
+	}
+	if cv.last != nil && t.PrevHash != cv.last.Hash {
+		return cv.broke(t.ID, fmt.Sprintf("previous hash does not match the hash of transfer %d: transfers were removed, inserted or reordered", cv.last.ID))
+	}
+	if chainHash(t.PrevHash, transferDigest(cv.v.TenantID, t.Transfer)) != t.Hash {
+		return cv.broke(t.ID, "contents do not match the hash: transfer was altered")
+	}
+	for len(cv.cps) > 0 && cv.cps[0].TransferID == t.ID {
+		cp := cv.cps[0]
+		cv.cps = cv.cps[1:]
+		if cp.Hash != t.Hash {
+			return cv.broke(t.ID, "hash does not match its checkpoint: the chain was rewritten")
+		}
+		if len(cv.keys) > 0 {
+			key, ok := cv.keys[cp.KeyID]
+			if !ok {
+				return cv.broke(t.ID, "checkpoint signed by unknown key "+cp.KeyID)
+			}
+			if !cp.verify(key) {
+				return cv.broke(t.ID, "checkpoint signature invalid")
+			}
+		}
+		cv.v.Checkpoints++
+	}
+
+	cv.v.Verified++
+	cv.last = &t
+	return true
+}
+
+// finish checks that the chain ends at the ledger head `head`
+func (cv *chainVerifier) finish(head ledgerHead) LedgerVerification {
+	if cv.v.Broken != nil {
+		return cv.v
+	}
+	if len(cv.cps) > 0 && cv.last != nil {
+		cv.broke(cv.cps[0].TransferID, "checkpointed transfer is missing")
+		return cv.v
+	}
+	if head.transferID == 0 {
+		return cv.v
+	}
+	if cv.last == nil && !cv.archivedBefore.IsZero() && head.at.Before(cv.archivedBefore) {
+		// every transfer of the tenant has been archived
+		cv.v.Archived = true
+		return cv.v
+	}
+	if cv.last == nil || cv.last.ID != head.transferID || cv.last.Hash != head.hash {
+		lastID := 0
+		if cv.last != nil {
+			lastID = cv.last.ID
+		}
+		cv.broke(head.transferID, fmt.Sprintf("ledger head is transfer %d but the chain ends at transfer %d: transfers were removed", head.transferID, lastID))
+	}
+
+	return cv.v
+}
+
+func (cv *chainVerifier) broke(transferID int, reason string) bool {
+	cv.v.Broken = &BrokenLink{TransferID: transferID, Reason: reason}
+	return false
+}
+
+// ledgerChainBatch is how many pending transfers of a tenant
+// are chained at most per transaction
+const ledgerChainBatch = 500
+
+// ChainLedger may run on several instances at once; each batch locks the
+// head of its tenant, so batches of a tenant are chained one at a time.
+// Transfers altered while pending are chained nonetheless and reported
+// once every batch is chained (`ErrTransfersAltered`).
+func (r *Repo) ChainLedger(ctx context.Context) (int, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT DISTINCT tenant_id FROM ledger_pending ORDER BY tenant_id;`)
+	if err != nil {
+		return 0, err
+	}
+	var tenants []string
+	for rows.Next() {
+		var tenant string
+		if err := rows.Scan(&tenant); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	chained := 0
+	var altered []string
+	for _, tenant := range tenants {
+		for {
+			n, ids, err := r.chainPending(ctx, tenant)
+			chained += n
+			if err != nil {
+				return chained, err
+			}
+			if len(ids) > 0 {
+				altered = append(altered, fmt.Sprintf("tenant %s transfers %v", tenant, ids))
+			}
+			if n < ledgerChainBatch {
+				break
+			}
+		}
+	}
+	if len(altered) > 0 {
+		return chained, fmt.Errorf("%w: %s", ErrTransfersAltered, strings.Join(altered, ", "))
+	}
+
+	return chained, nil
+}
+
+// chainPending takes a batch of the pending transfers of `tenant` off the
+// queue and chains them onto its head, in the order they were booked. The
+// head is locked for as long as that takes, rather than for as long as the
+// transactions of the transfers take. Returns how many it chained, and
+// the IDs of those that no longer match their digest.
+func (r *Repo) chainPending(ctx context.Context, tenant string) (int, []int, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	chained, altered, err := chainBatch(ctx, tx, tenant)
+	if err != nil {
+		tx.Rollback()
+		return 0, nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return chained, altered, nil
+}
+
+// chainBatch is `chainPending` within transaction `tx`. Transfers are
+// chained by the digest they were booked with; those whose contents no
+// longer match it are reported. Queue entries of transfers that are gone
+// cannot be taken off the queue (see the `ledger_pending_chained_only`
+// trigger), so they are left for `VerifyLedger` to report.
+func chainBatch(ctx context.Context, tx *sql.Tx, tenant string) (int, []int, error) {
+	var head ledgerHead
+	err := tx.QueryRowContext(ctx, `INSERT INTO ledger_heads (tenant_id) VALUES ($1)
+	ON CONFLICT (tenant_id) DO UPDATE SET tenant_id = EXCLUDED.tenant_id
+	RETURNING hash, seq;`, tenant).Scan(&head.hash, &head.seq)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// batches that concurrent chainers took off the queue are
+	// gone by the time they let go of the head
+	rows, err := tx.QueryContext(ctx, `WITH batch AS (
+		DELETE FROM ledger_pending WHERE tenant_id = $1 AND transfer_id IN (
+			SELECT p.transfer_id FROM ledger_pending p JOIN transfers t
+			ON t.tenant_id = p.tenant_id AND t.id = p.transfer_id AND t.created_at = p.created_at
+			WHERE p.tenant_id = $1 ORDER BY p.transfer_id LIMIT $2)
+		RETURNING transfer_id, created_at
+	)
+	SELECT `+chainedTransferColumns+` FROM transfers
+	WHERE tenant_id = $1 AND (id, created_at) IN (SELECT transfer_id, created_at FROM batch)
+	ORDER BY created_at, id;`, tenant, ledgerChainBatch)
+	if err != nil {
+		return 0, nil, err
+	}
+	var (
+		ids, seqs          []int64
+		prevHashes, hashes []string
+		altered            []int
+	)
+	for rows.Next() {
+		t, err := scanChainedTransfer(rows)
+		if err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		// transfers booked before digests were taken are chained as read
+		digest := transferDigest(tenant, t.Transfer)
+		if t.digest != "" && t.digest != digest {
+			altered = append(altered, t.ID)
+			digest = t.digest
+		}
+		head.seq++
+		head.transferID, head.at = t.ID, t.CreatedAt
+		prevHashes = append(prevHashes, head.hash)
+		head.hash = chainHash(head.hash, digest)
+		ids, seqs, hashes = append(ids, int64(t.ID)), append(seqs, head.seq), append(hashes, head.hash)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	if len(ids) == 0 {
+		return 0, nil, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE transfers t SET (prev_hash, hash, ledger_seq) = (c.prev_hash, c.hash, c.seq)
+	FROM unnest($2::integer[], $3::text[], $4::text[], $5::bigint[]) AS c (id, prev_hash, hash, seq)
+	WHERE t.tenant_id = $1 AND t.id = c.id;`,
+		tenant, pq.Array(ids), pq.Array(prevHashes), pq.Array(hashes), pq.Array(seqs))
+	if err != nil {
+		return 0, nil, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE ledger_heads SET (transfer_id, hash, at, seq) = ($2, $3, $4, $5)
+	WHERE tenant_id = $1;`, tenant, head.transferID, head.hash, head.at, head.seq)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return len(ids), altered, nil
+}
+
+// chainedTransferColumns are `transferColumns` with amounts read at full
+// precision, which digests need, followed by the links of transfers
+const chainedTransferColumns = `id, "from", "to", amount::double precision, currency, created_at, description, reference, metadata,
+	COALESCE(prev_hash, ''), COALESCE(hash, ''), COALESCE(ledger_seq, 0), COALESCE(digest, '')`
+
+func scanChainedTransfer(row interface{ Scan(...interface{}) error }) (ChainedTransfer, error) {
+	var t ChainedTransfer
+	var err error
+	t.Transfer, err = scanTransfer(row, &t.PrevHash, &t.Hash, &t.seq, &t.digest)
+	return t, err
+}
+
+const checkpointColumns = `tenant_id, transfer_id, hash, at, key_id, signature, seq`
+
+func scanCheckpoint(row interface{ Scan(...interface{}) error }) (LedgerCheckpoint, error) {
+	var (
+		cp  LedgerCheckpoint
+		seq sql.NullInt64
+	)
+	err := row.Scan(&cp.TenantID, &cp.TransferID, &cp.Hash, &cp.At, &cp.KeyID, &cp.Signature, &seq)
+	cp.At = cp.At.UTC()
+	cp.seq = seq.Int64
+	return cp, err
+}
+
+// GetLedgerProof reads from the primary so that proofs of transfers
+// just booked are found
+func (r *Repo) GetLedgerProof(ctx context.Context, req LedgerProofRequest) (LedgerProof, error) {
+	tenant := tenantOf(ctx)
+	proof := LedgerProof{TenantID: tenant, Links: []LedgerLink{}}
+	t, err := scanChainedTransfer(r.DB.QueryRowContext(ctx, `SELECT `+chainedTransferColumns+`
+	FROM transfers WHERE tenant_id = $1 AND id = $2;`, tenant, req.TransferID))
+	if err == sql.ErrNoRows {
+		return proof, fmt.Errorf("%w: %v", ErrTransferNotFound, req.TransferID)
+	}
+	if err != nil {
+		return proof, err
+	}
+	if t.Hash == "" {
+		var pending bool
+		err = r.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT FROM ledger_pending
+		WHERE tenant_id = $1 AND transfer_id = $2);`, tenant, t.ID).Scan(&pending)
+		if err != nil {
+			return proof, err
+		}
+		if pending {
+			return proof, fmt.Errorf("%w: %v", ErrTransferPending, req.TransferID)
+		}
+		return proof, fmt.Errorf("%w: %v", ErrTransferNotChained, req.TransferID)
+	}
+	proof.Transfer = t
+
+	cp, err := scanCheckpoint(r.DB.QueryRowContext(ctx, `SELECT `+checkpointColumns+` FROM ledger_checkpoints
+	WHERE tenant_id = $1 AND seq >= $2 ORDER BY seq LIMIT 1;`, tenant, t.seq))
+	if err == sql.ErrNoRows {
+		return proof, nil
+	}
+	if err != nil {
+		return proof, err
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+chainedTransferColumns+` FROM transfers
+	WHERE tenant_id = $1 AND ledger_seq > $2 AND ledger_seq <= $3 ORDER BY ledger_seq;`, tenant, t.seq, cp.seq)
+	if err != nil {
+		return proof, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		link, err := scanChainedTransfer(rows)
+		if err != nil {
+			return proof, err
+		}
+		proof.Links = append(proof.Links, LedgerLink{TransferID: link.ID, Digest: transferDigest(tenant, link.Transfer)})
+	}
+	if err = rows.Err(); err != nil {
+		return proof, err
+	}
+	proof.Checkpoint = &cp
+
+	return proof, nil
+}
+
+// CheckpointLedger may run on several instances at once; a head
+// is only ever checkpointed once
+func (r *Repo) CheckpointLedger(ctx context.Context, signer LedgerSigner) ([]LedgerCheckpoint, error) {
+	// altered transfers are chained as booked, so their ledgers may still
+	// be checkpointed
+	if _, err := r.ChainLedger(ctx); err != nil && !errors.Is(err, ErrTransfersAltered) {
+		return nil, err
+	}
+	rows, err := r.DB.QueryContext(ctx, `SELECT h.tenant_id, h.transfer_id, h.hash, h.seq FROM ledger_heads h
+	WHERE h.transfer_id IS NOT NULL AND NOT EXISTS (
+		SELECT FROM ledger_checkpoints c WHERE c.tenant_id = h.tenant_id AND c.transfer_id = h.transfer_id)
+	ORDER BY h.tenant_id;`)
+	if err != nil {
+		return nil, err
+	}
+	var heads []LedgerCheckpoint
+	at := time.Now()
+	for rows.Next() {
+		var (
+			tenant string
+			head   ledgerHead
+		)
+		if err := rows.Scan(&tenant, &head.transferID, &head.hash, &head.seq); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		heads = append(heads, newCheckpoint(tenant, head, at))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var cps []LedgerCheckpoint
+	for _, cp := range heads {
+		signer.sign(&cp)
+		res, err := r.DB.ExecContext(ctx, `INSERT INTO ledger_checkpoints (`+checkpointColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (tenant_id, transfer_id) DO NOTHING;`,
+			cp.TenantID, cp.TransferID, cp.Hash, cp.At, cp.KeyID, cp.Signature, cp.seq)
+		if err != nil {
+			return cps, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			cps = append(cps, cp)
+		}
+	}
+
+	return cps, nil
+}
+
+func (r *Repo) VerifyLedger(ctx context.Context, keys []ed25519.PublicKey, tenants ...string) ([]LedgerVerification, error) {
+	if len(tenants) == 0 {
+		rows, err := r.DB.QueryContext(ctx, `SELECT tenant_id FROM ledger_heads
+		UNION SELECT tenant_id FROM ledger_pending ORDER BY tenant_id;`)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var tenant string
+			if err := rows.Scan(&tenant); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			tenants = append(tenants, tenant)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var archivedBefore sql.NullTime
+	err := r.DB.QueryRowContext(ctx, `SELECT max(range_end) FROM transfer_archives;`).Scan(&archivedBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	var vs []LedgerVerification
+	for _, tenant := range tenants {
+		v, err := r.verifyLedger(ctx, tenant, keys, archivedBefore.Time)
+		if err != nil {
+			return vs, err
+		}
+		vs = append(vs, v)
+	}
+
+	return vs, nil
+}
+
+// verifyLedger reads the ledger of `tenant` in a snapshot, so that
+// transfers chained meanwhile are neither missed nor taken for extra
+func (r *Repo) verifyLedger(ctx context.Context, tenant string, keys []ed25519.PublicKey, archivedBefore time.Time) (LedgerVerification, error) {
+	tx, err := r.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return LedgerVerification{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		head   ledgerHead
+		headAt sql.NullTime
+		headID sql.NullInt64
+	)
+	err = tx.QueryRowContext(ctx, `SELECT transfer_id, hash, at, seq FROM ledger_heads WHERE tenant_id = $1;`, tenant).
+		Scan(&headID, &head.hash, &headAt, &head.seq)
+	if err != nil && err != sql.ErrNoRows {
+		return LedgerVerification{}, err
+	}
+	head.transferID, head.at = int(headID.Int64), headAt.Time
+
+	var pending int
+	err = tx.QueryRowContext(ctx, `SELECT count(*) FROM ledger_pending WHERE tenant_id = $1;`, tenant).Scan(&pending)
+	if err != nil {
+		return LedgerVerification{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+checkpointColumns+` FROM ledger_checkpoints
+	WHERE tenant_id = $1 ORDER BY seq NULLS FIRST, transfer_id;`, tenant)
+	if err != nil {
+		return LedgerVerification{}, err
+	}
+	var cps []LedgerCheckpoint
+	for rows.Next() {
+		cp, err := scanCheckpoint(rows)
+		if err != nil {
+			rows.Close()
+			return LedgerVerification{}, err
+		}
+		cps = append(cps, cp)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return LedgerVerification{}, err
+	}
+
+	cv := newChainVerifier(tenant, keys, cps, archivedBefore)
+	rows, err = tx.QueryContext(ctx, `SELECT `+chainedTransferColumns+` FROM transfers t
+	WHERE tenant_id = $1 AND NOT EXISTS (
+		SELECT FROM ledger_pending p WHERE p.tenant_id = $1 AND p.transfer_id = t.id)
+	ORDER BY ledger_seq NULLS FIRST, id;`, tenant)
+	if err != nil {
+		return LedgerVerification{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t, err := scanChainedTransfer(rows)
+		if err != nil {
+			return LedgerVerification{}, err
+		}
+		if !cv.add(t) {
+			break
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return LedgerVerification{}, err
+	}
+	v := cv.finish(head)
+	v.Pending = pending
+	if v.Broken != nil {
+		return v, nil
+	}
+
+	// queue entries are only taken off once their transfer is chained,
+	// so those left without a transfer are of removed ones, unless archived
+	var removed int
+	err = tx.QueryRowContext(ctx, `SELECT transfer_id FROM ledger_pending p
+	WHERE tenant_id = $1 AND created_at >= $2 AND NOT EXISTS (
+		SELECT FROM transfers t WHERE t.tenant_id = $1 AND t.id = p.transfer_id AND t.created_at = p.created_at)
+	ORDER BY transfer_id LIMIT 1;`, tenant, archivedBefore).Scan(&removed)
+	if err == sql.ErrNoRows {
+		return v, nil
+	}
+	if err != nil {
+		return LedgerVerification{}, err
+	}
+	v.Broken = &BrokenLink{TransferID: removed, Reason: "pending transfer is missing: transfer was removed"}
+
+	return v, nil
+}
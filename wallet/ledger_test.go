@@ -0,0 +1,87 @@
+package wallet_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+func TestLedgerProofVerify(t *testing.T) {
+	reqrd := require.New(t)
+	ctx := context.Background()
+	repo := wallet.NewMemRepo()
+	for _, req := range []wallet.CreateAccountRequest{
+		{ID: "alice-123", InitAmt: 100, Currency: "USD"},
+		{ID: "bob-456", InitAmt: 0, Currency: "USD"},
+	} {
+		_, err := repo.CreateAccount(ctx, req)
+		reqrd.Nil(err)
+	}
+	var ids []int
+	for _, amt := range []float64{10, 0.1, 2.5} {
+		trnsfr, err := repo.CreateTransfer(ctx, wallet.CreateTransferRequest{
+			From:     "alice-123",
+			To:       "bob-456",
+			Amount:   amt,
+			Metadata: wallet.Metadata{"order_id": "1234"},
+		})
+		reqrd.Nil(err)
+		ids = append(ids, trnsfr.ID)
+	}
+	seed, public, err := wallet.GenerateLedgerKey()
+	reqrd.Nil(err)
+	signer, err := wallet.ParseLedgerSigner(seed)
+	reqrd.Nil(err)
+	key, err := wallet.ParseLedgerPublicKey(public)
+	reqrd.Nil(err)
+	_, err = repo.CheckpointLedger(ctx, signer)
+	reqrd.Nil(err)
+
+	proof, err := repo.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: ids[0]})
+	reqrd.Nil(err)
+	reqrd.Len(proof.Links, 2)
+	reqrd.Nil(proof.Verify(key))
+	// proofs verify as served
+	b, err := json.Marshal(proof)
+	reqrd.Nil(err)
+	var served wallet.LedgerProof
+	reqrd.Nil(json.Unmarshal(b, &served))
+	reqrd.Nil(served.Verify(key))
+
+	// clone copies `proof` deep enough for each case to tamper with
+	clone := func() wallet.LedgerProof {
+		p := proof
+		p.Links = append([]wallet.LedgerLink(nil), proof.Links...)
+		cp := *proof.Checkpoint
+		cp.Signature = append([]byte(nil), cp.Signature...)
+		p.Checkpoint = &cp
+		return p
+	}
+	for name, tamper := range map[string]func(p *wallet.LedgerProof){
+		"amount":       func(p *wallet.LedgerProof) { p.Transfer.Amount = 1000 },
+		"metadata":     func(p *wallet.LedgerProof) { p.Transfer.Metadata = wallet.Metadata{"order_id": "4321"} },
+		"tenant":       func(p *wallet.LedgerProof) { p.TenantID = "acme" },
+		"hash":         func(p *wallet.LedgerProof) { p.Transfer.Hash = p.Links[0].Digest },
+		"link dropped": func(p *wallet.LedgerProof) { p.Links = p.Links[1:] },
+		"link digest":  func(p *wallet.LedgerProof) { p.Links[0].Digest = p.Transfer.Hash },
+		"links swapped": func(p *wallet.LedgerProof) {
+			p.Links[0], p.Links[1] = p.Links[1], p.Links[0]
+		},
+		"checkpoint hash": func(p *wallet.LedgerProof) { p.Checkpoint.Hash = p.Transfer.Hash },
+		"signature":       func(p *wallet.LedgerProof) { p.Checkpoint.Signature[0] ^= 1 },
+		"signer": func(p *wallet.LedgerProof) {
+			other, _, _ := ed25519.GenerateKey(nil)
+			p.Checkpoint.KeyID = wallet.LedgerKeyID(other)
+		},
+	} {
+		p := clone()
+		tamper(&p)
+		assert.NotNil(t, p.Verify(key), name)
+	}
+}
@@ -0,0 +1,799 @@
+package wallet
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	_ Repository = (*MemRepo)(nil)
+	_ Tenants    = (*MemRepo)(nil)
+	_ Ledger     = (*MemRepo)(nil)
+)
+
+// MemRepo is an in-memory `Repository` with the same semantics as `Repo`.
+// It is meant for tests and demos; nothing is persisted. Accounts are
+// never sharded since there is no row contention to spread.
+//
+// Every method holds a single lock for its whole duration so that writes
+// are trivially serializable, as `Repo`'s transactions are. Stream* methods
+// read a snapshot under the lock and call the passed func only after
+// releasing it, so the func may itself call into the repository.
+type MemRepo struct {
+	mu       sync.RWMutex
+	accounts map[accountKey]Account
+	// openings are the opening balances of accounts, for reconciliation
+	openings  map[accountKey]float64
+	transfers []tenantTransfer
+	// references are the transfer references used by each payer
+	references map[transferReference]struct{}
+	// idempotencyKeys are the indexes in `transfers` of the transfers
+	// booked with each idempotency key of each payer
+	idempotencyKeys map[transferReference]int
+	tenants         map[string]Tenant
+	apiKeys         map[string]memAPIKey
+	audits          []AuditEntry
+	// heads are the ledger heads of tenants
+	heads map[string]ledgerHead
+	// pending are the indexes in `transfers` of those not chained yet
+	pending     []int
+	checkpoints []LedgerCheckpoint
+	adjustments []tenantAdjustment
+	// now is the clock of `created_at`/`updated_at` columns
+	now func() time.Time
+}
+
+// accountKey is the key of accounts, whose IDs are unique per tenant
+type accountKey struct {
+	tenant, id string
+}
+
+type tenantTransfer struct {
+	tenant string
+	Transfer
+	prevHash, hash string
+	seq            int64
+	// digest is that of the transfer as booked
+	digest string
+}
+
+type tenantAdjustment struct {
+	tenant         string
+	idempotencyKey string
+	Adjustment
+}
+
+type transferReference struct {
+	tenant, payer, reference string
+}
+
+type memAPIKey struct {
+	tenant  string
+	hash    []byte
+	admin   bool
+	revoked bool
+}
+
+func NewMemRepo() *MemRepo {
+	r := &MemRepo{
+		accounts:        map[accountKey]Account{},
+		openings:        map[accountKey]float64{},
+		references:      map[transferReference]struct{}{},
+		idempotencyKeys: map[transferReference]int{},
+		tenants:         map[string]Tenant{},
+		apiKeys:         map[string]memAPIKey{},
+		heads:           map[string]ledgerHead{},
+		now:             func() time.Time { return time.Now().UTC() },
+	}
+	r.tenants[DefaultTenantID] = Tenant{ID: DefaultTenantID, Name: "Default", CreatedAt: r.now()}
+
+	return r
+}
+
+func (r *MemRepo) ListAccounts(ctx context.Context, req ListAccountsRequest) ([]Account, error) {
+	var accts []Account
+	err := r.StreamAccounts(ctx, req, func(acct Account) error {
+		accts = append(accts, acct)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accts, nil
+}
+
+func (r *MemRepo) StreamAccounts(ctx context.Context, req ListAccountsRequest, fn func(Account) error) error {
+	tenant := tenantOf(ctx)
+	r.mu.RLock()
+	var accts []Account
+	for key, acct := range r.accounts {
+		if key.tenant != tenant {
+			continue
+		}
+		if req.Currency != nil && acct.Currency != *req.Currency {
+			continue
+		}
+		if req.After != nil && acct.ID <= *req.After {
+			continue
+		}
+		accts = append(accts, acct)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(accts, func(i, j int) bool { return accts[i].ID < accts[j].ID })
+	if req.Limit > 0 && len(accts) > req.Limit {
+		accts = accts[:req.Limit]
+	}
+	for _, acct := range accts {
+		if err := fn(acct); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *MemRepo) GetAccount(ctx context.Context, req GetAccountRequest) (Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	acct, exists := r.accounts[accountKey{tenantOf(ctx), req.ID}]
+	if !exists {
+		return Account{}, fmt.Errorf("%w: %v", ErrAccountNotFound, req.ID)
+	}
+
+	return acct, nil
+}
+
+func (r *MemRepo) CreateAccount(ctx context.Context, req CreateAccountRequest) (_ Account, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() { r.audit(ctx, tenantOf(ctx), AuditCreateAccount, req.ID, req, err) }()
+
+	key := accountKey{tenantOf(ctx), req.ID}
+	if _, exists := r.accounts[key]; exists {
+		return Account{}, fmt.Errorf("%w: %v", ErrAccountExists, req.ID)
+	}
+	now := r.now()
+	acct := Account{
+		ID:        req.ID,
+		Balance:   req.InitAmt,
+		Currency:  req.Currency,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Metadata:  req.Metadata.clone(),
+	}
+	r.accounts[key] = acct
+	r.openings[key] = req.InitAmt
+
+	return acct, nil
+}
+
+func (r *MemRepo) CreateTransfer(ctx context.Context, req CreateTransferRequest) (_ Transfer, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// as with `Repo`, a repeated request returns the transfer of its key
+	if i, found := r.idempotencyKeys[transferReference{tenantOf(ctx), req.From, req.IdempotencyKey}]; found {
+		made := r.transfers[i].Transfer
+		if made.To != req.To || float32(made.Amount) != float32(req.Amount) {
+			return Transfer{}, fmt.Errorf("%w: %v", ErrIdempotencyKeyReused, req.IdempotencyKey)
+		}
+		return made, nil
+	}
+	defer func() { r.audit(ctx, tenantOf(ctx), AuditCreatePayment, req.From, req, err) }()
+
+	return r.createTransfer(tenantOf(ctx), req, false)
+}
+
+// createTransfer is `Repo.createTransfer`'s counterpart; the caller holds the lock
+func (r *MemRepo) createTransfer(tenant string, req CreateTransferRequest, adjustment bool) (Transfer, error) {
+	fromKey, toKey := accountKey{tenant, req.From}, accountKey{tenant, req.To}
+	from, exists := r.accounts[fromKey]
+	if !exists || (from.System && !adjustment) {
+		return Transfer{}, fmt.Errorf("%w: %v", ErrAccountNotFound, req.From)
+	}
+	to, exists := r.accounts[toKey]
+	if !exists || (to.System && !adjustment) {
+		return Transfer{}, fmt.Errorf("%w: %v", ErrAccountNotFound, req.To)
+	}
+	for _, acct := range []Account{from, to} {
+		if acct.Frozen && !adjustment {
+			return Transfer{}, fmt.Errorf("%w: %v", ErrAccountFrozen, acct.ID)
+		}
+	}
+	if from.Currency != to.Currency {
+		return Transfer{}, ErrCurrencyMismatch
+	}
+	if !from.System && from.Balance < req.Amount {
+		return Transfer{}, ErrInsufficientFunds
+	}
+	ref := transferReference{tenant: tenant, payer: req.From, reference: req.Reference}
+	if req.Reference != "" {
+		if _, used := r.references[ref]; used {
+			return Transfer{}, fmt.Errorf("%w: %v", ErrDuplicateReference, req.Reference)
+		}
+		r.references[ref] = struct{}{}
+	}
+	if req.IdempotencyKey != "" {
+		r.idempotencyKeys[transferReference{tenant, req.From, req.IdempotencyKey}] = len(r.transfers)
+	}
+
+	now := r.now()
+	from.Balance -= req.Amount
+	from.UpdatedAt = now
+	to.Balance += req.Amount
+	to.UpdatedAt = now
+	r.accounts[fromKey] = from
+	r.accounts[toKey] = to
+
+	trnsfr := Transfer{
+		ID:          len(r.transfers) + 1,
+		From:        req.From,
+		To:          req.To,
+		Currency:    from.Currency,
+		Amount:      req.Amount,
+		CreatedAt:   now,
+		Description: req.Description,
+		Reference:   req.Reference,
+		Metadata:    req.Metadata.clone(),
+	}
+	r.pending = append(r.pending, len(r.transfers))
+	r.transfers = append(r.transfers, tenantTransfer{tenant: tenant, Transfer: trnsfr, digest: transferDigest(tenant, trnsfr)})
+
+	return trnsfr, nil
+}
+
+func (r *MemRepo) ListTransfers(ctx context.Context, req ListTransfersRequest) ([]Transfer, error) {
+	var transfers []Transfer
+	err := r.StreamTransfers(ctx, req, func(trnsfr Transfer) error {
+		transfers = append(transfers, trnsfr)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+func (r *MemRepo) StreamTransfers(ctx context.Context, req ListTransfersRequest, fn func(Transfer) error) error {
+	tenant := tenantOf(ctx)
+	r.mu.RLock()
+	var transfers []Transfer
+	for _, t := range r.transfers {
+		if req.Limit > 0 && len(transfers) == req.Limit {
+			break
+		}
+		if t.tenant == tenant && transferMatches(req, t.Transfer) {
+			transfers = append(transfers, t.Transfer)
+		}
+	}
+	r.mu.RUnlock()
+
+	// transfers are appended in ID order already
+	for _, t := range transfers {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transferMatches is the in-memory counterpart of `listTransfersQuery`'s
+// conditions: `from` and `to` work together as a `where... OR` while
+// the other filters, if present, further narrow it down
+func transferMatches(req ListTransfersRequest, t Transfer) bool {
+	if req.Currency != nil && t.Currency != *req.Currency {
+		return false
+	}
+	if req.Reference != nil && t.Reference != *req.Reference {
+		return false
+	}
+	if req.AfterID != nil && t.ID <= *req.AfterID {
+		return false
+	}
+	if !t.Metadata.contains(req.Metadata) {
+		return false
+	}
+	if req.From == nil && req.To == nil {
+		return true
+	}
+
+	return (req.From != nil && t.From == *req.From) || (req.To != nil && t.To == *req.To)
+}
+
+func (r *MemRepo) GetStatement(ctx context.Context, req StatementRequest) (Statement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var stmt Statement
+	tenant := tenantOf(ctx)
+	acct, exists := r.accounts[accountKey{tenant, req.ID}]
+	if !exists {
+		return stmt, fmt.Errorf("%w: %v", ErrAccountNotFound, req.ID)
+	}
+	stmt.Account = acct
+
+	var after, period float64
+	for _, tt := range r.transfers {
+		t := tt.Transfer
+		if tt.tenant != tenant || (t.From != req.ID && t.To != req.ID) {
+			continue
+		}
+		amt := t.Amount
+		if t.To != req.ID {
+			amt = -amt
+		}
+		switch {
+		case !t.CreatedAt.Before(req.To):
+			after += amt
+		case !t.CreatedAt.Before(req.From):
+			period += amt
+			stmt.Entries = append(stmt.Entries, t)
+		}
+	}
+
+	stmt.From = req.From
+	stmt.To = req.To
+	stmt.ClosingBalance = acct.Balance - after
+	stmt.OpeningBalance = stmt.ClosingBalance - period
+
+	return stmt, nil
+}
+
+func (r *MemRepo) RequestAdjustment(ctx context.Context, req AdjustmentRequest) (_ Adjustment, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant := tenantOf(ctx)
+	// as with `Repo`, a repeated request returns the adjustment of its key
+	for _, ta := range r.adjustments {
+		if req.IdempotencyKey == "" || ta.tenant != tenant || ta.AccountID != req.AccountID || ta.idempotencyKey != req.IdempotencyKey {
+			continue
+		}
+		if float32(ta.Amount) != float32(req.Amount) {
+			return Adjustment{}, fmt.Errorf("%w: %v", ErrIdempotencyKeyReused, req.IdempotencyKey)
+		}
+		return ta.Adjustment, nil
+	}
+	defer func() { r.audit(ctx, tenant, AuditRequestAdjustment, req.AccountID, req, err) }()
+
+	acct, exists := r.accounts[accountKey{tenant, req.AccountID}]
+	if !exists || acct.System {
+		return Adjustment{}, fmt.Errorf("%w: %v", ErrAccountNotFound, req.AccountID)
+	}
+	if req.Reference != "" {
+		for _, ta := range r.adjustments {
+			if ta.tenant == tenant && ta.AccountID == req.AccountID && ta.Reference == req.Reference {
+				return Adjustment{}, fmt.Errorf("%w: %v", ErrDuplicateReference, req.Reference)
+			}
+		}
+	}
+
+	adj := Adjustment{
+		ID:          len(r.adjustments) + 1,
+		AccountID:   req.AccountID,
+		Amount:      req.Amount,
+		Reason:      req.Reason,
+		Reference:   req.Reference,
+		Attachments: append([]string(nil), req.Attachments...),
+		Status:      AdjustmentPending,
+		RequestedBy: actorOf(ctx),
+		RequestedAt: r.now(),
+	}
+	r.adjustments = append(r.adjustments, tenantAdjustment{tenant: tenant, idempotencyKey: req.IdempotencyKey, Adjustment: adj})
+
+	return adj, nil
+}
+
+func (r *MemRepo) ListAdjustments(ctx context.Context, req ListAdjustmentsRequest) ([]Adjustment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenant := tenantOf(ctx)
+	var adjs []Adjustment
+	for _, ta := range r.adjustments {
+		if req.Limit > 0 && len(adjs) == req.Limit {
+			break
+		}
+		switch {
+		case ta.tenant != tenant:
+		case req.AccountID != nil && ta.AccountID != *req.AccountID:
+		case req.Status != nil && ta.Status != *req.Status:
+		case req.Reference != nil && ta.Reference != *req.Reference:
+		case req.AfterID != nil && ta.ID <= *req.AfterID:
+		default:
+			adjs = append(adjs, ta.Adjustment)
+		}
+	}
+
+	return adjs, nil
+}
+
+func (r *MemRepo) GetAdjustment(ctx context.Context, req GetAdjustmentRequest) (Adjustment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ta, err := r.adjustment(tenantOf(ctx), req.ID)
+	return ta.Adjustment, err
+}
+
+// adjustment looks up adjustment `id` of tenant `tenant`;
+// the caller holds the lock
+func (r *MemRepo) adjustment(tenant string, id int) (*tenantAdjustment, error) {
+	if id <= 0 || id > len(r.adjustments) || r.adjustments[id-1].tenant != tenant {
+		return &tenantAdjustment{}, fmt.Errorf("%w: %v", ErrAdjustmentNotFound, id)
+	}
+	return &r.adjustments[id-1], nil
+}
+
+func (r *MemRepo) DecideAdjustment(ctx context.Context, req DecideAdjustmentRequest) (_ Adjustment, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant := tenantOf(ctx)
+	ta, err := r.adjustment(tenant, req.ID)
+	target := ta.AccountID
+	if err != nil {
+		target = strconv.Itoa(req.ID)
+	}
+	defer func() { r.audit(ctx, tenant, decisionAction(req.Approve), target, req, err) }()
+	if err != nil {
+		return Adjustment{}, err
+	}
+
+	actor := actorOf(ctx)
+	if err = checkDecision(ta.Adjustment, actor, req.Approve); err != nil {
+		return Adjustment{}, err
+	}
+	decided := ta.Adjustment
+	decided.Status = AdjustmentRejected
+	if req.Approve {
+		acct := r.accounts[accountKey{tenant, ta.AccountID}]
+		suspense := SuspenseAccountID(acct.Currency)
+		key := accountKey{tenant, suspense}
+		if _, exists := r.accounts[key]; !exists {
+			now := r.now()
+			r.accounts[key] = Account{
+				ID:        suspense,
+				Currency:  acct.Currency,
+				CreatedAt: now,
+				UpdatedAt: now,
+				System:    true,
+			}
+		}
+		trnsfr, err := r.createTransfer(tenant, adjustmentTransfer(ta.Adjustment, suspense), true)
+		if err != nil {
+			return Adjustment{}, err
+		}
+		decided.Status = AdjustmentApproved
+		decided.TransferID = &trnsfr.ID
+	}
+	now := r.now()
+	decided.DecidedBy = actor
+	decided.DecidedAt = &now
+	decided.Note = req.Note
+	ta.Adjustment = decided
+
+	return decided, nil
+}
+
+func (r *MemRepo) FreezeAccount(ctx context.Context, req FreezeAccountRequest) (_ Account, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() {
+		action := AuditFreezeAccount
+		if !req.Frozen {
+			action = AuditUnfreezeAccount
+		}
+		r.audit(ctx, tenantOf(ctx), action, req.ID, req, err)
+	}()
+
+	key := accountKey{tenantOf(ctx), req.ID}
+	acct, exists := r.accounts[key]
+	if !exists || acct.System {
+		return Account{}, fmt.Errorf("%w: %v", ErrAccountNotFound, req.ID)
+	}
+	acct.Frozen = req.Frozen
+	acct.UpdatedAt = r.now()
+	r.accounts[key] = acct
+
+	return acct, nil
+}
+
+func (r *MemRepo) Reconcile(ctx context.Context, req ReconcileRequest) ([]Reconciliation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenant := tenantOf(ctx)
+	expected := map[string]float64{}
+	for key, opening := range r.openings {
+		if key.tenant == tenant {
+			expected[key.id] = opening
+		}
+	}
+	for _, t := range r.transfers {
+		if t.tenant == tenant {
+			expected[t.From] -= t.Amount
+			expected[t.To] += t.Amount
+		}
+	}
+
+	var recs []Reconciliation
+	for key, acct := range r.accounts {
+		if key.tenant != tenant || (req.Currency != nil && acct.Currency != *req.Currency) {
+			continue
+		}
+		recs = append(recs, Reconciliation{
+			ID:       acct.ID,
+			Currency: acct.Currency,
+			Balance:  acct.Balance,
+			Expected: expected[acct.ID],
+		})
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].ID < recs[j].ID })
+
+	return recs, nil
+}
+
+func (r *MemRepo) CreateTenant(ctx context.Context, t Tenant) (_ Tenant, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	req := t
+	defer func() { r.audit(ctx, req.ID, AuditCreateTenant, req.ID, req, err) }()
+
+	if _, exists := r.tenants[t.ID]; exists {
+		return t, fmt.Errorf("%w: %v", ErrTenantExists, t.ID)
+	}
+	t.Currencies = append([]string(nil), t.Currencies...)
+	t.CreatedAt = r.now()
+	r.tenants[t.ID] = t
+
+	return t, nil
+}
+
+func (r *MemRepo) CreateAPIKey(ctx context.Context, req APIKey) (_ APIKey, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() { r.audit(ctx, req.TenantID, AuditCreateAPIKey, req.TenantID, req, err) }()
+
+	if _, exists := r.tenants[req.TenantID]; !exists {
+		return APIKey{}, fmt.Errorf("%w: %v", ErrTenantNotFound, req.TenantID)
+	}
+	key, hash, err := newAPIKey(req.TenantID, req.Admin)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.CreatedAt = r.now()
+	r.apiKeys[key.ID] = memAPIKey{tenant: key.TenantID, hash: hash, admin: key.Admin}
+
+	return key, nil
+}
+
+func (r *MemRepo) RevokeAPIKey(ctx context.Context, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, exists := r.apiKeys[id]
+	tenant := tenantOf(ctx)
+	if exists && !key.revoked {
+		tenant = key.tenant
+	}
+	defer func() { r.audit(ctx, tenant, AuditRevokeAPIKey, id, id, err) }()
+	if !exists || key.revoked {
+		return fmt.Errorf("%w: %v", ErrAPIKeyNotFound, id)
+	}
+	key.revoked = true
+	r.apiKeys[id] = key
+
+	return nil
+}
+
+func (r *MemRepo) Authenticate(ctx context.Context, key string) (Principal, error) {
+	id, secret, ok := parseAPIKey(key)
+	if !ok {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	k, exists := r.apiKeys[id]
+	if !exists || k.revoked || !apiKeyMatches(k.hash, secret) {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	return Principal{KeyID: id, Tenant: r.tenants[k.tenant], Admin: k.admin}, nil
+}
+
+// audit appends the entry of a call, or of its failure `err`,
+// as `Repo` writes it; the caller holds the lock
+func (r *MemRepo) audit(ctx context.Context, tenant, action, target string, req interface{}, err error) {
+	e := newAuditEntry(ctx, tenant, action, target, req)
+	if err != nil {
+		e = e.failed(err)
+	}
+	e.ID = len(r.audits) + 1
+	e.At = r.now()
+	r.audits = append(r.audits, e)
+}
+
+func (r *MemRepo) ListAudit(ctx context.Context, req ListAuditRequest) ([]AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenant := tenantOf(ctx)
+	var entries []AuditEntry
+	for _, e := range r.audits {
+		switch {
+		case e.tenant != tenant:
+		case req.Actor != nil && e.Actor != *req.Actor:
+		case req.Target != nil && e.Target != *req.Target:
+		case !req.From.IsZero() && e.At.Before(req.From):
+		case !req.To.IsZero() && !e.At.Before(req.To):
+		case req.AfterID != nil && e.ID <= *req.AfterID:
+		default:
+			entries = append(entries, e)
+		}
+		if req.Limit > 0 && len(entries) == req.Limit {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+func (r *MemRepo) GetLedgerProof(ctx context.Context, req LedgerProofRequest) (LedgerProof, error) {
+	tenant := tenantOf(ctx)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	proof := LedgerProof{TenantID: tenant, Links: []LedgerLink{}}
+	i := req.TransferID - 1
+	if i < 0 || i >= len(r.transfers) || r.transfers[i].tenant != tenant {
+		return proof, fmt.Errorf("%w: %v", ErrTransferNotFound, req.TransferID)
+	}
+	t := r.transfers[i]
+	if t.seq == 0 {
+		return proof, fmt.Errorf("%w: %v", ErrTransferPending, req.TransferID)
+	}
+	proof.Transfer = ChainedTransfer{Transfer: t.Transfer, PrevHash: t.prevHash, Hash: t.hash, seq: t.seq}
+
+	var cp *LedgerCheckpoint
+	for j := range r.checkpoints {
+		c := r.checkpoints[j]
+		if c.TenantID == tenant && c.seq >= t.seq && (cp == nil || c.seq < cp.seq) {
+			cp = &c
+		}
+	}
+	if cp == nil {
+		return proof, nil
+	}
+	// transfers are chained in the order they are booked
+	for _, link := range r.transfers[i+1:] {
+		if link.tenant == tenant && link.seq > t.seq && link.seq <= cp.seq {
+			proof.Links = append(proof.Links, LedgerLink{TransferID: link.ID, Digest: transferDigest(tenant, link.Transfer)})
+		}
+	}
+	proof.Checkpoint = cp
+
+	return proof, nil
+}
+
+func (r *MemRepo) ChainLedger(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.chainPending(), nil
+}
+
+// chainPending chains the pending transfers in the order they were booked,
+// by the digest they were booked with, and returns how many it chained; the
+// caller holds the lock
+func (r *MemRepo) chainPending() int {
+	for _, i := range r.pending {
+		t := &r.transfers[i]
+		head := r.heads[t.tenant]
+		t.prevHash, t.seq = head.hash, head.seq+1
+		t.hash = chainHash(head.hash, t.digest)
+		r.heads[t.tenant] = ledgerHead{transferID: t.ID, hash: t.hash, at: t.CreatedAt, seq: t.seq}
+	}
+	chained := len(r.pending)
+	r.pending = nil
+
+	return chained
+}
+
+func (r *MemRepo) CheckpointLedger(ctx context.Context, signer LedgerSigner) ([]LedgerCheckpoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.chainPending()
+	tenants := make([]string, 0, len(r.heads))
+	for tenant := range r.heads {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	var cps []LedgerCheckpoint
+	at := r.now()
+	for _, tenant := range tenants {
+		head := r.heads[tenant]
+		if r.checkpointed(tenant, head.transferID) {
+			continue
+		}
+		cp := newCheckpoint(tenant, head, at)
+		signer.sign(&cp)
+		r.checkpoints = append(r.checkpoints, cp)
+		cps = append(cps, cp)
+	}
+
+	return cps, nil
+}
+
+// checkpointed tells if transfer `transferID` of `tenant` has a checkpoint;
+// the caller holds the lock
+func (r *MemRepo) checkpointed(tenant string, transferID int) bool {
+	for _, cp := range r.checkpoints {
+		if cp.TenantID == tenant && cp.TransferID == transferID {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyLedger walks the ledgers as stored, which nothing but the
+// repository itself writes, so it only fails if the repository is broken
+func (r *MemRepo) VerifyLedger(ctx context.Context, keys []ed25519.PublicKey, tenants ...string) ([]LedgerVerification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pending := map[string]int{}
+	for _, i := range r.pending {
+		pending[r.transfers[i].tenant]++
+	}
+	if len(tenants) == 0 {
+		for tenant := range r.heads {
+			tenants = append(tenants, tenant)
+		}
+		for tenant := range pending {
+			if _, ok := r.heads[tenant]; !ok {
+				tenants = append(tenants, tenant)
+			}
+		}
+		sort.Strings(tenants)
+	}
+
+	var vs []LedgerVerification
+	for _, tenant := range tenants {
+		var cps []LedgerCheckpoint
+		for _, cp := range r.checkpoints {
+			if cp.TenantID == tenant {
+				cps = append(cps, cp)
+			}
+		}
+		sort.Slice(cps, func(i, j int) bool { return cps[i].seq < cps[j].seq })
+
+		// transfers are chained in the order they are booked,
+		// so that of `transfers` is the chain order
+		cv := newChainVerifier(tenant, keys, cps, time.Time{})
+		for _, t := range r.transfers {
+			if t.tenant != tenant || t.seq == 0 {
+				continue
+			}
+			if !cv.add(ChainedTransfer{Transfer: t.Transfer, PrevHash: t.prevHash, Hash: t.hash, seq: t.seq}) {
+				break
+			}
+		}
+		v := cv.finish(r.heads[tenant])
+		v.Pending = pending[tenant]
+		vs = append(vs, v)
+	}
+
+	return vs, nil
+}
@@ -0,0 +1,97 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/wallet"
+	"github.com/arhyth/genwallet/wallet/wallettest"
+)
+
+func TestMemRepoConformance(t *testing.T) {
+	wallettest.RunRepositoryTests(t, func(*testing.T) wallet.Repository {
+		return wallet.NewMemRepo()
+	})
+}
+
+func TestMemRepoCreateTransfer(t *testing.T) {
+	ctx := context.Background()
+	setup := func(tt *testing.T) *wallet.MemRepo {
+		repo := wallet.NewMemRepo()
+		for _, req := range []wallet.CreateAccountRequest{
+			{ID: "alice-123", InitAmt: 100, Currency: "USD"},
+			{ID: "bob-456", InitAmt: 0, Currency: "USD"},
+			{ID: "chen-789", InitAmt: 100, Currency: "CNY"},
+		} {
+			_, err := repo.CreateAccount(ctx, req)
+			require.Nil(tt, err)
+		}
+		return repo
+	}
+
+	t.Run("success", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		repo := setup(tt)
+
+		trnsfr, err := repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 40})
+		reqrd.Nil(err)
+		as.Equal(1, trnsfr.ID)
+		as.Equal("USD", trnsfr.Currency)
+
+		alice, err := repo.GetAccount(ctx, wallet.GetAccountRequest{ID: "alice-123"})
+		reqrd.Nil(err)
+		as.Equal(60.0, alice.Balance)
+		bob, err := repo.GetAccount(ctx, wallet.GetAccountRequest{ID: "bob-456"})
+		reqrd.Nil(err)
+		as.Equal(40.0, bob.Balance)
+	})
+
+	t.Run("errors", func(tt *testing.T) {
+		as := assert.New(tt)
+		repo := setup(tt)
+
+		_, err := repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "nobody-0", Amount: 1})
+		as.True(errors.Is(err, wallet.ErrAccountNotFound))
+		_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "chen-789", Amount: 1})
+		as.True(errors.Is(err, wallet.ErrCurrencyMismatch))
+		_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "bob-456", To: "alice-123", Amount: 1})
+		as.True(errors.Is(err, wallet.ErrInsufficientFunds))
+		_, err = repo.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "bob-456", Currency: "USD"})
+		as.True(errors.Is(err, wallet.ErrAccountExists))
+	})
+
+	t.Run("concurrent transfers", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		repo := setup(tt)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 3})
+			}()
+			go func() {
+				defer wg.Done()
+				repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "bob-456", To: "alice-123", Amount: 2})
+			}()
+		}
+		wg.Wait()
+
+		accts, err := repo.ListAccounts(ctx, wallet.ListAccountsRequest{})
+		reqrd.Nil(err)
+		var total float64
+		for _, a := range accts {
+			as.GreaterOrEqual(a.Balance, 0.0)
+			total += a.Balance
+		}
+		as.Equal(200.0, total)
+	})
+}
@@ -0,0 +1,98 @@
+package wallet
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Metadata is a set of arbitrary key-value pairs that clients attach to
+// accounts and transfers (e.g. their own order IDs). It is stored as a
+// JSONB object.
+type Metadata map[string]string
+
+// MetadataParamPrefix prefixes the keys of metadata filter query params,
+// e.g. `?metadata.order_id=1234`
+const MetadataParamPrefix = "metadata."
+
+// Value implements `driver.Valuer`; nil metadata is stored as `{}`
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	bits, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(bits), nil
+}
+
+// Scan implements `sql.Scanner`; empty objects are scanned as nil
+func (m *Metadata) Scan(src interface{}) error {
+	var bits []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		bits = v
+	case string:
+		bits = []byte(v)
+	default:
+		return fmt.Errorf("unsupported metadata column type %T", src)
+	}
+
+	var kv map[string]string
+	if err := json.Unmarshal(bits, &kv); err != nil {
+		return err
+	}
+	if len(kv) == 0 {
+		kv = nil
+	}
+	*m = kv
+
+	return nil
+}
+
+// contains tells whether `m` has every key-value pair of `sub`
+func (m Metadata) contains(sub Metadata) bool {
+	for k, v := range sub {
+		if mv, exists := m[k]; !exists || mv != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clone copies `m` so that stored metadata is not aliased by callers
+func (m Metadata) clone() Metadata {
+	if len(m) == 0 {
+		return nil
+	}
+	c := make(Metadata, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
+
+// metadataFilter collects `metadata.<key>=<value>` query params
+func metadataFilter(query url.Values) Metadata {
+	var filter Metadata
+	for param, vals := range query {
+		if !strings.HasPrefix(param, MetadataParamPrefix) || len(vals) == 0 {
+			continue
+		}
+		if filter == nil {
+			filter = Metadata{}
+		}
+		filter[strings.TrimPrefix(param, MetadataParamPrefix)] = vals[0]
+	}
+
+	return filter
+}
@@ -1,7 +1,9 @@
 package wallet
 
 import (
-	"github.com/arhyth/genwallet/errorrrs"
+	"context"
+	"strings"
+
 	"github.com/rs/zerolog"
 )
 
@@ -15,51 +17,151 @@ type ValidationMiddleware struct {
 	Logger *zerolog.Logger
 }
 
-func (vm *ValidationMiddleware) ListAccounts(req ListAccountsRequest) ([]Account, error) {
-	return vm.Next.ListAccounts(req)
+func (vm *ValidationMiddleware) ListAccounts(ctx context.Context, req ListAccountsRequest) ([]Account, error) {
+	req.Currency = normalizeCurrencyFilter(req.Currency)
+	if err := validate(req.rules()); err != nil {
+		return nil, err
+	}
+
+	return vm.Next.ListAccounts(ctx, req)
+}
+
+func (vm *ValidationMiddleware) StreamAccounts(ctx context.Context, req ListAccountsRequest, fn func(Account) error) error {
+	req.Currency = normalizeCurrencyFilter(req.Currency)
+	if err := validate(req.rules()); err != nil {
+		return err
+	}
+
+	return vm.Next.StreamAccounts(ctx, req, fn)
 }
 
-func (vm *ValidationMiddleware) GetAccount(req GetAccountRequest) (Account, error) {
-	return vm.Next.GetAccount(req)
+func (vm *ValidationMiddleware) GetAccount(ctx context.Context, req GetAccountRequest) (Account, error) {
+	return vm.Next.GetAccount(ctx, req)
 }
 
-func (vm *ValidationMiddleware) CreateAccount(req CreateAccountRequest) (Account, error) {
-	if _, exist := ValidCurrencies[req.Currency]; !exist {
-		return Account{}, &errorrrs.E{
-			ID:  errorrrs.BadRequest,
-			Msg: "invalid currency",
-		}
+func (vm *ValidationMiddleware) CreateAccount(ctx context.Context, req CreateAccountRequest) (Account, error) {
+	req.Currency = normalizeCurrency(req.Currency)
+	if err := validate(withTenantRules(ctx, req.rules(), req.tenantRules)); err != nil {
+		return Account{}, err
 	}
 
-	return vm.Next.CreateAccount(req)
+	return vm.Next.CreateAccount(ctx, req)
 }
 
-func (vm *ValidationMiddleware) ListPayments(req ListPaymentsRequest) ([]Payment, error) {
-	return vm.Next.ListPayments(req)
+func (vm *ValidationMiddleware) ListPayments(ctx context.Context, req ListPaymentsRequest) ([]Payment, error) {
+	if err := validate(req.rules()); err != nil {
+		return nil, err
+	}
+
+	return vm.Next.ListPayments(ctx, req)
+}
+
+func (vm *ValidationMiddleware) StreamPayments(ctx context.Context, req ListPaymentsRequest, fn func(Payment) error) error {
+	if err := validate(req.rules()); err != nil {
+		return err
+	}
+
+	return vm.Next.StreamPayments(ctx, req, fn)
 }
 
-func (vm *ValidationMiddleware) CreatePayment(req CreatePaymentRequest) (Payment, error) {
+func (vm *ValidationMiddleware) CreatePayment(ctx context.Context, req CreatePaymentRequest) (Payment, error) {
 	// Note: we can check here if payee and payer wallet currencies match by adding
 	// a dependency to wallet.Repository. However, since balance access and updates still need
 	// to be serialized we just piggyback currency matching validation on the transaction.
+	// The same goes for the uniqueness of references.
+	req.Reference = strings.TrimSpace(req.Reference)
+	if err := validate(withTenantRules(ctx, req.rules(), req.tenantRules)); err != nil {
+		return Payment{}, err
+	}
+
+	return vm.Next.CreatePayment(ctx, req)
+}
+
+func (vm *ValidationMiddleware) ListTransfers(ctx context.Context, req ListTransfersRequest) ([]Transfer, error) {
+	req.Currency = normalizeCurrencyFilter(req.Currency)
+	if err := validate(req.rules()); err != nil {
+		return nil, err
+	}
+
+	return vm.Next.ListTransfers(ctx, req)
+}
 
-	if req.Self == req.To {
-		return Payment{}, &errorrrs.E{
-			ID:  errorrrs.BadRequest,
-			Msg: "transfer recipient is same wallet",
-		}
+func (vm *ValidationMiddleware) StreamTransfers(ctx context.Context, req ListTransfersRequest, fn func(Transfer) error) error {
+	req.Currency = normalizeCurrencyFilter(req.Currency)
+	if err := validate(req.rules()); err != nil {
+		return err
 	}
 
-	if req.Amount == 0 {
-		return Payment{}, &errorrrs.E{
-			ID:  errorrrs.BadRequest,
-			Msg: "transfer amount is `0`",
-		}
+	return vm.Next.StreamTransfers(ctx, req, fn)
+}
+
+func (vm *ValidationMiddleware) GetStatement(ctx context.Context, req StatementRequest) (Statement, error) {
+	if err := validate(req.rules()); err != nil {
+		return Statement{}, err
 	}
 
-	return vm.Next.CreatePayment(req)
+	return vm.Next.GetStatement(ctx, req)
 }
 
-func (vm *ValidationMiddleware) ListTransfers(req ListTransfersRequest) ([]Transfer, error) {
-	return vm.Next.ListTransfers(req)
+func (vm *ValidationMiddleware) GetLedgerProof(ctx context.Context, req LedgerProofRequest) (LedgerProof, error) {
+	if err := validate(req.rules()); err != nil {
+		return LedgerProof{}, err
+	}
+
+	return vm.Next.GetLedgerProof(ctx, req)
+}
+
+func (vm *ValidationMiddleware) RequestAdjustment(ctx context.Context, req AdjustmentRequest) (Adjustment, error) {
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.Reference = strings.TrimSpace(req.Reference)
+	for i := range req.Attachments {
+		req.Attachments[i] = strings.TrimSpace(req.Attachments[i])
+	}
+	if err := validate(req.rules()); err != nil {
+		return Adjustment{}, err
+	}
+
+	return vm.Next.RequestAdjustment(ctx, req)
+}
+
+func (vm *ValidationMiddleware) ListAdjustments(ctx context.Context, req ListAdjustmentsRequest) ([]Adjustment, error) {
+	if err := validate(req.rules()); err != nil {
+		return nil, err
+	}
+
+	return vm.Next.ListAdjustments(ctx, req)
+}
+
+func (vm *ValidationMiddleware) GetAdjustment(ctx context.Context, req GetAdjustmentRequest) (Adjustment, error) {
+	return vm.Next.GetAdjustment(ctx, req)
+}
+
+func (vm *ValidationMiddleware) DecideAdjustment(ctx context.Context, req DecideAdjustmentRequest) (Adjustment, error) {
+	req.Note = strings.TrimSpace(req.Note)
+	if err := validate(req.rules()); err != nil {
+		return Adjustment{}, err
+	}
+
+	return vm.Next.DecideAdjustment(ctx, req)
+}
+
+func (vm *ValidationMiddleware) FreezeAccount(ctx context.Context, req FreezeAccountRequest) (Account, error) {
+	return vm.Next.FreezeAccount(ctx, req)
+}
+
+func (vm *ValidationMiddleware) Reconcile(ctx context.Context, req ReconcileRequest) ([]Reconciliation, error) {
+	req.Currency = normalizeCurrencyFilter(req.Currency)
+	if err := validate(req.rules()); err != nil {
+		return nil, err
+	}
+
+	return vm.Next.Reconcile(ctx, req)
+}
+
+func (vm *ValidationMiddleware) ListAudit(ctx context.Context, req ListAuditRequest) ([]AuditEntry, error) {
+	if err := validate(req.rules()); err != nil {
+		return nil, err
+	}
+
+	return vm.Next.ListAudit(ctx, req)
 }
@@ -0,0 +1,97 @@
+package wallet_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet"
+	MOCKWALLET "github.com/arhyth/genwallet/wallet/mock"
+)
+
+func TestValidationCreateAccount(t *testing.T) {
+	ctx := context.Background()
+	t.Run("normalizes currency", func(tt *testing.T) {
+		as := assert.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		next := MOCKWALLET.NewMockService(ctrl)
+		svc := &wallet.ValidationMiddleware{Next: next}
+
+		next.EXPECT().
+			CreateAccount(gomock.Any(), wallet.CreateAccountRequest{ID: "bob-888", Currency: "USD", InitAmt: 10}).
+			Return(wallet.Account{}, nil).
+			Times(1)
+
+		_, err := svc.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "bob-888", Currency: " usd", InitAmt: 10})
+		as.Nil(err)
+	})
+
+	t.Run("collects every violation", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		svc := &wallet.ValidationMiddleware{Next: MOCKWALLET.NewMockService(ctrl)}
+
+		_, err := svc.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "bob 888", Currency: "XXX", InitAmt: -5})
+		reqrd.Error(err)
+		e, ok := err.(*errorrrs.E)
+		reqrd.True(ok)
+		as.Equal(errorrrs.BadRequest, e.ID)
+		as.Equal(errorrrs.CodeValidationFailed, e.Code)
+		fields := []string{}
+		for _, f := range e.Fields {
+			fields = append(fields, f.Field)
+		}
+		as.Equal([]string{"id", "currency", "init_amt"}, fields)
+	})
+}
+
+func TestValidationCreatePayment(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name   string
+		req    wallet.CreatePaymentRequest
+		fields []string
+	}{
+		{"negative amount", wallet.CreatePaymentRequest{Self: "bob-888", To: "hao-91011", Amount: -10}, []string{"amount"}},
+		{"zero amount", wallet.CreatePaymentRequest{Self: "bob-888", To: "hao-91011"}, []string{"amount"}},
+		{"NaN amount", wallet.CreatePaymentRequest{Self: "bob-888", To: "hao-91011", Amount: math.NaN()}, []string{"amount"}},
+		{"infinite amount", wallet.CreatePaymentRequest{Self: "bob-888", To: "hao-91011", Amount: math.Inf(1)}, []string{"amount"}},
+		{"over max amount", wallet.CreatePaymentRequest{Self: "bob-888", To: "hao-91011", Amount: wallet.MaxAmount + 1}, []string{"amount"}},
+		{"self transfer", wallet.CreatePaymentRequest{Self: "bob-888", To: "bob-888", Amount: 10}, []string{"to_account"}},
+		{"missing recipient", wallet.CreatePaymentRequest{Self: "bob-888", Amount: 0}, []string{"to_account", "amount"}},
+		{"long reference", wallet.CreatePaymentRequest{Self: "bob-888", To: "hao-91011", Amount: 10,
+			Reference: strings.Repeat("r", wallet.MaxReferenceLen+1)}, []string{"reference"}},
+		{"unprintable description", wallet.CreatePaymentRequest{Self: "bob-888", To: "hao-91011", Amount: 10,
+			Description: "line\nbreak"}, []string{"description"}},
+		{"bad metadata", wallet.CreatePaymentRequest{Self: "bob-888", To: "hao-91011", Amount: 10,
+			Metadata: wallet.Metadata{"order.id": "1", "ok": "1", "long": strings.Repeat("v", wallet.MaxMetadataValueLen+1)}},
+			[]string{"metadata.long", "metadata.order.id"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(tt *testing.T) {
+			as := assert.New(tt)
+			reqrd := require.New(tt)
+			ctrl := gomock.NewController(tt)
+			defer ctrl.Finish()
+			svc := &wallet.ValidationMiddleware{Next: MOCKWALLET.NewMockService(ctrl)}
+
+			_, err := svc.CreatePayment(ctx, c.req)
+			e, ok := err.(*errorrrs.E)
+			reqrd.True(ok)
+			fields := []string{}
+			for _, f := range e.Fields {
+				fields = append(fields, f.Field)
+			}
+			as.Equal(c.fields, fields)
+		})
+	}
+}
@@ -5,105 +5,270 @@
 package mock_wallet
 
 import (
+	context "context"
+	reflect "reflect"
+
 	wallet "github.com/arhyth/genwallet/wallet"
 	gomock "github.com/golang/mock/gomock"
-	reflect "reflect"
 )
 
-// MockRepository is a mock of Repository interface
+// MockRepository is a mock of Repository interface.
 type MockRepository struct {
 	ctrl     *gomock.Controller
 	recorder *MockRepositoryMockRecorder
 }
 
-// MockRepositoryMockRecorder is the mock recorder for MockRepository
+// MockRepositoryMockRecorder is the mock recorder for MockRepository.
 type MockRepositoryMockRecorder struct {
 	mock *MockRepository
 }
 
-// NewMockRepository creates a new mock instance
+// NewMockRepository creates a new mock instance.
 func NewMockRepository(ctrl *gomock.Controller) *MockRepository {
 	mock := &MockRepository{ctrl: ctrl}
 	mock.recorder = &MockRepositoryMockRecorder{mock}
 	return mock
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
+// EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
-// ListAccounts mocks base method
-func (m *MockRepository) ListAccounts(arg0 wallet.ListAccountsRequest) ([]wallet.Account, error) {
+// CreateAccount mocks base method.
+func (m *MockRepository) CreateAccount(arg0 context.Context, arg1 wallet.CreateAccountRequest) (wallet.Account, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListAccounts", arg0)
-	ret0, _ := ret[0].([]wallet.Account)
+	ret := m.ctrl.Call(m, "CreateAccount", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Account)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ListAccounts indicates an expected call of ListAccounts
-func (mr *MockRepositoryMockRecorder) ListAccounts(arg0 interface{}) *gomock.Call {
+// CreateAccount indicates an expected call of CreateAccount.
+func (mr *MockRepositoryMockRecorder) CreateAccount(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccounts", reflect.TypeOf((*MockRepository)(nil).ListAccounts), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccount", reflect.TypeOf((*MockRepository)(nil).CreateAccount), arg0, arg1)
 }
 
-// GetAccount mocks base method
-func (m *MockRepository) GetAccount(arg0 wallet.GetAccountRequest) (wallet.Account, error) {
+// CreateTransfer mocks base method.
+func (m *MockRepository) CreateTransfer(arg0 context.Context, arg1 wallet.CreateTransferRequest) (wallet.Transfer, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAccount", arg0)
+	ret := m.ctrl.Call(m, "CreateTransfer", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTransfer indicates an expected call of CreateTransfer.
+func (mr *MockRepositoryMockRecorder) CreateTransfer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransfer", reflect.TypeOf((*MockRepository)(nil).CreateTransfer), arg0, arg1)
+}
+
+// DecideAdjustment mocks base method.
+func (m *MockRepository) DecideAdjustment(arg0 context.Context, arg1 wallet.DecideAdjustmentRequest) (wallet.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DecideAdjustment", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DecideAdjustment indicates an expected call of DecideAdjustment.
+func (mr *MockRepositoryMockRecorder) DecideAdjustment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecideAdjustment", reflect.TypeOf((*MockRepository)(nil).DecideAdjustment), arg0, arg1)
+}
+
+// FreezeAccount mocks base method.
+func (m *MockRepository) FreezeAccount(arg0 context.Context, arg1 wallet.FreezeAccountRequest) (wallet.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FreezeAccount", arg0, arg1)
 	ret0, _ := ret[0].(wallet.Account)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetAccount indicates an expected call of GetAccount
-func (mr *MockRepositoryMockRecorder) GetAccount(arg0 interface{}) *gomock.Call {
+// FreezeAccount indicates an expected call of FreezeAccount.
+func (mr *MockRepositoryMockRecorder) FreezeAccount(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccount", reflect.TypeOf((*MockRepository)(nil).GetAccount), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FreezeAccount", reflect.TypeOf((*MockRepository)(nil).FreezeAccount), arg0, arg1)
 }
 
-// CreateAccount mocks base method
-func (m *MockRepository) CreateAccount(arg0 wallet.CreateAccountRequest) (wallet.Account, error) {
+// GetAccount mocks base method.
+func (m *MockRepository) GetAccount(arg0 context.Context, arg1 wallet.GetAccountRequest) (wallet.Account, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateAccount", arg0)
+	ret := m.ctrl.Call(m, "GetAccount", arg0, arg1)
 	ret0, _ := ret[0].(wallet.Account)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CreateAccount indicates an expected call of CreateAccount
-func (mr *MockRepositoryMockRecorder) CreateAccount(arg0 interface{}) *gomock.Call {
+// GetAccount indicates an expected call of GetAccount.
+func (mr *MockRepositoryMockRecorder) GetAccount(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccount", reflect.TypeOf((*MockRepository)(nil).CreateAccount), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccount", reflect.TypeOf((*MockRepository)(nil).GetAccount), arg0, arg1)
 }
 
-// CreateTransfer mocks base method
-func (m *MockRepository) CreateTransfer(arg0 wallet.CreateTransferRequest) (wallet.Transfer, error) {
+// GetAdjustment mocks base method.
+func (m *MockRepository) GetAdjustment(arg0 context.Context, arg1 wallet.GetAdjustmentRequest) (wallet.Adjustment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateTransfer", arg0)
-	ret0, _ := ret[0].(wallet.Transfer)
+	ret := m.ctrl.Call(m, "GetAdjustment", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAdjustment indicates an expected call of GetAdjustment.
+func (mr *MockRepositoryMockRecorder) GetAdjustment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAdjustment", reflect.TypeOf((*MockRepository)(nil).GetAdjustment), arg0, arg1)
+}
+
+// GetLedgerProof mocks base method.
+func (m *MockRepository) GetLedgerProof(arg0 context.Context, arg1 wallet.LedgerProofRequest) (wallet.LedgerProof, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLedgerProof", arg0, arg1)
+	ret0, _ := ret[0].(wallet.LedgerProof)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLedgerProof indicates an expected call of GetLedgerProof.
+func (mr *MockRepositoryMockRecorder) GetLedgerProof(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLedgerProof", reflect.TypeOf((*MockRepository)(nil).GetLedgerProof), arg0, arg1)
+}
+
+// GetStatement mocks base method.
+func (m *MockRepository) GetStatement(arg0 context.Context, arg1 wallet.StatementRequest) (wallet.Statement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatement", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Statement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStatement indicates an expected call of GetStatement.
+func (mr *MockRepositoryMockRecorder) GetStatement(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatement", reflect.TypeOf((*MockRepository)(nil).GetStatement), arg0, arg1)
+}
+
+// ListAccounts mocks base method.
+func (m *MockRepository) ListAccounts(arg0 context.Context, arg1 wallet.ListAccountsRequest) ([]wallet.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccounts", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAccounts indicates an expected call of ListAccounts.
+func (mr *MockRepositoryMockRecorder) ListAccounts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccounts", reflect.TypeOf((*MockRepository)(nil).ListAccounts), arg0, arg1)
+}
+
+// ListAdjustments mocks base method.
+func (m *MockRepository) ListAdjustments(arg0 context.Context, arg1 wallet.ListAdjustmentsRequest) ([]wallet.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAdjustments", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.Adjustment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CreateTransfer indicates an expected call of CreateTransfer
-func (mr *MockRepositoryMockRecorder) CreateTransfer(arg0 interface{}) *gomock.Call {
+// ListAdjustments indicates an expected call of ListAdjustments.
+func (mr *MockRepositoryMockRecorder) ListAdjustments(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransfer", reflect.TypeOf((*MockRepository)(nil).CreateTransfer), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAdjustments", reflect.TypeOf((*MockRepository)(nil).ListAdjustments), arg0, arg1)
 }
 
-// ListTransfers mocks base method
-func (m *MockRepository) ListTransfers(arg0 wallet.ListTransfersRequest) ([]wallet.Transfer, error) {
+// ListAudit mocks base method.
+func (m *MockRepository) ListAudit(arg0 context.Context, arg1 wallet.ListAuditRequest) ([]wallet.AuditEntry, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListTransfers", arg0)
+	ret := m.ctrl.Call(m, "ListAudit", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAudit indicates an expected call of ListAudit.
+func (mr *MockRepositoryMockRecorder) ListAudit(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAudit", reflect.TypeOf((*MockRepository)(nil).ListAudit), arg0, arg1)
+}
+
+// ListTransfers mocks base method.
+func (m *MockRepository) ListTransfers(arg0 context.Context, arg1 wallet.ListTransfersRequest) ([]wallet.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTransfers", arg0, arg1)
 	ret0, _ := ret[0].([]wallet.Transfer)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ListTransfers indicates an expected call of ListTransfers
-func (mr *MockRepositoryMockRecorder) ListTransfers(arg0 interface{}) *gomock.Call {
+// ListTransfers indicates an expected call of ListTransfers.
+func (mr *MockRepositoryMockRecorder) ListTransfers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTransfers", reflect.TypeOf((*MockRepository)(nil).ListTransfers), arg0, arg1)
+}
+
+// Reconcile mocks base method.
+func (m *MockRepository) Reconcile(arg0 context.Context, arg1 wallet.ReconcileRequest) ([]wallet.Reconciliation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reconcile", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.Reconciliation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reconcile indicates an expected call of Reconcile.
+func (mr *MockRepositoryMockRecorder) Reconcile(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reconcile", reflect.TypeOf((*MockRepository)(nil).Reconcile), arg0, arg1)
+}
+
+// RequestAdjustment mocks base method.
+func (m *MockRepository) RequestAdjustment(arg0 context.Context, arg1 wallet.AdjustmentRequest) (wallet.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestAdjustment", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequestAdjustment indicates an expected call of RequestAdjustment.
+func (mr *MockRepositoryMockRecorder) RequestAdjustment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestAdjustment", reflect.TypeOf((*MockRepository)(nil).RequestAdjustment), arg0, arg1)
+}
+
+// StreamAccounts mocks base method.
+func (m *MockRepository) StreamAccounts(arg0 context.Context, arg1 wallet.ListAccountsRequest, arg2 func(wallet.Account) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamAccounts", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamAccounts indicates an expected call of StreamAccounts.
+func (mr *MockRepositoryMockRecorder) StreamAccounts(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamAccounts", reflect.TypeOf((*MockRepository)(nil).StreamAccounts), arg0, arg1, arg2)
+}
+
+// StreamTransfers mocks base method.
+func (m *MockRepository) StreamTransfers(arg0 context.Context, arg1 wallet.ListTransfersRequest, arg2 func(wallet.Transfer) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamTransfers", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamTransfers indicates an expected call of StreamTransfers.
+func (mr *MockRepositoryMockRecorder) StreamTransfers(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTransfers", reflect.TypeOf((*MockRepository)(nil).ListTransfers), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamTransfers", reflect.TypeOf((*MockRepository)(nil).StreamTransfers), arg0, arg1, arg2)
 }
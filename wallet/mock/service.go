@@ -5,120 +5,299 @@
 package mock_wallet
 
 import (
+	context "context"
+	reflect "reflect"
+
 	wallet "github.com/arhyth/genwallet/wallet"
 	gomock "github.com/golang/mock/gomock"
-	reflect "reflect"
 )
 
-// MockService is a mock of Service interface
+// MockService is a mock of Service interface.
 type MockService struct {
 	ctrl     *gomock.Controller
 	recorder *MockServiceMockRecorder
 }
 
-// MockServiceMockRecorder is the mock recorder for MockService
+// MockServiceMockRecorder is the mock recorder for MockService.
 type MockServiceMockRecorder struct {
 	mock *MockService
 }
 
-// NewMockService creates a new mock instance
+// NewMockService creates a new mock instance.
 func NewMockService(ctrl *gomock.Controller) *MockService {
 	mock := &MockService{ctrl: ctrl}
 	mock.recorder = &MockServiceMockRecorder{mock}
 	return mock
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
+// EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockService) EXPECT() *MockServiceMockRecorder {
 	return m.recorder
 }
 
-// ListAccounts mocks base method
-func (m *MockService) ListAccounts(arg0 wallet.ListAccountsRequest) ([]wallet.Account, error) {
+// CreateAccount mocks base method.
+func (m *MockService) CreateAccount(arg0 context.Context, arg1 wallet.CreateAccountRequest) (wallet.Account, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListAccounts", arg0)
-	ret0, _ := ret[0].([]wallet.Account)
+	ret := m.ctrl.Call(m, "CreateAccount", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Account)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ListAccounts indicates an expected call of ListAccounts
-func (mr *MockServiceMockRecorder) ListAccounts(arg0 interface{}) *gomock.Call {
+// CreateAccount indicates an expected call of CreateAccount.
+func (mr *MockServiceMockRecorder) CreateAccount(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccounts", reflect.TypeOf((*MockService)(nil).ListAccounts), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccount", reflect.TypeOf((*MockService)(nil).CreateAccount), arg0, arg1)
 }
 
-// GetAccount mocks base method
-func (m *MockService) GetAccount(arg0 wallet.GetAccountRequest) (wallet.Account, error) {
+// CreatePayment mocks base method.
+func (m *MockService) CreatePayment(arg0 context.Context, arg1 wallet.CreatePaymentRequest) (wallet.Payment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAccount", arg0)
+	ret := m.ctrl.Call(m, "CreatePayment", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Payment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePayment indicates an expected call of CreatePayment.
+func (mr *MockServiceMockRecorder) CreatePayment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePayment", reflect.TypeOf((*MockService)(nil).CreatePayment), arg0, arg1)
+}
+
+// DecideAdjustment mocks base method.
+func (m *MockService) DecideAdjustment(arg0 context.Context, arg1 wallet.DecideAdjustmentRequest) (wallet.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DecideAdjustment", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DecideAdjustment indicates an expected call of DecideAdjustment.
+func (mr *MockServiceMockRecorder) DecideAdjustment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecideAdjustment", reflect.TypeOf((*MockService)(nil).DecideAdjustment), arg0, arg1)
+}
+
+// FreezeAccount mocks base method.
+func (m *MockService) FreezeAccount(arg0 context.Context, arg1 wallet.FreezeAccountRequest) (wallet.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FreezeAccount", arg0, arg1)
 	ret0, _ := ret[0].(wallet.Account)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetAccount indicates an expected call of GetAccount
-func (mr *MockServiceMockRecorder) GetAccount(arg0 interface{}) *gomock.Call {
+// FreezeAccount indicates an expected call of FreezeAccount.
+func (mr *MockServiceMockRecorder) FreezeAccount(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccount", reflect.TypeOf((*MockService)(nil).GetAccount), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FreezeAccount", reflect.TypeOf((*MockService)(nil).FreezeAccount), arg0, arg1)
 }
 
-// CreateAccount mocks base method
-func (m *MockService) CreateAccount(arg0 wallet.CreateAccountRequest) (wallet.Account, error) {
+// GetAccount mocks base method.
+func (m *MockService) GetAccount(arg0 context.Context, arg1 wallet.GetAccountRequest) (wallet.Account, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateAccount", arg0)
+	ret := m.ctrl.Call(m, "GetAccount", arg0, arg1)
 	ret0, _ := ret[0].(wallet.Account)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CreateAccount indicates an expected call of CreateAccount
-func (mr *MockServiceMockRecorder) CreateAccount(arg0 interface{}) *gomock.Call {
+// GetAccount indicates an expected call of GetAccount.
+func (mr *MockServiceMockRecorder) GetAccount(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccount", reflect.TypeOf((*MockService)(nil).CreateAccount), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccount", reflect.TypeOf((*MockService)(nil).GetAccount), arg0, arg1)
 }
 
-// ListPayments mocks base method
-func (m *MockService) ListPayments(arg0 wallet.ListPaymentsRequest) ([]wallet.Payment, error) {
+// GetAdjustment mocks base method.
+func (m *MockService) GetAdjustment(arg0 context.Context, arg1 wallet.GetAdjustmentRequest) (wallet.Adjustment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListPayments", arg0)
-	ret0, _ := ret[0].([]wallet.Payment)
+	ret := m.ctrl.Call(m, "GetAdjustment", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Adjustment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ListPayments indicates an expected call of ListPayments
-func (mr *MockServiceMockRecorder) ListPayments(arg0 interface{}) *gomock.Call {
+// GetAdjustment indicates an expected call of GetAdjustment.
+func (mr *MockServiceMockRecorder) GetAdjustment(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPayments", reflect.TypeOf((*MockService)(nil).ListPayments), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAdjustment", reflect.TypeOf((*MockService)(nil).GetAdjustment), arg0, arg1)
 }
 
-// CreatePayment mocks base method
-func (m *MockService) CreatePayment(arg0 wallet.CreatePaymentRequest) (wallet.Payment, error) {
+// GetLedgerProof mocks base method.
+func (m *MockService) GetLedgerProof(arg0 context.Context, arg1 wallet.LedgerProofRequest) (wallet.LedgerProof, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreatePayment", arg0)
-	ret0, _ := ret[0].(wallet.Payment)
+	ret := m.ctrl.Call(m, "GetLedgerProof", arg0, arg1)
+	ret0, _ := ret[0].(wallet.LedgerProof)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLedgerProof indicates an expected call of GetLedgerProof.
+func (mr *MockServiceMockRecorder) GetLedgerProof(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLedgerProof", reflect.TypeOf((*MockService)(nil).GetLedgerProof), arg0, arg1)
+}
+
+// GetStatement mocks base method.
+func (m *MockService) GetStatement(arg0 context.Context, arg1 wallet.StatementRequest) (wallet.Statement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatement", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Statement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStatement indicates an expected call of GetStatement.
+func (mr *MockServiceMockRecorder) GetStatement(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatement", reflect.TypeOf((*MockService)(nil).GetStatement), arg0, arg1)
+}
+
+// ListAccounts mocks base method.
+func (m *MockService) ListAccounts(arg0 context.Context, arg1 wallet.ListAccountsRequest) ([]wallet.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccounts", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAccounts indicates an expected call of ListAccounts.
+func (mr *MockServiceMockRecorder) ListAccounts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccounts", reflect.TypeOf((*MockService)(nil).ListAccounts), arg0, arg1)
+}
+
+// ListAdjustments mocks base method.
+func (m *MockService) ListAdjustments(arg0 context.Context, arg1 wallet.ListAdjustmentsRequest) ([]wallet.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAdjustments", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAdjustments indicates an expected call of ListAdjustments.
+func (mr *MockServiceMockRecorder) ListAdjustments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAdjustments", reflect.TypeOf((*MockService)(nil).ListAdjustments), arg0, arg1)
+}
+
+// ListAudit mocks base method.
+func (m *MockService) ListAudit(arg0 context.Context, arg1 wallet.ListAuditRequest) ([]wallet.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAudit", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.AuditEntry)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CreatePayment indicates an expected call of CreatePayment
-func (mr *MockServiceMockRecorder) CreatePayment(arg0 interface{}) *gomock.Call {
+// ListAudit indicates an expected call of ListAudit.
+func (mr *MockServiceMockRecorder) ListAudit(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePayment", reflect.TypeOf((*MockService)(nil).CreatePayment), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAudit", reflect.TypeOf((*MockService)(nil).ListAudit), arg0, arg1)
 }
 
-// ListTransfers mocks base method
-func (m *MockService) ListTransfers(arg0 wallet.ListTransfersRequest) ([]wallet.Transfer, error) {
+// ListPayments mocks base method.
+func (m *MockService) ListPayments(arg0 context.Context, arg1 wallet.ListPaymentsRequest) ([]wallet.Payment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListTransfers", arg0)
+	ret := m.ctrl.Call(m, "ListPayments", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.Payment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPayments indicates an expected call of ListPayments.
+func (mr *MockServiceMockRecorder) ListPayments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPayments", reflect.TypeOf((*MockService)(nil).ListPayments), arg0, arg1)
+}
+
+// ListTransfers mocks base method.
+func (m *MockService) ListTransfers(arg0 context.Context, arg1 wallet.ListTransfersRequest) ([]wallet.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTransfers", arg0, arg1)
 	ret0, _ := ret[0].([]wallet.Transfer)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ListTransfers indicates an expected call of ListTransfers
-func (mr *MockServiceMockRecorder) ListTransfers(arg0 interface{}) *gomock.Call {
+// ListTransfers indicates an expected call of ListTransfers.
+func (mr *MockServiceMockRecorder) ListTransfers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTransfers", reflect.TypeOf((*MockService)(nil).ListTransfers), arg0, arg1)
+}
+
+// Reconcile mocks base method.
+func (m *MockService) Reconcile(arg0 context.Context, arg1 wallet.ReconcileRequest) ([]wallet.Reconciliation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reconcile", arg0, arg1)
+	ret0, _ := ret[0].([]wallet.Reconciliation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reconcile indicates an expected call of Reconcile.
+func (mr *MockServiceMockRecorder) Reconcile(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reconcile", reflect.TypeOf((*MockService)(nil).Reconcile), arg0, arg1)
+}
+
+// RequestAdjustment mocks base method.
+func (m *MockService) RequestAdjustment(arg0 context.Context, arg1 wallet.AdjustmentRequest) (wallet.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestAdjustment", arg0, arg1)
+	ret0, _ := ret[0].(wallet.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequestAdjustment indicates an expected call of RequestAdjustment.
+func (mr *MockServiceMockRecorder) RequestAdjustment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestAdjustment", reflect.TypeOf((*MockService)(nil).RequestAdjustment), arg0, arg1)
+}
+
+// StreamAccounts mocks base method.
+func (m *MockService) StreamAccounts(arg0 context.Context, arg1 wallet.ListAccountsRequest, arg2 func(wallet.Account) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamAccounts", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamAccounts indicates an expected call of StreamAccounts.
+func (mr *MockServiceMockRecorder) StreamAccounts(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamAccounts", reflect.TypeOf((*MockService)(nil).StreamAccounts), arg0, arg1, arg2)
+}
+
+// StreamPayments mocks base method.
+func (m *MockService) StreamPayments(arg0 context.Context, arg1 wallet.ListPaymentsRequest, arg2 func(wallet.Payment) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamPayments", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamPayments indicates an expected call of StreamPayments.
+func (mr *MockServiceMockRecorder) StreamPayments(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamPayments", reflect.TypeOf((*MockService)(nil).StreamPayments), arg0, arg1, arg2)
+}
+
+// StreamTransfers mocks base method.
+func (m *MockService) StreamTransfers(arg0 context.Context, arg1 wallet.ListTransfersRequest, arg2 func(wallet.Transfer) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamTransfers", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamTransfers indicates an expected call of StreamTransfers.
+func (mr *MockServiceMockRecorder) StreamTransfers(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTransfers", reflect.TypeOf((*MockService)(nil).ListTransfers), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamTransfers", reflect.TypeOf((*MockService)(nil).StreamTransfers), arg0, arg1, arg2)
 }
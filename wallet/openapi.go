@@ -0,0 +1,692 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arhyth/genwallet/errorrrs"
+)
+
+// OpenAPI is the subset of an OpenAPI 3 document that describes
+// the wallet API. Schemas are derived by reflection from the
+// request/response types so that they cannot drift from the code;
+// operations, on the other hand, are listed in `apiOperations` and
+// are checked against the registered routes by tests.
+type OpenAPI struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       OpenAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas         map[string]*Schema         `json:"schemas"`
+		SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+	} `json:"components"`
+	// Security applies to every operation that does not override it
+	Security []SecurityRequirement `json:"security"`
+}
+
+// SecurityRequirement maps security scheme names to their scopes
+type SecurityRequirement map[string][]string
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Operation struct {
+	Summary     string               `json:"summary"`
+	OperationID string               `json:"operationId"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// Security, if not nil, overrides that of the document;
+	// an empty one makes the operation public
+	Security *[]SecurityRequirement `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// apiOperation describes a route of the API. Request/response bodies
+// are given as (zero) values of their Go types.
+type apiOperation struct {
+	method, path string
+	id, summary  string
+	params       []Parameter
+	// body is the JSON request body, if any, and bodyExcept are
+	// fields of it that are bound from elsewhere (e.g. the path)
+	body       interface{}
+	bodyExcept []string
+	// bodyOptional bodies may be left out altogether
+	bodyOptional bool
+	resp         interface{}
+	// respTypes are media types besides JSON that the response can be
+	// negotiated to; a nil `resp` means the response is not JSON at all
+	respTypes []string
+	errs      []int
+	// public operations need no API key
+	public bool
+}
+
+var (
+	pathParamID = Parameter{
+		Name:     "id",
+		In:       "path",
+		Required: true,
+		Schema:   &Schema{Type: "string"},
+	}
+	pathParamAdjustmentID = Parameter{
+		Name:     "id",
+		In:       "path",
+		Required: true,
+		Schema:   &Schema{Type: "integer"},
+	}
+	queryParamCurrency = Parameter{
+		Name:        "currency",
+		In:          "query",
+		Description: "ISO 4217 currency code",
+		Schema:      &Schema{Type: "string"},
+	}
+	queryParamReference = Parameter{
+		Name:        "reference",
+		In:          "query",
+		Description: "payer's reference of the transfer",
+		Schema:      &Schema{Type: "string"},
+	}
+	// queryParamMetadata stands for any number of `metadata.<key>` params,
+	// which OpenAPI has no way to describe
+	queryParamMetadata = Parameter{
+		Name:        MetadataParamPrefix + "{key}",
+		In:          "query",
+		Description: "`metadata.<key>=<value>` params filter transfers having every one of the key-value pairs",
+		Schema:      &Schema{Type: "string"},
+	}
+	queryParamLimit = Parameter{
+		Name:        "limit",
+		In:          "query",
+		Description: "maximum number to list, at most " + strconv.Itoa(MaxPageSize) + "; none if absent",
+		Schema:      &Schema{Type: "integer"},
+	}
+	queryParamAfterID = Parameter{
+		Name:        "after_id",
+		In:          "query",
+		Description: "only list transfers with greater IDs, i.e. the page after the one ending with this ID",
+		Schema:      &Schema{Type: "integer"},
+	}
+	headerParamReadYourWrites = Parameter{
+		Name:        ReadYourWritesHeader,
+		In:          "header",
+		Description: "`true` to read from the primary database rather than the (possibly lagging) replica; also accepted as the `" + ReadYourWritesParam + "` query param",
+		Schema:      &Schema{Type: "boolean"},
+	}
+	headerParamIdempotencyKey = Parameter{
+		Name:        IdempotencyKeyHeader,
+		In:          "header",
+		Description: "key of the request, at most " + strconv.Itoa(MaxIdempotencyKeyLen) + " characters; requests of a wallet with the key of an earlier one return what that one made",
+		Schema:      &Schema{Type: "string"},
+	}
+	exportTypes = []string{MediaTypeCSV, MediaTypeNDJSON}
+)
+
+var apiOperations = []apiOperation{
+	{
+		method:  "GET",
+		path:    "/wallets",
+		id:      "listWallets",
+		summary: "list all wallets",
+		params: []Parameter{
+			queryParamCurrency,
+			{
+				Name:        "after",
+				In:          "query",
+				Description: "only list wallets with greater IDs, i.e. the page after the one ending with this ID",
+				Schema:      &Schema{Type: "string"},
+			},
+			queryParamLimit,
+			headerParamReadYourWrites,
+		},
+		resp:      []Account{},
+		respTypes: exportTypes,
+		errs:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	{
+		method:  "POST",
+		path:    "/wallets",
+		id:      "createWallet",
+		summary: "create wallet",
+		body:    CreateAccountRequest{},
+		resp:    Account{},
+		errs:    []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+	},
+	{
+		method:  "GET",
+		path:    "/wallets/{id}",
+		id:      "getWallet",
+		summary: "show wallet",
+		params:  []Parameter{pathParamID, headerParamReadYourWrites},
+		resp:    Account{},
+		errs:    []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	{
+		method:  "GET",
+		path:    "/wallets/{id}/payments",
+		id:      "listWalletPayments",
+		summary: "list all transfers from/to wallet",
+		params: []Parameter{
+			pathParamID,
+			queryParamReference,
+			queryParamMetadata,
+			queryParamAfterID,
+			queryParamLimit,
+			headerParamReadYourWrites,
+		},
+		resp:      []Payment{},
+		respTypes: exportTypes,
+		errs:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	{
+		method:     "POST",
+		path:       "/wallets/{id}/payments",
+		id:         "createWalletPayment",
+		summary:    "make transfer from one wallet to another",
+		params:     []Parameter{pathParamID, headerParamIdempotencyKey},
+		body:       CreatePaymentRequest{},
+		bodyExcept: []string{"account"},
+		resp:       Payment{},
+		errs: []int{
+			http.StatusBadRequest,
+			http.StatusNotFound,
+			http.StatusConflict,
+			http.StatusUnprocessableEntity,
+			http.StatusInternalServerError,
+			http.StatusServiceUnavailable,
+		},
+	},
+	{
+		method:  "GET",
+		path:    "/wallets/{id}/statement.xml",
+		id:      "getWalletStatement",
+		summary: "wallet statement (ISO 20022 camt.053)",
+		params: []Parameter{
+			pathParamID,
+			{
+				Name:        "from",
+				In:          "query",
+				Description: "start of period; date (inclusive) or RFC 3339 timestamp",
+				Schema:      &Schema{Type: "string"},
+			},
+			{
+				Name:        "to",
+				In:          "query",
+				Description: "end of period; date (inclusive) or RFC 3339 timestamp (exclusive)",
+				Schema:      &Schema{Type: "string"},
+			},
+		},
+		respTypes: []string{"application/xml"},
+		errs: []int{
+			http.StatusBadRequest,
+			http.StatusNotFound,
+			http.StatusUnprocessableEntity,
+			http.StatusInternalServerError,
+		},
+	},
+	{
+		method:  "GET",
+		path:    "/transfers",
+		id:      "listTransfers",
+		summary: "list all transfers",
+		params: []Parameter{
+			queryParamCurrency,
+			{
+				Name:        "from",
+				In:          "query",
+				Description: "payer wallet ID; works together with `to` as a `where... OR`",
+				Schema:      &Schema{Type: "string"},
+			},
+			{
+				Name:        "to",
+				In:          "query",
+				Description: "payee wallet ID; works together with `from` as a `where... OR`",
+				Schema:      &Schema{Type: "string"},
+			},
+			queryParamReference,
+			queryParamMetadata,
+			queryParamAfterID,
+			queryParamLimit,
+			headerParamReadYourWrites,
+		},
+		resp:      []Transfer{},
+		respTypes: exportTypes,
+		errs:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	{
+		method:  "GET",
+		path:    "/ledger/proof",
+		id:      "getLedgerProof",
+		summary: "proof that a transfer is part of the ledger, up to the first signed checkpoint after it",
+		params: []Parameter{
+			{Name: "transfer_id", In: "query", Description: "ID of the transfer to prove", Required: true, Schema: &Schema{Type: "integer"}},
+		},
+		resp: LedgerProof{},
+		errs: []int{
+			http.StatusBadRequest,
+			http.StatusNotFound,
+			http.StatusConflict,
+			http.StatusUnprocessableEntity,
+			http.StatusInternalServerError,
+		},
+	},
+	{
+		method:  "POST",
+		path:    "/adjustments",
+		id:      "requestAdjustment",
+		summary: "request to credit (positive amount) or debit (negative amount) a wallet against the suspense account of its currency, booked once another principal approves; admin only",
+		params:  []Parameter{headerParamIdempotencyKey},
+		body:    AdjustmentRequest{},
+		resp:    Adjustment{},
+		errs: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusConflict,
+			http.StatusInternalServerError,
+		},
+	},
+	{
+		method:  "GET",
+		path:    "/adjustments",
+		id:      "listAdjustments",
+		summary: "list adjustments, in ID order; admin only",
+		params: []Parameter{
+			{Name: "account_id", In: "query", Description: "wallet ID", Schema: &Schema{Type: "string"}},
+			{Name: "status", In: "query", Schema: adjustmentStatusSchema()},
+			queryParamReference,
+			queryParamAfterID,
+			queryParamLimit,
+		},
+		resp: []Adjustment{},
+		errs: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	{
+		method:  "GET",
+		path:    "/adjustments/{id}",
+		id:      "getAdjustment",
+		summary: "get adjustment; admin only",
+		params:  []Parameter{pathParamAdjustmentID},
+		resp:    Adjustment{},
+		errs:    []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	{
+		method:       "POST",
+		path:         "/adjustments/{id}/approve",
+		id:           "approveAdjustment",
+		summary:      "approve pending adjustment and book it; admin only, and not by its requester",
+		params:       []Parameter{pathParamAdjustmentID},
+		body:         DecideAdjustmentRequest{},
+		bodyExcept:   []string{"id", "approve"},
+		bodyOptional: true,
+		resp:         Adjustment{},
+		errs: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusConflict,
+			http.StatusUnprocessableEntity,
+			http.StatusInternalServerError,
+		},
+	},
+	{
+		method:       "POST",
+		path:         "/adjustments/{id}/reject",
+		id:           "rejectAdjustment",
+		summary:      "reject (or, by its requester, withdraw) pending adjustment; admin only",
+		params:       []Parameter{pathParamAdjustmentID},
+		body:         DecideAdjustmentRequest{},
+		bodyExcept:   []string{"id", "approve"},
+		bodyOptional: true,
+		resp:         Adjustment{},
+		errs: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusConflict,
+			http.StatusInternalServerError,
+		},
+	},
+	{
+		method:  "POST",
+		path:    "/wallets/{id}/freeze",
+		id:      "freezeWallet",
+		summary: "freeze wallet, refusing payments from/to it; admin only",
+		params:  []Parameter{pathParamID},
+		resp:    Account{},
+		errs:    []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	{
+		method:  "POST",
+		path:    "/wallets/{id}/unfreeze",
+		id:      "unfreezeWallet",
+		summary: "unfreeze wallet; admin only",
+		params:  []Parameter{pathParamID},
+		resp:    Account{},
+		errs:    []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	{
+		method:  "GET",
+		path:    "/reconciliation",
+		id:      "reconcileWallets",
+		summary: "check wallet balances against their opening balances and transfers; admin only",
+		params:  []Parameter{queryParamCurrency},
+		resp:    []Reconciliation{},
+		errs:    []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	{
+		method:  "GET",
+		path:    "/audit",
+		id:      "listAudit",
+		summary: "list the audit entries of state-changing calls, in ID order; admin only",
+		params: []Parameter{
+			{Name: "actor", In: "query", Description: "`apikey:<ID>` of the API key of the calls, or `anonymous`", Schema: &Schema{Type: "string"}},
+			{Name: "target", In: "query", Description: "what the calls were on, e.g. a wallet ID", Schema: &Schema{Type: "string"}},
+			{Name: "from", In: "query", Description: "RFC 3339 timestamp of the start of the period, inclusive", Schema: &Schema{Type: "string", Format: "date-time"}},
+			{Name: "to", In: "query", Description: "RFC 3339 timestamp of the end of the period, exclusive", Schema: &Schema{Type: "string", Format: "date-time"}},
+			{Name: "after_id", In: "query", Description: "only list entries with greater IDs", Schema: &Schema{Type: "integer"}},
+			queryParamLimit,
+		},
+		resp: []AuditEntry{},
+		errs: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	{
+		method:    "GET",
+		path:      "/openapi.json",
+		id:        "getOpenAPI",
+		summary:   "this document",
+		respTypes: []string{"application/json"},
+		public:    true,
+	},
+}
+
+// adjustmentStatusSchema is that of `AdjustmentStatus`, which
+// is used as a query param as well as in bodies
+func adjustmentStatusSchema() *Schema {
+	return &Schema{Type: "string", Enum: []string{
+		string(AdjustmentPending),
+		string(AdjustmentApproved),
+		string(AdjustmentRejected),
+	}}
+}
+
+var (
+	timeType             = reflect.TypeOf(time.Time{})
+	entryType            = reflect.TypeOf(EntryType(0))
+	adjustmentStatusType = reflect.TypeOf(AdjustmentStatus(""))
+	problemType          = reflect.TypeOf(errorrrs.Problem{})
+)
+
+// schemaBuilder derives schemas of Go types as they are (un)marshaled
+// by encoding/json, registering named struct types as components
+type schemaBuilder struct {
+	components map[string]*Schema
+}
+
+func (sb *schemaBuilder) schemaOf(t reflect.Type) *Schema {
+	// types with custom (un)marshaling
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case entryType:
+		return &Schema{Type: "string", Enum: []string{Incoming.String(), Outgoing.String()}}
+	case adjustmentStatusType:
+		return adjustmentStatusSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := sb.schemaOf(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes byte slices as base64 strings
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: sb.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: sb.schemaOf(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return sb.structSchema(t, nil)
+		}
+		if _, exists := sb.components[name]; !exists {
+			// register before recursing in case of self reference
+			sb.components[name] = &Schema{}
+			*sb.components[name] = *sb.structSchema(t, nil)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	return &Schema{}
+}
+
+// structSchema is the object schema of struct type `t` leaving out
+// JSON fields named in `except`
+func (sb *schemaBuilder) structSchema(t reflect.Type, except []string) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{},
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, optns, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := sb.structSchema(f.Type, except)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if contains(except, name) {
+			continue
+		}
+
+		s.Properties[name] = sb.schemaOf(f.Type)
+		if !strings.Contains(optns, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+
+	return s
+}
+
+func contains(ss []string, s string) bool {
+	for i := range ss {
+		if ss[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewOpenAPI derives the OpenAPI document of the wallet API
+func NewOpenAPI() *OpenAPI {
+	sb := &schemaBuilder{components: map[string]*Schema{}}
+	doc := &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:   "Genwallet",
+			Version: "1.0.0",
+		},
+		Paths: map[string]map[string]*Operation{},
+	}
+	errSchema := sb.schemaOf(problemType)
+	// either scheme authenticates; keys are only required with `AUTH_REQUIRED`
+	doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+		"bearer": {
+			Type:        "http",
+			Scheme:      "bearer",
+			Description: "API key of a tenant",
+		},
+		"apiKey": {
+			Type:        "apiKey",
+			In:          "header",
+			Name:        APIKeyHeader,
+			Description: "API key of a tenant",
+		},
+	}
+	doc.Security = []SecurityRequirement{{"bearer": {}}, {"apiKey": {}}}
+
+	for _, ao := range apiOperations {
+		op := &Operation{
+			Summary:     ao.summary,
+			OperationID: ao.id,
+			Parameters:  ao.params,
+			Responses:   map[string]*Response{},
+		}
+		if ao.body != nil {
+			t := reflect.TypeOf(ao.body)
+			var s *Schema
+			if ao.bodyExcept != nil {
+				s = sb.structSchema(t, ao.bodyExcept)
+			} else {
+				s = sb.schemaOf(t)
+			}
+			op.RequestBody = &RequestBody{
+				Required: !ao.bodyOptional,
+				Content:  map[string]*MediaType{"application/json": {Schema: s}},
+			}
+		}
+
+		ok := &Response{
+			Description: "success",
+			Content:     map[string]*MediaType{},
+		}
+		if ao.resp != nil {
+			ok.Content["application/json"] = &MediaType{Schema: sb.schemaOf(reflect.TypeOf(ao.resp))}
+		}
+		for _, mt := range ao.respTypes {
+			// no schema (other than opaque) is described for these
+			st := "string"
+			if mt == "application/json" {
+				st = "object"
+			}
+			ok.Content[mt] = &MediaType{Schema: &Schema{Type: st}}
+		}
+		op.Responses["200"] = ok
+		errs := ao.errs
+		if ao.public {
+			op.Security = &[]SecurityRequirement{}
+		} else {
+			// public operations are not rate limited either
+			errs = append([]int{http.StatusUnauthorized, http.StatusTooManyRequests}, errs...)
+		}
+		for _, status := range errs {
+			op.Responses[strconv.Itoa(status)] = &Response{
+				Description: http.StatusText(status),
+				Content: map[string]*MediaType{
+					errorrrs.ProblemMediaType: {Schema: errSchema},
+				},
+			}
+		}
+
+		if doc.Paths[ao.path] == nil {
+			doc.Paths[ao.path] = map[string]*Operation{}
+		}
+		doc.Paths[ao.path][strings.ToLower(ao.method)] = op
+	}
+	doc.Components.Schemas = sb.components
+
+	return doc
+}
+
+// OpenAPIHandler serves the OpenAPI document as JSON
+func OpenAPIHandler() http.Handler {
+	var (
+		once sync.Once
+		bits []byte
+		err  error
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		once.Do(func() {
+			bits, err = json.MarshalIndent(NewOpenAPI(), "", "  ")
+		})
+		if err != nil {
+			errorrrs.GokitErrorEncoder(context.Background(), err, w)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(bits)
+	})
+}
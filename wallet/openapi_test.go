@@ -0,0 +1,251 @@
+package wallet_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// resolve follows a schema reference, if any
+func resolve(doc *wallet.OpenAPI, s *wallet.Schema) *wallet.Schema {
+	if s.Ref == "" {
+		return s
+	}
+	return doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+}
+
+// validateJSON checks a decoded JSON value against schema `s`
+// returning every violation found
+func validateJSON(doc *wallet.OpenAPI, v interface{}, s *wallet.Schema, path string) []string {
+	s = resolve(doc, s)
+	if s == nil {
+		return []string{fmt.Sprintf("%v: unresolved schema", path)}
+	}
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return []string{fmt.Sprintf("%v: null but not nullable", path)}
+	}
+
+	var errs []string
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected object, got %T", path, v)}
+		}
+		for _, name := range s.Required {
+			if _, exists := obj[name]; !exists {
+				errs = append(errs, fmt.Sprintf("%v.%v: required but missing", path, name))
+			}
+		}
+		for name, fv := range obj {
+			fs, exists := s.Properties[name]
+			if !exists {
+				fs = s.AdditionalProperties
+			}
+			if fs == nil {
+				errs = append(errs, fmt.Sprintf("%v.%v: not in spec", path, name))
+				continue
+			}
+			errs = append(errs, validateJSON(doc, fv, fs, path+"."+name)...)
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected array, got %T", path, v)}
+		}
+		for i := range arr {
+			errs = append(errs, validateJSON(doc, arr[i], s.Items, fmt.Sprintf("%v[%d]", path, i))...)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected string, got %T", path, v)}
+		}
+		if len(s.Enum) > 0 && !containsStr(s.Enum, str) {
+			errs = append(errs, fmt.Sprintf("%v: %q not one of %v", path, str, s.Enum))
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				errs = append(errs, fmt.Sprintf("%v: %q not a date-time", path, str))
+			}
+		}
+	case "number", "integer":
+		n, ok := v.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%v: expected %v, got %T", path, s.Type, v)}
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			errs = append(errs, fmt.Sprintf("%v: %v not an integer", path, n))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{fmt.Sprintf("%v: expected boolean, got %T", path, v)}
+		}
+	}
+
+	return errs
+}
+
+func containsStr(ss []string, s string) bool {
+	for i := range ss {
+		if ss[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleOf makes up a value conforming to schema `s`
+func sampleOf(doc *wallet.OpenAPI, s *wallet.Schema) interface{} {
+	s = resolve(doc, s)
+	switch s.Type {
+	case "object":
+		obj := map[string]interface{}{}
+		for name, fs := range s.Properties {
+			obj[name] = sampleOf(doc, fs)
+		}
+		return obj
+	case "array":
+		return []interface{}{sampleOf(doc, s.Items)}
+	case "string":
+		if len(s.Enum) > 0 {
+			return s.Enum[0]
+		}
+		if s.Format == "date-time" {
+			return time.Now().UTC().Format(time.RFC3339)
+		}
+		return "USD"
+	case "number", "integer":
+		return 10
+	case "boolean":
+		return true
+	}
+	return nil
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+
+	doc := wallet.NewOpenAPI()
+	var specd []string
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			specd = append(specd, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	var routed []string
+	router := wallet.MakeHTTPHandler(wallet.NewSimpleWalletService())
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed = append(routed, method+" "+route)
+		return nil
+	})
+	reqrd.Nil(err)
+
+	sort.Strings(specd)
+	sort.Strings(routed)
+	as.Equal(routed, specd, "routes and OpenAPI document operations differ")
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	doc := wallet.NewOpenAPI()
+	handler := wallet.MakeHTTPHandler(wallet.NewSimpleWalletService())
+
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			ok := op.Responses["200"]
+			mt, isJSON := ok.Content["application/json"]
+			if !isJSON || mt.Schema.Type == "object" && mt.Schema.Properties == nil {
+				continue
+			}
+
+			name := strings.ToUpper(method) + " " + path
+			t.Run(name, func(tt *testing.T) {
+				as := assert.New(tt)
+				reqrd := require.New(tt)
+
+				var body bytes.Buffer
+				if op.RequestBody != nil {
+					sample := sampleOf(doc, op.RequestBody.Content["application/json"].Schema)
+					reqrd.Nil(json.NewEncoder(&body).Encode(sample))
+				}
+				url := path
+				for _, param := range op.Parameters {
+					if param.In == "path" {
+						v := "alice-123"
+						if param.Schema.Type == "integer" {
+							v = "1"
+						}
+						url = strings.ReplaceAll(url, "{"+param.Name+"}", v)
+					}
+				}
+				req, err := http.NewRequest(strings.ToUpper(method), url, &body)
+				reqrd.Nil(err)
+				w := httptest.NewRecorder()
+
+				handler.ServeHTTP(w, req)
+
+				reqrd.Equal(http.StatusOK, w.Code, w.Body.String())
+				var resp interface{}
+				reqrd.Nil(json.Unmarshal(w.Body.Bytes(), &resp))
+				as.Empty(validateJSON(doc, resp, mt.Schema, "$"))
+			})
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+
+	req, err := http.NewRequest("GET", "/openapi.json", nil)
+	reqrd.Nil(err)
+	w := httptest.NewRecorder()
+
+	wallet.MakeHTTPHandler(wallet.NewSimpleWalletService()).ServeHTTP(w, req)
+
+	as.Equal(http.StatusOK, w.Code)
+	var doc wallet.OpenAPI
+	reqrd.Nil(json.Unmarshal(w.Body.Bytes(), &doc))
+	as.Equal("3.0.3", doc.OpenAPI)
+	as.Contains(doc.Components.Schemas, "Account")
+	as.Equal([]string{"incoming", "outgoing"}, doc.Components.Schemas["Payment"].Properties["direction"].Enum)
+}
+
+func TestOpenAPISecurity(t *testing.T) {
+	as := assert.New(t)
+	doc := wallet.NewOpenAPI()
+
+	as.Contains(doc.Components.SecuritySchemes, "bearer")
+	as.Contains(doc.Components.SecuritySchemes, "apiKey")
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			name := strings.ToUpper(method) + " " + path
+			if path == "/openapi.json" {
+				if as.NotNil(op.Security, name) {
+					as.Empty(*op.Security, name)
+				}
+				continue
+			}
+			as.Nil(op.Security, name)
+			as.Contains(op.Responses, "401", name)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package wallet
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Transfers are range partitioned by month of `created_at` (UTC)
+// in partitions named after the month, e.g. `transfers_p2021_11`
+const (
+	partitionPrefix = "transfers_p"
+	partitionLayout = "2006_01"
+)
+
+// archiveLockKey identifies the Postgres advisory lock
+// held while archiving so that archive runs don't overlap
+const archiveLockKey = 7_136_504_172
+
+// TransferArchive is a partition of transfers that has been detached
+// and exported to `File`
+type TransferArchive struct {
+	Partition string
+	// From and To bound the partition's `created_at` as [From, To)
+	From, To time.Time
+	File     string
+	Rows     int64
+}
+
+// EnsureTransferPartitions creates the missing monthly partitions of
+// transfers from the month of `now` through `ahead` months later,
+// returning the names of those it created
+func (r *Repo) EnsureTransferPartitions(ctx context.Context, now time.Time, ahead int) ([]string, error) {
+	first := monthOf(now)
+	last := first.AddDate(0, ahead, 0)
+	rows, err := r.DB.QueryContext(ctx, `SELECT create_transfers_partitions($1, $2);`,
+		first.Format("2006-01-02"), last.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var created []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		created = append(created, name)
+	}
+
+	return created, rows.Err()
+}
+
+// MissingTransferPartitions lists the monthly partitions of transfers from
+// the month of `now` through `ahead` months later that are yet to be created.
+// Transfers have no default partition, so those of a month without one
+// cannot be booked.
+func (r *Repo) MissingTransferPartitions(ctx context.Context, now time.Time, ahead int) ([]string, error) {
+	partitions, err := attachedPartitions(ctx, r.DB)
+	if err != nil {
+		return nil, err
+	}
+	attached := make(map[string]bool, len(partitions))
+	for _, p := range partitions {
+		attached[p.Partition] = true
+	}
+
+	var missing []string
+	for m := monthOf(now); !m.After(monthOf(now).AddDate(0, ahead, 0)); m = m.AddDate(0, 1, 0) {
+		if name := partitionPrefix + m.Format(partitionLayout); !attached[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing, nil
+}
+
+// ArchiveTransfers detaches the partitions of transfers that end on or
+// before the month of `before` and exports each to a gzipped NDJSON file
+// of `Transfer`s, tagged with their tenant, in `dir`, dropping the partition
+// once its file is written. Detached partitions are recorded in
+// `transfer_archives` beforehand so that an interrupted run is
+// completed by the next one.
+//
+// Archived transfers are no longer listed and statements over periods
+// that include them are refused (`ErrPeriodArchived`).
+func (r *Repo) ArchiveTransfers(ctx context.Context, before time.Time, dir string) ([]TransferArchive, error) {
+	cutoff := monthOf(before)
+	if cutoff.After(monthOf(time.Now())) {
+		return nil, fmt.Errorf("archive: cannot archive the current month or later")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	conn, err := r.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1);`, archiveLockKey).Scan(&locked)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, errors.New("archive: another archive run is in progress")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, archiveLockKey)
+
+	partitions, err := attachedPartitions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range partitions {
+		if p.To.After(cutoff) {
+			continue
+		}
+		if err := detachPartition(ctx, conn, p); err != nil {
+			return nil, err
+		}
+	}
+
+	pending, err := pendingArchives(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var archived []TransferArchive
+	for _, p := range pending {
+		p.File = filepath.Join(dir, p.Partition+".ndjson.gz")
+		if p.Rows, err = exportPartition(ctx, conn, p.Partition, p.File); err != nil {
+			return archived, err
+		}
+		if err := dropPartition(ctx, conn, p); err != nil {
+			return archived, err
+		}
+		archived = append(archived, p)
+	}
+
+	return archived, nil
+}
+
+// monthOf returns the start of the (UTC) month of `t`
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// attachedPartitions lists the monthly partitions of transfers.
+// Bounds are derived from partition names; other partitions are skipped.
+func attachedPartitions(ctx context.Context, conn interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}) ([]TransferArchive, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT c.relname
+	FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+	WHERE i.inhparent = 'transfers'::regclass
+	ORDER BY c.relname;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []TransferArchive
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(name, partitionPrefix) {
+			continue
+		}
+		from, err := time.Parse(partitionLayout, strings.TrimPrefix(name, partitionPrefix))
+		if err != nil {
+			continue
+		}
+		partitions = append(partitions, TransferArchive{
+			Partition: name,
+			From:      from,
+			To:        from.AddDate(0, 1, 0),
+		})
+	}
+
+	return partitions, rows.Err()
+}
+
+// detachPartition detaches partition `p` and records it in `transfer_archives`,
+// along with the net of its transfers to each account so that reconciliation
+// still accounts for them
+func detachPartition(ctx context.Context, conn *sql.Conn, p TransferArchive) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO transfer_archives (partition, range_start, range_end)
+	VALUES ($1, $2, $3);`, p.Partition, p.From, p.To)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `ALTER TABLE transfers DETACH PARTITION `+pq.QuoteIdentifier(p.Partition)+`;`)
+	}
+	if err == nil {
+		partition := pq.QuoteIdentifier(p.Partition)
+		_, err = tx.ExecContext(ctx, `UPDATE accounts a SET archived_net = a.archived_net + n.net
+		FROM (
+			SELECT tenant_id, account_id, SUM(amount) AS net FROM (
+				SELECT tenant_id, "to" AS account_id, amount::double precision FROM `+partition+`
+				UNION ALL
+				SELECT tenant_id, "from", -amount::double precision FROM `+partition+`
+			) e GROUP BY tenant_id, account_id
+		) n
+		WHERE a.tenant_id = n.tenant_id AND a.id = n.account_id;`)
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("archive: detach %v: %w", p.Partition, err)
+	}
+
+	return tx.Commit()
+}
+
+// pendingArchives lists the detached partitions that are yet to be exported
+func pendingArchives(ctx context.Context, conn *sql.Conn) ([]TransferArchive, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT partition, range_start, range_end
+	FROM transfer_archives WHERE archived_at IS NULL ORDER BY range_start;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []TransferArchive
+	for rows.Next() {
+		var p TransferArchive
+		if err := rows.Scan(&p.Partition, &p.From, &p.To); err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+
+	return pending, rows.Err()
+}
+
+// archivedTransfer is a line of archive files. Unlike the API, archives
+// span tenants so each transfer is tagged with its own.
+type archivedTransfer struct {
+	TenantID string `json:"tenant_id"`
+	Transfer
+}
+
+// exportPartition writes the transfers of (detached) partition `name`
+// to `file`, returning how many were written. The file is written under
+// a temporary name first so that a complete file is never overwritten
+// by a partial one.
+func exportPartition(ctx context.Context, conn *sql.Conn, name, file string) (int64, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT `+transferColumns+`, tenant_id
+	FROM `+pq.QuoteIdentifier(name)+` ORDER BY id;`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	bw := bufio.NewWriter(gz)
+	enc := json.NewEncoder(bw)
+	var n int64
+	for rows.Next() {
+		var line archivedTransfer
+		line.Transfer, err = scanTransfer(rows, &line.TenantID)
+		if err != nil {
+			return 0, err
+		}
+		if err := enc.Encode(line); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	return n, os.Rename(tmp, file)
+}
+
+// dropPartition drops exported partition `p`, recording where it was exported to
+func dropPartition(ctx context.Context, conn *sql.Conn, p TransferArchive) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE transfer_archives
+	SET (file, rows, archived_at) = ($1, $2, now())
+	WHERE partition = $3;`, p.File, p.Rows, p.Partition)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DROP TABLE `+pq.QuoteIdentifier(p.Partition)+`;`)
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("archive: drop %v: %w", p.Partition, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,5 @@
+// Package pb holds the protobuf definition of the wallet API and the
+// code generated from it. Regenerate with `go generate ./wallet/pb`.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative wallet.proto
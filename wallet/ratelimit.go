@@ -0,0 +1,272 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/arhyth/genwallet/errorrrs"
+)
+
+// Rate is that of a token bucket: requests take a token each, of which up
+// to `Burst` are kept and `PerSecond` are added every second. Rates with no
+// `PerSecond` do not limit anything.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+func (r Rate) limits() bool {
+	return r.PerSecond > 0
+}
+
+// Limits are what the endpoints of the API are limited to, so that no single
+// client can saturate the database pool. Zero values do not limit anything.
+type Limits struct {
+	// PerKey is the rate of requests of each API key, or of each source
+	// IP for requests without one or with one not known to be valid
+	PerKey Rate
+	// PerAccount is the rate of payments from each account, of each
+	// API key (or source IP), so that retry storms on a busy wallet
+	// do not starve the other requests of the client
+	PerAccount Rate
+	// MaxInFlightPayments is how many payments may be in flight at once,
+	// across clients; payments beyond it are shed rather than queued
+	MaxInFlightPayments int
+}
+
+// Limiter enforces `Limits` on endpoints. The same limiter is meant to be
+// shared by every transport so that clients cannot get around their limits
+// by switching transports. A nil limiter does not limit anything.
+type Limiter struct {
+	perKey      endpoint.Middleware
+	perAccount  endpoint.Middleware
+	maxInFlight endpoint.Middleware
+
+	mu sync.RWMutex
+	// keys are the API keys that requests were authenticated with
+	keys map[string]struct{}
+}
+
+// NewLimiter makes a limiter of `l`
+func NewLimiter(l Limits) *Limiter {
+	lim := &Limiter{keys: make(map[string]struct{})}
+	if l.PerKey.limits() {
+		lim.perKey = RateLimit(l.PerKey, lim.callerOf)
+	}
+	if l.PerAccount.limits() {
+		lim.perAccount = RateLimit(l.PerAccount, lim.payerOf)
+	}
+	if l.MaxInFlightPayments > 0 {
+		lim.maxInFlight = LimitInFlight(l.MaxInFlightPayments)
+	}
+
+	return lim
+}
+
+// endpoint limits the endpoint of any operation
+func (l *Limiter) endpoint(e endpoint.Endpoint) endpoint.Endpoint {
+	if l == nil {
+		return e
+	}
+	if l.perKey != nil {
+		e = l.perKey(e)
+	}
+
+	return l.learnKeys(e)
+}
+
+// learnKeys learns which API keys are valid from the outcome of the
+// requests made with them: keys of requests that went past authentication
+// are, while those of requests refused as `unauthenticated` are not (or no
+// longer). Only valid keys are kept, so made up ones do not pile up.
+func (l *Limiter) learnKeys(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp, err := next(ctx, request)
+		key := apiKeyFrom(ctx)
+		if key == "" {
+			return resp, err
+		}
+		code := errorrrs.CodeInternal
+		if err != nil {
+			code = errorrrs.Classify(err).Code
+		}
+		switch {
+		case err == nil || (code != errorrrs.CodeUnauthenticated && code != errorrrs.CodeRateLimited && code != errorrrs.CodeOverloaded):
+			// rate limited and shed requests never got to authentication
+			l.mu.Lock()
+			l.keys[key] = struct{}{}
+			l.mu.Unlock()
+		case code == errorrrs.CodeUnauthenticated:
+			l.mu.Lock()
+			delete(l.keys, key)
+			l.mu.Unlock()
+		}
+
+		return resp, err
+	}
+}
+
+// payments limits the endpoint of `CreatePayment`. In-flight payments
+// are capped innermost so that rate limited ones do not take a slot.
+func (l *Limiter) payments(e endpoint.Endpoint) endpoint.Endpoint {
+	if l == nil {
+		return e
+	}
+	if l.maxInFlight != nil {
+		e = l.maxInFlight(e)
+	}
+	if l.perAccount != nil {
+		e = l.perAccount(e)
+	}
+
+	return l.endpoint(e)
+}
+
+// callerOf is the rate limiting key of the caller of `ctx`: its API key as
+// presented, which is yet to be authenticated (see `AuthMiddleware`), if
+// earlier requests were authenticated with it, or else its source IP. Keys
+// not known to be valid take from the bucket of their source IP so that
+// clients cannot make up keys for fresh buckets, each costing a lookup of
+// the key. Keys are not resolved to their ID (or tenant) as unknown keys
+// must not take from the bucket of known ones.
+func (l *Limiter) callerOf(ctx context.Context, _ interface{}) string {
+	if key := apiKeyFrom(ctx); key != "" {
+		l.mu.RLock()
+		_, known := l.keys[key]
+		l.mu.RUnlock()
+		if known {
+			return "key:" + key
+		}
+	}
+	return "ip:" + sourceIPFrom(ctx)
+}
+
+// payerOf is the rate limiting key of the payer of payment requests,
+// scoped by caller since tenants are yet to be known
+func (l *Limiter) payerOf(ctx context.Context, request interface{}) string {
+	req, ok := request.(CreatePaymentRequest)
+	if !ok {
+		return ""
+	}
+	return l.callerOf(ctx, request) + "/" + req.Self
+}
+
+// RateLimit is an endpoint middleware that refuses requests with
+// `rate_limited` once the bucket of their key (see `Rate`) is empty.
+// Requests whose key is empty are not limited.
+func RateLimit(rate Rate, keyOf func(ctx context.Context, request interface{}) string) endpoint.Middleware {
+	buckets := newBuckets(rate)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			key := keyOf(ctx, request)
+			if key == "" {
+				return next(ctx, request)
+			}
+			if wait := buckets.take(key, time.Now()); wait > 0 {
+				return nil, &errorrrs.E{
+					ID:         errorrrs.TooManyRequests,
+					Code:       errorrrs.CodeRateLimited,
+					Msg:        fmt.Sprintf("rate limit of %v requests per second exceeded", rate.PerSecond),
+					RetryAfter: wait,
+				}
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// overloadRetryAfter is how long clients of shed requests are told to wait
+const overloadRetryAfter = time.Second
+
+// LimitInFlight is an endpoint middleware that sheds requests with
+// `overloaded` while `max` of them are in flight. Shedding rather than
+// queueing lets clients see the backpressure, and back off.
+func LimitInFlight(max int) endpoint.Middleware {
+	slots := make(chan struct{}, max)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				return next(ctx, request)
+			default:
+				return nil, &errorrrs.E{
+					ID:         errorrrs.Unavailable,
+					Code:       errorrrs.CodeOverloaded,
+					Msg:        fmt.Sprintf("more than %v requests in flight", max),
+					RetryAfter: overloadRetryAfter,
+				}
+			}
+		}
+	}
+}
+
+// buckets are the token buckets of a rate, by key
+type buckets struct {
+	rate Rate
+	// refill is how long an empty bucket takes to fill up
+	refill time.Duration
+
+	mu      sync.Mutex
+	byKey   map[string]*bucket
+	sweptAt time.Time
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+func newBuckets(rate Rate) *buckets {
+	if rate.Burst < 1 {
+		rate.Burst = 1
+	}
+	return &buckets{
+		rate:   rate,
+		refill: time.Duration(float64(rate.Burst) / rate.PerSecond * float64(time.Second)),
+		byKey:  make(map[string]*bucket),
+	}
+}
+
+// take takes a token from the bucket of `key` as of `now`, returning
+// how long until there is one if it is empty
+func (bs *buckets) take(key string, now time.Time) time.Duration {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	bs.sweep(now)
+	b, ok := bs.byKey[key]
+	if !ok {
+		b = &bucket{tokens: float64(bs.rate.Burst), at: now}
+		bs.byKey[key] = b
+	}
+	if elapsed := now.Sub(b.at); elapsed > 0 {
+		b.tokens = math.Min(float64(bs.rate.Burst), b.tokens+elapsed.Seconds()*bs.rate.PerSecond)
+		b.at = now
+	}
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / bs.rate.PerSecond * float64(time.Second))
+	}
+	b.tokens--
+
+	return 0
+}
+
+// sweep drops the buckets that have filled up since, as they are no
+// different from new ones, so that buckets do not pile up with keys
+func (bs *buckets) sweep(now time.Time) {
+	if now.Sub(bs.sweptAt) < bs.refill {
+		return
+	}
+	for key, b := range bs.byKey {
+		if now.Sub(b.at) >= bs.refill {
+			delete(bs.byKey, key)
+		}
+	}
+	bs.sweptAt = now
+}
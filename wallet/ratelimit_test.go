@@ -0,0 +1,133 @@
+package wallet_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet"
+	MOCKWALLET "github.com/arhyth/genwallet/wallet/mock"
+)
+
+func TestHTTPRateLimits(t *testing.T) {
+	// serve sends a request with API key `key` (if any) to `handler`
+	serve := func(handler http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(wallet.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	codeOf := func(t *testing.T, w *httptest.ResponseRecorder) errorrrs.Code {
+		var prob errorrrs.Problem
+		require.Nil(t, json.NewDecoder(w.Body).Decode(&prob))
+		return prob.Code
+	}
+
+	t.Run("per key", func(tt *testing.T) {
+		as := assert.New(tt)
+		repo := wallet.NewMemRepo()
+		keyA := newTenant(tt, repo, wallet.Tenant{ID: "acme", Name: "Acme"})
+		keyB := newTenant(tt, repo, wallet.Tenant{ID: "umbrella", Name: "Umbrella"})
+		lim := wallet.NewLimiter(wallet.Limits{PerKey: wallet.Rate{PerSecond: 0.1, Burst: 2}})
+		handler := wallet.MakeLimitedHTTPHandler(&wallet.AuthMiddleware{Next: wallet.NewSimpleWalletService(), Keys: repo}, lim)
+
+		// the first request of a key takes from the bucket of its source IP
+		as.Equal(http.StatusOK, serve(handler, "GET", "/wallets", keyA.Key, "").Code)
+		for i := 0; i < 2; i++ {
+			as.Equal(http.StatusOK, serve(handler, "GET", "/wallets", keyA.Key, "").Code)
+		}
+		w := serve(handler, "GET", "/wallets", keyA.Key, "")
+		as.Equal(http.StatusTooManyRequests, w.Code)
+		as.Equal("10", w.Header().Get("Retry-After"))
+		as.Equal(errorrrs.CodeRateLimited, codeOf(tt, w))
+
+		// the buckets of other keys are their own
+		for i := 0; i < 2; i++ {
+			as.Equal(http.StatusOK, serve(handler, "GET", "/wallets", keyB.Key, "").Code)
+		}
+		// documents are not limited
+		as.Equal(http.StatusOK, serve(handler, "GET", "/openapi.json", keyA.Key, "").Code)
+	})
+
+	t.Run("unknown keys", func(tt *testing.T) {
+		as := assert.New(tt)
+		repo := wallet.NewMemRepo()
+		key := newTenant(tt, repo, wallet.Tenant{ID: "acme", Name: "Acme"})
+		lim := wallet.NewLimiter(wallet.Limits{PerKey: wallet.Rate{PerSecond: 0.1, Burst: 2}})
+		handler := wallet.MakeLimitedHTTPHandler(&wallet.AuthMiddleware{Next: wallet.NewSimpleWalletService(), Keys: repo}, lim)
+		as.Equal(http.StatusOK, serve(handler, "GET", "/wallets", key.Key, "").Code)
+
+		// made up keys, and requests without one, share the bucket of
+		// their source IP rather than getting fresh ones
+		w := serve(handler, "GET", "/wallets", key.Key+"x", "")
+		as.Equal(http.StatusUnauthorized, w.Code)
+		as.Equal(errorrrs.CodeUnauthenticated, codeOf(tt, w))
+		for _, k := range []string{key.Key + "y", ""} {
+			w = serve(handler, "GET", "/wallets", k, "")
+			as.Equal(http.StatusTooManyRequests, w.Code)
+			as.Equal(errorrrs.CodeRateLimited, codeOf(tt, w))
+		}
+		// while known ones have theirs
+		as.Equal(http.StatusOK, serve(handler, "GET", "/wallets", key.Key, "").Code)
+	})
+
+	t.Run("per account", func(tt *testing.T) {
+		as := assert.New(tt)
+		lim := wallet.NewLimiter(wallet.Limits{PerAccount: wallet.Rate{PerSecond: 1, Burst: 1}})
+		handler := wallet.MakeLimitedHTTPHandler(wallet.NewSimpleWalletService(), lim)
+		pay := func(from string) *httptest.ResponseRecorder {
+			return serve(handler, "POST", "/wallets/"+from+"/payments", "gw_a", `{"to_account": "hao-91011", "amount": 10}`)
+		}
+
+		// so that payments take from the buckets of the key
+		as.Equal(http.StatusOK, serve(handler, "GET", "/wallets", "gw_a", "").Code)
+		as.Equal(http.StatusOK, pay("alice-123").Code)
+		w := pay("alice-123")
+		as.Equal(http.StatusTooManyRequests, w.Code)
+		as.Equal("1", w.Header().Get("Retry-After"))
+		as.Equal(http.StatusOK, pay("bob-456").Code)
+		// other operations are only limited per key
+		as.Equal(http.StatusOK, serve(handler, "GET", "/wallets/alice-123/payments", "gw_a", "").Code)
+	})
+
+	t.Run("in flight payments", func(tt *testing.T) {
+		as := assert.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		svc := MOCKWALLET.NewMockService(ctrl)
+		entered, release := make(chan struct{}), make(chan struct{})
+		svc.EXPECT().
+			CreatePayment(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(context.Context, wallet.CreatePaymentRequest) (wallet.Payment, error) {
+				close(entered)
+				<-release
+				return wallet.Payment{Direction: wallet.Outgoing}, nil
+			})
+		lim := wallet.NewLimiter(wallet.Limits{MaxInFlightPayments: 1})
+		handler := wallet.MakeLimitedHTTPHandler(svc, lim)
+		body := `{"to_account": "hao-91011", "amount": 10}`
+
+		done := make(chan int)
+		go func() {
+			done <- serve(handler, "POST", "/wallets/alice-123/payments", "", body).Code
+		}()
+		<-entered
+		w := serve(handler, "POST", "/wallets/bob-456/payments", "", body)
+		as.Equal(http.StatusServiceUnavailable, w.Code)
+		as.Equal("1", w.Header().Get("Retry-After"))
+		as.Equal(errorrrs.CodeOverloaded, codeOf(tt, w))
+		close(release)
+		as.Equal(http.StatusOK, <-done)
+	})
+}
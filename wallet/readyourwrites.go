@@ -0,0 +1,57 @@
+package wallet
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// A request asks to read its own writes, i.e. to be served from the
+// primary database rather than the possibly lagging replica, with a true
+// (`1`, `true`...) `X-Read-Your-Writes` header or `read_your_writes` query
+// param over HTTP, or `x-read-your-writes` metadata over gRPC
+const (
+	ReadYourWritesHeader = "X-Read-Your-Writes"
+	ReadYourWritesParam  = "read_your_writes"
+)
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites marks the request of `ctx` as one that must
+// read its own writes
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+// ReadYourWrites tells whether the request of `ctx` must read its own writes
+func ReadYourWrites(ctx context.Context) bool {
+	ryw, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return ryw
+}
+
+// readYourWritesHTTP is a go-kit http `ServerBefore` func
+func readYourWritesHTTP(ctx context.Context, req *http.Request) context.Context {
+	v := req.Header.Get(ReadYourWritesHeader)
+	if v == "" {
+		v = req.URL.Query().Get(ReadYourWritesParam)
+	}
+	if ryw, _ := strconv.ParseBool(v); ryw {
+		return WithReadYourWrites(ctx)
+	}
+
+	return ctx
+}
+
+// readYourWritesGRPC is a go-kit grpc `ServerBefore` func
+func readYourWritesGRPC(ctx context.Context, md metadata.MD) context.Context {
+	for _, v := range md.Get(strings.ToLower(ReadYourWritesHeader)) {
+		if ryw, _ := strconv.ParseBool(v); ryw {
+			return WithReadYourWrites(ctx)
+		}
+	}
+
+	return ctx
+}
@@ -5,30 +5,160 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type CreateTransferRequest struct {
-	From   string  `json:"from"`
-	To     string  `json:"to"`
-	Amount float64 `json:"amount"`
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Amount      float64  `json:"amount"`
+	Description string   `json:"description,omitempty"`
+	Reference   string   `json:"reference,omitempty"`
+	Metadata    Metadata `json:"metadata,omitempty"`
+	// IdempotencyKey, if any, makes transfers of the same payer and key
+	// return the transfer the first one booked rather than book another
+	IdempotencyKey string `json:"-"`
+}
+
+// Errors that `Repository` implementations return (possibly wrapped)
+// for the corresponding conditions so that the service can classify them
+var (
+	ErrAccountNotFound   = errors.New("wallet account not found")
+	ErrAccountExists     = errors.New("wallet account already exists")
+	ErrCurrencyMismatch  = errors.New("wallet accounts are not of same currency")
+	ErrAccountFrozen     = errors.New("wallet account is frozen")
+	ErrInsufficientFunds = errors.New("existing balance less than requested transfer amount")
+	// ErrDuplicateReference is of transfers whose reference
+	// the payer already used for another transfer
+	ErrDuplicateReference = errors.New("transfer reference already used by payer")
+	// ErrIdempotencyKeyReused is of transfers whose idempotency key the
+	// payer already used for a different transfer
+	ErrIdempotencyKeyReused = errors.New("idempotency key already used by payer for another transfer")
+	// ErrPeriodArchived is of statements over periods that
+	// include transfers no longer in the database
+	ErrPeriodArchived = errors.New("statement period includes archived transfers")
+	// ErrTransferNotFound is of ledger proofs of transfers that do not exist
+	ErrTransferNotFound = errors.New("transfer not found")
+	// ErrTransferNotChained is of ledger proofs of transfers
+	// booked before the ledger was introduced
+	ErrTransferNotChained = errors.New("transfer predates the ledger")
+	// ErrTransferPending is of ledger proofs of transfers
+	// booked but not chained yet
+	ErrTransferPending = errors.New("transfer not chained yet")
+	// ErrContention is of transactions aborted by concurrent ones;
+	// these are safe to retry
+	ErrContention = errors.New("transaction aborted by a concurrent update")
+)
+
+// accountErr wraps the error of looking up account `id`
+func accountErr(err error, id string) error {
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %v", ErrAccountNotFound, id)
+	}
+	return err
+}
+
+// Postgres error codes
+const (
+	pgUniqueViolation      = "23505"
+	pgForeignKeyViolation  = "23503"
+	pgCheckViolation       = "23514"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// contentionErr wraps serialization failures and deadlocks
+// (i.e. transaction aborts that are safe to retry) in `ErrContention`
+func contentionErr(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) &&
+		(pqErr.Code == pgSerializationFailure || pqErr.Code == pgDeadlockDetected) {
+		return &causedErr{err: ErrContention, cause: err}
+	}
+	return err
+}
+
+// causedErr is a sentinel error of the repository caused by an error of
+// the database, whose message is kept out of that of the sentinel (and so
+// out of responses) since it is of the schema rather than of the request
+type causedErr struct {
+	err   error
+	cause error
+}
+
+func (ce *causedErr) Error() string {
+	return ce.err.Error()
+}
+
+func (ce *causedErr) Unwrap() error {
+	return ce.err
 }
 
 type Repository interface {
-	ListAccounts(ListAccountsRequest) ([]Account, error)
-	GetAccount(GetAccountRequest) (Account, error)
-	CreateAccount(CreateAccountRequest) (Account, error)
-	CreateTransfer(CreateTransferRequest) (Transfer, error)
-	ListTransfers(ListTransfersRequest) ([]Transfer, error)
+	ListAccounts(context.Context, ListAccountsRequest) ([]Account, error)
+	GetAccount(context.Context, GetAccountRequest) (Account, error)
+	CreateAccount(context.Context, CreateAccountRequest) (Account, error)
+	CreateTransfer(context.Context, CreateTransferRequest) (Transfer, error)
+	ListTransfers(context.Context, ListTransfersRequest) ([]Transfer, error)
+
+	// Stream* methods are the row-by-row counterparts of the List* methods.
+	// They call the passed func for each row as it is read so that listings
+	// of arbitrary size are served in constant memory. Iteration stops at the
+	// first error returned by the func and that error is returned as is.
+	StreamAccounts(context.Context, ListAccountsRequest, func(Account) error) error
+	StreamTransfers(context.Context, ListTransfersRequest, func(Transfer) error) error
+
+	// GetStatement reads the account, its balances at both ends of the
+	// requested period and the transfers within it from a single snapshot
+	GetStatement(context.Context, StatementRequest) (Statement, error)
+
+	// RequestAdjustment records a pending adjustment of a (non-system)
+	// account by the caller, to be decided by another (see `Adjustment`)
+	RequestAdjustment(context.Context, AdjustmentRequest) (Adjustment, error)
+	ListAdjustments(context.Context, ListAdjustmentsRequest) ([]Adjustment, error)
+	GetAdjustment(context.Context, GetAdjustmentRequest) (Adjustment, error)
+	// DecideAdjustment approves or rejects a pending adjustment. Approved
+	// ones are booked against the suspense account of the account's
+	// currency, creating it on first use. Adjustments are corrections by
+	// ops, so they go through to frozen accounts.
+	DecideAdjustment(context.Context, DecideAdjustmentRequest) (Adjustment, error)
+	// FreezeAccount freezes or unfreezes an account; system accounts
+	// are as good as nonexistent to it
+	FreezeAccount(context.Context, FreezeAccountRequest) (Account, error)
+	// Reconcile reads the balances of accounts along with their expected
+	// balances from a single snapshot; `Difference` and `Balanced` are
+	// left to the service
+	Reconcile(context.Context, ReconcileRequest) ([]Reconciliation, error)
+
+	// ListAudit lists the audit entries of state-changing calls, which
+	// every mutating method records (see `AuditEntry`), in ID order
+	ListAudit(context.Context, ListAuditRequest) ([]AuditEntry, error)
+	// GetLedgerProof proves that a transfer is part of the ledger of its
+	// tenant, up to the first checkpoint after it (see `LedgerProof`)
+	GetLedgerProof(context.Context, LedgerProofRequest) (LedgerProof, error)
 }
 
-var _ Repository = (*Repo)(nil)
+var (
+	_ Repository = (*Repo)(nil)
+	_ Ledger     = (*Repo)(nil)
+)
 
 type Repo struct {
 	DB *sql.DB
+	// Replica, if set, is a read replica of `DB` that account lookups and
+	// account/transfer listings go to, unless the request asks to read its
+	// own writes (see `WithReadYourWrites`). Everything else, including
+	// statements, goes to `DB`.
+	Replica *sql.DB
 
 	// Note: here we make prepared statements for each repository method
 	// and use sync.Once/s to lazily initialize the statements.
@@ -42,48 +172,251 @@ type Repo struct {
 	createAcctOnce *sync.Once
 	createAcctStmt *sql.Stmt
 
-	listAcctsOnce    *sync.Once
+	// reads are prepared once per database they may be routed to
+	primaryReads *readStmts
+	replicaReads *readStmts
+
+	transferStrategy TransferStrategy
+	replicaDSN       string
+	// tracer spans statements, if set (see `WithTracing`)
+	tracer trace.Tracer
+	// pool sizes the connection pools of `DB` and `Replica`
+	pool Pool
+	// contentionRetries is how many times transfers aborted by concurrent
+	// ones are retried (see `WithContentionRetries`)
+	contentionRetries int
+	contentionBackoff time.Duration
+}
+
+// readStmts are the prepared statements of reads on `db`
+type readStmts struct {
+	db *sql.DB
+
+	listAcctsOnce    sync.Once
 	listAcctsStmt    *sql.Stmt
 	listAcctsCurStmt *sql.Stmt
 
-	getAcctOnce *sync.Once
+	getAcctOnce sync.Once
 	getAcctStmt *sql.Stmt
 }
 
-func NewRepo(dsn string) (*Repo, error) {
-	db, err := sql.Open("postgres", dsn)
+// reads returns the statements of the database that
+// the reads of the request of `ctx` are routed to
+func (r *Repo) reads(ctx context.Context) *readStmts {
+	if r.replicaReads == nil || ReadYourWrites(ctx) {
+		return r.primaryReads
+	}
+	return r.replicaReads
+}
+
+// TransferStrategy is how `Repo.CreateTransfer` keeps concurrent
+// transfers from the same accounts correct
+type TransferStrategy string
+
+const (
+	// TransferSerializable runs transfers in SERIALIZABLE transactions.
+	// Concurrent transfers involving the same account abort all but one
+	// of them (`ErrContention`) to be retried by the client.
+	TransferSerializable TransferStrategy = "serializable"
+	// TransferRowLock runs transfers in READ COMMITTED transactions that
+	// lock both accounts' rows (`SELECT ... FOR UPDATE`) in ID order.
+	// Concurrent transfers involving the same account queue up instead of
+	// aborting, which suits hot wallets (e.g. a merchant receiving many payments).
+	TransferRowLock TransferStrategy = "rowlock"
+)
+
+// ParseTransferStrategy parses the name of a transfer strategy
+func ParseTransferStrategy(name string) (TransferStrategy, error) {
+	switch s := TransferStrategy(name); s {
+	case TransferSerializable, TransferRowLock:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown transfer strategy %q: should be one of `%v`, `%v`",
+			name, TransferSerializable, TransferRowLock)
+	}
+}
+
+// RepoOption sets optional parameters of `Repo`
+type RepoOption func(*Repo)
+
+// WithTransferStrategy sets the transfer strategy
+// (`TransferSerializable` by default)
+func WithTransferStrategy(s TransferStrategy) RepoOption {
+	return func(r *Repo) {
+		r.transferStrategy = s
+	}
+}
+
+// WithReplica routes reads to the read replica at `dsn` (see `Repo.Replica`)
+func WithReplica(dsn string) RepoOption {
+	return func(r *Repo) {
+		r.replicaDSN = dsn
+	}
+}
+
+// Pool sizes connection pools (see `sql.DB.SetMaxOpenConns` and the like).
+// Zero values leave the defaults of `database/sql` as they are.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// apply sizes the connection pool of `db`
+func (p Pool) apply(db *sql.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// WithPool sizes the connection pools of the primary and the replica each
+func WithPool(p Pool) RepoOption {
+	return func(r *Repo) {
+		r.pool = p
+	}
+}
+
+// maxContentionBackoff caps the doubling of `WithContentionRetries`
+const maxContentionBackoff = time.Second
+
+// WithContentionRetries retries transfers aborted by concurrent ones
+// (`ErrContention`) up to `n` times, after `backoff`, doubling up to
+// `maxContentionBackoff`, before failing them. Clients retry these as well so this only saves them
+// the round trips, at the cost of holding their requests longer.
+func WithContentionRetries(n int, backoff time.Duration) RepoOption {
+	return func(r *Repo) {
+		r.contentionRetries = n
+		r.contentionBackoff = backoff
+	}
+}
+
+func NewRepo(dsn string, options ...RepoOption) (*Repo, error) {
+	repo := &Repo{
+		transferStrategy: TransferSerializable,
+	}
+	for _, optn := range options {
+		optn(repo)
+	}
+
+	db, err := openDB(dsn, repo.tracer)
 	if err != nil {
 		return nil, err
 	}
+	repo.pool.apply(db)
 	err = db.Ping()
 	if err != nil {
 		return nil, err
 	}
-
-	repo := &Repo{
-		DB: db,
-	}
+	repo.DB = db
 
 	repo.createAcctOnce = &sync.Once{}
-	repo.listAcctsOnce = &sync.Once{}
-	repo.getAcctOnce = &sync.Once{}
+	repo.primaryReads = &readStmts{db: db}
+	if repo.replicaDSN != "" {
+		replica, err := openDB(repo.replicaDSN, repo.tracer)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		repo.pool.apply(replica)
+		if err = replica.Ping(); err != nil {
+			db.Close()
+			replica.Close()
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+		repo.Replica = replica
+		repo.replicaReads = &readStmts{db: replica}
+	}
 
 	return repo, nil
 }
 
-func (r *Repo) ListAccounts(req ListAccountsRequest) ([]Account, error) {
-	// TODO: add pagination
+// ReplicationLag is how far behind the primary the replica's data is,
+// i.e. the age of the latest transaction it replayed, or zero if it has
+// replayed everything it received
+func (r *Repo) ReplicationLag(ctx context.Context) (time.Duration, error) {
+	if r.Replica == nil {
+		return 0, errors.New("no replica")
+	}
+
+	var secs float64
+	err := r.Replica.QueryRowContext(ctx, `SELECT CASE
+		WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END;`).Scan(&secs)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// selectAccounts selects accounts (aliased `a`) along with the totals
+// of their shards, for sharded accounts, so that sharding is invisible
+// to readers. It is to be followed by conditions on `a`, the first
+// of which must be that of its tenant.
+const selectAccounts = `SELECT a.id, a.balance + COALESCE(s.balance, 0), a.currency,
+	a.created_at, GREATEST(a.updated_at, s.updated_at), a.metadata, a.frozen, a.system
+	FROM accounts a LEFT JOIN LATERAL (
+		SELECT SUM(balance) AS balance, MAX(updated_at) AS updated_at
+		FROM account_shards WHERE tenant_id = a.tenant_id AND account_id = a.id
+	) s ON true`
+
+// scanAccount scans a row of `selectAccounts`
+func scanAccount(row interface{ Scan(...interface{}) error }) (Account, error) {
+	var acct Account
+	err := row.Scan(&acct.ID, &acct.Balance, &acct.Currency,
+		&acct.CreatedAt, &acct.UpdatedAt, &acct.Metadata, &acct.Frozen, &acct.System)
+	return acct, err
+}
+
+// MemoryDSN is the data source name of an in-memory repository
+const MemoryDSN = "memory://"
 
-	r.listAcctsOnce.Do(func() {
+// OpenRepository opens the repository at `dsn`, which is either
+// a Postgres connection string or `MemoryDSN`. Options only apply to
+// the former since the in-memory repository has nothing to tune.
+func OpenRepository(dsn string, options ...RepoOption) (Repository, error) {
+	if dsn == MemoryDSN {
+		return NewMemRepo(), nil
+	}
+
+	return NewRepo(dsn, options...)
+}
+
+func (r *Repo) ListAccounts(ctx context.Context, req ListAccountsRequest) ([]Account, error) {
+	var accts []Account
+	err := r.StreamAccounts(ctx, req, func(acct Account) error {
+		accts = append(accts, acct)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accts, nil
+}
+
+func (r *Repo) StreamAccounts(ctx context.Context, req ListAccountsRequest, fn func(Account) error) error {
+	rs := r.reads(ctx)
+	rs.listAcctsOnce.Do(func() {
 		var err error
-		listAccts := `SELECT id, balance, currency, created_at, updated_at FROM accounts;`
-		r.listAcctsStmt, err = r.DB.Prepare(listAccts)
+		listAccts := selectAccounts + ` WHERE a.tenant_id = $1 ORDER BY a.id;`
+		rs.listAcctsStmt, err = rs.db.Prepare(listAccts)
 		if err != nil {
 			panic(err.Error())
 		}
-		listAcctsWithCur := `SELECT id, balance, currency, created_at, updated_at
-			FROM accounts WHERE currency = $1;`
-		r.listAcctsCurStmt, err = r.DB.Prepare(listAcctsWithCur)
+		listAcctsWithCur := selectAccounts + ` WHERE a.tenant_id = $1 AND a.currency = $2 ORDER BY a.id;`
+		rs.listAcctsCurStmt, err = rs.db.Prepare(listAcctsWithCur)
 		if err != nil {
 			panic(err)
 		}
@@ -93,83 +426,236 @@ func (r *Repo) ListAccounts(req ListAccountsRequest) ([]Account, error) {
 		rows *sql.Rows
 		err  error
 	)
-	if req.Currency != nil {
-		rows, err = r.listAcctsCurStmt.Query(req.Currency)
-	} else {
-		rows, err = r.listAcctsStmt.Query()
+	switch {
+	case req.After != nil || req.Limit > 0:
+		// pages are not worth preparing statements for
+		query, args := listAccountsQuery(tenantOf(ctx), req)
+		rows, err = rs.db.QueryContext(ctx, query, args...)
+	case req.Currency != nil:
+		rows, err = rs.listAcctsCurStmt.QueryContext(ctx, tenantOf(ctx), *req.Currency)
+	default:
+		rows, err = rs.listAcctsStmt.QueryContext(ctx, tenantOf(ctx))
 	}
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer rows.Close()
 
-	var accts []Account
 	for rows.Next() {
-		var acct Account
-		if err := rows.Scan(&acct.ID, &acct.Balance, &acct.Currency,
-			&acct.CreatedAt, &acct.UpdatedAt); err != nil {
-			return nil, err
+		acct, err := scanAccount(rows)
+		if err != nil {
+			return err
 		}
 
-		accts = append(accts, acct)
+		if err := fn(acct); err != nil {
+			return err
+		}
 	}
 
-	return accts, err
+	return rows.Err()
 }
 
-func (r *Repo) GetAccount(req GetAccountRequest) (Account, error) {
-	r.getAcctOnce.Do(func() {
+func (r *Repo) GetAccount(ctx context.Context, req GetAccountRequest) (Account, error) {
+	rs := r.reads(ctx)
+	rs.getAcctOnce.Do(func() {
 		var err error
-		getAcct := `SELECT id, balance, currency, created_at, updated_at
-		FROM accounts WHERE id = $1;`
-		r.getAcctStmt, err = r.DB.Prepare(getAcct)
+		getAcct := selectAccounts + ` WHERE a.tenant_id = $1 AND a.id = $2;`
+		rs.getAcctStmt, err = rs.db.Prepare(getAcct)
 		if err != nil {
 			panic(err.Error())
 		}
 	})
 
-	var acct Account
-	err := r.getAcctStmt.QueryRow(req.ID).
-		Scan(&acct.ID, &acct.Balance, &acct.Currency, &acct.CreatedAt, &acct.UpdatedAt)
+	acct, err := scanAccount(rs.getAcctStmt.QueryRowContext(ctx, tenantOf(ctx), req.ID))
 	if err != nil {
-		return acct, err
+		return acct, accountErr(err, req.ID)
 	}
 
 	return acct, nil
 }
 
-func (r *Repo) CreateAccount(req CreateAccountRequest) (Account, error) {
+func (r *Repo) CreateAccount(ctx context.Context, req CreateAccountRequest) (Account, error) {
 	r.createAcctOnce.Do(func() {
 		var err error
-		createAcct := `INSERT INTO accounts (id, balance, currency)
-		VALUES ($1, $2, $3)
-		RETURNING id, balance, currency, created_at, updated_at;`
+		createAcct := `INSERT INTO accounts (tenant_id, id, balance, opening_balance, currency, metadata)
+		VALUES ($1, $2, $3, $3, $4, $5)
+		RETURNING id, balance, currency, created_at, updated_at, metadata;`
 		r.createAcctStmt, err = r.DB.Prepare(createAcct)
 		if err != nil {
 			panic(err.Error())
 		}
 	})
 
+	e := newAuditEntry(ctx, tenantOf(ctx), AuditCreateAccount, req.ID, req)
+	acct, err := r.createAccount(ctx, req, e)
+	r.auditFailure(ctx, e, err)
+
+	return acct, err
+}
+
+// createAccount creates the account of `req` and writes audit entry `e`
+// of it in the same transaction
+func (r *Repo) createAccount(ctx context.Context, req CreateAccountRequest, e AuditEntry) (Account, error) {
+	var (
+		acct  Account
+		rbErr error
+	)
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return acct, err
+	}
+	defer func() {
+		// catch if rollback fails
+		if rbErr != nil {
+			log.Err(rbErr).Msg("repo.CreateAccount: txn rollback fail")
+		}
+	}()
+
+	if req.Shards > 1 {
+		acct, err = createShardedAccount(ctx, tx, req)
+	} else {
+		err = tx.StmtContext(ctx, r.createAcctStmt).QueryRowContext(ctx, tenantOf(ctx), req.ID, req.InitAmt, req.Currency, req.Metadata).
+			Scan(&acct.ID, &acct.Balance, &acct.Currency, &acct.CreatedAt, &acct.UpdatedAt, &acct.Metadata)
+	}
+	if err != nil {
+		rbErr = tx.Rollback()
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgUniqueViolation {
+			return acct, fmt.Errorf("%w: %v", ErrAccountExists, req.ID)
+		}
+		return acct, err
+	}
+	if err = writeAudit(ctx, tx, e); err != nil {
+		rbErr = tx.Rollback()
+		return acct, err
+	}
+	if err = tx.Commit(); err != nil {
+		rbErr = tx.Rollback()
+		return acct, err
+	}
+
+	return acct, nil
+}
+
+// createShardedAccount creates an account with its balance split across
+// `req.Shards` sub-balances. The initial amount is put in the first.
+func createShardedAccount(ctx context.Context, tx *sql.Tx, req CreateAccountRequest) (Account, error) {
 	var acct Account
-	err := r.createAcctStmt.QueryRow(req.ID, req.InitAmt, req.Currency).
-		Scan(&acct.ID, &acct.Balance, &acct.Currency, &acct.CreatedAt, &acct.UpdatedAt)
+	tenant := tenantOf(ctx)
+	err := tx.QueryRowContext(ctx, `INSERT INTO accounts (tenant_id, id, balance, opening_balance, currency, shards, metadata)
+	VALUES ($1, $2, 0, $3, $4, $5, $6)
+	RETURNING id, currency, created_at, updated_at, metadata;`, tenant, req.ID, req.InitAmt, req.Currency, req.Shards, req.Metadata).
+		Scan(&acct.ID, &acct.Currency, &acct.CreatedAt, &acct.UpdatedAt, &acct.Metadata)
 	if err != nil {
 		return acct, err
 	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO account_shards (tenant_id, account_id, shard, balance, updated_at)
+	SELECT $1, $2, shard, CASE WHEN shard = 0 THEN $3 ELSE 0 END, $4
+	FROM generate_series(0, $5 - 1) AS shard;`, tenant, req.ID, req.InitAmt, acct.UpdatedAt, req.Shards)
+	if err != nil {
+		return acct, err
+	}
+	acct.Balance = req.InitAmt
 
 	return acct, nil
 }
 
-func (r *Repo) CreateTransfer(req CreateTransferRequest) (Transfer, error) {
+// CreateTransfer is of payments, whose audit target is the payer. Those
+// aborted by concurrent ones are retried as set by `WithContentionRetries`.
+func (r *Repo) CreateTransfer(ctx context.Context, req CreateTransferRequest) (Transfer, error) {
+	e := newAuditEntry(ctx, tenantOf(ctx), AuditCreatePayment, req.From, req)
+	backoff := r.contentionBackoff
+	var (
+		trnsfr Transfer
+		err    error
+	)
+	for attempt := 0; ; attempt++ {
+		trnsfr, err = r.createTransfer(ctx, req, false, e, nil)
+		err = balanceErr(contentionErr(err))
+		if attempt == r.contentionRetries || !errors.Is(err, ErrContention) || !sleep(ctx, backoff) {
+			break
+		}
+		if backoff *= 2; backoff > maxContentionBackoff {
+			backoff = maxContentionBackoff
+		}
+	}
+	// only the outcome of the last attempt is audited
+	r.auditFailure(ctx, e, err)
+
+	return trnsfr, err
+}
+
+// sleep waits for `d`, unless `ctx` is done first, returning whether it did
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// balanceErr wraps violations of the non-negative balance constraints
+// (of accounts other than system ones) in `ErrInsufficientFunds`. Balances are checked before they are debited
+// so this only catches float rounding at the edge.
+func balanceErr(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgCheckViolation &&
+		(pqErr.Constraint == "accounts_balance_nonnegative" ||
+			pqErr.Constraint == "account_shards_balance_nonnegative") {
+		return &causedErr{err: ErrInsufficientFunds, cause: err}
+	}
+	return err
+}
+
+// transferParty is an account as read by a transfer
+type transferParty struct {
+	tenant   string
+	id       string
+	currency string
+	shards   int
+	frozen   bool
+	system   bool
+	// shardBals are the balances of a sharded payer's shards
+	// while `balance` is the total balance of any payer
+	shardBals []float64
+	balance   float64
+}
+
+func (tp *transferParty) sharded() bool {
+	return tp.shards > 1
+}
+
+// createTransfer runs a transfer according to the transfer strategy:
+//   - `TransferSerializable` relies on SERIALIZABLE isolation to abort
+//     transfers that conflict with concurrent ones
+//   - `TransferRowLock` uses READ COMMITTED isolation but locks the rows it
+//     updates upfront. Rows are locked in account ID order so that transfers
+//     between the same accounts in opposite directions cannot deadlock.
+//
+// Credits to sharded accounts update one of their shards at random, without
+// reading it, so that concurrent credits to a hot account rarely conflict.
+// Debits from sharded accounts read every shard and drain the fullest first.
+//
+// Transfers of `adjustment`s are the only ones that may involve system
+// accounts or frozen ones, and system payers need not have the funds.
+// Transfers are queued to be chained onto the ledger of their tenant (see
+// `ChainLedger`) and audit entry `e` of the call is written in their
+// transaction, as is whatever `then`, if not nil, writes of the booked transfer.
+func (r *Repo) createTransfer(ctx context.Context, req CreateTransferRequest, adjustment bool, e AuditEntry, then func(*sql.Tx, Transfer) error) (Transfer, error) {
 	var (
-		trnsfr         Transfer
-		fromCur, toCur string
-		fromBal, toBal float64
-		rbErr          error
+		trnsfr Transfer
+		rbErr  error
 	)
-	ctx := context.Background()
 	txOptns := &sql.TxOptions{
 		Isolation: sql.LevelSerializable,
 	}
+	lock := ""
+	if r.transferStrategy == TransferRowLock {
+		txOptns.Isolation = sql.LevelReadCommitted
+		lock = " FOR UPDATE"
+	}
 	tx, err := r.DB.BeginTx(ctx, txOptns)
 	if err != nil {
 		return trnsfr, err
@@ -181,116 +667,506 @@ func (r *Repo) CreateTransfer(req CreateTransferRequest) (Transfer, error) {
 			log.Err(rbErr).Msg("repo.CreateTransfer: txn rollback fail")
 		}
 	}()
-	err = tx.QueryRow(`SELECT currency, balance FROM accounts where id = $1;`, req.From).Scan(&fromCur, &fromBal)
-	if err != nil {
-		rbErr = tx.Rollback()
-		return trnsfr, err
+
+	// transfers repeated with the idempotency key of one that went through
+	// return that one rather than book another, or fail for its effects
+	tenant := tenantOf(ctx)
+	if req.IdempotencyKey != "" {
+		made, found, err := idempotentTransfer(ctx, tx, tenant, req)
+		if err != nil || found {
+			rbErr = tx.Rollback()
+			return made, err
+		}
 	}
 
-	err = tx.QueryRow(`SELECT currency, balance FROM accounts where id = $1;`, req.To).Scan(&toCur, &toBal)
-	if err != nil {
-		rbErr = tx.Rollback()
-		return trnsfr, err
+	// currencies and shard counts never change so these are read without locks
+	// both accounts are looked up within the tenant of the request
+	// so that transfers across tenants fail as if the other account
+	// did not exist (and its existence is not disclosed). So are system
+	// accounts to payments. Frozen flags are read again once the rows
+	// are locked, see below.
+	from := &transferParty{tenant: tenant, id: req.From}
+	to := &transferParty{tenant: tenant, id: req.To}
+	for _, tp := range []*transferParty{from, to} {
+		err = tx.QueryRowContext(ctx, `SELECT currency, shards, frozen, system FROM accounts
+		WHERE tenant_id = $1 AND id = $2;`, tp.tenant, tp.id).
+			Scan(&tp.currency, &tp.shards, &tp.frozen, &tp.system)
+		if err == nil && tp.system && !adjustment {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			rbErr = tx.Rollback()
+			return trnsfr, accountErr(err, tp.id)
+		}
+		if tp.frozen && !adjustment {
+			rbErr = tx.Rollback()
+			return trnsfr, fmt.Errorf("%w: %v", ErrAccountFrozen, tp.id)
+		}
 	}
 
-	if toCur != fromCur {
+	if to.currency != from.currency {
 		rbErr = tx.Rollback()
-		return trnsfr, errors.New("wallet accounts are not of same currency")
+		return trnsfr, ErrCurrencyMismatch
 	}
 
-	if fromBal < req.Amount {
+	toShard := 0
+	if to.sharded() {
+		toShard = rand.Intn(to.shards)
+	}
+	parties := []*transferParty{from, to}
+	if to.id < from.id {
+		parties[0], parties[1] = to, from
+	}
+	for _, tp := range parties {
+		switch {
+		case tp == from && tp.sharded():
+			err = readShards(ctx, tx, tp, lock)
+		case tp == from:
+			err = tx.QueryRowContext(ctx, `SELECT balance FROM accounts
+			WHERE tenant_id = $1 AND id = $2`+lock+`;`, tp.tenant, tp.id).Scan(&tp.balance)
+		case lock == "":
+			// payees' balances need not be read
+		case tp.sharded():
+			_, err = tx.ExecContext(ctx, `SELECT FROM account_shards
+			WHERE tenant_id = $1 AND account_id = $2 AND shard = $3 FOR UPDATE;`, tp.tenant, tp.id, toShard)
+		default:
+			_, err = tx.ExecContext(ctx, `SELECT FROM accounts WHERE tenant_id = $1 AND id = $2 FOR UPDATE;`, tp.tenant, tp.id)
+		}
+		if err != nil {
+			rbErr = tx.Rollback()
+			return trnsfr, err
+		}
+	}
+	// freezes update the rows locked above (see `Repo.FreezeAccount`), so
+	// under `TransferRowLock` one that committed since the flags were read
+	// has been waited for and is read now. Under `TransferSerializable`
+	// transfers updating those rows after a freeze abort instead.
+	if lock != "" && !adjustment {
+		var frozen string
+		err = tx.QueryRowContext(ctx, `SELECT id FROM accounts
+		WHERE tenant_id = $1 AND id IN ($2, $3) AND frozen LIMIT 1;`, tenant, from.id, to.id).Scan(&frozen)
+		if err == nil {
+			rbErr = tx.Rollback()
+			return trnsfr, fmt.Errorf("%w: %v", ErrAccountFrozen, frozen)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			rbErr = tx.Rollback()
+			return trnsfr, err
+		}
+	}
+
+	if !from.system && from.balance < req.Amount {
 		rbErr = tx.Rollback()
-		return trnsfr, errors.New("existing balance less than requested transfer amount")
+		return trnsfr, ErrInsufficientFunds
 	}
 
-	_, err = tx.Exec(`UPDATE accounts
-	SET (balance, updated_at) = ($1, now())
-	WHERE id = $2;`, fromBal-req.Amount, req.From)
+	if from.sharded() {
+		err = debitShards(ctx, tx, from, req.Amount)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE accounts
+		SET (balance, updated_at) = (balance - $1, now())
+		WHERE tenant_id = $2 AND id = $3;`, req.Amount, tenant, from.id)
+	}
 	if err != nil {
 		rbErr = tx.Rollback()
 		return trnsfr, err
 	}
 
-	_, err = tx.Exec(`UPDATE accounts
-	SET (balance, updated_at) = ($1, now())
-	WHERE id = $2;`, toBal+req.Amount, req.To)
+	if to.sharded() {
+		_, err = tx.ExecContext(ctx, `UPDATE account_shards
+		SET (balance, updated_at) = (balance + $1, now())
+		WHERE tenant_id = $2 AND account_id = $3 AND shard = $4;`, req.Amount, tenant, to.id, toShard)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE accounts
+		SET (balance, updated_at) = (balance + $1, now())
+		WHERE tenant_id = $2 AND id = $3;`, req.Amount, tenant, to.id)
+	}
 	if err != nil {
 		rbErr = tx.Rollback()
 		return trnsfr, err
 	}
 
-	err = tx.QueryRow(`INSERT INTO transfers ("from", "to", currency, amount)
-	VALUES ($1, $2, $3, $4) RETURNING id, created_at;`, req.From, req.To, fromCur, req.Amount).
-		Scan(&trnsfr.ID, &trnsfr.CreatedAt)
+	// queuing transfers only inserts rows, so it never conflicts
+	err = tx.QueryRowContext(ctx, `WITH t AS (
+		INSERT INTO transfers (tenant_id, "from", "to", currency, amount, description, reference, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING tenant_id, id, created_at, metadata
+	), pending AS (
+		INSERT INTO ledger_pending (tenant_id, transfer_id, created_at) SELECT tenant_id, id, created_at FROM t
+	)
+	SELECT id, created_at, metadata FROM t;`,
+		tenant, req.From, req.To, from.currency, req.Amount,
+		nullString(req.Description), nullString(req.Reference), req.Metadata).
+		Scan(&trnsfr.ID, &trnsfr.CreatedAt, &trnsfr.Metadata)
 	if err != nil {
 		rbErr = tx.Rollback()
 		return trnsfr, err
 	}
+	trnsfr.Amount = req.Amount
+	trnsfr.From = req.From
+	trnsfr.To = req.To
+	trnsfr.Currency = from.currency
+	trnsfr.Description = req.Description
+	trnsfr.Reference = req.Reference
+	// the digest of the transfer as booked is what the ledger chainer links,
+	// so that transfers altered while pending are caught (see `chainBatch`)
+	_, err = tx.ExecContext(ctx, `UPDATE transfers SET digest = $4 WHERE tenant_id = $1 AND id = $2 AND created_at = $3;`,
+		tenant, trnsfr.ID, trnsfr.CreatedAt, transferDigest(tenant, trnsfr))
+	if err != nil {
+		rbErr = tx.Rollback()
+		return trnsfr, err
+	}
+	// idempotency keys and references are kept unique per payer in tables of
+	// their own since unique indexes of (partitioned) transfers must include
+	// `created_at`. A transfer of the same key that committed first is that
+	// of the request.
+	if req.IdempotencyKey != "" {
+		_, err = tx.ExecContext(ctx, `INSERT INTO transfer_idempotency_keys (tenant_id, payer, key, transfer_id)
+		VALUES ($1, $2, $3, $4);`, tenant, req.From, req.IdempotencyKey, trnsfr.ID)
+		if err != nil {
+			rbErr = tx.Rollback()
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgUniqueViolation {
+				made, _, err := idempotentTransfer(ctx, r.DB, tenant, req)
+				return made, err
+			}
+			return trnsfr, err
+		}
+	}
+	if req.Reference != "" {
+		_, err = tx.ExecContext(ctx, `INSERT INTO transfer_references (tenant_id, payer, reference, transfer_id)
+		VALUES ($1, $2, $3, $4);`, tenant, req.From, req.Reference, trnsfr.ID)
+		if err != nil {
+			rbErr = tx.Rollback()
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgUniqueViolation {
+				return trnsfr, fmt.Errorf("%w: %v", ErrDuplicateReference, req.Reference)
+			}
+			return trnsfr, err
+		}
+	}
+	if then != nil {
+		if err = then(tx, trnsfr); err != nil {
+			rbErr = tx.Rollback()
+			return trnsfr, err
+		}
+	}
+	if err = writeAudit(ctx, tx, e); err != nil {
+		rbErr = tx.Rollback()
+		return trnsfr, err
+	}
 	if err = tx.Commit(); err != nil {
 		rbErr = tx.Rollback()
 		return trnsfr, err
 	}
-	trnsfr.Amount = req.Amount
-	trnsfr.From = req.From
-	trnsfr.To = req.To
-	trnsfr.Currency = fromCur
 
 	return trnsfr, nil
 }
 
-func (r *Repo) ListTransfers(req ListTransfersRequest) ([]Transfer, error) {
-	// TODO: add pagination
+// idempotentTransfer reads the transfer of payer `req.From` booked with
+// idempotency key `req.IdempotencyKey`, if any. It must be to the same
+// payee and of the same amount as `req`.
+func idempotentTransfer(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, tenant string, req CreateTransferRequest) (Transfer, bool, error) {
+	var id int
+	err := q.QueryRowContext(ctx, `SELECT transfer_id FROM transfer_idempotency_keys
+	WHERE tenant_id = $1 AND payer = $2 AND key = $3;`, tenant, req.From, req.IdempotencyKey).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transfer{}, false, nil
+	}
+	if err != nil {
+		return Transfer{}, false, err
+	}
+	trnsfr, err := scanTransfer(q.QueryRowContext(ctx, `SELECT `+transferColumns+` FROM transfers
+	WHERE tenant_id = $1 AND id = $2;`, tenant, id))
+	// amounts are stored in single precision; transfers archived since
+	// cannot be told apart from other ones
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (trnsfr.To != req.To || float32(trnsfr.Amount) != float32(req.Amount))) {
+		return Transfer{}, true, fmt.Errorf("%w: %v", ErrIdempotencyKeyReused, req.IdempotencyKey)
+	}
 
-	listTrnsfrBase := `SELECT id, "from", "to", amount, currency, created_at
-	FROM transfers %v;`
-	var whereClause string
+	return trnsfr, true, err
+}
 
-	// TODO: use string builder, if possible, to optimize
-	if req.Currency != nil {
-		whereClause = fmt.Sprintf(`WHERE currency = '%v'`, req.Currency)
+// readShards reads the balances of every shard of `tp`
+func readShards(ctx context.Context, tx *sql.Tx, tp *transferParty, lock string) error {
+	rows, err := tx.QueryContext(ctx, `SELECT balance FROM account_shards
+	WHERE tenant_id = $1 AND account_id = $2 ORDER BY shard`+lock+`;`, tp.tenant, tp.id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-		if req.From == nil || req.To == nil {
-			if req.From != nil {
-				whereClause = fmt.Sprintf(` AND WHERE "from" = '%v'`, *req.From)
-			} else if req.To != nil {
-				whereClause = fmt.Sprintf(` AND WHERE "to" = '%v'`, *req.From)
-			}
-		} else {
-			whereClause = fmt.Sprintf(` AND WHERE "from" = '%v' OR "to" = '%v'`, *req.From, *req.To)
+	tp.shardBals = make([]float64, 0, tp.shards)
+	tp.balance = 0
+	for rows.Next() {
+		var bal float64
+		if err := rows.Scan(&bal); err != nil {
+			return err
 		}
-	} else {
-		if req.From == nil || req.To == nil {
-			if req.From != nil {
-				whereClause = fmt.Sprintf(`WHERE "from" = '%v'`, *req.From)
-			} else if req.To != nil {
-				whereClause = fmt.Sprintf(`WHERE "to" = '%v'`, *req.From)
-			}
-		} else {
-			whereClause = fmt.Sprintf(`WHERE "from" = '%v' OR "to" = '%v'`, *req.From, *req.To)
+		tp.shardBals = append(tp.shardBals, bal)
+		tp.balance += bal
+	}
+
+	return rows.Err()
+}
+
+// debitShards takes `amt` from the shards of `tp`, fullest first,
+// so that as few shards as possible are updated
+func debitShards(ctx context.Context, tx *sql.Tx, tp *transferParty, amt float64) error {
+	order := make([]int, len(tp.shardBals))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return tp.shardBals[order[i]] > tp.shardBals[order[j]]
+	})
+
+	for _, shard := range order {
+		if amt <= 0 {
+			break
+		}
+		take := math.Min(amt, tp.shardBals[shard])
+		if take <= 0 {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE account_shards
+		SET (balance, updated_at) = (balance - $1, now())
+		WHERE tenant_id = $2 AND account_id = $3 AND shard = $4;`, take, tp.tenant, tp.id, shard)
+		if err != nil {
+			return err
 		}
+		amt -= take
 	}
 
-	query := fmt.Sprintf(listTrnsfrBase, whereClause)
-	rows, err := r.DB.Query(query)
+	return nil
+}
+
+func (r *Repo) ListTransfers(ctx context.Context, req ListTransfersRequest) ([]Transfer, error) {
+	var transfers []Transfer
+	err := r.StreamTransfers(ctx, req, func(trnsfr Transfer) error {
+		transfers = append(transfers, trnsfr)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var transfers []Transfer
+	return transfers, nil
+}
+
+func (r *Repo) StreamTransfers(ctx context.Context, req ListTransfersRequest, fn func(Transfer) error) error {
+	query, args := listTransfersQuery(tenantOf(ctx), req)
+	rows, err := r.reads(ctx).db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var trnsfr Transfer
-		if err := rows.Scan(&trnsfr.ID,
-			&trnsfr.From,
-			&trnsfr.To,
-			&trnsfr.Amount,
-			&trnsfr.Currency,
-			&trnsfr.CreatedAt); err != nil {
+		trnsfr, err := scanTransfer(rows)
+		if err != nil {
+			return err
+		}
 
-			return nil, err
+		if err := fn(trnsfr); err != nil {
+			return err
 		}
+	}
 
-		transfers = append(transfers, trnsfr)
+	return rows.Err()
+}
+
+// transferColumns are the columns of transfers that `scanTransfer` scans
+const transferColumns = `id, "from", "to", amount, currency, created_at, description, reference, metadata`
+
+// scanTransfer scans a row of `transferColumns`, followed by
+// as many more columns as there are `extra` destinations
+func scanTransfer(row interface{ Scan(...interface{}) error }, extra ...interface{}) (Transfer, error) {
+	var (
+		trnsfr    Transfer
+		desc, ref sql.NullString
+	)
+	dests := append([]interface{}{&trnsfr.ID,
+		&trnsfr.From,
+		&trnsfr.To,
+		&trnsfr.Amount,
+		&trnsfr.Currency,
+		&trnsfr.CreatedAt,
+		&desc,
+		&ref,
+		&trnsfr.Metadata}, extra...)
+	err := row.Scan(dests...)
+	trnsfr.Description = desc.String
+	trnsfr.Reference = ref.String
+
+	return trnsfr, err
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// listTransfersQuery builds the (parameterized) query for the passed filter
+// within tenant `tenant`. `from` and `to` work together as a `where... OR`
+// while the other filters, if present, further narrow it down.
+func listTransfersQuery(tenant string, req ListTransfersRequest) (string, []interface{}) {
+	var (
+		conds   = []string{`tenant_id = $1`}
+		args    = []interface{}{tenant}
+		parties []string
+	)
+	if req.Currency != nil {
+		args = append(args, *req.Currency)
+		conds = append(conds, fmt.Sprintf(`currency = $%d`, len(args)))
+	}
+	if req.Reference != nil {
+		args = append(args, *req.Reference)
+		conds = append(conds, fmt.Sprintf(`reference = $%d`, len(args)))
+	}
+	if len(req.Metadata) > 0 {
+		args = append(args, req.Metadata)
+		conds = append(conds, fmt.Sprintf(`metadata @> $%d::jsonb`, len(args)))
+	}
+	if req.AfterID != nil {
+		args = append(args, *req.AfterID)
+		conds = append(conds, fmt.Sprintf(`id > $%d`, len(args)))
+	}
+	if req.From != nil {
+		args = append(args, *req.From)
+		parties = append(parties, fmt.Sprintf(`"from" = $%d`, len(args)))
+	}
+	if req.To != nil {
+		args = append(args, *req.To)
+		parties = append(parties, fmt.Sprintf(`"to" = $%d`, len(args)))
+	}
+	if len(parties) > 0 {
+		conds = append(conds, "("+strings.Join(parties, " OR ")+")")
 	}
 
-	return transfers, nil
+	query := `SELECT ` + transferColumns + ` FROM transfers WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY id`
+
+	return query + limitClause(&args, req.Limit) + ";", args
+}
+
+// listAccountsQuery builds the (parameterized) query for
+// a page of the accounts of tenant `tenant`
+func listAccountsQuery(tenant string, req ListAccountsRequest) (string, []interface{}) {
+	var (
+		conds = []string{`a.tenant_id = $1`}
+		args  = []interface{}{tenant}
+	)
+	if req.Currency != nil {
+		args = append(args, *req.Currency)
+		conds = append(conds, fmt.Sprintf(`a.currency = $%d`, len(args)))
+	}
+	if req.After != nil {
+		args = append(args, *req.After)
+		conds = append(conds, fmt.Sprintf(`a.id > $%d`, len(args)))
+	}
+	query := selectAccounts + ` WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY a.id`
+
+	return query + limitClause(&args, req.Limit) + ";", args
+}
+
+// limitClause returns the LIMIT clause of listing limit `limit`, if any,
+// appending its parameter to `args`
+func limitClause(args *[]interface{}, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	*args = append(*args, limit)
+	return fmt.Sprintf(` LIMIT $%d`, len(*args))
+}
+
+func (r *Repo) GetStatement(ctx context.Context, req StatementRequest) (Statement, error) {
+	var (
+		stmt  Statement
+		rbErr error
+	)
+	txOptns := &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	}
+	tx, err := r.DB.BeginTx(ctx, txOptns)
+	if err != nil {
+		return stmt, err
+	}
+	defer func() {
+		// catch if rollback fails
+		if rbErr != nil {
+			log.Err(rbErr).Msg("repo.GetStatement: txn rollback fail")
+		}
+	}()
+
+	tenant := tenantOf(ctx)
+	stmt.Account, err = scanAccount(tx.QueryRowContext(ctx, selectAccounts+` WHERE a.tenant_id = $1 AND a.id = $2;`, tenant, req.ID))
+	acct := &stmt.Account
+	if err != nil {
+		rbErr = tx.Rollback()
+		return stmt, accountErr(err, req.ID)
+	}
+
+	// transfers of archived (detached) partitions are gone, so periods
+	// reaching into those are refused rather than misstated, unless the
+	// account did not exist yet
+	var horizon sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT max(range_end) FROM transfer_archives;`).Scan(&horizon)
+	if err != nil {
+		rbErr = tx.Rollback()
+		return stmt, err
+	}
+	if horizon.Valid && req.From.Before(horizon.Time) && acct.CreatedAt.Before(horizon.Time) {
+		rbErr = tx.Rollback()
+		return stmt, fmt.Errorf("%w: before %v", ErrPeriodArchived, horizon.Time.Format(time.RFC3339))
+	}
+
+	// net of entries booked after the period, to derive the closing balance
+	// from the current one
+	var after float64
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(CASE WHEN "to" = $2 THEN amount ELSE -amount END), 0)
+	FROM transfers WHERE tenant_id = $1 AND ("from" = $2 OR "to" = $2) AND created_at >= $3;`, tenant, req.ID, req.To).
+		Scan(&after)
+	if err != nil {
+		rbErr = tx.Rollback()
+		return stmt, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+transferColumns+`
+	FROM transfers WHERE tenant_id = $1 AND ("from" = $2 OR "to" = $2) AND created_at >= $3 AND created_at < $4
+	ORDER BY id;`, tenant, req.ID, req.From, req.To)
+	if err != nil {
+		rbErr = tx.Rollback()
+		return stmt, err
+	}
+	defer rows.Close()
+
+	var period float64
+	for rows.Next() {
+		trnsfr, err := scanTransfer(rows)
+		if err != nil {
+			rbErr = tx.Rollback()
+			return stmt, err
+		}
+
+		if trnsfr.To == req.ID {
+			period += trnsfr.Amount
+		} else {
+			period -= trnsfr.Amount
+		}
+		stmt.Entries = append(stmt.Entries, trnsfr)
+	}
+	if err = rows.Err(); err != nil {
+		rbErr = tx.Rollback()
+		return stmt, err
+	}
+	if err = tx.Commit(); err != nil {
+		return stmt, err
+	}
+
+	stmt.From = req.From
+	stmt.To = req.To
+	stmt.ClosingBalance = acct.Balance - after
+	stmt.OpeningBalance = stmt.ClosingBalance - period
+
+	return stmt, nil
 }
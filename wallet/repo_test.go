@@ -3,14 +3,29 @@
 package wallet_test
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/arhyth/genwallet/config"
+	"github.com/arhyth/genwallet/errorrrs"
 	"github.com/arhyth/genwallet/wallet"
+	"github.com/arhyth/genwallet/wallet/wallettest"
 )
 
 var repo wallet.Repository
@@ -30,15 +45,671 @@ func TestMain(m *testing.M) {
 func TestRepoCreateAccount(t *testing.T) {
 	reqrd := require.New(t)
 	as := assert.New(t)
+	ctx := context.Background()
 
 	createReq := wallet.CreateAccountRequest{
 		ID:       "alice-123",
 		Currency: "USD",
 		InitAmt:  800.0,
 	}
-	acct, err := repo.CreateAccount(createReq)
+	acct, err := repo.CreateAccount(ctx, createReq)
 	reqrd.Nil(err)
 	as.Equal(createReq.ID, acct.ID)
 	as.Equal(createReq.InitAmt, acct.Balance)
 	as.Equal(createReq.Currency, acct.Currency)
 }
+
+// newRepo opens a `Repo` at `DB_URL` with the passed strategy
+func newRepo(tb testing.TB, strategy wallet.TransferStrategy) *wallet.Repo {
+	cfg, err := config.GetAPIConfig()
+	require.Nil(tb, err)
+	pg, err := wallet.NewRepo(cfg.DBConnStr, wallet.WithTransferStrategy(strategy))
+	require.Nil(tb, err)
+	tb.Cleanup(func() { pg.DB.Close() })
+
+	return pg
+}
+
+func truncate(tb testing.TB, pg *wallet.Repo) {
+	_, err := pg.DB.Exec(`TRUNCATE transfers, transfer_references, account_shards, accounts, transfer_archives, api_keys,
+	adjustments, audit_log, ledger_heads, ledger_checkpoints, ledger_pending, transfer_idempotency_keys RESTART IDENTITY;`)
+	require.Nil(tb, err)
+	_, err = pg.DB.Exec(`DELETE FROM tenants WHERE id <> $1;`, wallet.DefaultTenantID)
+	require.Nil(tb, err)
+}
+
+func TestRepoConformance(t *testing.T) {
+	for _, strategy := range []wallet.TransferStrategy{wallet.TransferSerializable, wallet.TransferRowLock} {
+		t.Run(string(strategy), func(tt *testing.T) {
+			pg := newRepo(tt, strategy)
+			wallettest.RunRepositoryTests(tt, func(ttt *testing.T) wallet.Repository {
+				truncate(ttt, pg)
+				return pg
+			})
+		})
+	}
+}
+
+// TestRepoReplica has `DB_URL` stand in as its own replica since reads
+// routed to the replica must behave the same, only possibly staler
+func TestRepoReplica(t *testing.T) {
+	reqrd := require.New(t)
+	as := assert.New(t)
+	ctx := context.Background()
+	cfg, err := config.GetAPIConfig()
+	reqrd.Nil(err)
+	pg, err := wallet.NewRepo(cfg.DBConnStr, wallet.WithReplica(cfg.DBConnStr))
+	reqrd.Nil(err)
+	t.Cleanup(func() {
+		pg.Replica.Close()
+		pg.DB.Close()
+	})
+
+	lag, err := pg.ReplicationLag(ctx)
+	reqrd.Nil(err)
+	as.Zero(lag)
+
+	wallettest.RunRepositoryTests(t, func(tt *testing.T) wallet.Repository {
+		truncate(tt, pg)
+		return pg
+	})
+}
+
+// TestRepoTracing runs the conformance tests on traced connections,
+// which must behave the same, and checks the spans of a transfer
+func TestRepoTracing(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	cfg, err := config.GetAPIConfig()
+	reqrd.Nil(err)
+	pg, err := wallet.NewRepo(cfg.DBConnStr, wallet.WithTracing(tp))
+	reqrd.Nil(err)
+	t.Cleanup(func() { pg.DB.Close() })
+
+	wallettest.RunRepositoryTests(t, func(tt *testing.T) wallet.Repository {
+		truncate(tt, pg)
+		return pg
+	})
+
+	truncate(t, pg)
+	for _, req := range []wallet.CreateAccountRequest{
+		{ID: "alice-123", InitAmt: 100, Currency: "USD"},
+		{ID: "bob-456", Currency: "USD"},
+	} {
+		_, err = pg.CreateAccount(ctx, req)
+		reqrd.Nil(err)
+	}
+	tracer := tp.Tracer("test")
+	ctx, parent := tracer.Start(ctx, "transfer")
+	_, err = pg.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 10})
+	reqrd.Nil(err)
+	_, err = pg.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "bob-456", To: "alice-123", Amount: 1000})
+	reqrd.NotNil(err)
+	parent.End()
+
+	names := map[string]int{}
+	for _, span := range rec.Ended() {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			continue
+		}
+		names[span.Name()]++
+		as.Contains(span.Attributes(), attribute.String("db.system", "postgresql"))
+		if span.Name() == "sql COMMIT" {
+			as.Equal(codes.Unset, span.Status().Code)
+		}
+	}
+	as.Equal(1, names["sql COMMIT"], "the transfer that went through")
+	as.Equal(1, names["sql ROLLBACK"], "the transfer that did not")
+	as.NotZero(names["sql UPDATE"])
+}
+
+// TestRepoContentionDetail checks that the payments aborted by concurrent
+// ones are refused without the message of the database
+func TestRepoContentionDetail(t *testing.T) {
+	reqrd := require.New(t)
+	ctx := context.Background()
+	pg := newRepo(t, wallet.TransferSerializable)
+	truncate(t, pg)
+	svc := &wallet.ServiceImpl{Repo: pg}
+
+	const payers = 8
+	_, err := pg.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "merchant", Currency: "USD"})
+	reqrd.Nil(err)
+	for i := 0; i < payers; i++ {
+		_, err = pg.CreateAccount(ctx, wallet.CreateAccountRequest{ID: fmt.Sprintf("payer-%02d", i), InitAmt: 100, Currency: "USD"})
+		reqrd.Nil(err)
+	}
+
+	aborted := 0
+	for round := 0; round < 10 && aborted == 0; round++ {
+		errs := make(chan error, payers)
+		for i := 0; i < payers; i++ {
+			req := wallet.CreatePaymentRequest{Self: fmt.Sprintf("payer-%02d", i), To: "merchant", Amount: 1}
+			go func() {
+				_, err := svc.CreatePayment(ctx, req)
+				errs <- err
+			}()
+		}
+		for i := 0; i < payers; i++ {
+			err := <-errs
+			if err == nil {
+				continue
+			}
+			reqrd.Equal(errorrrs.CodeConcurrentUpdate, errorrrs.Classify(err).Code, "%v", err)
+			prob := errorrrs.NewProblem(err, "test")
+			assert.Equal(t, wallet.ErrContention.Error(), prob.Detail)
+			assert.NotContains(t, prob.Detail, "pq:")
+			aborted++
+		}
+	}
+	reqrd.NotZero(aborted, "no payment was aborted")
+}
+
+// TestRepoContentionRetries pays from many wallets to the same one at once,
+// which aborts all but one of them at a time without retries
+func TestRepoContentionRetries(t *testing.T) {
+	reqrd := require.New(t)
+	ctx := context.Background()
+	cfg, err := config.GetAPIConfig()
+	reqrd.Nil(err)
+	pg, err := wallet.NewRepo(cfg.DBConnStr,
+		wallet.WithPool(wallet.Pool{MaxOpenConns: 8, MaxIdleConns: 8}),
+		wallet.WithContentionRetries(50, time.Millisecond),
+	)
+	reqrd.Nil(err)
+	t.Cleanup(func() { pg.DB.Close() })
+	truncate(t, pg)
+
+	const payers = 8
+	_, err = pg.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "merchant", Currency: "USD"})
+	reqrd.Nil(err)
+	for i := 0; i < payers; i++ {
+		_, err = pg.CreateAccount(ctx, wallet.CreateAccountRequest{ID: fmt.Sprintf("payer-%02d", i), InitAmt: 100, Currency: "USD"})
+		reqrd.Nil(err)
+	}
+
+	errs := make(chan error, payers)
+	for i := 0; i < payers; i++ {
+		req := wallet.CreateTransferRequest{From: fmt.Sprintf("payer-%02d", i), To: "merchant", Amount: 10}
+		go func() {
+			_, err := pg.CreateTransfer(ctx, req)
+			errs <- err
+		}()
+	}
+	for i := 0; i < payers; i++ {
+		assert.Nil(t, <-errs)
+	}
+	merchant, err := pg.GetAccount(ctx, wallet.GetAccountRequest{ID: "merchant"})
+	reqrd.Nil(err)
+	assert.Equal(t, float64(10*payers), merchant.Balance)
+}
+
+// TestRepoFreezeRace freezes accounts while transfers of theirs are under
+// way: transfers that read the accounts before the freeze committed must
+// not go through once it has
+func TestRepoFreezeRace(t *testing.T) {
+	for _, strategy := range []wallet.TransferStrategy{wallet.TransferSerializable, wallet.TransferRowLock} {
+		for _, frozen := range []string{"alice-123", "hot-1"} {
+			strategy, frozen := strategy, frozen
+			t.Run(string(strategy)+"/"+frozen, func(tt *testing.T) {
+				reqrd := require.New(tt)
+				ctx := context.Background()
+				pg := newRepo(tt, strategy)
+				truncate(tt, pg)
+				for _, req := range []wallet.CreateAccountRequest{
+					{ID: "alice-123", Currency: "USD", InitAmt: 100},
+					{ID: "hot-1", Currency: "USD", Shards: 4},
+				} {
+					_, err := pg.CreateAccount(ctx, req)
+					reqrd.Nil(err)
+				}
+
+				// as `FreezeAccount` does, held open until the transfer waits on it
+				tx, err := pg.DB.BeginTx(ctx, nil)
+				reqrd.Nil(err)
+				_, err = tx.Exec(`UPDATE accounts SET frozen = true WHERE id = $1;`, frozen)
+				reqrd.Nil(err)
+				_, err = tx.Exec(`UPDATE account_shards SET updated_at = now() WHERE account_id = $1;`, frozen)
+				reqrd.Nil(err)
+				errs := make(chan error, 1)
+				go func() {
+					_, err := pg.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "hot-1", Amount: 10})
+					errs <- err
+				}()
+				time.Sleep(200 * time.Millisecond)
+				reqrd.Nil(tx.Commit())
+
+				err = <-errs
+				assert.True(tt, errors.Is(err, wallet.ErrAccountFrozen) || errors.Is(err, wallet.ErrContention), "%v", err)
+				alice, err := pg.GetAccount(ctx, wallet.GetAccountRequest{ID: "alice-123"})
+				reqrd.Nil(err)
+				assert.Equal(tt, 100.0, alice.Balance)
+			})
+		}
+	}
+}
+
+func TestRepoAuditAppendOnly(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	pg := newRepo(t, wallet.TransferSerializable)
+	truncate(t, pg)
+
+	_, err := pg.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "alice-123", InitAmt: 100, Currency: "USD"})
+	reqrd.Nil(err)
+
+	_, err = pg.DB.ExecContext(ctx, `UPDATE audit_log SET actor = 'someone-else';`)
+	reqrd.NotNil(err)
+	as.Contains(err.Error(), "append-only")
+	_, err = pg.DB.ExecContext(ctx, `DELETE FROM audit_log;`)
+	reqrd.NotNil(err)
+	as.Contains(err.Error(), "append-only")
+
+	entries, err := pg.ListAudit(ctx, wallet.ListAuditRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(entries, 1)
+	as.Equal(wallet.AnonymousActor, entries[0].Actor)
+}
+
+func TestRepoAuditCanceled(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	pg := newRepo(t, wallet.TransferSerializable)
+	truncate(t, pg)
+
+	// the call fails as the client went away, which is still recorded
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := pg.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "alice-123", InitAmt: 100, Currency: "USD"})
+	reqrd.NotNil(err)
+
+	entries, err := pg.ListAudit(context.Background(), wallet.ListAuditRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(entries, 1)
+	as.Equal(wallet.AuditCreateAccount, entries[0].Action)
+	as.NotEqual(wallet.AuditOutcomeOK, entries[0].Outcome)
+}
+
+func TestRepoLedgerTamper(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	pg := newRepo(t, wallet.TransferSerializable)
+	truncate(t, pg)
+	t.Cleanup(func() { truncate(t, pg) })
+
+	for _, req := range []wallet.CreateAccountRequest{
+		{ID: "alice-123", InitAmt: 100, Currency: "USD"},
+		{ID: "bob-456", InitAmt: 0, Currency: "USD"},
+	} {
+		_, err := pg.CreateAccount(ctx, req)
+		reqrd.Nil(err)
+	}
+	var ids []int
+	// 0.1 is not exactly representable as `real`, so this
+	// checks that amounts are hashed as stored
+	for _, amt := range []float64{10, 0.1, 2.5, 1} {
+		trnsfr, err := pg.CreateTransfer(ctx, wallet.CreateTransferRequest{
+			From:        "alice-123",
+			To:          "bob-456",
+			Amount:      amt,
+			Description: "tamper test",
+			Metadata:    wallet.Metadata{"order_id": "1234"},
+		})
+		reqrd.Nil(err)
+		ids = append(ids, trnsfr.ID)
+	}
+	seed, public, err := wallet.GenerateLedgerKey()
+	reqrd.Nil(err)
+	signer, err := wallet.ParseLedgerSigner(seed)
+	reqrd.Nil(err)
+	key, err := wallet.ParseLedgerPublicKey(public)
+	reqrd.Nil(err)
+	_, err = pg.CheckpointLedger(ctx, signer)
+	reqrd.Nil(err)
+
+	verify := func() *wallet.BrokenLink {
+		vs, err := pg.VerifyLedger(ctx, []ed25519.PublicKey{key})
+		reqrd.Nil(err)
+		reqrd.Len(vs, 1)
+		return vs[0].Broken
+	}
+	exec := func(query string, args ...interface{}) {
+		_, err := pg.DB.ExecContext(ctx, query, args...)
+		reqrd.Nil(err)
+	}
+	reqrd.Nil(verify())
+	proof, err := pg.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: ids[1]})
+	reqrd.Nil(err)
+	as.Nil(proof.Verify(key))
+
+	// altered
+	exec(`UPDATE transfers SET amount = 1000 WHERE id = $1;`, ids[1])
+	broken := verify()
+	reqrd.NotNil(broken)
+	as.Equal(ids[1], broken.TransferID)
+	as.Contains(broken.Reason, "altered")
+	proof, err = pg.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: ids[1]})
+	reqrd.Nil(err)
+	as.NotNil(proof.Verify(key))
+	exec(`UPDATE transfers SET amount = 0.1 WHERE id = $1;`, ids[1])
+	reqrd.Nil(verify())
+
+	// altered along with its hash
+	exec(`UPDATE transfers SET "to" = "from", hash = md5(hash) WHERE id = $1;`, ids[2])
+	broken = verify()
+	reqrd.NotNil(broken)
+	as.Equal(ids[2], broken.TransferID)
+
+	// removed
+	exec(`DELETE FROM transfers WHERE id = $1;`, ids[2])
+	broken = verify()
+	reqrd.NotNil(broken)
+	as.Equal(ids[3], broken.TransferID)
+	as.Contains(broken.Reason, fmt.Sprintf("transfer %d", ids[1]))
+
+	// removed at the head
+	exec(`DELETE FROM transfers WHERE id >= $1;`, ids[2])
+	broken = verify()
+	reqrd.NotNil(broken)
+	as.Equal(ids[3], broken.TransferID)
+	as.Contains(broken.Reason, "missing")
+}
+
+// TestRepoLedgerPendingTamper tampers with transfers before they are chained
+func TestRepoLedgerPendingTamper(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	pg := newRepo(t, wallet.TransferSerializable)
+	truncate(t, pg)
+	t.Cleanup(func() { truncate(t, pg) })
+
+	for _, req := range []wallet.CreateAccountRequest{
+		{ID: "alice-123", InitAmt: 100, Currency: "USD"},
+		{ID: "bob-456", InitAmt: 0, Currency: "USD"},
+	} {
+		_, err := pg.CreateAccount(ctx, req)
+		reqrd.Nil(err)
+	}
+	pay := func() int {
+		trnsfr, err := pg.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 0.1})
+		reqrd.Nil(err)
+		return trnsfr.ID
+	}
+	exec := func(query string, args ...interface{}) error {
+		_, err := pg.DB.ExecContext(ctx, query, args...)
+		return err
+	}
+	verify := func() *wallet.BrokenLink {
+		vs, err := pg.VerifyLedger(ctx, nil)
+		reqrd.Nil(err)
+		reqrd.Len(vs, 1)
+		return vs[0].Broken
+	}
+
+	// altered while pending, which the chainer links as booked all the same
+	altered := pay()
+	reqrd.Nil(exec(`UPDATE transfers SET amount = 1000 WHERE id = $1;`, altered))
+	_, err := pg.ChainLedger(ctx)
+	as.ErrorIs(err, wallet.ErrTransfersAltered)
+	as.Contains(err.Error(), fmt.Sprint(altered))
+	broken := verify()
+	reqrd.NotNil(broken)
+	as.Equal(altered, broken.TransferID)
+	as.Contains(broken.Reason, "altered")
+	reqrd.Nil(exec(`UPDATE transfers SET amount = 0.1 WHERE id = $1;`, altered))
+	reqrd.Nil(verify())
+
+	// removed while pending, along with its queue entry or not
+	removed := pay()
+	err = exec(`WITH p AS (DELETE FROM ledger_pending WHERE transfer_id = $1)
+	DELETE FROM transfers WHERE id = $1;`, removed)
+	reqrd.NotNil(err)
+	as.Contains(err.Error(), "not chained")
+	reqrd.NotNil(exec(`UPDATE ledger_pending SET transfer_id = $1 WHERE transfer_id = $2;`, altered, removed))
+	reqrd.Nil(exec(`DELETE FROM transfers WHERE id = $1;`, removed))
+	_, err = pg.ChainLedger(ctx)
+	reqrd.Nil(err)
+	broken = verify()
+	reqrd.NotNil(broken)
+	as.Equal(removed, broken.TransferID)
+	as.Contains(broken.Reason, "removed")
+}
+
+// TestRepoLedgerConcurrency pays between distinct wallets of the same tenant
+// at once, which do not contend since transfers are chained apart from their
+// transactions, while two chainers chain them as they commit
+func TestRepoLedgerConcurrency(t *testing.T) {
+	reqrd := require.New(t)
+	as := assert.New(t)
+	ctx := context.Background()
+	pg := newRepo(t, wallet.TransferSerializable)
+	truncate(t, pg)
+	t.Cleanup(func() { truncate(t, pg) })
+
+	const pairs, rounds = 8, 10
+	for i := 0; i < pairs; i++ {
+		for _, req := range []wallet.CreateAccountRequest{
+			{ID: fmt.Sprintf("payer-%02d", i), InitAmt: 100, Currency: "USD"},
+			{ID: fmt.Sprintf("payee-%02d", i), Currency: "USD"},
+		} {
+			_, err := pg.CreateAccount(ctx, req)
+			reqrd.Nil(err)
+		}
+	}
+
+	chainCtx, stop := context.WithCancel(ctx)
+	chainErrs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			for chainCtx.Err() == nil {
+				if _, err := pg.ChainLedger(chainCtx); err != nil && chainCtx.Err() == nil {
+					chainErrs <- err
+					return
+				}
+			}
+			chainErrs <- nil
+		}()
+	}
+	errs := make(chan error, pairs)
+	for i := 0; i < pairs; i++ {
+		req := wallet.CreateTransferRequest{From: fmt.Sprintf("payer-%02d", i), To: fmt.Sprintf("payee-%02d", i), Amount: 1}
+		go func() {
+			for r := 0; r < rounds; r++ {
+				if _, err := pg.CreateTransfer(ctx, req); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < pairs; i++ {
+		as.Nil(<-errs, "payments of distinct wallets do not contend")
+	}
+	stop()
+	for i := 0; i < 2; i++ {
+		as.Nil(<-chainErrs)
+	}
+
+	_, err := pg.ChainLedger(ctx)
+	reqrd.Nil(err)
+	vs, err := pg.VerifyLedger(ctx, nil)
+	reqrd.Nil(err)
+	reqrd.Len(vs, 1)
+	as.Equal(wallet.LedgerVerification{TenantID: wallet.DefaultTenantID, Verified: pairs * rounds}, vs[0])
+
+	// transfers that are neither chained nor pending were not booked as such
+	_, err = pg.DB.ExecContext(ctx, `INSERT INTO transfers (tenant_id, "from", "to", currency, amount)
+	VALUES ($1, 'payer-00', 'payee-00', 'USD', 1);`, wallet.DefaultTenantID)
+	reqrd.Nil(err)
+	vs, err = pg.VerifyLedger(ctx, nil)
+	reqrd.Nil(err)
+	reqrd.NotNil(vs[0].Broken)
+	as.Contains(vs[0].Broken.Reason, "not chained")
+}
+
+func TestRepoArchiveTransfers(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	pg := newRepo(t, wallet.TransferSerializable)
+	truncate(t, pg)
+	t.Cleanup(func() { truncate(t, pg) })
+
+	month := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	created, err := pg.EnsureTransferPartitions(ctx, month, 0)
+	reqrd.Nil(err)
+	as.Equal([]string{"transfers_p2000_01"}, created)
+	created, err = pg.EnsureTransferPartitions(ctx, month, 0)
+	reqrd.Nil(err)
+	as.Empty(created)
+	missing, err := pg.MissingTransferPartitions(ctx, month, 1)
+	reqrd.Nil(err)
+	as.Equal([]string{"transfers_p2000_02"}, missing)
+
+	for _, req := range []wallet.CreateAccountRequest{
+		{ID: "alice-123", InitAmt: 100, Currency: "USD"},
+		{ID: "bob-456", InitAmt: 0, Currency: "USD"},
+	} {
+		_, err := pg.CreateAccount(ctx, req)
+		reqrd.Nil(err)
+	}
+	// back date the accounts and transfers of January 2000
+	_, err = pg.DB.Exec(`UPDATE accounts SET created_at = $1;`, month.AddDate(0, -1, 0))
+	reqrd.Nil(err)
+	_, err = pg.DB.Exec(`INSERT INTO transfers (tenant_id, "from", "to", currency, amount, created_at)
+	VALUES ('default', 'alice-123', 'bob-456', 'USD', 10, $1), ('default', 'bob-456', 'alice-123', 'USD', 5, $2);`,
+		month.Add(time.Hour), month.AddDate(0, 0, 14))
+	reqrd.Nil(err)
+	_, err = pg.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 1})
+	reqrd.Nil(err)
+
+	_, err = pg.ArchiveTransfers(ctx, time.Now().AddDate(0, 2, 0), t.TempDir())
+	as.NotNil(err, "archives current month")
+
+	dir := t.TempDir()
+	archived, err := pg.ArchiveTransfers(ctx, month.AddDate(0, 1, 0), dir)
+	reqrd.Nil(err)
+	reqrd.Len(archived, 1)
+	as.Equal("transfers_p2000_01", archived[0].Partition)
+	as.EqualValues(2, archived[0].Rows)
+
+	f, err := os.Open(archived[0].File)
+	reqrd.Nil(err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	reqrd.Nil(err)
+	type archivedTransfer struct {
+		TenantID string `json:"tenant_id"`
+		wallet.Transfer
+	}
+	var exported []archivedTransfer
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var trnsfr archivedTransfer
+		reqrd.Nil(json.Unmarshal(scanner.Bytes(), &trnsfr))
+		exported = append(exported, trnsfr)
+	}
+	reqrd.Nil(scanner.Err())
+	reqrd.Len(exported, 2)
+	as.Equal(10.0, exported[0].Amount)
+	as.Equal(5.0, exported[1].Amount)
+	as.Equal(wallet.DefaultTenantID, exported[0].TenantID)
+
+	// only live partitions are listed
+	transfers, err := pg.ListTransfers(ctx, wallet.ListTransfersRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(transfers, 1)
+	as.Equal(1.0, transfers[0].Amount)
+
+	_, err = pg.GetStatement(ctx, wallet.StatementRequest{ID: "alice-123", To: time.Now()})
+	as.True(errors.Is(err, wallet.ErrPeriodArchived))
+	stmt, err := pg.GetStatement(ctx, wallet.StatementRequest{ID: "alice-123", From: month.AddDate(0, 1, 0), To: time.Now()})
+	reqrd.Nil(err)
+	as.Len(stmt.Entries, 1)
+	// the back dated transfers were never applied to the balances
+	as.Equal(99.0, stmt.ClosingBalance)
+	as.Equal(100.0, stmt.OpeningBalance)
+}
+
+// BenchmarkHotWalletTransfers compares the transfer strategies, with and
+// without sharding, when every transfer goes to the same (merchant) wallet. Transfers aborted due to
+// contention are retried until they commit; `aborts/op` is their rate.
+func BenchmarkHotWalletTransfers(b *testing.B) {
+	ctx := context.Background()
+	cases := []struct {
+		strategy wallet.TransferStrategy
+		shards   int
+	}{
+		{wallet.TransferSerializable, 0},
+		{wallet.TransferRowLock, 0},
+		{wallet.TransferSerializable, 16},
+		{wallet.TransferRowLock, 16},
+	}
+	for _, c := range cases {
+		strategy := c.strategy
+		shards := c.shards
+		b.Run(fmt.Sprintf("%v/shards=%d", strategy, shards), func(bb *testing.B) {
+			pg := newRepo(bb, strategy)
+			truncate(bb, pg)
+
+			const payers = 32
+			_, err := pg.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "merchant", Currency: "USD", Shards: shards})
+			require.Nil(bb, err)
+			for i := 0; i < payers; i++ {
+				_, err := pg.CreateAccount(ctx, wallet.CreateAccountRequest{
+					ID:       fmt.Sprintf("payer-%02d", i),
+					InitAmt:  1 << 20,
+					Currency: "USD",
+				})
+				require.Nil(bb, err)
+			}
+
+			// transfers are chained as they would be by the server
+			chainCtx, stop := context.WithCancel(ctx)
+			defer stop()
+			go func() {
+				ticker := time.NewTicker(time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-chainCtx.Done():
+						return
+					case <-ticker.C:
+						pg.ChainLedger(chainCtx)
+					}
+				}
+			}()
+
+			var (
+				aborts int64
+				next   int64
+			)
+			bb.ResetTimer()
+			bb.RunParallel(func(pb *testing.PB) {
+				payer := fmt.Sprintf("payer-%02d", atomic.AddInt64(&next, 1)%payers)
+				req := wallet.CreateTransferRequest{From: payer, To: "merchant", Amount: 1}
+				for pb.Next() {
+					for {
+						_, err := pg.CreateTransfer(ctx, req)
+						if errors.Is(err, wallet.ErrContention) {
+							atomic.AddInt64(&aborts, 1)
+							continue
+						}
+						if err != nil {
+							bb.Error(err)
+						}
+						break
+					}
+				}
+			})
+			bb.ReportMetric(float64(aborts)/float64(bb.N), "aborts/op")
+		})
+	}
+}
@@ -1,10 +1,11 @@
 package wallet
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/arhyth/genwallet/errorrrs"
@@ -16,20 +17,47 @@ type Account struct {
 	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  Metadata  `json:"metadata,omitempty"`
+	// Frozen accounts can neither pay nor be paid (see `FreezeAccount`)
+	Frozen bool `json:"frozen,omitempty"`
+	// System accounts are booked by the service itself, e.g. the suspense
+	// accounts of adjustments; they cannot take part in payments
+	System bool `json:"system,omitempty"`
 }
 
 // Note: The API seems a bit unintuitive since the business/domain model
 // is a bit confusing; unsure if the `Service` interface should be broken
 // into 2 interfaces and how to model `transfer`s/`payment`s.
-// We could also propagate request context here but since we will not
-// be making use of cancellation or deadline, seems currently unnecessary.
+// Request context is propagated down to the repository, which reads
+// per-request options from it (e.g. `WithReadYourWrites`).
 type Service interface {
-	ListAccounts(ListAccountsRequest) ([]Account, error)
-	GetAccount(GetAccountRequest) (Account, error)
-	CreateAccount(CreateAccountRequest) (Account, error)
-	ListPayments(ListPaymentsRequest) ([]Payment, error)
-	CreatePayment(CreatePaymentRequest) (Payment, error)
-	ListTransfers(ListTransfersRequest) ([]Transfer, error)
+	ListAccounts(context.Context, ListAccountsRequest) ([]Account, error)
+	GetAccount(context.Context, GetAccountRequest) (Account, error)
+	CreateAccount(context.Context, CreateAccountRequest) (Account, error)
+	ListPayments(context.Context, ListPaymentsRequest) ([]Payment, error)
+	CreatePayment(context.Context, CreatePaymentRequest) (Payment, error)
+	ListTransfers(context.Context, ListTransfersRequest) ([]Transfer, error)
+
+	// Stream* are the row-by-row counterparts of the List* methods,
+	// used for exports that should not be materialized in memory
+	StreamAccounts(context.Context, ListAccountsRequest, func(Account) error) error
+	StreamPayments(context.Context, ListPaymentsRequest, func(Payment) error) error
+	StreamTransfers(context.Context, ListTransfersRequest, func(Transfer) error) error
+
+	GetStatement(context.Context, StatementRequest) (Statement, error)
+	// GetLedgerProof proves that a transfer is part of the
+	// (tamper-evident) ledger of its tenant
+	GetLedgerProof(context.Context, LedgerProofRequest) (LedgerProof, error)
+
+	// Admin operations, for ops rather than wallet holders; callers
+	// authenticated with a non-admin API key are refused
+	RequestAdjustment(context.Context, AdjustmentRequest) (Adjustment, error)
+	ListAdjustments(context.Context, ListAdjustmentsRequest) ([]Adjustment, error)
+	GetAdjustment(context.Context, GetAdjustmentRequest) (Adjustment, error)
+	DecideAdjustment(context.Context, DecideAdjustmentRequest) (Adjustment, error)
+	FreezeAccount(context.Context, FreezeAccountRequest) (Account, error)
+	Reconcile(context.Context, ReconcileRequest) ([]Reconciliation, error)
+	ListAudit(context.Context, ListAuditRequest) ([]AuditEntry, error)
 }
 
 type GetAccountRequest struct {
@@ -62,6 +90,17 @@ func (et EntryType) MarshalJSON() ([]byte, error) {
 	}
 }
 
+func (et EntryType) String() string {
+	switch et {
+	case Incoming:
+		return "incoming"
+	case Outgoing:
+		return "outgoing"
+	default:
+		return fmt.Sprintf("EntryType(%d)", int(et))
+	}
+}
+
 func (et *EntryType) UnmarshalJSON(data []byte) error {
 	if string(data) == string(incomingJSON) {
 		*et = Incoming
@@ -74,48 +113,196 @@ func (et *EntryType) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Payment `ID` is that of its transfer
 type Payment struct {
-	Self      string    `json:"account"`
-	From      *string   `json:"from_account,omitempty"`
-	To        *string   `json:"to_account,omitempty"`
-	Amount    float64   `json:"amount"`
-	Direction EntryType `json:"direction"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          int       `json:"id"`
+	Self        string    `json:"account"`
+	From        *string   `json:"from_account,omitempty"`
+	To          *string   `json:"to_account,omitempty"`
+	Amount      float64   `json:"amount"`
+	Direction   EntryType `json:"direction"`
+	CreatedAt   time.Time `json:"created_at"`
+	Description string    `json:"description,omitempty"`
+	Reference   string    `json:"reference,omitempty"`
+	Metadata    Metadata  `json:"metadata,omitempty"`
 }
 
 type Transfer struct {
-	ID        int       `json:"id"`
-	From      string    `json:"from"`
-	To        string    `json:"to"`
-	Currency  string    `json:"currency"`
-	Amount    float64   `json:"amount"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          int       `json:"id"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Currency    string    `json:"currency"`
+	Amount      float64   `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+	Description string    `json:"description,omitempty"`
+	Reference   string    `json:"reference,omitempty"`
+	Metadata    Metadata  `json:"metadata,omitempty"`
 }
 
+// ListTransfersRequest `From` and `To` work together as a `where... OR`
+// while the other filters, if present, further narrow it down. Transfers
+// match `Metadata` if they have every one of its key-value pairs.
+// `AfterID`, if set, only lists transfers with greater IDs, e.g. those
+// booked since the last one a caller has seen. Along with `Limit`, it
+// pages through listings: the next page is after the last ID of a page.
 type ListTransfersRequest struct {
-	Currency *string
-	From     *string
-	To       *string
+	Currency  *string
+	From      *string
+	To        *string
+	Reference *string
+	Metadata  Metadata
+	AfterID   *int
+	// Limit, if not 0, is the maximum number of transfers listed
+	Limit int
 }
 
+// ListAccountsRequest `After` and `Limit` page through accounts,
+// which are listed in ID order, as `ListTransfersRequest` ones do
 type ListAccountsRequest struct {
 	Currency *string
+	After    *string
+	Limit    int
 }
 
 type CreateAccountRequest struct {
 	ID       string  `json:"id"`
 	InitAmt  float64 `json:"init_amt"`
 	Currency string  `json:"currency" `
+	// Shards, if more than 1, splits the account balance across as many
+	// sub-balances so that concurrent incoming transfers to it (e.g. to
+	// a merchant wallet) do not contend on a single row
+	Shards   int      `json:"shards,omitempty"`
+	Metadata Metadata `json:"metadata,omitempty"`
 }
 
+// ListPaymentsRequest filters are as those of `ListTransfersRequest`
 type ListPaymentsRequest struct {
-	ID string `json:"id"`
+	ID        string   `json:"id"`
+	Reference *string  `json:"reference,omitempty"`
+	Metadata  Metadata `json:"metadata,omitempty"`
+	AfterID   *int     `json:"after_id,omitempty"`
+	Limit     int      `json:"limit,omitempty"`
 }
 
+// CreatePaymentRequest `Reference` is the payer's own identifier of the
+// payment (e.g. an order ID); a payer cannot use the same one twice.
+// `IdempotencyKey` is of the request rather than of the payment: requests
+// of a payer with the same key return the payment the first one made.
+// It is sent as header `Idempotency-Key`, not in the body.
 type CreatePaymentRequest struct {
-	Self   string  `json:"account"`
-	To     string  `json:"to_account"`
-	Amount float64 `json:"amount"`
+	Self           string   `json:"account"`
+	To             string   `json:"to_account"`
+	Amount         float64  `json:"amount"`
+	Description    string   `json:"description,omitempty"`
+	Reference      string   `json:"reference,omitempty"`
+	Metadata       Metadata `json:"metadata,omitempty"`
+	IdempotencyKey string   `json:"-"`
+}
+
+// StatementRequest is for an account statement over the period [From, To).
+// A zero `From` means since the account was opened and a zero `To` means now.
+type StatementRequest struct {
+	ID   string    `json:"id"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Statement is an account's booked entries over a period, along with
+// its balances at the opening and closing of that period
+type Statement struct {
+	Account        Account    `json:"account"`
+	From           time.Time  `json:"from"`
+	To             time.Time  `json:"to"`
+	OpeningBalance float64    `json:"opening_balance"`
+	ClosingBalance float64    `json:"closing_balance"`
+	Entries        []Transfer `json:"entries"`
+}
+
+type FreezeAccountRequest struct {
+	ID     string `json:"id"`
+	Frozen bool   `json:"frozen"`
+}
+
+type ReconcileRequest struct {
+	Currency *string
+}
+
+// Reconciliation is an account's balance checked against the one expected
+// from its opening balance and every transfer booked to it since
+type Reconciliation struct {
+	ID         string  `json:"id"`
+	Currency   string  `json:"currency"`
+	Balance    float64 `json:"balance"`
+	Expected   float64 `json:"expected"`
+	Difference float64 `json:"difference"`
+	Balanced   bool    `json:"balanced"`
+}
+
+// ReconcileTolerance is the difference between an account's balance and
+// its expected balance that is put down to rounding; balances are stored
+// as single precision floats.
+const ReconcileTolerance = 0.01
+
+// SuspenseAccountID is the ID of the system account that adjustments in
+// currency `cur` are booked against. IDs starting with `_` are reserved
+// for system accounts.
+func SuspenseAccountID(cur string) string {
+	return "_suspense-" + cur
+}
+
+// classify converts repository errors into service errors. Conditions
+// that clients can act on get their own codes; anything else is internal.
+func classify(err error) error {
+	var (
+		id   errorrrs.ID
+		code errorrrs.Code
+	)
+	switch {
+	case errors.Is(err, ErrAccountNotFound):
+		id, code = errorrrs.NotFound, errorrrs.CodeAccountNotFound
+	case errors.Is(err, ErrAccountExists):
+		id, code = errorrrs.Conflict, errorrrs.CodeAccountExists
+	case errors.Is(err, ErrInsufficientFunds):
+		id, code = errorrrs.Unprocessable, errorrrs.CodeInsufficientFunds
+	case errors.Is(err, ErrCurrencyMismatch):
+		id, code = errorrrs.Unprocessable, errorrrs.CodeCurrencyMismatch
+	case errors.Is(err, ErrAccountFrozen):
+		id, code = errorrrs.Unprocessable, errorrrs.CodeAccountFrozen
+	case errors.Is(err, ErrDuplicateReference):
+		id, code = errorrrs.Conflict, errorrrs.CodeDuplicateReference
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		id, code = errorrrs.Conflict, errorrrs.CodeIdempotencyKeyReused
+	case errors.Is(err, ErrPeriodArchived):
+		id, code = errorrrs.Unprocessable, errorrrs.CodePeriodArchived
+	case errors.Is(err, ErrTransferNotFound):
+		id, code = errorrrs.NotFound, errorrrs.CodeTransferNotFound
+	case errors.Is(err, ErrTransferNotChained):
+		id, code = errorrrs.Unprocessable, errorrrs.CodeTransferNotChained
+	case errors.Is(err, ErrTransferPending):
+		id, code = errorrrs.Conflict, errorrrs.CodeTransferPending
+	case errors.Is(err, ErrAdjustmentNotFound):
+		id, code = errorrrs.NotFound, errorrrs.CodeAdjustmentNotFound
+	case errors.Is(err, ErrAdjustmentDecided):
+		id, code = errorrrs.Conflict, errorrrs.CodeAdjustmentDecided
+	case errors.Is(err, ErrSelfApproval):
+		id, code = errorrrs.Forbidden, errorrrs.CodeSelfApproval
+	case errors.Is(err, ErrContention):
+		id, code = errorrrs.Conflict, errorrrs.CodeConcurrentUpdate
+	default:
+		id, code = errorrrs.InternalServerError, errorrrs.CodeInternal
+	}
+
+	e := &errorrrs.E{
+		ID:   id,
+		Code: code,
+		Msg:  err.Error(),
+	}
+	var ce *causedErr
+	if errors.As(err, &ce) {
+		e.Cause = ce.cause
+	}
+
+	return e
 }
 
 var _ Service = (*ServiceImpl)(nil)
@@ -124,119 +311,127 @@ type ServiceImpl struct {
 	Repo Repository
 }
 
-func (ws *ServiceImpl) GetAccount(req GetAccountRequest) (Account, error) {
-	acct, err := ws.Repo.GetAccount(req)
+func (ws *ServiceImpl) GetAccount(ctx context.Context, req GetAccountRequest) (Account, error) {
+	acct, err := ws.Repo.GetAccount(ctx, req)
 	if err != nil {
-		// Yes, yes, reader, this seems unergonomic. I haven't found a better
-		// way to classify errors without this hassle. If you find one, please
-		// feel free to share and refactor.
-		if err == sql.ErrNoRows {
-			return acct, &errorrrs.E{
-				ID:  errorrrs.NotFound,
-				Msg: err.Error(),
-			}
-		} else {
-			return acct, &errorrrs.E{
-				ID:  errorrrs.InternalServerError,
-				Msg: err.Error(),
-			}
-		}
+		return acct, classify(err)
 	}
 
 	return acct, err
 }
 
-func (ws *ServiceImpl) ListAccounts(req ListAccountsRequest) ([]Account, error) {
-	accts, err := ws.Repo.ListAccounts(req)
+func (ws *ServiceImpl) ListAccounts(ctx context.Context, req ListAccountsRequest) ([]Account, error) {
+	accts, err := ws.Repo.ListAccounts(ctx, req)
 	if err != nil {
-		return accts, &errorrrs.E{
-			ID:  errorrrs.InternalServerError,
-			Msg: err.Error(),
-		}
+		return accts, classify(err)
 	}
 
 	return accts, err
 }
 
-func (ws *ServiceImpl) CreateAccount(req CreateAccountRequest) (Account, error) {
-	acct, err := ws.Repo.CreateAccount(req)
+func (ws *ServiceImpl) StreamAccounts(ctx context.Context, req ListAccountsRequest, fn func(Account) error) error {
+	if err := ws.Repo.StreamAccounts(ctx, req, fn); err != nil {
+		return classify(err)
+	}
+
+	return nil
+}
+
+func (ws *ServiceImpl) CreateAccount(ctx context.Context, req CreateAccountRequest) (Account, error) {
+	acct, err := ws.Repo.CreateAccount(ctx, req)
 	if err != nil {
-		return acct, &errorrrs.E{
-			ID:  errorrrs.InternalServerError,
-			Msg: err.Error(),
-		}
+		return acct, classify(err)
 	}
 
 	return acct, err
 }
 
-func (ws *ServiceImpl) CreatePayment(req CreatePaymentRequest) (Payment, error) {
+func (ws *ServiceImpl) CreatePayment(ctx context.Context, req CreatePaymentRequest) (Payment, error) {
 	transferReq := CreateTransferRequest{
-		From:   req.Self,
-		To:     req.To,
-		Amount: req.Amount,
+		From:           req.Self,
+		To:             req.To,
+		Amount:         req.Amount,
+		Description:    req.Description,
+		Reference:      req.Reference,
+		Metadata:       req.Metadata,
+		IdempotencyKey: req.IdempotencyKey,
 	}
 
 	var pymt Payment
-	transfer, err := ws.Repo.CreateTransfer(transferReq)
+	transfer, err := ws.Repo.CreateTransfer(ctx, transferReq)
 	if err != nil {
-		return pymt, &errorrrs.E{
-			ID:  errorrrs.InternalServerError,
-			Msg: err.Error(),
-		}
+		return pymt, classify(err)
 	}
 
-	pymt.Self = transfer.From
-	pymt.To = &transfer.To
-	pymt.Amount = transfer.Amount
-	pymt.Direction = Outgoing
+	pymt = paymentOf(transfer.From, transfer)
 
 	return pymt, nil
 }
 
-func (ws *ServiceImpl) ListPayments(req ListPaymentsRequest) ([]Payment, error) {
+func (ws *ServiceImpl) ListPayments(ctx context.Context, req ListPaymentsRequest) ([]Payment, error) {
 	// Note: we make use of same DB method as `ListTransfers` since `Payment`s
 	// are only a `Service` "domain object" and exist in the DB also as `Transfer`s
-	transferReq := ListTransfersRequest{
-		From: &req.ID,
-		To:   &req.ID,
-	}
-
-	transfers, err := ws.Repo.ListTransfers(transferReq)
+	transfers, err := ws.Repo.ListTransfers(ctx, paymentsTransfersReq(req))
 	if err != nil {
-		return nil, &errorrrs.E{
-			ID:  errorrrs.InternalServerError,
-			Msg: err.Error(),
-		}
+		return nil, classify(err)
 	}
 
 	payments := make([]Payment, len(transfers))
 	for i := range transfers {
-		t := transfers[i]
-		p := Payment{
-			Self:   req.ID,
-			Amount: t.Amount,
-		}
-		if req.ID == t.From {
-			p.To = &t.To
-			p.Direction = Outgoing
-		} else {
-			p.From = &t.From
-			p.Direction = Incoming
-		}
-		payments[i] = p
+		payments[i] = paymentOf(req.ID, transfers[i])
 	}
 
 	return payments, nil
 }
 
-func (ws *ServiceImpl) ListTransfers(req ListTransfersRequest) ([]Transfer, error) {
-	trnsfrs, err := ws.Repo.ListTransfers(req)
+func (ws *ServiceImpl) StreamPayments(ctx context.Context, req ListPaymentsRequest, fn func(Payment) error) error {
+	err := ws.Repo.StreamTransfers(ctx, paymentsTransfersReq(req), func(t Transfer) error {
+		return fn(paymentOf(req.ID, t))
+	})
+	if err != nil {
+		return classify(err)
+	}
+
+	return nil
+}
+
+func paymentsTransfersReq(req ListPaymentsRequest) ListTransfersRequest {
+	return ListTransfersRequest{
+		From:      &req.ID,
+		To:        &req.ID,
+		Reference: req.Reference,
+		Metadata:  req.Metadata,
+		AfterID:   req.AfterID,
+		Limit:     req.Limit,
+	}
+}
+
+// paymentOf represents transfer `t` with respect to account `self`
+func paymentOf(self string, t Transfer) Payment {
+	p := Payment{
+		ID:          t.ID,
+		Self:        self,
+		Amount:      t.Amount,
+		CreatedAt:   t.CreatedAt,
+		Description: t.Description,
+		Reference:   t.Reference,
+		Metadata:    t.Metadata,
+	}
+	if self == t.From {
+		p.To = &t.To
+		p.Direction = Outgoing
+	} else {
+		p.From = &t.From
+		p.Direction = Incoming
+	}
+
+	return p
+}
+
+func (ws *ServiceImpl) ListTransfers(ctx context.Context, req ListTransfersRequest) ([]Transfer, error) {
+	trnsfrs, err := ws.Repo.ListTransfers(ctx, req)
 	if err != nil {
-		return nil, &errorrrs.E{
-			ID:  errorrrs.InternalServerError,
-			Msg: err.Error(),
-		}
+		return nil, classify(err)
 	}
 	if trnsfrs == nil {
 		trnsfrs = []Transfer{}
@@ -244,3 +439,112 @@ func (ws *ServiceImpl) ListTransfers(req ListTransfersRequest) ([]Transfer, erro
 
 	return trnsfrs, err
 }
+
+func (ws *ServiceImpl) StreamTransfers(ctx context.Context, req ListTransfersRequest, fn func(Transfer) error) error {
+	if err := ws.Repo.StreamTransfers(ctx, req, fn); err != nil {
+		return classify(err)
+	}
+
+	return nil
+}
+
+func (ws *ServiceImpl) GetStatement(ctx context.Context, req StatementRequest) (Statement, error) {
+	if req.To.IsZero() {
+		req.To = time.Now().UTC()
+	}
+
+	stmt, err := ws.Repo.GetStatement(ctx, req)
+	if err != nil {
+		return stmt, classify(err)
+	}
+	if stmt.Entries == nil {
+		stmt.Entries = []Transfer{}
+	}
+
+	return stmt, nil
+}
+
+func (ws *ServiceImpl) RequestAdjustment(ctx context.Context, req AdjustmentRequest) (Adjustment, error) {
+	adj, err := ws.Repo.RequestAdjustment(ctx, req)
+	if err != nil {
+		return adj, classify(err)
+	}
+
+	return adj, nil
+}
+
+func (ws *ServiceImpl) ListAdjustments(ctx context.Context, req ListAdjustmentsRequest) ([]Adjustment, error) {
+	adjs, err := ws.Repo.ListAdjustments(ctx, req)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if adjs == nil {
+		adjs = []Adjustment{}
+	}
+
+	return adjs, nil
+}
+
+func (ws *ServiceImpl) GetAdjustment(ctx context.Context, req GetAdjustmentRequest) (Adjustment, error) {
+	adj, err := ws.Repo.GetAdjustment(ctx, req)
+	if err != nil {
+		return adj, classify(err)
+	}
+
+	return adj, nil
+}
+
+func (ws *ServiceImpl) DecideAdjustment(ctx context.Context, req DecideAdjustmentRequest) (Adjustment, error) {
+	adj, err := ws.Repo.DecideAdjustment(ctx, req)
+	if err != nil {
+		return adj, classify(err)
+	}
+
+	return adj, nil
+}
+
+func (ws *ServiceImpl) FreezeAccount(ctx context.Context, req FreezeAccountRequest) (Account, error) {
+	acct, err := ws.Repo.FreezeAccount(ctx, req)
+	if err != nil {
+		return acct, classify(err)
+	}
+
+	return acct, nil
+}
+
+func (ws *ServiceImpl) Reconcile(ctx context.Context, req ReconcileRequest) ([]Reconciliation, error) {
+	recs, err := ws.Repo.Reconcile(ctx, req)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if recs == nil {
+		recs = []Reconciliation{}
+	}
+	for i := range recs {
+		recs[i].Difference = recs[i].Balance - recs[i].Expected
+		recs[i].Balanced = math.Abs(recs[i].Difference) <= ReconcileTolerance
+	}
+
+	return recs, nil
+}
+
+func (ws *ServiceImpl) GetLedgerProof(ctx context.Context, req LedgerProofRequest) (LedgerProof, error) {
+	proof, err := ws.Repo.GetLedgerProof(ctx, req)
+	if err != nil {
+		return proof, classify(err)
+	}
+
+	return proof, nil
+}
+
+func (ws *ServiceImpl) ListAudit(ctx context.Context, req ListAuditRequest) ([]AuditEntry, error) {
+	entries, err := ws.Repo.ListAudit(ctx, req)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+
+	return entries, nil
+}
@@ -1,6 +1,7 @@
 package wallet_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 // These "happy path" tests serve only as base case that the service at least works :D
 
 func TestListAccounts(t *testing.T) {
+	ctx := context.Background()
 	t.Run("success", func(tt *testing.T) {
 		as := assert.New(tt)
 		ctrl := gomock.NewController(tt)
@@ -43,17 +45,18 @@ func TestListAccounts(t *testing.T) {
 			},
 		}
 		repo.EXPECT().
-			ListAccounts(gomock.AssignableToTypeOf(listReq)).
+			ListAccounts(gomock.Any(), gomock.AssignableToTypeOf(listReq)).
 			Return(accounts, nil).
 			Times(1)
 
-		result, err := svc.ListAccounts(listReq)
+		result, err := svc.ListAccounts(ctx, listReq)
 		as.Nil(err)
 		as.Len(result, len(accounts))
 	})
 }
 
 func TestGetAccount(t *testing.T) {
+	ctx := context.Background()
 	t.Run("success", func(tt *testing.T) {
 		as := assert.New(tt)
 		ctrl := gomock.NewController(tt)
@@ -70,17 +73,18 @@ func TestGetAccount(t *testing.T) {
 			Currency: "CNY",
 		}
 		repo.EXPECT().
-			GetAccount(gomock.AssignableToTypeOf(getReq)).
+			GetAccount(gomock.Any(), gomock.AssignableToTypeOf(getReq)).
 			Return(account, nil).
 			Times(1)
 
-		result, err := svc.GetAccount(getReq)
+		result, err := svc.GetAccount(ctx, getReq)
 		as.Nil(err)
 		as.Equal(account.ID, result.ID)
 	})
 }
 
 func TestCreateAccount(t *testing.T) {
+	ctx := context.Background()
 	t.Run("success", func(tt *testing.T) {
 		as := assert.New(tt)
 		ctrl := gomock.NewController(tt)
@@ -93,8 +97,8 @@ func TestCreateAccount(t *testing.T) {
 		createReq := wallet.CreateAccountRequest{}
 		now := time.Now().UTC()
 		repo.EXPECT().
-			CreateAccount(gomock.AssignableToTypeOf(createReq)).
-			DoAndReturn(func(r wallet.CreateAccountRequest) (wallet.Account, error) {
+			CreateAccount(gomock.Any(), gomock.AssignableToTypeOf(createReq)).
+			DoAndReturn(func(_ context.Context, r wallet.CreateAccountRequest) (wallet.Account, error) {
 				return wallet.Account{
 					ID:        r.ID,
 					Balance:   r.InitAmt,
@@ -105,7 +109,7 @@ func TestCreateAccount(t *testing.T) {
 			}).
 			Times(1)
 
-		result, err := svc.CreateAccount(createReq)
+		result, err := svc.CreateAccount(ctx, createReq)
 		as.Nil(err)
 		as.Equal(result.ID, createReq.ID)
 		as.Equal(result.Balance, createReq.InitAmt)
@@ -116,6 +120,7 @@ func TestCreateAccount(t *testing.T) {
 }
 
 func TestListPayments(t *testing.T) {
+	ctx := context.Background()
 	t.Run("success", func(tt *testing.T) {
 		as := assert.New(tt)
 		ctrl := gomock.NewController(tt)
@@ -148,11 +153,11 @@ func TestListPayments(t *testing.T) {
 			},
 		}
 		repo.EXPECT().
-			ListTransfers(gomock.AssignableToTypeOf(listTransferReq)).
+			ListTransfers(gomock.Any(), gomock.AssignableToTypeOf(listTransferReq)).
 			Return(transfers, nil).
 			Times(1)
 
-		result, err := svc.ListPayments(listPReq)
+		result, err := svc.ListPayments(ctx, listPReq)
 		as.Nil(err)
 		as.Len(result, len(transfers))
 		as.Equal(result[0].Self, transfers[0].From)
@@ -163,6 +168,7 @@ func TestListPayments(t *testing.T) {
 }
 
 func TestCreatePayment(t *testing.T) {
+	ctx := context.Background()
 	t.Run("success", func(tt *testing.T) {
 		as := assert.New(tt)
 		ctrl := gomock.NewController(tt)
@@ -191,11 +197,11 @@ func TestCreatePayment(t *testing.T) {
 			CreatedAt: now.AddDate(0, -1, 0),
 		}
 		repo.EXPECT().
-			CreateTransfer(createTransferRequest).
+			CreateTransfer(gomock.Any(), createTransferRequest).
 			Return(trnsfr, nil).
 			Times(1)
 
-		result, err := svc.CreatePayment(createPReq)
+		result, err := svc.CreatePayment(ctx, createPReq)
 		as.Nil(err)
 		as.Equal(result.Self, createPReq.Self)
 		as.Equal(*result.To, createPReq.To)
@@ -0,0 +1,275 @@
+package wallet
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Tenant is a business unit with a namespace of account IDs and a ledger of
+// its own. Every `Repository` read and write is scoped to the tenant of the
+// request (see `WithPrincipal`); accounts of other tenants are as good as
+// nonexistent, so transfers across tenants fail as `ErrAccountNotFound`.
+type Tenant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Currencies are those its accounts can be opened in, any if empty
+	Currencies []string `json:"currencies,omitempty"`
+	// MaxTransferAmount is the maximum amount of its single
+	// payments, on top of `MaxAmount`, none if zero
+	MaxTransferAmount float64   `json:"max_transfer_amount,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// DefaultTenantID is the tenant of requests without a principal, i.e.
+// unauthenticated requests where authentication is not required and
+// internal callers (e.g. maintenance commands). Accounts and transfers
+// that predate tenants belong to it.
+const DefaultTenantID = "default"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// KeyID is the ID of the API key the caller authenticated with
+	KeyID  string
+	Tenant Tenant
+	// Admin principals may also run the admin operations of `Service`
+	// within their tenant
+	Admin bool
+}
+
+type principalKey struct{}
+
+// WithPrincipal sets the principal, and so the tenant, of the request of `ctx`
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal of the request of `ctx`, if any
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// tenantOf is the ID of the tenant that the request of `ctx` is scoped to
+func tenantOf(ctx context.Context) string {
+	if p, ok := PrincipalFrom(ctx); ok {
+		return p.Tenant.ID
+	}
+	return DefaultTenantID
+}
+
+// APIKey authenticates callers as principals of its tenant. Only a hash
+// of the key is stored, so `Key` is only known to whoever created it.
+type APIKey struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id"`
+	Key       string    `json:"key,omitempty"`
+	Admin     bool      `json:"admin,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// API keys are of the form `gw_<ID>_<secret>` so that they are looked up
+// by ID and the hash of the secret compared in constant time
+const apiKeyPrefix = "gw"
+
+// newAPIKey generates a key of tenant `tenantID`, returning it along
+// with the hash of its secret
+func newAPIKey(tenantID string, admin bool) (APIKey, []byte, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return APIKey{}, nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, nil, err
+	}
+
+	key := APIKey{
+		ID:       hex.EncodeToString(id),
+		TenantID: tenantID,
+		Admin:    admin,
+	}
+	secretStr := base64.RawURLEncoding.EncodeToString(secret)
+	key.Key = strings.Join([]string{apiKeyPrefix, key.ID, secretStr}, "_")
+
+	return key, hashAPIKeySecret(secretStr), nil
+}
+
+// parseAPIKey splits `key` into its ID and secret
+func parseAPIKey(key string) (id, secret string, ok bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func hashAPIKeySecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// apiKeyMatches tells whether `secret` is that of the key with hash `hash`
+func apiKeyMatches(hash []byte, secret string) bool {
+	return subtle.ConstantTimeCompare(hash, hashAPIKeySecret(secret)) == 1
+}
+
+// Errors that `Tenants` implementations return (possibly wrapped)
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantExists   = errors.New("tenant already exists")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidAPIKey is of keys that are malformed, unknown or revoked
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// Authenticator resolves API keys to the principals they authenticate
+type Authenticator interface {
+	Authenticate(ctx context.Context, key string) (Principal, error)
+}
+
+// Tenants manages tenants and their API keys. `Repo` and `MemRepo` implement it.
+type Tenants interface {
+	Authenticator
+
+	CreateTenant(context.Context, Tenant) (Tenant, error)
+	// CreateAPIKey generates a key of tenant `key.TenantID`, an admin
+	// one if `key.Admin`; the returned `APIKey.Key` cannot be recovered later
+	CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+}
+
+// Validate checks a tenant to be created; `Currencies` are
+// expected to be normalized already (see `NormalizeTenant`)
+func (t Tenant) Validate() error {
+	return validate(t.rules())
+}
+
+// NormalizeTenant trims the name and upper cases the currencies of `t`
+func NormalizeTenant(t Tenant) Tenant {
+	t.Name = strings.TrimSpace(t.Name)
+	if len(t.Currencies) > 0 {
+		curs := make([]string, len(t.Currencies))
+		for i, cur := range t.Currencies {
+			curs[i] = normalizeCurrency(cur)
+		}
+		t.Currencies = curs
+	}
+
+	return t
+}
+
+// allowsCurrency tells whether accounts of `t` can be opened in `cur`
+func (t Tenant) allowsCurrency(cur string) bool {
+	if len(t.Currencies) == 0 {
+		return true
+	}
+	for _, c := range t.Currencies {
+		if c == cur {
+			return true
+		}
+	}
+	return false
+}
+
+var _ Tenants = (*Repo)(nil)
+
+func (r *Repo) CreateTenant(ctx context.Context, t Tenant) (Tenant, error) {
+	// no currencies (any) are stored as an empty array rather than NULL
+	curs := pq.StringArray(t.Currencies)
+	if curs == nil {
+		curs = pq.StringArray{}
+	}
+	maxAmt := sql.NullFloat64{Float64: t.MaxTransferAmount, Valid: t.MaxTransferAmount > 0}
+	e := newAuditEntry(ctx, t.ID, AuditCreateTenant, t.ID, t)
+	err := r.audited(ctx, &e, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `INSERT INTO tenants (id, name, currencies, max_transfer_amount)
+		VALUES ($1, $2, $3, $4) RETURNING created_at;`, t.ID, t.Name, curs, maxAmt).
+			Scan(&t.CreatedAt)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgUniqueViolation {
+			return fmt.Errorf("%w: %v", ErrTenantExists, t.ID)
+		}
+		return err
+	})
+
+	return t, err
+}
+
+// CreateAPIKey is audited as of the tenant of the key, which is its target
+func (r *Repo) CreateAPIKey(ctx context.Context, req APIKey) (APIKey, error) {
+	key, hash, err := newAPIKey(req.TenantID, req.Admin)
+	if err != nil {
+		return key, err
+	}
+	e := newAuditEntry(ctx, req.TenantID, AuditCreateAPIKey, req.TenantID, req)
+	err = r.audited(ctx, &e, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `INSERT INTO api_keys (id, tenant_id, key_hash, admin)
+		VALUES ($1, $2, $3, $4) RETURNING created_at;`, key.ID, key.TenantID, hash, key.Admin).Scan(&key.CreatedAt)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgForeignKeyViolation {
+			return fmt.Errorf("%w: %v", ErrTenantNotFound, key.TenantID)
+		}
+		return err
+	})
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// RevokeAPIKey is audited as of the tenant of the key, if it exists,
+// and of the tenant of the request otherwise
+func (r *Repo) RevokeAPIKey(ctx context.Context, id string) error {
+	e := newAuditEntry(ctx, tenantOf(ctx), AuditRevokeAPIKey, id, id)
+	return r.audited(ctx, &e, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `UPDATE api_keys SET revoked_at = now()
+		WHERE id = $1 AND revoked_at IS NULL RETURNING tenant_id;`, id).Scan(&e.tenant)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %v", ErrAPIKeyNotFound, id)
+		}
+		return err
+	})
+}
+
+// Authenticate reads keys from the primary, never the replica,
+// so that revocations take effect immediately
+func (r *Repo) Authenticate(ctx context.Context, key string) (Principal, error) {
+	var p Principal
+	id, secret, ok := parseAPIKey(key)
+	if !ok {
+		return p, ErrInvalidAPIKey
+	}
+
+	var (
+		hash   []byte
+		maxAmt sql.NullFloat64
+		t      = &p.Tenant
+	)
+	err := r.DB.QueryRowContext(ctx, `SELECT k.key_hash, k.admin, t.id, t.name, t.currencies, t.max_transfer_amount, t.created_at
+	FROM api_keys k JOIN tenants t ON t.id = k.tenant_id
+	WHERE k.id = $1 AND k.revoked_at IS NULL;`, id).
+		Scan(&hash, &p.Admin, &t.ID, &t.Name, pq.Array(&t.Currencies), &maxAmt, &t.CreatedAt)
+	if err == sql.ErrNoRows || (err == nil && !apiKeyMatches(hash, secret)) {
+		return Principal{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	p.KeyID = id
+	t.MaxTransferAmount = maxAmt.Float64
+	if len(t.Currencies) == 0 {
+		t.Currencies = nil
+	}
+
+	return p, nil
+}
@@ -0,0 +1,241 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/arhyth/genwallet/errorrrs"
+)
+
+// TracerName is the name of the tracer of every span of the package
+const TracerName = "github.com/arhyth/genwallet/wallet"
+
+// propagator propagates trace contexts as W3C `traceparent` headers
+// (and metadata, over gRPC)
+var propagator = propagation.TraceContext{}
+
+// errorCodeKey is the attribute of the error code of failed spans
+const errorCodeKey = attribute.Key("error.code")
+
+// endSpan ends `span`, marking it failed if `err` is not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		var e *errorrrs.E
+		if errors.As(err, &e) {
+			span.SetAttributes(errorCodeKey.String(string(errorrrs.Classify(e).Code)))
+		}
+	}
+	span.End()
+}
+
+// HTTPTracing is a router middleware that spans each request, continuing
+// the trace of its `traceparent` header, if any. Spans are named after
+// the route rather than the path so that requests of a route add up.
+func HTTPTracing(tp trace.TracerProvider) func(http.Handler) http.Handler {
+	tracer := tp.Tracer(TracerName)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracer.Start(ctx, "HTTP "+req.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPMethod(req.Method)),
+			)
+			defer span.End()
+			// routers fill in the route of requests on the way
+			if chi.RouteContext(ctx) == nil {
+				ctx = context.WithValue(ctx, chi.RouteCtxKey, chi.NewRouteContext())
+			}
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, req.WithContext(ctx))
+
+			if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+				span.SetName(req.Method + " " + rctx.RoutePattern())
+				span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+			}
+			span.SetAttributes(semconv.HTTPStatusCode(sw.status))
+			if sw.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(sw.status))
+			}
+		})
+	}
+}
+
+// statusWriter records the status of responses
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// traceGRPC is a go-kit grpc `ServerBefore` func continuing the
+// trace of the `traceparent` metadata of calls, if any
+func traceGRPC(ctx context.Context, md metadata.MD) context.Context {
+	return propagator.Extract(ctx, metadataCarrier(md))
+}
+
+// metadataCarrier carries trace contexts in gRPC metadata
+type metadataCarrier metadata.MD
+
+func (mc metadataCarrier) Get(key string) string {
+	if vs := metadata.MD(mc).Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+func (mc metadataCarrier) Set(key, value string) {
+	metadata.MD(mc).Set(key, value)
+}
+
+func (mc metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(mc))
+	for key := range mc {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+var _ Service = (*TracingMiddleware)(nil)
+
+// TracingMiddleware spans each call of the service. Outermost, its spans
+// cover authentication and validation as well as the repository, whose
+// statements have spans of their own (see `WithTracing`), so that the
+// time of a call can be told apart from that of its transaction.
+type TracingMiddleware struct {
+	Next   Service
+	Tracer trace.Tracer
+}
+
+func (tm *TracingMiddleware) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tm.Tracer.Start(ctx, "wallet.Service/"+method)
+}
+
+func (tm *TracingMiddleware) ListAccounts(ctx context.Context, req ListAccountsRequest) (_ []Account, err error) {
+	ctx, span := tm.start(ctx, "ListAccounts")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.ListAccounts(ctx, req)
+}
+
+func (tm *TracingMiddleware) GetAccount(ctx context.Context, req GetAccountRequest) (_ Account, err error) {
+	ctx, span := tm.start(ctx, "GetAccount")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.GetAccount(ctx, req)
+}
+
+func (tm *TracingMiddleware) CreateAccount(ctx context.Context, req CreateAccountRequest) (_ Account, err error) {
+	ctx, span := tm.start(ctx, "CreateAccount")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.CreateAccount(ctx, req)
+}
+
+func (tm *TracingMiddleware) ListPayments(ctx context.Context, req ListPaymentsRequest) (_ []Payment, err error) {
+	ctx, span := tm.start(ctx, "ListPayments")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.ListPayments(ctx, req)
+}
+
+func (tm *TracingMiddleware) CreatePayment(ctx context.Context, req CreatePaymentRequest) (_ Payment, err error) {
+	ctx, span := tm.start(ctx, "CreatePayment")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.CreatePayment(ctx, req)
+}
+
+func (tm *TracingMiddleware) ListTransfers(ctx context.Context, req ListTransfersRequest) (_ []Transfer, err error) {
+	ctx, span := tm.start(ctx, "ListTransfers")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.ListTransfers(ctx, req)
+}
+
+func (tm *TracingMiddleware) StreamAccounts(ctx context.Context, req ListAccountsRequest, fn func(Account) error) (err error) {
+	ctx, span := tm.start(ctx, "StreamAccounts")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.StreamAccounts(ctx, req, fn)
+}
+
+func (tm *TracingMiddleware) StreamPayments(ctx context.Context, req ListPaymentsRequest, fn func(Payment) error) (err error) {
+	ctx, span := tm.start(ctx, "StreamPayments")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.StreamPayments(ctx, req, fn)
+}
+
+func (tm *TracingMiddleware) StreamTransfers(ctx context.Context, req ListTransfersRequest, fn func(Transfer) error) (err error) {
+	ctx, span := tm.start(ctx, "StreamTransfers")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.StreamTransfers(ctx, req, fn)
+}
+
+func (tm *TracingMiddleware) GetStatement(ctx context.Context, req StatementRequest) (_ Statement, err error) {
+	ctx, span := tm.start(ctx, "GetStatement")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.GetStatement(ctx, req)
+}
+
+func (tm *TracingMiddleware) GetLedgerProof(ctx context.Context, req LedgerProofRequest) (_ LedgerProof, err error) {
+	ctx, span := tm.start(ctx, "GetLedgerProof")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.GetLedgerProof(ctx, req)
+}
+
+func (tm *TracingMiddleware) RequestAdjustment(ctx context.Context, req AdjustmentRequest) (_ Adjustment, err error) {
+	ctx, span := tm.start(ctx, "RequestAdjustment")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.RequestAdjustment(ctx, req)
+}
+
+func (tm *TracingMiddleware) ListAdjustments(ctx context.Context, req ListAdjustmentsRequest) (_ []Adjustment, err error) {
+	ctx, span := tm.start(ctx, "ListAdjustments")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.ListAdjustments(ctx, req)
+}
+
+func (tm *TracingMiddleware) GetAdjustment(ctx context.Context, req GetAdjustmentRequest) (_ Adjustment, err error) {
+	ctx, span := tm.start(ctx, "GetAdjustment")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.GetAdjustment(ctx, req)
+}
+
+func (tm *TracingMiddleware) DecideAdjustment(ctx context.Context, req DecideAdjustmentRequest) (_ Adjustment, err error) {
+	ctx, span := tm.start(ctx, "DecideAdjustment")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.DecideAdjustment(ctx, req)
+}
+
+func (tm *TracingMiddleware) FreezeAccount(ctx context.Context, req FreezeAccountRequest) (_ Account, err error) {
+	ctx, span := tm.start(ctx, "FreezeAccount")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.FreezeAccount(ctx, req)
+}
+
+func (tm *TracingMiddleware) Reconcile(ctx context.Context, req ReconcileRequest) (_ []Reconciliation, err error) {
+	ctx, span := tm.start(ctx, "Reconcile")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.Reconcile(ctx, req)
+}
+
+func (tm *TracingMiddleware) ListAudit(ctx context.Context, req ListAuditRequest) (_ []AuditEntry, err error) {
+	ctx, span := tm.start(ctx, "ListAudit")
+	defer func() { endSpan(span, err) }()
+	return tm.Next.ListAudit(ctx, req)
+}
@@ -0,0 +1,183 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracing spans each SQL statement (and transaction commit or rollback)
+// of the repository with tracers of `tp`, as children of the spans in the
+// contexts they run with. Statements are recorded without their arguments.
+func WithTracing(tp trace.TracerProvider) RepoOption {
+	return func(r *Repo) {
+		r.tracer = tp.Tracer(TracerName)
+	}
+}
+
+// openDB opens the Postgres database at `dsn`, tracing its statements
+// with `tracer` if not nil
+func openDB(dsn string, tracer trace.Tracer) (*sql.DB, error) {
+	if tracer == nil {
+		return sql.Open("postgres", dsn)
+	}
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.OpenDB(&tracedConnector{Connector: connector, tracer: tracer}), nil
+}
+
+// tracedConnector wraps the connections of a driver so that their
+// statements are traced. Only the interfaces that `pq` implements
+// are passed through, for `database/sql` to fall back on the rest.
+type tracedConnector struct {
+	driver.Connector
+	tracer trace.Tracer
+}
+
+func (tc *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := tc.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{conn: conn, tracer: tc.tracer}, nil
+}
+
+// tracedConn is a traced `pq` connection
+type tracedConn struct {
+	conn   driver.Conn
+	tracer trace.Tracer
+}
+
+var (
+	_ driver.QueryerContext     = (*tracedConn)(nil)
+	_ driver.ExecerContext      = (*tracedConn)(nil)
+	_ driver.ConnPrepareContext = (*tracedConn)(nil)
+	_ driver.ConnBeginTx        = (*tracedConn)(nil)
+	_ driver.Pinger             = (*tracedConn)(nil)
+)
+
+// start starts the span of running `query`, named after its operation
+// (e.g. `SELECT`) as whole statements would make for too many names
+func (tc *tracedConn) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	op := sqlOperation(query)
+	return tc.tracer.Start(ctx, "sql "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(op), semconv.DBStatement(query)),
+	)
+}
+
+// sqlOperation is the first keyword of `query`, upper cased
+func sqlOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSuffix(fields[0], ";"))
+}
+
+func (tc *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return tc.PrepareContext(context.Background(), query)
+}
+
+func (tc *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := tc.conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, conn: tc, query: query}, nil
+}
+
+func (tc *tracedConn) Close() error {
+	return tc.conn.Close()
+}
+
+func (tc *tracedConn) Begin() (driver.Tx, error) {
+	return tc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (tc *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := tc.conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, ctx: ctx, tracer: tc.tracer}, nil
+}
+
+func (tc *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Rows, err error) {
+	ctx, span := tc.start(ctx, query)
+	defer func() { endSQLSpan(span, err) }()
+	return tc.conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (tc *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Result, err error) {
+	ctx, span := tc.start(ctx, query)
+	defer func() { endSQLSpan(span, err) }()
+	return tc.conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (tc *tracedConn) Ping(ctx context.Context) error {
+	return tc.conn.(driver.Pinger).Ping(ctx)
+}
+
+// endSQLSpan is `endSpan` for errors of the driver; `ErrSkip` is
+// not one, but the driver asking for the statement to be prepared
+func endSQLSpan(span trace.Span, err error) {
+	if err == driver.ErrSkip {
+		err = nil
+	}
+	endSpan(span, err)
+}
+
+// tracedStmt is a traced prepared statement of a `tracedConn`
+type tracedStmt struct {
+	driver.Stmt
+	conn  *tracedConn
+	query string
+}
+
+var (
+	_ driver.StmtQueryContext = (*tracedStmt)(nil)
+	_ driver.StmtExecContext  = (*tracedStmt)(nil)
+)
+
+func (ts *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (_ driver.Rows, err error) {
+	ctx, span := ts.conn.start(ctx, ts.query)
+	defer func() { endSQLSpan(span, err) }()
+	return ts.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+}
+
+func (ts *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (_ driver.Result, err error) {
+	ctx, span := ts.conn.start(ctx, ts.query)
+	defer func() { endSQLSpan(span, err) }()
+	return ts.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+}
+
+// tracedTx spans the commit or rollback of a transaction, which is where
+// serialization failures (and the waits of commits) of transfers show
+type tracedTx struct {
+	driver.Tx
+	ctx    context.Context
+	tracer trace.Tracer
+}
+
+func (tt *tracedTx) Commit() (err error) {
+	_, span := tt.tracer.Start(tt.ctx, "sql COMMIT", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation("COMMIT")))
+	defer func() { endSpan(span, err) }()
+	return tt.Tx.Commit()
+}
+
+func (tt *tracedTx) Rollback() (err error) {
+	_, span := tt.tracer.Start(tt.ctx, "sql ROLLBACK", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation("ROLLBACK")))
+	defer func() { endSpan(span, err) }()
+	return tt.Tx.Rollback()
+}
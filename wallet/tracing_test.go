@@ -0,0 +1,54 @@
+package wallet_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+func TestHTTPTracing(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	handler := wallet.HTTPTracing(tp)(wallet.MakeHTTPHandler(&wallet.TracingMiddleware{
+		Next:   &wallet.ServiceImpl{Repo: wallet.NewMemRepo()},
+		Tracer: tp.Tracer(wallet.TracerName),
+	}))
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parent  = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest("GET", "/wallets/nobody-0", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parent+"-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	as.Equal(http.StatusNotFound, w.Code)
+
+	spans := rec.Ended()
+	reqrd.Len(spans, 2)
+	svcSpan, httpSpan := spans[0], spans[1]
+
+	// the request continues the trace of its caller
+	as.Equal("GET /wallets/{id}", httpSpan.Name())
+	as.Equal(traceID, httpSpan.SpanContext().TraceID().String())
+	as.Equal(parent, httpSpan.Parent().SpanID().String())
+	as.True(httpSpan.Parent().IsRemote())
+	as.Contains(httpSpan.Attributes(), attribute.Int("http.status_code", http.StatusNotFound))
+
+	// which the call of the service is part of
+	as.Equal("wallet.Service/GetAccount", svcSpan.Name())
+	as.Equal(httpSpan.SpanContext().SpanID(), svcSpan.Parent().SpanID())
+	as.Equal(codes.Error, svcSpan.Status().Code)
+	as.Contains(svcSpan.Attributes(), attribute.String("error.code", "account_not_found"))
+}
@@ -3,24 +3,37 @@ package wallet
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
 )
 
 var (
 	rgxpWalletsIDPayments = regexp.MustCompile(`/wallets/([\w-]+)/payments`)
 	rgxpWalletsID         = regexp.MustCompile(`/wallets/([\w-]+)`)
+	rgxpAdjustmentsID     = regexp.MustCompile(`/adjustments/(\d+)(/|$)`)
 )
 
+// IdempotencyKeyHeader is the header of the idempotency keys of payments
+// and adjustment requests over HTTP; over gRPC, of payments, it is the
+// same (lower case) metadata
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 // Go-kit http transport signature funcs
 
 func MakeWalletGetEndpt(svc Service) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(GetAccountRequest)
-		return svc.GetAccount(req)
+		return svc.GetAccount(ctx, req)
 	}
 }
 
@@ -29,8 +42,9 @@ func DecodeHTTPGetAccountReq(_ context.Context, req *http.Request) (interface{},
 	match := rgxpWalletsID.FindStringSubmatch(req.URL.Path)
 	if len(match) < 2 {
 		return nil, &errorrrs.E{
-			ID:  errorrrs.BadRequest,
-			Msg: "malformed path: should be of `/wallets/{id}` format",
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed path: should be of `/wallets/{id}` format",
 		}
 	}
 	getReq.ID = match[1]
@@ -38,15 +52,46 @@ func DecodeHTTPGetAccountReq(_ context.Context, req *http.Request) (interface{},
 	return getReq, nil
 }
 
+// decodeJSONBody decodes a request body into `v` rejecting unknown fields.
+// Any decoding failure is the client's, so it is reported as a bad request.
+func decodeJSONBody(req *http.Request, v interface{}) error {
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		e := &errorrrs.E{
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed JSON body: " + err.Error(),
+		}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			e.Code = errorrrs.CodeValidationFailed
+			e.Fields = []errorrrs.FieldError{
+				{Field: typeErr.Field, Msg: "must not be a JSON " + typeErr.Value},
+			}
+		}
+		return e
+	}
+	if dec.More() {
+		return &errorrrs.E{
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed JSON body: unexpected data after the JSON object",
+		}
+	}
+
+	return nil
+}
+
 func EncodeJSONResponse(_ context.Context, w http.ResponseWriter, resp interface{}) error {
 	w.Header().Add("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(resp)
 }
 
 func MakeWalletListEndpt(svc Service) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(ListAccountsRequest)
-		return svc.ListAccounts(req)
+		return svc.ListAccounts(ctx, req)
 	}
 }
 
@@ -56,20 +101,54 @@ func DecodeHTTPListAccountsReq(_ context.Context, req *http.Request) (interface{
 	if cur != "" {
 		listReq.Currency = &cur
 	}
+	if after := req.URL.Query().Get("after"); after != "" {
+		listReq.After = &after
+	}
+	var err error
+	if listReq.Limit, err = limitParam(req.URL.Query()); err != nil {
+		return nil, err
+	}
 
 	return listReq, nil
 }
 
+// intParam parses integer query param `name`, if present
+func intParam(query url.Values, name string) (*int, error) {
+	v := query.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, &errorrrs.E{
+			ID:     errorrrs.BadRequest,
+			Code:   errorrrs.CodeValidationFailed,
+			Msg:    name + ": must be an integer",
+			Fields: []errorrrs.FieldError{{Field: name, Msg: "must be an integer"}},
+		}
+	}
+	return &n, nil
+}
+
+// limitParam parses the `limit` query param of listings, 0 if absent
+func limitParam(query url.Values) (int, error) {
+	limit, err := intParam(query, "limit")
+	if err != nil || limit == nil {
+		return 0, err
+	}
+	return *limit, nil
+}
+
 func MakeWalletCreateEndpt(svc Service) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(CreateAccountRequest)
-		return svc.CreateAccount(req)
+		return svc.CreateAccount(ctx, req)
 	}
 }
 
 func DecodeHTTPCreateAccountReq(_ context.Context, req *http.Request) (interface{}, error) {
 	var createReq CreateAccountRequest
-	if err := json.NewDecoder(req.Body).Decode(&createReq); err != nil {
+	if err := decodeJSONBody(req, &createReq); err != nil {
 		return nil, err
 	}
 
@@ -77,9 +156,9 @@ func DecodeHTTPCreateAccountReq(_ context.Context, req *http.Request) (interface
 }
 
 func MakePaymentsIndexEndpt(svc Service) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(ListPaymentsRequest)
-		return svc.ListPayments(req)
+		return svc.ListPayments(ctx, req)
 	}
 }
 
@@ -88,46 +167,57 @@ func DecodeHTTPListPaymentsReq(_ context.Context, req *http.Request) (interface{
 	match := rgxpWalletsIDPayments.FindStringSubmatch(req.URL.Path)
 	if len(match) < 2 {
 		return nil, &errorrrs.E{
-			ID:  errorrrs.BadRequest,
-			Msg: "malformed path: should be of `/wallets/{id}/payments` format",
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed path: should be of `/wallets/{id}/payments` format",
 		}
 	}
 	listPayments.ID = match[1]
+	if ref := req.URL.Query().Get("reference"); ref != "" {
+		listPayments.Reference = &ref
+	}
+	listPayments.Metadata = metadataFilter(req.URL.Query())
+	var err error
+	if listPayments.AfterID, err = intParam(req.URL.Query(), "after_id"); err != nil {
+		return nil, err
+	}
+	if listPayments.Limit, err = limitParam(req.URL.Query()); err != nil {
+		return nil, err
+	}
 
 	return listPayments, nil
 }
 
 func MakePaymentsPostEndpt(svc Service) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(CreatePaymentRequest)
-		return svc.CreatePayment(req)
+		return svc.CreatePayment(ctx, req)
 	}
 }
 
 func DecodeHTTPPostPaymentsReq(_ context.Context, req *http.Request) (interface{}, error) {
 	var paymentReq CreatePaymentRequest
-	if err := json.NewDecoder(req.Body).Decode(&paymentReq); err != nil {
-		return nil, &errorrrs.E{
-			ID:  errorrrs.InternalServerError,
-			Msg: err.Error(),
-		}
+	if err := decodeJSONBody(req, &paymentReq); err != nil {
+		return nil, err
 	}
 	match := rgxpWalletsIDPayments.FindStringSubmatch(req.URL.Path)
 	if len(match) < 2 {
 		return nil, &errorrrs.E{
-			ID:  errorrrs.BadRequest,
-			Msg: "malformed path: should be of `/wallets/{id}/payments` format",
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed path: should be of `/wallets/{id}/payments` format",
 		}
 	}
 	paymentReq.Self = match[1]
+	paymentReq.IdempotencyKey = req.Header.Get(IdempotencyKeyHeader)
 
 	return paymentReq, nil
 }
 
 func MakeListTransfersEndpt(svc Service) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(ListTransfersRequest)
-		return svc.ListTransfers(req)
+		return svc.ListTransfers(ctx, req)
 	}
 }
 
@@ -145,6 +235,409 @@ func DecodeHTTPListTransfersReq(_ context.Context, req *http.Request) (interface
 	if to != "" {
 		listReq.To = &to
 	}
+	ref := req.URL.Query().Get("reference")
+	if ref != "" {
+		listReq.Reference = &ref
+	}
+	listReq.Metadata = metadataFilter(req.URL.Query())
+	var err error
+	if listReq.AfterID, err = intParam(req.URL.Query(), "after_id"); err != nil {
+		return nil, err
+	}
+	if listReq.Limit, err = limitParam(req.URL.Query()); err != nil {
+		return nil, err
+	}
 
 	return listReq, nil
 }
+
+// walletsIDPath returns the wallet ID of `/wallets/{id}...` paths
+func walletsIDPath(req *http.Request) (string, error) {
+	match := rgxpWalletsID.FindStringSubmatch(req.URL.Path)
+	if len(match) < 2 {
+		return "", &errorrrs.E{
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed path: should be of `/wallets/{id}/...` format",
+		}
+	}
+	return match[1], nil
+}
+
+func MakeRequestAdjustmentEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(AdjustmentRequest)
+		return svc.RequestAdjustment(ctx, req)
+	}
+}
+
+func DecodeHTTPRequestAdjustmentReq(_ context.Context, req *http.Request) (interface{}, error) {
+	var adjReq AdjustmentRequest
+	if err := decodeJSONBody(req, &adjReq); err != nil {
+		return nil, err
+	}
+	adjReq.IdempotencyKey = req.Header.Get(IdempotencyKeyHeader)
+
+	return adjReq, nil
+}
+
+func MakeListAdjustmentsEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ListAdjustmentsRequest)
+		return svc.ListAdjustments(ctx, req)
+	}
+}
+
+func DecodeHTTPListAdjustmentsReq(_ context.Context, req *http.Request) (interface{}, error) {
+	var (
+		listReq ListAdjustmentsRequest
+		query   = req.URL.Query()
+		err     error
+	)
+	if acct := query.Get("account_id"); acct != "" {
+		listReq.AccountID = &acct
+	}
+	if status := query.Get("status"); status != "" {
+		s := AdjustmentStatus(status)
+		listReq.Status = &s
+	}
+	if ref := query.Get("reference"); ref != "" {
+		listReq.Reference = &ref
+	}
+	if listReq.AfterID, err = intParam(query, "after_id"); err != nil {
+		return nil, err
+	}
+	if listReq.Limit, err = limitParam(query); err != nil {
+		return nil, err
+	}
+
+	return listReq, nil
+}
+
+// adjustmentsIDPath extracts the adjustment ID from `/adjustments/{id}/...` paths
+func adjustmentsIDPath(req *http.Request) (int, error) {
+	match := rgxpAdjustmentsID.FindStringSubmatch(req.URL.Path)
+	if len(match) < 2 {
+		return 0, &errorrrs.E{
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed path: should be of `/adjustments/{id}` format with an integer ID",
+		}
+	}
+	id, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, &errorrrs.E{
+			ID:   errorrrs.BadRequest,
+			Code: errorrrs.CodeMalformedRequest,
+			Msg:  "malformed path: adjustment ID out of range",
+		}
+	}
+	return id, nil
+}
+
+func MakeGetAdjustmentEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(GetAdjustmentRequest)
+		return svc.GetAdjustment(ctx, req)
+	}
+}
+
+func DecodeHTTPGetAdjustmentReq(_ context.Context, req *http.Request) (interface{}, error) {
+	id, err := adjustmentsIDPath(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetAdjustmentRequest{ID: id}, nil
+}
+
+func MakeDecideAdjustmentEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(DecideAdjustmentRequest)
+		return svc.DecideAdjustment(ctx, req)
+	}
+}
+
+// DecodeHTTPDecideAdjustmentReq decodes both `/adjustments/{id}/approve`
+// and `/adjustments/{id}/reject` requests, whose body (a note) is optional
+func DecodeHTTPDecideAdjustmentReq(_ context.Context, req *http.Request) (interface{}, error) {
+	var decideReq DecideAdjustmentRequest
+	if req.ContentLength != 0 {
+		if err := decodeJSONBody(req, &decideReq); err != nil {
+			return nil, err
+		}
+	}
+	id, err := adjustmentsIDPath(req)
+	if err != nil {
+		return nil, err
+	}
+	decideReq.ID = id
+	decideReq.Approve = strings.HasSuffix(req.URL.Path, "/approve")
+
+	return decideReq, nil
+}
+
+func MakeFreezeAccountEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(FreezeAccountRequest)
+		return svc.FreezeAccount(ctx, req)
+	}
+}
+
+// DecodeHTTPFreezeAccountReq decodes both `/wallets/{id}/freeze`
+// and `/wallets/{id}/unfreeze` requests, which have no body
+func DecodeHTTPFreezeAccountReq(_ context.Context, req *http.Request) (interface{}, error) {
+	id, err := walletsIDPath(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return FreezeAccountRequest{
+		ID:     id,
+		Frozen: !strings.HasSuffix(req.URL.Path, "/unfreeze"),
+	}, nil
+}
+
+func MakeReconcileEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ReconcileRequest)
+		return svc.Reconcile(ctx, req)
+	}
+}
+
+func DecodeHTTPReconcileReq(_ context.Context, req *http.Request) (interface{}, error) {
+	var recReq ReconcileRequest
+	if cur := req.URL.Query().Get("currency"); cur != "" {
+		recReq.Currency = &cur
+	}
+
+	return recReq, nil
+}
+
+func MakeGetLedgerProofEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(LedgerProofRequest)
+		return svc.GetLedgerProof(ctx, req)
+	}
+}
+
+func DecodeHTTPGetLedgerProofReq(_ context.Context, req *http.Request) (interface{}, error) {
+	var proofReq LedgerProofRequest
+	id, err := intParam(req.URL.Query(), "transfer_id")
+	if err != nil {
+		return nil, err
+	}
+	if id != nil {
+		proofReq.TransferID = *id
+	}
+
+	return proofReq, nil
+}
+
+func MakeListAuditEndpt(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ListAuditRequest)
+		return svc.ListAudit(ctx, req)
+	}
+}
+
+func DecodeHTTPListAuditReq(_ context.Context, req *http.Request) (interface{}, error) {
+	var (
+		auditReq ListAuditRequest
+		query    = req.URL.Query()
+		err      error
+	)
+	if actor := query.Get("actor"); actor != "" {
+		auditReq.Actor = &actor
+	}
+	if target := query.Get("target"); target != "" {
+		auditReq.Target = &target
+	}
+	if auditReq.From, err = timeParam(query, "from"); err != nil {
+		return nil, err
+	}
+	if auditReq.To, err = timeParam(query, "to"); err != nil {
+		return nil, err
+	}
+	if auditReq.AfterID, err = intParam(query, "after_id"); err != nil {
+		return nil, err
+	}
+	if auditReq.Limit, err = limitParam(query); err != nil {
+		return nil, err
+	}
+
+	return auditReq, nil
+}
+
+// timeParam parses RFC 3339 timestamp query param `name`, zero if absent
+func timeParam(query url.Values, name string) (time.Time, error) {
+	v := query.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, &errorrrs.E{
+			ID:     errorrrs.BadRequest,
+			Code:   errorrrs.CodeValidationFailed,
+			Msg:    name + ": must be an RFC 3339 timestamp",
+			Fields: []errorrrs.FieldError{{Field: name, Msg: "must be an RFC 3339 timestamp"}},
+		}
+	}
+	return t, nil
+}
+
+// MakeHTTPHandler mounts every wallet API route on a router. Routes for the
+// API must be registered here (and not elsewhere, e.g. `main`) so that they
+// are covered by the OpenAPI document served at `/openapi.json`.
+func MakeHTTPHandler(svc Service, options ...httptransport.ServerOption) chi.Router {
+	return MakeLimitedHTTPHandler(svc, nil, options...)
+}
+
+// MakeLimitedHTTPHandler is `MakeHTTPHandler` with the endpoints of every
+// route limited by `lim` (see `Limits`)
+func MakeLimitedHTTPHandler(svc Service, lim *Limiter, options ...httptransport.ServerOption) chi.Router {
+	r := chi.NewRouter()
+
+	// The request context is populated for every route since exports read the
+	// `Accept` header and the error encoder logs the `X-Request-Id` header from it.
+	// Source IPs are recorded in the audit entries of mutations.
+	// Exports (CSV, NDJSON) of listings are served from the same routes
+	// through `Accept` header content negotiation.
+	optns := append([]httptransport.ServerOption{
+		httptransport.ServerBefore(httptransport.PopulateRequestContext, readYourWritesHTTP, apiKeyHTTP, sourceIPHTTP),
+		httptransport.ServerErrorEncoder(errorrrs.GokitErrorEncoder),
+	}, options...)
+
+	walletsIndexHandler := httptransport.NewServer(
+		lim.endpoint(MakeWalletListEndpt(svc)),
+		DecodeHTTPListAccountsReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	walletsExportHandler := httptransport.NewServer(
+		lim.endpoint(MakeWalletExportEndpt(svc)),
+		DecodeHTTPListAccountsReq,
+		EncodeExportResponse,
+		optns...,
+	)
+	walletGetHandler := httptransport.NewServer(
+		lim.endpoint(MakeWalletGetEndpt(svc)),
+		DecodeHTTPGetAccountReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	walletCreateHandler := httptransport.NewServer(
+		lim.endpoint(MakeWalletCreateEndpt(svc)),
+		DecodeHTTPCreateAccountReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	walletPaymentsIndexHandler := httptransport.NewServer(
+		lim.endpoint(MakePaymentsIndexEndpt(svc)),
+		DecodeHTTPListPaymentsReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	walletPaymentsExportHandler := httptransport.NewServer(
+		lim.endpoint(MakePaymentsExportEndpt(svc)),
+		DecodeHTTPListPaymentsReq,
+		EncodeExportResponse,
+		optns...,
+	)
+	walletPostPaymentHandler := httptransport.NewServer(
+		lim.payments(MakePaymentsPostEndpt(svc)),
+		DecodeHTTPPostPaymentsReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	statementHandler := httptransport.NewServer(
+		lim.endpoint(MakeStatementEndpt(svc)),
+		DecodeHTTPStatementReq,
+		EncodeCamt053Response,
+		optns...,
+	)
+	ledgerHandler := httptransport.NewServer(
+		lim.endpoint(MakeListTransfersEndpt(svc)),
+		DecodeHTTPListTransfersReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	ledgerExportHandler := httptransport.NewServer(
+		lim.endpoint(MakeTransfersExportEndpt(svc)),
+		DecodeHTTPListTransfersReq,
+		EncodeExportResponse,
+		optns...,
+	)
+	ledgerProofHandler := httptransport.NewServer(
+		lim.endpoint(MakeGetLedgerProofEndpt(svc)),
+		DecodeHTTPGetLedgerProofReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+
+	// admin operations, see `AuthMiddleware`
+	adjustmentRequestHandler := httptransport.NewServer(
+		lim.endpoint(MakeRequestAdjustmentEndpt(svc)),
+		DecodeHTTPRequestAdjustmentReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	adjustmentsIndexHandler := httptransport.NewServer(
+		lim.endpoint(MakeListAdjustmentsEndpt(svc)),
+		DecodeHTTPListAdjustmentsReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	adjustmentGetHandler := httptransport.NewServer(
+		lim.endpoint(MakeGetAdjustmentEndpt(svc)),
+		DecodeHTTPGetAdjustmentReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	adjustmentDecideHandler := httptransport.NewServer(
+		lim.endpoint(MakeDecideAdjustmentEndpt(svc)),
+		DecodeHTTPDecideAdjustmentReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	freezeHandler := httptransport.NewServer(
+		lim.endpoint(MakeFreezeAccountEndpt(svc)),
+		DecodeHTTPFreezeAccountReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	reconcileHandler := httptransport.NewServer(
+		lim.endpoint(MakeReconcileEndpt(svc)),
+		DecodeHTTPReconcileReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+	auditHandler := httptransport.NewServer(
+		lim.endpoint(MakeListAuditEndpt(svc)),
+		DecodeHTTPListAuditReq,
+		EncodeJSONResponse,
+		optns...,
+	)
+
+	r.Method("GET", "/wallets", NegotiateExport(walletsIndexHandler, walletsExportHandler))
+	r.Method("POST", "/wallets", walletCreateHandler)
+	r.Method("GET", "/wallets/{id}", walletGetHandler)
+	r.Method("GET", "/wallets/{id}/payments", NegotiateExport(walletPaymentsIndexHandler, walletPaymentsExportHandler))
+	r.Method("POST", "/wallets/{id}/payments", walletPostPaymentHandler)
+	r.Method("GET", "/wallets/{id}/statement.xml", statementHandler)
+	r.Method("GET", "/transfers", NegotiateExport(ledgerHandler, ledgerExportHandler))
+	r.Method("GET", "/ledger/proof", ledgerProofHandler)
+	r.Method("POST", "/adjustments", adjustmentRequestHandler)
+	r.Method("GET", "/adjustments", adjustmentsIndexHandler)
+	r.Method("GET", "/adjustments/{id}", adjustmentGetHandler)
+	r.Method("POST", "/adjustments/{id}/approve", adjustmentDecideHandler)
+	r.Method("POST", "/adjustments/{id}/reject", adjustmentDecideHandler)
+	r.Method("POST", "/wallets/{id}/freeze", freezeHandler)
+	r.Method("POST", "/wallets/{id}/unfreeze", freezeHandler)
+	r.Method("GET", "/reconciliation", reconcileHandler)
+	r.Method("GET", "/audit", auditHandler)
+	r.Method("GET", "/openapi.json", OpenAPIHandler())
+
+	return r
+}
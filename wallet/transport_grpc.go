@@ -0,0 +1,328 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/arhyth/genwallet/errorrrs"
+	"github.com/arhyth/genwallet/wallet/pb"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Go-kit grpc transport. Endpoints are the same ones served over HTTP,
+// only the request/response codecs differ.
+
+var _ pb.WalletServer = (*grpcServer)(nil)
+
+type grpcServer struct {
+	pb.UnimplementedWalletServer
+
+	svc           Service
+	lim           *Limiter
+	listAccounts  grpctransport.Handler
+	getAccount    grpctransport.Handler
+	createAccount grpctransport.Handler
+	listPayments  grpctransport.Handler
+	createPayment grpctransport.Handler
+	listTransfers grpctransport.Handler
+}
+
+// grpcBefore are the `ServerBefore` funcs of every call, streaming ones included
+var grpcBefore = []grpctransport.ServerRequestFunc{traceGRPC, readYourWritesGRPC, apiKeyGRPC, sourceIPGRPC}
+
+// NewGRPCServer makes the wallet service available as a `pb.WalletServer`
+// to be registered on a `grpc.Server`
+func NewGRPCServer(svc Service, options ...grpctransport.ServerOption) pb.WalletServer {
+	return NewLimitedGRPCServer(svc, nil, options...)
+}
+
+// NewLimitedGRPCServer is `NewGRPCServer` with every call limited
+// by `lim` (see `Limits`)
+func NewLimitedGRPCServer(svc Service, lim *Limiter, options ...grpctransport.ServerOption) pb.WalletServer {
+	options = append([]grpctransport.ServerOption{
+		grpctransport.ServerBefore(grpcBefore...),
+	}, options...)
+
+	return &grpcServer{
+		svc: svc,
+		lim: lim,
+		listAccounts: grpctransport.NewServer(
+			lim.endpoint(MakeWalletListEndpt(svc)),
+			decodeGRPCListAccountsReq,
+			encodeGRPCListAccountsResp,
+			options...,
+		),
+		getAccount: grpctransport.NewServer(
+			lim.endpoint(MakeWalletGetEndpt(svc)),
+			decodeGRPCGetAccountReq,
+			encodeGRPCAccountResp,
+			options...,
+		),
+		createAccount: grpctransport.NewServer(
+			lim.endpoint(MakeWalletCreateEndpt(svc)),
+			decodeGRPCCreateAccountReq,
+			encodeGRPCAccountResp,
+			options...,
+		),
+		listPayments: grpctransport.NewServer(
+			lim.endpoint(MakePaymentsIndexEndpt(svc)),
+			decodeGRPCListPaymentsReq,
+			encodeGRPCListPaymentsResp,
+			options...,
+		),
+		createPayment: grpctransport.NewServer(
+			lim.payments(MakePaymentsPostEndpt(svc)),
+			decodeGRPCCreatePaymentReq,
+			encodeGRPCPaymentResp,
+			options...,
+		),
+		listTransfers: grpctransport.NewServer(
+			lim.endpoint(MakeListTransfersEndpt(svc)),
+			decodeGRPCListTransfersReq,
+			encodeGRPCListTransfersResp,
+			options...,
+		),
+	}
+}
+
+func (s *grpcServer) ListAccounts(ctx context.Context, req *pb.ListAccountsRequest) (*pb.ListAccountsReply, error) {
+	_, rep, err := s.listAccounts.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errorrrs.GRPCError(err)
+	}
+	return rep.(*pb.ListAccountsReply), nil
+}
+
+func (s *grpcServer) GetAccount(ctx context.Context, req *pb.GetAccountRequest) (*pb.Account, error) {
+	_, rep, err := s.getAccount.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errorrrs.GRPCError(err)
+	}
+	return rep.(*pb.Account), nil
+}
+
+func (s *grpcServer) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.Account, error) {
+	_, rep, err := s.createAccount.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errorrrs.GRPCError(err)
+	}
+	return rep.(*pb.Account), nil
+}
+
+func (s *grpcServer) ListPayments(ctx context.Context, req *pb.ListPaymentsRequest) (*pb.ListPaymentsReply, error) {
+	_, rep, err := s.listPayments.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errorrrs.GRPCError(err)
+	}
+	return rep.(*pb.ListPaymentsReply), nil
+}
+
+func (s *grpcServer) CreatePayment(ctx context.Context, req *pb.CreatePaymentRequest) (*pb.Payment, error) {
+	_, rep, err := s.createPayment.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errorrrs.GRPCError(err)
+	}
+	return rep.(*pb.Payment), nil
+}
+
+func (s *grpcServer) ListTransfers(ctx context.Context, req *pb.ListTransfersRequest) (*pb.ListTransfersReply, error) {
+	_, rep, err := s.listTransfers.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errorrrs.GRPCError(err)
+	}
+	return rep.(*pb.ListTransfersReply), nil
+}
+
+// StreamTransfers goes straight to the service since go-kit
+// transports/endpoints have no notion of streaming. It is limited
+// all the same through an endpoint of the whole stream, and its context
+// populated by the same `grpcBefore` funcs as that of unary calls. Other
+// options of the server (e.g. further `ServerBefore` funcs) do not apply.
+func (s *grpcServer) StreamTransfers(req *pb.ListTransfersRequest, stream pb.Wallet_StreamTransfersServer) error {
+	ctx := stream.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, f := range grpcBefore {
+		ctx = f(ctx, md)
+	}
+	listReq, _ := decodeGRPCListTransfersReq(ctx, req)
+	streamEndpt := s.lim.endpoint(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, s.svc.StreamTransfers(ctx, request.(ListTransfersRequest), func(t Transfer) error {
+			return stream.Send(transferToPB(t))
+		})
+	})
+	_, err := streamEndpt(ctx, listReq)
+
+	return errorrrs.GRPCError(err)
+}
+
+func decodeGRPCListAccountsReq(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ListAccountsRequest)
+	return ListAccountsRequest{
+		Currency: req.Currency,
+		After:    req.After,
+		Limit:    int(req.Limit),
+	}, nil
+}
+
+func encodeGRPCListAccountsResp(_ context.Context, response interface{}) (interface{}, error) {
+	accts := response.([]Account)
+	rep := &pb.ListAccountsReply{Accounts: make([]*pb.Account, len(accts))}
+	for i := range accts {
+		rep.Accounts[i] = accountToPB(accts[i])
+	}
+	return rep, nil
+}
+
+func decodeGRPCGetAccountReq(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetAccountRequest)
+	return GetAccountRequest{ID: req.Id}, nil
+}
+
+func decodeGRPCCreateAccountReq(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.CreateAccountRequest)
+	return CreateAccountRequest{
+		ID:       req.Id,
+		InitAmt:  req.InitAmt,
+		Currency: req.Currency,
+		Shards:   int(req.Shards),
+		Metadata: metadataOf(req.Metadata),
+	}, nil
+}
+
+func encodeGRPCAccountResp(_ context.Context, response interface{}) (interface{}, error) {
+	return accountToPB(response.(Account)), nil
+}
+
+func decodeGRPCListPaymentsReq(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ListPaymentsRequest)
+	return ListPaymentsRequest{
+		ID:        req.Id,
+		Reference: req.Reference,
+		Metadata:  metadataOf(req.Metadata),
+		AfterID:   intOf(req.AfterId),
+		Limit:     int(req.Limit),
+	}, nil
+}
+
+func encodeGRPCListPaymentsResp(_ context.Context, response interface{}) (interface{}, error) {
+	pymts := response.([]Payment)
+	rep := &pb.ListPaymentsReply{Payments: make([]*pb.Payment, len(pymts))}
+	for i := range pymts {
+		rep.Payments[i] = paymentToPB(pymts[i])
+	}
+	return rep, nil
+}
+
+func decodeGRPCCreatePaymentReq(ctx context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.CreatePaymentRequest)
+	var key string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if vs := md.Get(IdempotencyKeyHeader); len(vs) > 0 {
+		key = vs[0]
+	}
+	return CreatePaymentRequest{
+		Self:           req.Account,
+		To:             req.ToAccount,
+		Amount:         req.Amount,
+		Description:    req.Description,
+		Reference:      req.Reference,
+		Metadata:       metadataOf(req.Metadata),
+		IdempotencyKey: key,
+	}, nil
+}
+
+func encodeGRPCPaymentResp(_ context.Context, response interface{}) (interface{}, error) {
+	return paymentToPB(response.(Payment)), nil
+}
+
+func decodeGRPCListTransfersReq(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ListTransfersRequest)
+	listReq := ListTransfersRequest{
+		Currency:  req.Currency,
+		From:      req.From,
+		To:        req.To,
+		Reference: req.Reference,
+		Metadata:  metadataOf(req.Metadata),
+		AfterID:   intOf(req.AfterId),
+		Limit:     int(req.Limit),
+	}
+
+	return listReq, nil
+}
+
+// intOf converts optional proto IDs
+func intOf(id *int64) *int {
+	if id == nil {
+		return nil
+	}
+	n := int(*id)
+	return &n
+}
+
+func encodeGRPCListTransfersResp(_ context.Context, response interface{}) (interface{}, error) {
+	trnsfrs := response.([]Transfer)
+	rep := &pb.ListTransfersReply{Transfers: make([]*pb.Transfer, len(trnsfrs))}
+	for i := range trnsfrs {
+		rep.Transfers[i] = transferToPB(trnsfrs[i])
+	}
+	return rep, nil
+}
+
+func accountToPB(a Account) *pb.Account {
+	return &pb.Account{
+		Id:        a.ID,
+		Balance:   a.Balance,
+		Currency:  a.Currency,
+		CreatedAt: timestamppb.New(a.CreatedAt),
+		UpdatedAt: timestamppb.New(a.UpdatedAt),
+		Metadata:  a.Metadata,
+		Frozen:    a.Frozen,
+		System:    a.System,
+	}
+}
+
+func paymentToPB(p Payment) *pb.Payment {
+	var dir pb.Direction
+	switch p.Direction {
+	case Incoming:
+		dir = pb.Direction_DIRECTION_INCOMING
+	case Outgoing:
+		dir = pb.Direction_DIRECTION_OUTGOING
+	}
+
+	return &pb.Payment{
+		Id:          int64(p.ID),
+		Account:     p.Self,
+		FromAccount: p.From,
+		ToAccount:   p.To,
+		Amount:      p.Amount,
+		Direction:   dir,
+		CreatedAt:   timestamppb.New(p.CreatedAt),
+		Description: p.Description,
+		Reference:   p.Reference,
+		Metadata:    p.Metadata,
+	}
+}
+
+func transferToPB(t Transfer) *pb.Transfer {
+	return &pb.Transfer{
+		Id:          int64(t.ID),
+		From:        t.From,
+		To:          t.To,
+		Currency:    t.Currency,
+		Amount:      t.Amount,
+		CreatedAt:   timestamppb.New(t.CreatedAt),
+		Description: t.Description,
+		Reference:   t.Reference,
+		Metadata:    t.Metadata,
+	}
+}
+
+// metadataOf converts protobuf maps, leaving empty ones as no metadata
+func metadataOf(m map[string]string) Metadata {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
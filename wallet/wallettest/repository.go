@@ -0,0 +1,1174 @@
+// Package wallettest provides helpers for testing implementations
+// and consumers of the `wallet` package.
+package wallettest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhyth/genwallet/wallet"
+)
+
+// RepositoryFactory returns an empty repository for a single test.
+// Implementations backed by shared storage should clear it here.
+type RepositoryFactory func(t *testing.T) wallet.Repository
+
+// RunRepositoryTests is the conformance suite of `wallet.Repository`. Every
+// implementation is expected to pass it, e.g.
+//
+//	func TestMemRepo(t *testing.T) {
+//		wallettest.RunRepositoryTests(t, func(*testing.T) wallet.Repository {
+//			return wallet.NewMemRepo()
+//		})
+//	}
+//
+// Amounts used are exactly representable as `real` (float32)
+// since that is the type of the Postgres balance column.
+func RunRepositoryTests(t *testing.T, factory RepositoryFactory) {
+	t.Run("CreateAccount", func(tt *testing.T) { testCreateAccount(tt, factory(tt)) })
+	t.Run("GetAccount", func(tt *testing.T) { testGetAccount(tt, factory(tt)) })
+	t.Run("ListAccounts", func(tt *testing.T) { testListAccounts(tt, factory(tt)) })
+	t.Run("CreateTransfer", func(tt *testing.T) { testCreateTransfer(tt, factory(tt)) })
+	t.Run("ConcurrentTransfers", func(tt *testing.T) { testConcurrentTransfers(tt, factory(tt)) })
+	t.Run("ListTransfers", func(tt *testing.T) { testListTransfers(tt, factory(tt)) })
+	t.Run("TransferMetadata", func(tt *testing.T) { testTransferMetadata(tt, factory(tt)) })
+	t.Run("IdempotencyKeys", func(tt *testing.T) { testIdempotencyKeys(tt, factory(tt)) })
+	t.Run("GetStatement", func(tt *testing.T) { testGetStatement(tt, factory(tt)) })
+	t.Run("ShardedAccount", func(tt *testing.T) { testShardedAccount(tt, factory(tt)) })
+	t.Run("Tenants", func(tt *testing.T) { testTenants(tt, factory(tt)) })
+	t.Run("Adjustments", func(tt *testing.T) { testAdjustments(tt, factory(tt)) })
+	t.Run("FreezeAccount", func(tt *testing.T) { testFreezeAccount(tt, factory(tt)) })
+	t.Run("Reconcile", func(tt *testing.T) { testReconcile(tt, factory(tt)) })
+	t.Run("Audit", func(tt *testing.T) { testAudit(tt, factory(tt)) })
+	t.Run("Ledger", func(tt *testing.T) { testLedger(tt, factory(tt)) })
+}
+
+// fixture accounts created by `seed`
+var fixture = []wallet.CreateAccountRequest{
+	{ID: "alice-123", InitAmt: 100, Currency: "USD"},
+	{ID: "bob-456", InitAmt: 50, Currency: "USD"},
+	{ID: "chen-789", InitAmt: 100, Currency: "CNY"},
+	{ID: "dana-012", InitAmt: 0, Currency: "USD"},
+}
+
+func seed(t *testing.T, repo wallet.Repository) {
+	t.Helper()
+	ctx := context.Background()
+	for _, req := range fixture {
+		_, err := repo.CreateAccount(ctx, req)
+		require.Nil(t, err, "seed account %v", req.ID)
+	}
+}
+
+func transfer(t *testing.T, repo wallet.Repository, from, to string, amt float64) wallet.Transfer {
+	t.Helper()
+	ctx := context.Background()
+	trnsfr, err := repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: from, To: to, Amount: amt})
+	require.Nil(t, err, "transfer %v -> %v", from, to)
+	return trnsfr
+}
+
+func balance(t *testing.T, repo wallet.Repository, id string) float64 {
+	t.Helper()
+	ctx := context.Background()
+	acct, err := repo.GetAccount(ctx, wallet.GetAccountRequest{ID: id})
+	require.Nil(t, err, "get account %v", id)
+	return acct.Balance
+}
+
+func testCreateAccount(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+
+	req := fixture[0]
+	acct, err := repo.CreateAccount(ctx, req)
+	reqrd.Nil(err)
+	as.Equal(req.ID, acct.ID)
+	as.Equal(req.InitAmt, acct.Balance)
+	as.Equal(req.Currency, acct.Currency)
+	as.False(acct.CreatedAt.IsZero())
+	as.False(acct.UpdatedAt.IsZero())
+
+	_, err = repo.CreateAccount(ctx, req)
+	as.True(errors.Is(err, wallet.ErrAccountExists), "duplicate ID: %v", err)
+}
+
+func testGetAccount(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+
+	acct, err := repo.GetAccount(ctx, wallet.GetAccountRequest{ID: "bob-456"})
+	reqrd.Nil(err)
+	as.Equal("bob-456", acct.ID)
+	as.Equal(50.0, acct.Balance)
+	as.Equal("USD", acct.Currency)
+
+	_, err = repo.GetAccount(ctx, wallet.GetAccountRequest{ID: "nobody-0"})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "unknown ID: %v", err)
+}
+
+func accountIDs(accts []wallet.Account) []string {
+	ids := []string{}
+	for _, a := range accts {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func testListAccounts(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+
+	accts, err := repo.ListAccounts(ctx, wallet.ListAccountsRequest{})
+	reqrd.Nil(err)
+	as.Empty(accts)
+
+	seed(t, repo)
+	usd, cny, jpy, bob := "USD", "CNY", "JPY", "bob-456"
+	cases := []struct {
+		name string
+		req  wallet.ListAccountsRequest
+		ids  []string
+	}{
+		{"all", wallet.ListAccountsRequest{}, []string{"alice-123", "bob-456", "chen-789", "dana-012"}},
+		{"USD", wallet.ListAccountsRequest{Currency: &usd}, []string{"alice-123", "bob-456", "dana-012"}},
+		{"CNY", wallet.ListAccountsRequest{Currency: &cny}, []string{"chen-789"}},
+		{"none", wallet.ListAccountsRequest{Currency: &jpy}, []string{}},
+		{"limit", wallet.ListAccountsRequest{Limit: 2}, []string{"alice-123", "bob-456"}},
+		{"after", wallet.ListAccountsRequest{After: &bob}, []string{"chen-789", "dana-012"}},
+		{"after AND currency AND limit", wallet.ListAccountsRequest{After: &bob, Currency: &usd, Limit: 1}, []string{"dana-012"}},
+	}
+	for _, c := range cases {
+		accts, err := repo.ListAccounts(ctx, c.req)
+		reqrd.Nil(err, c.name)
+		as.Equal(c.ids, accountIDs(accts), c.name)
+
+		var streamed []wallet.Account
+		err = repo.StreamAccounts(ctx, c.req, func(a wallet.Account) error {
+			streamed = append(streamed, a)
+			return nil
+		})
+		reqrd.Nil(err, c.name)
+		as.Equal(c.ids, accountIDs(streamed), "stream %v", c.name)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = repo.StreamAccounts(ctx, wallet.ListAccountsRequest{}, func(wallet.Account) error {
+		n++
+		return stop
+	})
+	as.Equal(stop, err, "stream returns the func's error as is")
+	as.Equal(1, n, "stream stops at the first error")
+}
+
+func testCreateTransfer(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+
+	trnsfr, err := repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 30})
+	reqrd.Nil(err)
+	as.Equal("alice-123", trnsfr.From)
+	as.Equal("bob-456", trnsfr.To)
+	as.Equal(30.0, trnsfr.Amount)
+	as.Equal("USD", trnsfr.Currency)
+	as.False(trnsfr.CreatedAt.IsZero())
+	as.Equal(70.0, balance(t, repo, "alice-123"))
+	as.Equal(80.0, balance(t, repo, "bob-456"))
+
+	// the whole balance can be transferred
+	transfer(t, repo, "bob-456", "dana-012", 80)
+	as.Equal(0.0, balance(t, repo, "bob-456"))
+
+	errCases := []struct {
+		name string
+		req  wallet.CreateTransferRequest
+		err  error
+	}{
+		{"unknown payer", wallet.CreateTransferRequest{From: "nobody-0", To: "bob-456", Amount: 1}, wallet.ErrAccountNotFound},
+		{"unknown payee", wallet.CreateTransferRequest{From: "alice-123", To: "nobody-0", Amount: 1}, wallet.ErrAccountNotFound},
+		{"currency mismatch", wallet.CreateTransferRequest{From: "alice-123", To: "chen-789", Amount: 1}, wallet.ErrCurrencyMismatch},
+		{"insufficient funds", wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 70.5}, wallet.ErrInsufficientFunds},
+		{"empty balance", wallet.CreateTransferRequest{From: "bob-456", To: "alice-123", Amount: 0.5}, wallet.ErrInsufficientFunds},
+	}
+	for _, c := range errCases {
+		_, err := repo.CreateTransfer(ctx, c.req)
+		as.True(errors.Is(err, c.err), "%v: %v", c.name, err)
+	}
+
+	// failed transfers change nothing
+	as.Equal(70.0, balance(t, repo, "alice-123"))
+	as.Equal(0.0, balance(t, repo, "bob-456"))
+	as.Equal(100.0, balance(t, repo, "chen-789"))
+	trnsfrs, err := repo.ListTransfers(ctx, wallet.ListTransfersRequest{})
+	reqrd.Nil(err)
+	as.Len(trnsfrs, 2)
+}
+
+// testConcurrentTransfers fires transfers back and forth between accounts
+// concurrently. Implementations may fail some of them (e.g. on serialization
+// failures) but every successful one must be reflected exactly once.
+func testConcurrentTransfers(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+
+	ids := []string{"alice-123", "bob-456", "dana-012"}
+	const workers = 8
+	const perWorker = 25
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		committed []wallet.Transfer
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				from := ids[(w+i)%len(ids)]
+				to := ids[(w+i+1)%len(ids)]
+				trnsfr, err := repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: from, To: to, Amount: 5})
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				committed = append(committed, trnsfr)
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	expected := map[string]float64{}
+	var total float64
+	for _, req := range fixture {
+		if req.Currency == "USD" {
+			expected[req.ID] = req.InitAmt
+			total += req.InitAmt
+		}
+	}
+	for _, trnsfr := range committed {
+		expected[trnsfr.From] -= trnsfr.Amount
+		expected[trnsfr.To] += trnsfr.Amount
+	}
+
+	var actual float64
+	for _, id := range ids {
+		bal := balance(t, repo, id)
+		as.GreaterOrEqual(bal, 0.0, id)
+		as.Equal(expected[id], bal, id)
+		actual += bal
+	}
+	as.Equal(total, actual, "total balance is preserved")
+
+	listed, err := repo.ListTransfers(ctx, wallet.ListTransfersRequest{})
+	reqrd.Nil(err)
+	as.Len(listed, len(committed), "every committed transfer is listed once")
+}
+
+func transferIDs(trnsfrs []wallet.Transfer) []int {
+	ids := []int{}
+	for _, t := range trnsfrs {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func testListTransfers(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+	_, err := repo.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "chao-345", InitAmt: 10, Currency: "CNY"})
+	reqrd.Nil(err)
+
+	ab := transfer(t, repo, "alice-123", "bob-456", 10)
+	bd := transfer(t, repo, "bob-456", "dana-012", 5)
+	cc := transfer(t, repo, "chen-789", "chao-345", 20)
+	da := transfer(t, repo, "dana-012", "alice-123", 1)
+	as.True(ab.ID < bd.ID && bd.ID < cc.ID && cc.ID < da.ID, "transfer IDs increase")
+
+	alice, bob, usd, cny := "alice-123", "bob-456", "USD", "CNY"
+	afterBD := bd.ID
+	cases := []struct {
+		name string
+		req  wallet.ListTransfersRequest
+		want []wallet.Transfer
+	}{
+		{"all", wallet.ListTransfersRequest{}, []wallet.Transfer{ab, bd, cc, da}},
+		{"from", wallet.ListTransfersRequest{From: &alice}, []wallet.Transfer{ab}},
+		{"to", wallet.ListTransfersRequest{To: &alice}, []wallet.Transfer{da}},
+		{"from OR to", wallet.ListTransfersRequest{From: &alice, To: &alice}, []wallet.Transfer{ab, da}},
+		{"from OR other to", wallet.ListTransfersRequest{From: &alice, To: &bob}, []wallet.Transfer{ab}},
+		{"currency", wallet.ListTransfersRequest{Currency: &cny}, []wallet.Transfer{cc}},
+		{"currency AND party", wallet.ListTransfersRequest{Currency: &usd, To: &bob}, []wallet.Transfer{ab}},
+		{"currency AND no party", wallet.ListTransfersRequest{Currency: &cny, From: &bob}, []wallet.Transfer{}},
+		{"after ID", wallet.ListTransfersRequest{AfterID: &afterBD}, []wallet.Transfer{cc, da}},
+		{"after ID AND party", wallet.ListTransfersRequest{AfterID: &afterBD, To: &alice}, []wallet.Transfer{da}},
+		{"limit", wallet.ListTransfersRequest{Limit: 2}, []wallet.Transfer{ab, bd}},
+		{"after ID AND limit", wallet.ListTransfersRequest{AfterID: &afterBD, Limit: 1}, []wallet.Transfer{cc}},
+		{"party AND limit", wallet.ListTransfersRequest{From: &alice, To: &alice, Limit: 1}, []wallet.Transfer{ab}},
+	}
+	for _, c := range cases {
+		trnsfrs, err := repo.ListTransfers(ctx, c.req)
+		reqrd.Nil(err, c.name)
+		as.Equal(transferIDs(c.want), transferIDs(trnsfrs), c.name)
+
+		var streamed []wallet.Transfer
+		err = repo.StreamTransfers(ctx, c.req, func(t wallet.Transfer) error {
+			streamed = append(streamed, t)
+			return nil
+		})
+		reqrd.Nil(err, c.name)
+		as.Equal(transferIDs(c.want), transferIDs(streamed), "stream %v", c.name)
+	}
+
+	trnsfrs, err := repo.ListTransfers(ctx, wallet.ListTransfersRequest{From: &alice})
+	reqrd.Nil(err)
+	reqrd.Len(trnsfrs, 1)
+	as.Equal(ab.From, trnsfrs[0].From)
+	as.Equal(ab.To, trnsfrs[0].To)
+	as.Equal(ab.Amount, trnsfrs[0].Amount)
+	as.Equal(ab.Currency, trnsfrs[0].Currency)
+	as.True(ab.CreatedAt.Equal(trnsfrs[0].CreatedAt))
+}
+
+func testTransferMetadata(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+
+	acct, err := repo.CreateAccount(ctx, wallet.CreateAccountRequest{
+		ID:       "erin-345",
+		Currency: "USD",
+		Metadata: wallet.Metadata{"customer_id": "c-42"},
+	})
+	reqrd.Nil(err)
+	as.Equal(wallet.Metadata{"customer_id": "c-42"}, acct.Metadata)
+	acct, err = repo.GetAccount(ctx, wallet.GetAccountRequest{ID: "erin-345"})
+	reqrd.Nil(err)
+	as.Equal(wallet.Metadata{"customer_id": "c-42"}, acct.Metadata)
+	acct, err = repo.GetAccount(ctx, wallet.GetAccountRequest{ID: "alice-123"})
+	reqrd.Nil(err)
+	as.Nil(acct.Metadata, "no metadata")
+
+	req := wallet.CreateTransferRequest{
+		From:        "alice-123",
+		To:          "bob-456",
+		Amount:      10,
+		Description: "order #1234",
+		Reference:   "ord-1234",
+		Metadata:    wallet.Metadata{"order_id": "1234", "channel": "web"},
+	}
+	ab, err := repo.CreateTransfer(ctx, req)
+	reqrd.Nil(err)
+	as.Equal(req.Description, ab.Description)
+	as.Equal(req.Reference, ab.Reference)
+	as.Equal(req.Metadata, ab.Metadata)
+
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{
+		From: "alice-123", To: "dana-012", Amount: 1, Reference: "ord-1234",
+	})
+	as.True(errors.Is(err, wallet.ErrDuplicateReference), "reused reference: %v", err)
+	as.Equal(90.0, balance(t, repo, "alice-123"), "rejected transfer is not booked")
+
+	// references are unique per payer only
+	bd, err := repo.CreateTransfer(ctx, wallet.CreateTransferRequest{
+		From: "bob-456", To: "dana-012", Amount: 5, Reference: "ord-1234",
+		Metadata: wallet.Metadata{"order_id": "5678", "channel": "web"},
+	})
+	reqrd.Nil(err)
+	da := transfer(t, repo, "dana-012", "alice-123", 1)
+
+	trnsfrs, err := repo.ListTransfers(ctx, wallet.ListTransfersRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(trnsfrs, 3)
+	as.Equal(req.Description, trnsfrs[0].Description)
+	as.Equal(req.Reference, trnsfrs[0].Reference)
+	as.Equal(req.Metadata, trnsfrs[0].Metadata)
+	as.Empty(trnsfrs[2].Reference)
+	as.Nil(trnsfrs[2].Metadata)
+
+	alice, ref, other := "alice-123", "ord-1234", "none"
+	cases := []struct {
+		name string
+		req  wallet.ListTransfersRequest
+		want []wallet.Transfer
+	}{
+		{"reference", wallet.ListTransfersRequest{Reference: &ref}, []wallet.Transfer{ab, bd}},
+		{"reference AND party", wallet.ListTransfersRequest{Reference: &ref, From: &alice}, []wallet.Transfer{ab}},
+		{"unknown reference", wallet.ListTransfersRequest{Reference: &other}, []wallet.Transfer{}},
+		{"metadata", wallet.ListTransfersRequest{Metadata: wallet.Metadata{"order_id": "5678"}}, []wallet.Transfer{bd}},
+		{"metadata pairs", wallet.ListTransfersRequest{
+			Metadata: wallet.Metadata{"order_id": "1234", "channel": "web"},
+		}, []wallet.Transfer{ab}},
+		{"metadata mismatch", wallet.ListTransfersRequest{
+			Metadata: wallet.Metadata{"order_id": "1234", "channel": "app"},
+		}, []wallet.Transfer{}},
+		{"metadata AND party", wallet.ListTransfersRequest{
+			Metadata: wallet.Metadata{"channel": "web"}, To: &alice,
+		}, []wallet.Transfer{}},
+		{"party", wallet.ListTransfersRequest{To: &alice}, []wallet.Transfer{da}},
+	}
+	for _, c := range cases {
+		trnsfrs, err := repo.ListTransfers(ctx, c.req)
+		reqrd.Nil(err, c.name)
+		as.Equal(transferIDs(c.want), transferIDs(trnsfrs), c.name)
+	}
+}
+
+func testIdempotencyKeys(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+
+	req := wallet.CreateTransferRequest{From: "bob-456", To: "alice-123", Amount: 50, IdempotencyKey: "k-1"}
+	first, err := repo.CreateTransfer(ctx, req)
+	reqrd.Nil(err)
+	as.Empty(first.Reference, "idempotency keys are not references")
+
+	// the balance no longer covers the transfer, yet its repetition
+	// returns the transfer rather than fail
+	again, err := repo.CreateTransfer(ctx, req)
+	reqrd.Nil(err)
+	as.Equal(first.ID, again.ID)
+	as.Equal(first.Amount, again.Amount)
+	as.Equal(0.0, balance(t, repo, "bob-456"))
+	as.Equal(150.0, balance(t, repo, "alice-123"))
+
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "bob-456", To: "alice-123", Amount: 1, IdempotencyKey: "k-1"})
+	as.True(errors.Is(err, wallet.ErrIdempotencyKeyReused), "other amount: %v", err)
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "bob-456", To: "dana-012", Amount: 50, IdempotencyKey: "k-1"})
+	as.True(errors.Is(err, wallet.ErrIdempotencyKeyReused), "other payee: %v", err)
+
+	// keys are unique per payer only
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 50, IdempotencyKey: "k-1"})
+	reqrd.Nil(err)
+	trnsfrs, err := repo.ListTransfers(ctx, wallet.ListTransfersRequest{})
+	reqrd.Nil(err)
+	as.Len(trnsfrs, 2)
+}
+
+func testGetStatement(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+
+	ab := transfer(t, repo, "alice-123", "bob-456", 10)
+	// make sure the transfers are booked at distinct instants
+	time.Sleep(10 * time.Millisecond)
+	ba := transfer(t, repo, "bob-456", "alice-123", 4)
+	time.Sleep(10 * time.Millisecond)
+	ad := transfer(t, repo, "alice-123", "dana-012", 20)
+
+	// whole history
+	stmt, err := repo.GetStatement(ctx, wallet.StatementRequest{
+		ID: "alice-123",
+		To: ad.CreatedAt.Add(time.Hour),
+	})
+	reqrd.Nil(err)
+	as.Equal("alice-123", stmt.Account.ID)
+	as.Equal(100.0, stmt.OpeningBalance)
+	as.Equal(74.0, stmt.ClosingBalance)
+	as.Equal(transferIDs([]wallet.Transfer{ab, ba, ad}), transferIDs(stmt.Entries))
+
+	// [ba, ad) holds only ba
+	stmt, err = repo.GetStatement(ctx, wallet.StatementRequest{
+		ID:   "alice-123",
+		From: ba.CreatedAt,
+		To:   ad.CreatedAt,
+	})
+	reqrd.Nil(err)
+	as.Equal(90.0, stmt.OpeningBalance)
+	as.Equal(94.0, stmt.ClosingBalance)
+	as.Equal(transferIDs([]wallet.Transfer{ba}), transferIDs(stmt.Entries))
+
+	// an account without transfers
+	stmt, err = repo.GetStatement(ctx, wallet.StatementRequest{
+		ID: "chen-789",
+		To: ad.CreatedAt.Add(time.Hour),
+	})
+	reqrd.Nil(err)
+	as.Equal(100.0, stmt.OpeningBalance)
+	as.Equal(100.0, stmt.ClosingBalance)
+	as.Empty(stmt.Entries)
+
+	_, err = repo.GetStatement(ctx, wallet.StatementRequest{ID: "nobody-0", To: time.Now()})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "unknown ID: %v", err)
+}
+
+// testShardedAccount checks that sharding is invisible to clients: whatever
+// the shards the balance is split across, it behaves as a single balance
+func testShardedAccount(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+
+	acct, err := repo.CreateAccount(ctx, wallet.CreateAccountRequest{
+		ID:       "merchant-1",
+		InitAmt:  10,
+		Currency: "USD",
+		Shards:   4,
+	})
+	reqrd.Nil(err)
+	as.Equal(10.0, acct.Balance)
+
+	// credits land on random shards
+	for i := 0; i < 8; i++ {
+		transfer(t, repo, "alice-123", "merchant-1", 5)
+	}
+	as.Equal(50.0, balance(t, repo, "merchant-1"))
+
+	accts, err := repo.ListAccounts(ctx, wallet.ListAccountsRequest{})
+	reqrd.Nil(err)
+	for _, a := range accts {
+		if a.ID == "merchant-1" {
+			as.Equal(50.0, a.Balance, "listed balance is the total")
+		}
+	}
+
+	// debits may span shards, up to the total balance only
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "merchant-1", To: "bob-456", Amount: 50.5})
+	as.True(errors.Is(err, wallet.ErrInsufficientFunds), "debit over total: %v", err)
+	transfer(t, repo, "merchant-1", "bob-456", 45)
+	as.Equal(5.0, balance(t, repo, "merchant-1"))
+	transfer(t, repo, "merchant-1", "dana-012", 5)
+	as.Equal(0.0, balance(t, repo, "merchant-1"))
+	as.Equal(95.0, balance(t, repo, "bob-456"))
+
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "merchant-1", To: "chen-789", Amount: 1})
+	as.True(errors.Is(err, wallet.ErrCurrencyMismatch), "currency mismatch: %v", err)
+
+	stmt, err := repo.GetStatement(ctx, wallet.StatementRequest{ID: "merchant-1", To: time.Now().Add(time.Hour)})
+	reqrd.Nil(err)
+	as.Equal(10.0, stmt.OpeningBalance)
+	as.Equal(0.0, stmt.ClosingBalance)
+	as.Len(stmt.Entries, 10)
+}
+
+// testTenants requires the repository to also implement `wallet.Tenants`
+func testTenants(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	tenants, ok := repo.(wallet.Tenants)
+	if !ok {
+		t.Skip("repository does not implement wallet.Tenants")
+	}
+	ctx := context.Background()
+	seed(t, repo)
+
+	acme, err := tenants.CreateTenant(ctx, wallet.Tenant{ID: "acme", Name: "Acme", Currencies: []string{"USD"}})
+	reqrd.Nil(err)
+	as.False(acme.CreatedAt.IsZero())
+	_, err = tenants.CreateTenant(ctx, wallet.Tenant{ID: "acme", Name: "Acme again"})
+	as.True(errors.Is(err, wallet.ErrTenantExists), "tenant exists: %v", err)
+
+	key, err := tenants.CreateAPIKey(ctx, wallet.APIKey{TenantID: "acme"})
+	reqrd.Nil(err)
+	as.NotEmpty(key.Key)
+	_, err = tenants.CreateAPIKey(ctx, wallet.APIKey{TenantID: "unknown"})
+	as.True(errors.Is(err, wallet.ErrTenantNotFound), "unknown tenant: %v", err)
+
+	p, err := tenants.Authenticate(ctx, key.Key)
+	reqrd.Nil(err)
+	as.Equal(key.ID, p.KeyID)
+	as.Equal("acme", p.Tenant.ID)
+	as.Equal([]string{"USD"}, p.Tenant.Currencies)
+	as.False(p.Admin)
+	adminKey, err := tenants.CreateAPIKey(ctx, wallet.APIKey{TenantID: "acme", Admin: true})
+	reqrd.Nil(err)
+	p, err = tenants.Authenticate(ctx, adminKey.Key)
+	reqrd.Nil(err)
+	as.True(p.Admin)
+	for _, bad := range []string{"", "gw", key.Key + "x", "gw_" + key.ID + "_secret"} {
+		_, err = tenants.Authenticate(ctx, bad)
+		as.True(errors.Is(err, wallet.ErrInvalidAPIKey), "key %q: %v", bad, err)
+	}
+
+	// account IDs are per tenant
+	acmeCtx := wallet.WithPrincipal(ctx, p)
+	for _, req := range []wallet.CreateAccountRequest{
+		{ID: "alice-123", InitAmt: 30, Currency: "USD"},
+		{ID: "zoe-678", InitAmt: 0, Currency: "USD"},
+	} {
+		_, err := repo.CreateAccount(acmeCtx, req)
+		reqrd.Nil(err, "create account %v", req.ID)
+	}
+	acct, err := repo.GetAccount(acmeCtx, wallet.GetAccountRequest{ID: "alice-123"})
+	reqrd.Nil(err)
+	as.Equal(30.0, acct.Balance)
+	as.Equal(100.0, balance(t, repo, "alice-123"), "default tenant's alice-123")
+	_, err = repo.GetAccount(acmeCtx, wallet.GetAccountRequest{ID: "bob-456"})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "other tenant's account: %v", err)
+	_, err = repo.GetAccount(ctx, wallet.GetAccountRequest{ID: "zoe-678"})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "other tenant's account: %v", err)
+
+	accts, err := repo.ListAccounts(acmeCtx, wallet.ListAccountsRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(accts, 2)
+	as.Equal("zoe-678", accts[1].ID)
+	accts, err = repo.ListAccounts(ctx, wallet.ListAccountsRequest{})
+	reqrd.Nil(err)
+	as.Len(accts, len(fixture))
+
+	// transfers across tenants are as to nonexistent accounts
+	_, err = repo.CreateTransfer(acmeCtx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 1})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "transfer to other tenant: %v", err)
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "bob-456", To: "zoe-678", Amount: 1})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "transfer to other tenant: %v", err)
+
+	_, err = repo.CreateTransfer(acmeCtx, wallet.CreateTransferRequest{
+		From: "alice-123", To: "zoe-678", Amount: 10, Reference: "ref-1",
+	})
+	reqrd.Nil(err)
+	// references are unique per payer of a tenant
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{
+		From: "alice-123", To: "bob-456", Amount: 10, Reference: "ref-1",
+	})
+	reqrd.Nil(err)
+	as.Equal(90.0, balance(t, repo, "alice-123"))
+	acct, err = repo.GetAccount(acmeCtx, wallet.GetAccountRequest{ID: "alice-123"})
+	reqrd.Nil(err)
+	as.Equal(20.0, acct.Balance)
+
+	trnsfrs, err := repo.ListTransfers(acmeCtx, wallet.ListTransfersRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(trnsfrs, 1)
+	as.Equal("zoe-678", trnsfrs[0].To)
+	trnsfrs, err = repo.ListTransfers(ctx, wallet.ListTransfersRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(trnsfrs, 1)
+	as.Equal("bob-456", trnsfrs[0].To)
+
+	stmt, err := repo.GetStatement(acmeCtx, wallet.StatementRequest{ID: "alice-123", To: time.Now().Add(time.Minute)})
+	reqrd.Nil(err)
+	reqrd.Len(stmt.Entries, 1)
+	as.Equal(30.0, stmt.OpeningBalance)
+	as.Equal(20.0, stmt.ClosingBalance)
+
+	reqrd.Nil(tenants.RevokeAPIKey(ctx, key.ID))
+	_, err = tenants.Authenticate(ctx, key.Key)
+	as.True(errors.Is(err, wallet.ErrInvalidAPIKey), "revoked key: %v", err)
+	err = tenants.RevokeAPIKey(ctx, key.ID)
+	as.True(errors.Is(err, wallet.ErrAPIKeyNotFound), "revoked twice: %v", err)
+}
+
+// maker and checker are the contexts that `adjust` requests and approves
+// adjustments in, as different actors
+var (
+	maker   = wallet.WithActor(context.Background(), "cli:maker")
+	checker = wallet.WithActor(context.Background(), "cli:checker")
+)
+
+// adjust requests an adjustment of account `id` and has it approved,
+// returning the approved adjustment or the error of the approval
+func adjust(t *testing.T, repo wallet.Repository, id string, amt float64, reason string) (wallet.Adjustment, error) {
+	t.Helper()
+	adj, err := repo.RequestAdjustment(maker, wallet.AdjustmentRequest{AccountID: id, Amount: amt, Reason: reason})
+	require.Nil(t, err, "request adjustment of %v", id)
+	return repo.DecideAdjustment(checker, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true})
+}
+
+// bookedAs is the transfer that approved adjustment `adj` was booked as
+func bookedAs(t *testing.T, repo wallet.Repository, adj wallet.Adjustment) wallet.Transfer {
+	t.Helper()
+	require.NotNil(t, adj.TransferID, "adjustment %v not booked", adj.ID)
+	after := *adj.TransferID - 1
+	trnsfrs, err := repo.ListTransfers(context.Background(), wallet.ListTransfersRequest{AfterID: &after, Limit: 1})
+	require.Nil(t, err)
+	require.Len(t, trnsfrs, 1)
+	return trnsfrs[0]
+}
+
+func testAdjustments(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	seed(t, repo)
+	suspense := wallet.SuspenseAccountID("USD")
+
+	// adjustments are only booked once approved by another actor
+	req := wallet.AdjustmentRequest{
+		AccountID:   "dana-012",
+		Amount:      25,
+		Reason:      "goodwill",
+		Reference:   "ticket-42",
+		Attachments: []string{"https://tickets.example.com/42", "https://tickets.example.com/42/chat"},
+	}
+	adj, err := repo.RequestAdjustment(maker, req)
+	reqrd.Nil(err)
+	as.Equal(wallet.AdjustmentPending, adj.Status)
+	as.Equal("dana-012", adj.AccountID)
+	as.Equal(25.0, adj.Amount)
+	as.Equal("goodwill", adj.Reason)
+	as.Equal("ticket-42", adj.Reference)
+	as.Equal(req.Attachments, adj.Attachments)
+	as.Equal("cli:maker", adj.RequestedBy)
+	as.Nil(adj.DecidedAt)
+	as.Nil(adj.TransferID)
+	as.Equal(0.0, balance(t, repo, "dana-012"))
+	_, err = repo.RequestAdjustment(maker, req)
+	as.True(errors.Is(err, wallet.ErrDuplicateReference), "duplicate reference: %v", err)
+
+	_, err = repo.DecideAdjustment(maker, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true})
+	as.True(errors.Is(err, wallet.ErrSelfApproval), "approved by requester: %v", err)
+	_, err = repo.DecideAdjustment(context.Background(), wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true})
+	as.True(errors.Is(err, wallet.ErrSelfApproval), "approved anonymously: %v", err)
+	as.Equal(0.0, balance(t, repo, "dana-012"))
+
+	approved, err := repo.DecideAdjustment(checker, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true, Note: "ok"})
+	reqrd.Nil(err)
+	as.Equal(wallet.AdjustmentApproved, approved.Status)
+	as.Equal("cli:checker", approved.DecidedBy)
+	as.Equal("ok", approved.Note)
+	reqrd.NotNil(approved.DecidedAt)
+	credit := bookedAs(t, repo, approved)
+	as.Equal(suspense, credit.From)
+	as.Equal("dana-012", credit.To)
+	as.Equal(25.0, credit.Amount)
+	as.Equal("goodwill", credit.Description)
+	as.Equal(25.0, balance(t, repo, "dana-012"))
+	got, err := repo.GetAdjustment(maker, wallet.GetAdjustmentRequest{ID: adj.ID})
+	reqrd.Nil(err)
+	as.Equal(approved.Status, got.Status)
+	as.Equal(approved.TransferID, got.TransferID)
+	_, err = repo.DecideAdjustment(checker, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true})
+	as.True(errors.Is(err, wallet.ErrAdjustmentDecided), "approved twice: %v", err)
+	_, err = repo.DecideAdjustment(maker, wallet.DecideAdjustmentRequest{ID: adj.ID})
+	as.True(errors.Is(err, wallet.ErrAdjustmentDecided), "rejected once approved: %v", err)
+	as.Equal(25.0, balance(t, repo, "dana-012"))
+
+	// suspense accounts go negative, regular ones do not
+	acct, err := repo.GetAccount(maker, wallet.GetAccountRequest{ID: suspense})
+	reqrd.Nil(err)
+	as.True(acct.System)
+	as.Equal(-25.0, acct.Balance)
+	debit, err := adjust(t, repo, "bob-456", -20, "correction")
+	reqrd.Nil(err)
+	trnsfr := bookedAs(t, repo, debit)
+	as.Equal("bob-456", trnsfr.From)
+	as.Equal(suspense, trnsfr.To)
+	as.Equal(20.0, trnsfr.Amount)
+	as.Equal(30.0, balance(t, repo, "bob-456"))
+	as.Equal(-5.0, balance(t, repo, suspense))
+	_, err = adjust(t, repo, "bob-456", -31, "correction")
+	as.True(errors.Is(err, wallet.ErrInsufficientFunds), "debit over balance: %v", err)
+
+	// rejected (e.g. withdrawn) adjustments are never booked
+	withdrawn, err := repo.RequestAdjustment(maker, wallet.AdjustmentRequest{AccountID: "bob-456", Amount: 5, Reason: "goodwill"})
+	reqrd.Nil(err)
+	withdrawn, err = repo.DecideAdjustment(maker, wallet.DecideAdjustmentRequest{ID: withdrawn.ID, Note: "wrong account"})
+	reqrd.Nil(err)
+	as.Equal(wallet.AdjustmentRejected, withdrawn.Status)
+	as.Equal("cli:maker", withdrawn.DecidedBy)
+	as.Nil(withdrawn.TransferID)
+	_, err = repo.DecideAdjustment(checker, wallet.DecideAdjustmentRequest{ID: withdrawn.ID, Approve: true})
+	as.True(errors.Is(err, wallet.ErrAdjustmentDecided), "approved once rejected: %v", err)
+	as.Equal(30.0, balance(t, repo, "bob-456"))
+
+	// suspense accounts are per currency
+	_, err = adjust(t, repo, "chen-789", 1, "goodwill")
+	reqrd.Nil(err)
+	as.Equal(-1.0, balance(t, repo, wallet.SuspenseAccountID("CNY")))
+
+	_, err = repo.RequestAdjustment(maker, wallet.AdjustmentRequest{AccountID: "nobody-0", Amount: 1, Reason: "goodwill"})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "unknown account: %v", err)
+	_, err = repo.RequestAdjustment(maker, wallet.AdjustmentRequest{AccountID: suspense, Amount: 1, Reason: "goodwill"})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "adjusting suspense account: %v", err)
+	_, err = repo.GetAdjustment(maker, wallet.GetAdjustmentRequest{ID: 1000})
+	as.True(errors.Is(err, wallet.ErrAdjustmentNotFound), "unknown adjustment: %v", err)
+	_, err = repo.DecideAdjustment(checker, wallet.DecideAdjustmentRequest{ID: 1000, Approve: true})
+	as.True(errors.Is(err, wallet.ErrAdjustmentNotFound), "deciding unknown adjustment: %v", err)
+
+	adjs, err := repo.ListAdjustments(maker, wallet.ListAdjustmentsRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(adjs, 5)
+	for i := 1; i < len(adjs); i++ {
+		as.Greater(adjs[i].ID, adjs[i-1].ID, "IDs ascend")
+	}
+	bob, pending, rejected := "bob-456", wallet.AdjustmentPending, wallet.AdjustmentRejected
+	adjs, err = repo.ListAdjustments(maker, wallet.ListAdjustmentsRequest{AccountID: &bob})
+	reqrd.Nil(err)
+	as.Len(adjs, 3)
+	adjs, err = repo.ListAdjustments(maker, wallet.ListAdjustmentsRequest{Status: &pending})
+	reqrd.Nil(err)
+	reqrd.Len(adjs, 1)
+	as.Equal(-31.0, adjs[0].Amount, "failed approvals leave adjustments pending")
+	adjs, err = repo.ListAdjustments(maker, wallet.ListAdjustmentsRequest{AccountID: &bob, Status: &rejected})
+	reqrd.Nil(err)
+	reqrd.Len(adjs, 1)
+	as.Equal(withdrawn.ID, adjs[0].ID)
+	adjs, err = repo.ListAdjustments(maker, wallet.ListAdjustmentsRequest{Reference: &req.Reference})
+	reqrd.Nil(err)
+	reqrd.Len(adjs, 1)
+	adjs, err = repo.ListAdjustments(maker, wallet.ListAdjustmentsRequest{AfterID: &adj.ID, Limit: 2})
+	reqrd.Nil(err)
+	reqrd.Len(adjs, 2)
+	as.Equal(debit.ID, adjs[0].ID)
+	as.Equal(-31.0, adjs[1].Amount)
+
+	// requests repeated with the idempotency key of one return its adjustment
+	keyed := wallet.AdjustmentRequest{AccountID: "dana-012", Amount: 1, Reason: "goodwill", IdempotencyKey: "k-1"}
+	first, err := repo.RequestAdjustment(maker, keyed)
+	reqrd.Nil(err)
+	as.Empty(first.Reference, "idempotency keys are not references")
+	again, err := repo.RequestAdjustment(maker, keyed)
+	reqrd.Nil(err)
+	as.Equal(first.ID, again.ID)
+	keyed.Amount = 2
+	_, err = repo.RequestAdjustment(maker, keyed)
+	as.True(errors.Is(err, wallet.ErrIdempotencyKeyReused), "other amount: %v", err)
+
+	// system accounts take no part in payments
+	ctx := context.Background()
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: suspense, To: "alice-123", Amount: 1})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "payment from suspense account: %v", err)
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: suspense, Amount: 1})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "payment to suspense account: %v", err)
+}
+
+func testFreezeAccount(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+
+	acct, err := repo.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: "bob-456", Frozen: true})
+	reqrd.Nil(err)
+	as.True(acct.Frozen)
+	as.Equal(50.0, acct.Balance)
+	acct, err = repo.GetAccount(ctx, wallet.GetAccountRequest{ID: "bob-456"})
+	reqrd.Nil(err)
+	as.True(acct.Frozen)
+
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "bob-456", To: "alice-123", Amount: 1})
+	as.True(errors.Is(err, wallet.ErrAccountFrozen), "payment from frozen account: %v", err)
+	_, err = repo.CreateTransfer(ctx, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 1})
+	as.True(errors.Is(err, wallet.ErrAccountFrozen), "payment to frozen account: %v", err)
+	as.Equal(100.0, balance(t, repo, "alice-123"))
+
+	// adjustments go through
+	_, err = adjust(t, repo, "bob-456", 5, "goodwill")
+	reqrd.Nil(err)
+
+	acct, err = repo.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: "bob-456", Frozen: false})
+	reqrd.Nil(err)
+	as.False(acct.Frozen)
+	as.Equal(55.0, acct.Balance)
+	transfer(t, repo, "bob-456", "alice-123", 1)
+
+	_, err = repo.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: "nobody-0", Frozen: true})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "unknown account: %v", err)
+	_, err = repo.FreezeAccount(ctx, wallet.FreezeAccountRequest{ID: wallet.SuspenseAccountID("USD"), Frozen: true})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "suspense account: %v", err)
+}
+
+func testReconcile(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ctx := context.Background()
+	seed(t, repo)
+	_, err := repo.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "merchant-1", InitAmt: 10, Currency: "USD", Shards: 4})
+	reqrd.Nil(err)
+
+	transfer(t, repo, "alice-123", "bob-456", 10)
+	transfer(t, repo, "bob-456", "merchant-1", 5)
+	transfer(t, repo, "merchant-1", "dana-012", 12)
+	_, err = adjust(t, repo, "chen-789", -40, "correction")
+	reqrd.Nil(err)
+
+	recs, err := repo.Reconcile(ctx, wallet.ReconcileRequest{})
+	reqrd.Nil(err)
+	ids := []string{}
+	for _, rec := range recs {
+		ids = append(ids, rec.ID)
+		as.Equal(rec.Balance, rec.Expected, rec.ID)
+		as.Equal(balance(t, repo, rec.ID), rec.Balance, rec.ID)
+	}
+	as.Equal([]string{wallet.SuspenseAccountID("CNY"), "alice-123", "bob-456", "chen-789", "dana-012", "merchant-1"}, ids)
+
+	usd := "USD"
+	recs, err = repo.Reconcile(ctx, wallet.ReconcileRequest{Currency: &usd})
+	reqrd.Nil(err)
+	as.Len(recs, 4)
+}
+
+// payloadHash is the `PayloadHash` of audit entries of request `req`
+func payloadHash(t *testing.T, req interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(req)
+	require.Nil(t, err)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func testAudit(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ops := wallet.WithSourceIP(wallet.WithActor(context.Background(), "cli:ops"), "192.0.2.7")
+	ctx := context.Background()
+	start := time.Now().Add(-time.Minute)
+
+	createReq := wallet.CreateAccountRequest{ID: "alice-123", InitAmt: 100, Currency: "USD"}
+	_, err := repo.CreateAccount(ctx, createReq)
+	reqrd.Nil(err)
+	_, err = repo.CreateAccount(ctx, createReq)
+	as.True(errors.Is(err, wallet.ErrAccountExists), "account exists: %v", err)
+	_, err = repo.CreateAccount(ctx, wallet.CreateAccountRequest{ID: "bob-456", Currency: "USD"})
+	reqrd.Nil(err)
+	pymtReq := wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 10, Reference: "order-1"}
+	_, err = repo.CreateTransfer(ctx, pymtReq)
+	reqrd.Nil(err)
+	_, err = repo.CreateTransfer(ctx, pymtReq)
+	as.True(errors.Is(err, wallet.ErrDuplicateReference), "duplicate reference: %v", err)
+	adjReq := wallet.AdjustmentRequest{AccountID: "bob-456", Amount: -2.5, Reason: "fee"}
+	adj, err := repo.RequestAdjustment(ops, adjReq)
+	reqrd.Nil(err)
+	_, err = repo.DecideAdjustment(ops, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true})
+	as.True(errors.Is(err, wallet.ErrSelfApproval), "self approval: %v", err)
+	_, err = repo.DecideAdjustment(checker, wallet.DecideAdjustmentRequest{ID: adj.ID, Approve: true})
+	reqrd.Nil(err)
+	_, err = repo.FreezeAccount(ops, wallet.FreezeAccountRequest{ID: "bob-456", Frozen: true})
+	reqrd.Nil(err)
+	_, err = repo.FreezeAccount(ops, wallet.FreezeAccountRequest{ID: "nobody-0", Frozen: true})
+	as.True(errors.Is(err, wallet.ErrAccountNotFound), "unknown account: %v", err)
+
+	entries, err := repo.ListAudit(ctx, wallet.ListAuditRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(entries, 10)
+	type call struct{ actor, action, target, outcome, ip string }
+	calls := make([]call, len(entries))
+	for i, e := range entries {
+		calls[i] = call{e.Actor, e.Action, e.Target, e.Outcome, e.SourceIP}
+		if i > 0 {
+			as.Greater(e.ID, entries[i-1].ID, "IDs ascend")
+		}
+		as.True(e.At.After(start), "at: %v", e.At)
+	}
+	as.Equal([]call{
+		{wallet.AnonymousActor, wallet.AuditCreateAccount, "alice-123", wallet.AuditOutcomeOK, ""},
+		{wallet.AnonymousActor, wallet.AuditCreateAccount, "alice-123", "account_exists", ""},
+		{wallet.AnonymousActor, wallet.AuditCreateAccount, "bob-456", wallet.AuditOutcomeOK, ""},
+		{wallet.AnonymousActor, wallet.AuditCreatePayment, "alice-123", wallet.AuditOutcomeOK, ""},
+		{wallet.AnonymousActor, wallet.AuditCreatePayment, "alice-123", "duplicate_reference", ""},
+		{"cli:ops", wallet.AuditRequestAdjustment, "bob-456", wallet.AuditOutcomeOK, "192.0.2.7"},
+		{"cli:ops", wallet.AuditApproveAdjustment, "bob-456", "self_approval", "192.0.2.7"},
+		{"cli:checker", wallet.AuditApproveAdjustment, "bob-456", wallet.AuditOutcomeOK, ""},
+		{"cli:ops", wallet.AuditFreezeAccount, "bob-456", wallet.AuditOutcomeOK, "192.0.2.7"},
+		{"cli:ops", wallet.AuditFreezeAccount, "nobody-0", "account_not_found", "192.0.2.7"},
+	}, calls)
+	as.Equal(payloadHash(t, createReq), entries[0].PayloadHash)
+	as.Equal(entries[0].PayloadHash, entries[1].PayloadHash, "same request")
+	as.Equal(payloadHash(t, pymtReq), entries[3].PayloadHash)
+	as.Equal(payloadHash(t, adjReq), entries[5].PayloadHash)
+
+	bob := "bob-456"
+	entries, err = repo.ListAudit(ctx, wallet.ListAuditRequest{Target: &bob})
+	reqrd.Nil(err)
+	as.Len(entries, 5)
+	actor := "cli:ops"
+	entries, err = repo.ListAudit(ctx, wallet.ListAuditRequest{Actor: &actor, Limit: 2})
+	reqrd.Nil(err)
+	reqrd.Len(entries, 2)
+	as.Equal(wallet.AuditRequestAdjustment, entries[0].Action)
+	entries, err = repo.ListAudit(ctx, wallet.ListAuditRequest{Actor: &actor, AfterID: &entries[1].ID})
+	reqrd.Nil(err)
+	reqrd.Len(entries, 2)
+	as.Equal("nobody-0", entries[1].Target)
+	entries, err = repo.ListAudit(ctx, wallet.ListAuditRequest{From: time.Now().Add(time.Minute)})
+	reqrd.Nil(err)
+	as.Empty(entries)
+	entries, err = repo.ListAudit(ctx, wallet.ListAuditRequest{To: start})
+	reqrd.Nil(err)
+	as.Empty(entries)
+
+	tenants, ok := repo.(wallet.Tenants)
+	if !ok {
+		return
+	}
+
+	// entries are of the tenant of the call
+	_, err = tenants.CreateTenant(ops, wallet.Tenant{ID: "acme", Name: "Acme"})
+	reqrd.Nil(err)
+	acme := wallet.WithPrincipal(ctx, wallet.Principal{KeyID: "k1", Tenant: wallet.Tenant{ID: "acme"}})
+	_, err = repo.CreateAccount(acme, wallet.CreateAccountRequest{ID: "alice-123", Currency: "USD"})
+	reqrd.Nil(err)
+	entries, err = repo.ListAudit(acme, wallet.ListAuditRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(entries, 2)
+	as.Equal(wallet.AuditCreateTenant, entries[0].Action)
+	as.Equal("apikey:k1", entries[1].Actor)
+	entries, err = repo.ListAudit(ctx, wallet.ListAuditRequest{})
+	reqrd.Nil(err)
+	as.Len(entries, 10)
+
+	_, err = tenants.CreateTenant(ops, wallet.Tenant{ID: "initech", Name: "Initech"})
+	reqrd.Nil(err)
+	key, err := tenants.CreateAPIKey(ops, wallet.APIKey{TenantID: "initech"})
+	reqrd.Nil(err)
+	reqrd.Nil(tenants.RevokeAPIKey(ops, key.ID))
+	as.True(errors.Is(tenants.RevokeAPIKey(ops, key.ID), wallet.ErrAPIKeyNotFound))
+	initech := wallet.WithPrincipal(ctx, wallet.Principal{Tenant: wallet.Tenant{ID: "initech"}})
+	entries, err = repo.ListAudit(initech, wallet.ListAuditRequest{})
+	reqrd.Nil(err)
+	reqrd.Len(entries, 3)
+	as.Equal(wallet.AuditCreateTenant, entries[0].Action)
+	as.Equal(wallet.AuditCreateAPIKey, entries[1].Action)
+	as.Equal(wallet.AuditRevokeAPIKey, entries[2].Action)
+	as.Equal(key.ID, entries[2].Target)
+	// the second revocation is of a key that is as good as nonexistent,
+	// so it is of the tenant of the call
+	entries, err = repo.ListAudit(ctx, wallet.ListAuditRequest{Target: &key.ID})
+	reqrd.Nil(err)
+	reqrd.Len(entries, 1)
+	as.Equal("api_key_not_found", entries[0].Outcome)
+}
+
+func ledgerKey(t *testing.T) (wallet.LedgerSigner, ed25519.PublicKey) {
+	t.Helper()
+	seed, public, err := wallet.GenerateLedgerKey()
+	require.Nil(t, err)
+	signer, err := wallet.ParseLedgerSigner(seed)
+	require.Nil(t, err)
+	key, err := wallet.ParseLedgerPublicKey(public)
+	require.Nil(t, err)
+	require.Equal(t, key, signer.PublicKey())
+	return signer, key
+}
+
+func testLedger(t *testing.T, repo wallet.Repository) {
+	as := assert.New(t)
+	reqrd := require.New(t)
+	ledger, ok := repo.(wallet.Ledger)
+	if !ok {
+		t.Skip("repository does not implement wallet.Ledger")
+	}
+	ctx := context.Background()
+	signer, key := ledgerKey(t)
+	_, otherKey := ledgerKey(t)
+	seed(t, repo)
+
+	t1 := transfer(t, repo, "alice-123", "bob-456", 10)
+	t2 := transfer(t, repo, "bob-456", "dana-012", 2.5)
+	_, err := repo.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: t1.ID})
+	as.True(errors.Is(err, wallet.ErrTransferPending), "not chained yet: %v", err)
+	vs, err := ledger.VerifyLedger(ctx, nil)
+	reqrd.Nil(err)
+	as.Equal([]wallet.LedgerVerification{{TenantID: wallet.DefaultTenantID, Pending: 2}}, vs)
+	chained, err := ledger.ChainLedger(ctx)
+	reqrd.Nil(err)
+	as.Equal(2, chained)
+	chained, err = ledger.ChainLedger(ctx)
+	reqrd.Nil(err)
+	as.Zero(chained, "nothing pending")
+	proof, err := repo.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: t1.ID})
+	reqrd.Nil(err)
+	as.Equal(wallet.DefaultTenantID, proof.TenantID)
+	as.Equal(t1.ID, proof.Transfer.ID)
+	as.Equal(10.0, proof.Transfer.Amount)
+	as.Empty(proof.Transfer.PrevHash, "first of the chain")
+	as.NotEmpty(proof.Transfer.Hash)
+	as.Nil(proof.Checkpoint)
+	as.True(errors.Is(proof.Verify(key), wallet.ErrNotCheckpointed), "not checkpointed yet")
+
+	cps, err := ledger.CheckpointLedger(ctx, signer)
+	reqrd.Nil(err)
+	reqrd.Len(cps, 1)
+	as.Equal(wallet.DefaultTenantID, cps[0].TenantID)
+	as.Equal(t2.ID, cps[0].TransferID)
+	cps, err = ledger.CheckpointLedger(ctx, signer)
+	reqrd.Nil(err)
+	as.Empty(cps, "nothing moved since")
+
+	t3 := transfer(t, repo, "alice-123", "dana-012", 1)
+	_, err = ledger.ChainLedger(ctx)
+	reqrd.Nil(err)
+	proof, err = repo.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: t1.ID})
+	reqrd.Nil(err)
+	reqrd.NotNil(proof.Checkpoint)
+	as.Equal(t2.ID, proof.Checkpoint.TransferID)
+	reqrd.Len(proof.Links, 1)
+	as.Equal(t2.ID, proof.Links[0].TransferID)
+	as.Nil(proof.Verify(key))
+	as.NotNil(proof.Verify(otherKey), "signed by another key")
+	t2Proof, err := repo.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: t2.ID})
+	reqrd.Nil(err)
+	as.Empty(t2Proof.Links)
+	as.Nil(t2Proof.Verify(key))
+	as.Equal(proof.Transfer.Hash, t2Proof.Transfer.PrevHash)
+	proof, err = repo.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: t3.ID})
+	reqrd.Nil(err)
+	as.Equal(t2Proof.Transfer.Hash, proof.Transfer.PrevHash)
+	as.Nil(proof.Checkpoint)
+	_, err = repo.GetLedgerProof(ctx, wallet.LedgerProofRequest{TransferID: t3.ID + 100})
+	as.True(errors.Is(err, wallet.ErrTransferNotFound), "unknown transfer: %v", err)
+
+	vs, err = ledger.VerifyLedger(ctx, []ed25519.PublicKey{otherKey, key})
+	reqrd.Nil(err)
+	reqrd.Len(vs, 1)
+	as.Equal(wallet.LedgerVerification{TenantID: wallet.DefaultTenantID, Verified: 3, Checkpoints: 1}, vs[0])
+	vs, err = ledger.VerifyLedger(ctx, []ed25519.PublicKey{otherKey}, wallet.DefaultTenantID)
+	reqrd.Nil(err)
+	reqrd.Len(vs, 1)
+	reqrd.NotNil(vs[0].Broken)
+	as.Equal(t2.ID, vs[0].Broken.TransferID)
+	as.Contains(vs[0].Broken.Reason, "unknown key")
+
+	// each tenant has a chain of its own
+	tenants, ok := repo.(wallet.Tenants)
+	if !ok {
+		return
+	}
+	_, err = tenants.CreateTenant(ctx, wallet.Tenant{ID: "acme", Name: "Acme"})
+	reqrd.Nil(err)
+	acme := wallet.WithPrincipal(ctx, wallet.Principal{Tenant: wallet.Tenant{ID: "acme"}})
+	for _, req := range fixture[:2] {
+		_, err = repo.CreateAccount(acme, req)
+		reqrd.Nil(err)
+	}
+	a1, err := repo.CreateTransfer(acme, wallet.CreateTransferRequest{From: "alice-123", To: "bob-456", Amount: 10})
+	reqrd.Nil(err)
+	_, err = ledger.ChainLedger(ctx)
+	reqrd.Nil(err)
+	_, err = repo.GetLedgerProof(acme, wallet.LedgerProofRequest{TransferID: t1.ID})
+	as.True(errors.Is(err, wallet.ErrTransferNotFound), "transfer of another tenant: %v", err)
+	proof, err = repo.GetLedgerProof(acme, wallet.LedgerProofRequest{TransferID: a1.ID})
+	reqrd.Nil(err)
+	as.Equal("acme", proof.TenantID)
+	as.Empty(proof.Transfer.PrevHash)
+
+	cps, err = ledger.CheckpointLedger(ctx, signer)
+	reqrd.Nil(err)
+	reqrd.Len(cps, 2)
+	proof, err = repo.GetLedgerProof(acme, wallet.LedgerProofRequest{TransferID: a1.ID})
+	reqrd.Nil(err)
+	as.Nil(proof.Verify(key))
+	vs, err = ledger.VerifyLedger(ctx, []ed25519.PublicKey{key})
+	reqrd.Nil(err)
+	reqrd.Len(vs, 2)
+	for _, v := range vs {
+		as.Nil(v.Broken, "tenant %v", v.TenantID)
+	}
+}